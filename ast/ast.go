@@ -0,0 +1,404 @@
+package ast
+
+import "github.com/sent-hil/bitlang/token"
+
+// Node is implemented by every node of the tree. Span returns the range of
+// source the node was parsed from.
+type Node interface {
+	Span() token.Span
+}
+
+// Expr is implemented by expression nodes. Types are written as expressions
+// too, eg u8 is an *Ident.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Stmt is implemented by statement nodes.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Decl is implemented by nodes that can be declared at top level of a file.
+type Decl interface {
+	Node
+	declNode()
+}
+
+// File is the root of the tree of a single source file.
+type File struct {
+	Loc   token.Span
+	Decls []Decl
+}
+
+// ----------------------------------------------------------------------------
+// Expressions
+
+// Ident is a name, eg of a variable or function.
+type Ident struct {
+	Loc  token.Span
+	Name string
+}
+
+// IsExported returns if given name can be used outside its module, ie if it
+// starts with an upper case letter.
+func IsExported(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// BasicLit is a literal; Kind is one of INTEGER, FLOAT, STRING, TRUE, FALSE
+// or NIL.
+type BasicLit struct {
+	Loc   token.Span
+	Kind  token.TokenID
+	Value string
+}
+
+// ParenExpr is an expression wrapped in parens.
+type ParenExpr struct {
+	Loc token.Span
+	X   Expr
+}
+
+// UnaryExpr is a prefix operator applied to an expression, eg -x or !x.
+type UnaryExpr struct {
+	Loc token.Span
+	Op  token.TokenID
+	X   Expr
+}
+
+// BinaryExpr is an infix operator applied to two expressions, eg x + y or
+// x and y.
+type BinaryExpr struct {
+	Loc token.Span
+	Op  token.TokenID
+	X   Expr
+	Y   Expr
+}
+
+// CallExpr is a call of Fun with given arguments.
+type CallExpr struct {
+	Loc  token.Span
+	Fun  Expr
+	Args []Expr
+}
+
+// SelectorExpr is an access of field Sel of X, eg x.y.
+type SelectorExpr struct {
+	Loc token.Span
+	X   Expr
+	Sel *Ident
+}
+
+// IndexExpr is an access of element Index of X, eg x[i].
+type IndexExpr struct {
+	Loc   token.Span
+	X     Expr
+	Index Expr
+}
+
+// ArrayLit is an array literal, eg [1, 2, 3].
+type ArrayLit struct {
+	Loc   token.Span
+	Elems []Expr
+}
+
+// ArrayType is the type of a fixed size array, eg [4]u8.
+type ArrayType struct {
+	Loc  token.Span
+	Len  Expr
+	Elem Expr
+}
+
+func (*Ident) exprNode()        {}
+func (*BasicLit) exprNode()     {}
+func (*ParenExpr) exprNode()    {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*CallExpr) exprNode()     {}
+func (*SelectorExpr) exprNode() {}
+func (*IndexExpr) exprNode()    {}
+func (*ArrayLit) exprNode()     {}
+func (*ArrayType) exprNode()    {}
+
+// ----------------------------------------------------------------------------
+// Statements
+
+// VarDecl declares a variable with an optional Type and initial Value. It can
+// be declared at top level or in a block.
+type VarDecl struct {
+	Loc   token.Span
+	Name  *Ident
+	Type  Expr
+	Attrs []*Attr
+	Value Expr
+}
+
+// ConstDecl declares a constant with an optional Type. Value is evaluated at
+// compile time. Like VarDecl, it can be at top level or in a block.
+type ConstDecl struct {
+	Loc   token.Span
+	Name  *Ident
+	Type  Expr
+	Value Expr
+}
+
+// AssignStmt assigns Value to Target.
+type AssignStmt struct {
+	Loc    token.Span
+	Target Expr
+	Value  Expr
+}
+
+// ExprStmt is an expression evaluated for its side effects, eg a call.
+type ExprStmt struct {
+	Loc token.Span
+	X   Expr
+}
+
+// BlockStmt is a list of statements in braces.
+type BlockStmt struct {
+	Loc   token.Span
+	Stmts []Stmt
+}
+
+// IfStmt runs Then if Cond is true, else Else. Else is either nil, a
+// *BlockStmt or an *IfStmt.
+type IfStmt struct {
+	Loc  token.Span
+	Cond Expr
+	Then *BlockStmt
+	Else Stmt
+}
+
+// ForStmt is a loop with optional Init, Cond and Post clauses.
+type ForStmt struct {
+	Loc  token.Span
+	Init Stmt
+	Cond Expr
+	Post Stmt
+	Body *BlockStmt
+}
+
+// WhileStmt runs Body as long as Cond is true.
+type WhileStmt struct {
+	Loc  token.Span
+	Cond Expr
+	Body *BlockStmt
+}
+
+// LoopStmt runs Body forever, till a break or return leaves it.
+type LoopStmt struct {
+	Loc  token.Span
+	Body *BlockStmt
+}
+
+// AtomicStmt runs Body with interrupts disabled, restoring them as they were
+// on every way out of it, including returns.
+type AtomicStmt struct {
+	Loc  token.Span
+	Body *BlockStmt
+}
+
+// LabeledStmt is a loop with a label, which break and continue can name to
+// leave or continue an outer loop.
+type LabeledStmt struct {
+	Loc   token.Span
+	Label *Ident
+	Stmt  Stmt
+}
+
+// BranchStmt is a break or continue, with an optional Label of the loop it
+// applies to; without one it applies to the innermost loop.
+type BranchStmt struct {
+	Loc   token.Span
+	Tok   token.TokenID
+	Label *Ident
+}
+
+// ReturnStmt returns from a function with an optional Value.
+type ReturnStmt struct {
+	Loc   token.Span
+	Value Expr
+}
+
+// SwitchStmt runs body of the first case whose value equals Tag.
+type SwitchStmt struct {
+	Loc   token.Span
+	Tag   Expr
+	Cases []*CaseClause
+}
+
+// CaseClause is a case of a switch statement. Values is nil for the default
+// case.
+type CaseClause struct {
+	Loc    token.Span
+	Values []Expr
+	Body   *BlockStmt
+}
+
+// BadStmt is a statement that couldn't be parsed.
+type BadStmt struct {
+	Loc token.Span
+}
+
+func (*VarDecl) stmtNode()     {}
+func (*ConstDecl) stmtNode()   {}
+func (*AssignStmt) stmtNode()  {}
+func (*ExprStmt) stmtNode()    {}
+func (*BlockStmt) stmtNode()   {}
+func (*IfStmt) stmtNode()      {}
+func (*ForStmt) stmtNode()     {}
+func (*WhileStmt) stmtNode()   {}
+func (*LoopStmt) stmtNode()    {}
+func (*LabeledStmt) stmtNode() {}
+func (*BranchStmt) stmtNode()  {}
+func (*ReturnStmt) stmtNode()  {}
+func (*SwitchStmt) stmtNode()  {}
+func (*BadStmt) stmtNode()     {}
+func (*AtomicStmt) stmtNode()  {}
+
+// ----------------------------------------------------------------------------
+// Declarations
+
+// FuncDecl declares a function. Result is nil if function doesn't return a
+// value.
+type FuncDecl struct {
+	Loc    token.Span
+	Name   *Ident
+	Params []*Param
+	Result Expr
+	Attrs  []*Attr
+	Body   *BlockStmt
+}
+
+// Param is a parameter of a function.
+type Param struct {
+	Loc  token.Span
+	Name *Ident
+	Type Expr
+}
+
+// ImportDecl imports module at Path, eg `import "drivers/lcd"`. Its
+// exported names are used qualified with last element of the path, eg
+// lcd.Print. Name is _ for a module imported only for its side effects, like
+// the interrupts it handles, or nil.
+type ImportDecl struct {
+	Loc  token.Span
+	Name *Ident
+	Path *BasicLit
+}
+
+// BadDecl is a declaration that couldn't be parsed.
+type BadDecl struct {
+	Loc token.Span
+}
+
+// StructDecl declares a struct type.
+type StructDecl struct {
+	Loc    token.Span
+	Name   *Ident
+	Attrs  []*Attr
+	Fields []*Field
+}
+
+// Field is a field of a struct.
+type Field struct {
+	Loc   token.Span
+	Name  *Ident
+	Type  Expr
+	Attrs []*Attr
+}
+
+// EnumDecl declares an enum type, whose values are stored as a u8.
+type EnumDecl struct {
+	Loc     token.Span
+	Name    *Ident
+	Members []*EnumMember
+}
+
+// EnumMember is a member of an enum. Value is nil if it's left out, in which
+// case member's value is one more than the member before it, or 0 for the
+// first member.
+type EnumMember struct {
+	Loc   token.Span
+	Name  *Ident
+	Value Expr
+}
+
+// RegDecl declares a memory-mapped I/O register at a data space address,
+// eg `reg PORTB @ 0x25 { PB5: bit 5 }`. Reads and writes of it are
+// volatile.
+type RegDecl struct {
+	Loc  token.Span
+	Name *Ident
+	Addr Expr
+	Bits []*RegBit
+}
+
+// RegBit names a bit of a register, eg `PB5: bit 5`.
+type RegBit struct {
+	Loc  token.Span
+	Name *Ident
+	Bit  Expr
+}
+
+// Attr is an attribute of a declaration, eg packed or align(2).
+type Attr struct {
+	Loc  token.Span
+	Name *Ident
+	Args []Expr
+}
+
+func (*VarDecl) declNode()    {}
+func (*ConstDecl) declNode()  {}
+func (*FuncDecl) declNode()   {}
+func (*StructDecl) declNode() {}
+func (*EnumDecl) declNode()   {}
+func (*RegDecl) declNode()    {}
+func (*ImportDecl) declNode() {}
+func (*BadDecl) declNode()    {}
+
+// ----------------------------------------------------------------------------
+// Spans
+
+func (n *File) Span() token.Span         { return n.Loc }
+func (n *Ident) Span() token.Span        { return n.Loc }
+func (n *BasicLit) Span() token.Span     { return n.Loc }
+func (n *ParenExpr) Span() token.Span    { return n.Loc }
+func (n *UnaryExpr) Span() token.Span    { return n.Loc }
+func (n *BinaryExpr) Span() token.Span   { return n.Loc }
+func (n *CallExpr) Span() token.Span     { return n.Loc }
+func (n *SelectorExpr) Span() token.Span { return n.Loc }
+func (n *IndexExpr) Span() token.Span    { return n.Loc }
+func (n *ArrayLit) Span() token.Span     { return n.Loc }
+func (n *ArrayType) Span() token.Span    { return n.Loc }
+func (n *VarDecl) Span() token.Span      { return n.Loc }
+func (n *ConstDecl) Span() token.Span    { return n.Loc }
+func (n *AssignStmt) Span() token.Span   { return n.Loc }
+func (n *ExprStmt) Span() token.Span     { return n.Loc }
+func (n *BlockStmt) Span() token.Span    { return n.Loc }
+func (n *IfStmt) Span() token.Span       { return n.Loc }
+func (n *ForStmt) Span() token.Span      { return n.Loc }
+func (n *WhileStmt) Span() token.Span    { return n.Loc }
+func (n *LoopStmt) Span() token.Span     { return n.Loc }
+func (n *LabeledStmt) Span() token.Span  { return n.Loc }
+func (n *BranchStmt) Span() token.Span   { return n.Loc }
+func (n *ReturnStmt) Span() token.Span   { return n.Loc }
+func (n *BadStmt) Span() token.Span      { return n.Loc }
+func (n *AtomicStmt) Span() token.Span   { return n.Loc }
+func (n *SwitchStmt) Span() token.Span   { return n.Loc }
+func (n *CaseClause) Span() token.Span   { return n.Loc }
+func (n *FuncDecl) Span() token.Span     { return n.Loc }
+func (n *Param) Span() token.Span        { return n.Loc }
+func (n *StructDecl) Span() token.Span   { return n.Loc }
+func (n *Field) Span() token.Span        { return n.Loc }
+func (n *EnumDecl) Span() token.Span     { return n.Loc }
+func (n *EnumMember) Span() token.Span   { return n.Loc }
+func (n *RegDecl) Span() token.Span      { return n.Loc }
+func (n *RegBit) Span() token.Span       { return n.Loc }
+func (n *ImportDecl) Span() token.Span   { return n.Loc }
+func (n *Attr) Span() token.Span         { return n.Loc }
+func (n *BadDecl) Span() token.Span      { return n.Loc }
@@ -0,0 +1,206 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+var (
+	spanType    = reflect.TypeOf(token.Span{})
+	tokenIDType = reflect.TypeOf(token.TokenID(0))
+	nodeType    = reflect.TypeOf((*Node)(nil)).Elem()
+)
+
+// Dump returns tree of given node as indented text, one node per line with
+// names of the fields holding them, eg for `blink(13)`:
+//
+//	CallExpr
+//	  Fun: Ident "blink"
+//	  Args:
+//	    - BasicLit INTEGER "13"
+//
+// Strings and tokens of a node are on its line; nil fields and empty lists
+// are left out. It's meant for golden files, so any node type is dumped
+// without having to be taught about it.
+func Dump(node Node) string {
+	d := &dumper{}
+	d.node(reflect.ValueOf(node), "")
+	return d.String()
+}
+
+// DumpSpans is like Dump, but also writes span of each node.
+func DumpSpans(node Node) string {
+	d := &dumper{spans: true}
+	d.node(reflect.ValueOf(node), "")
+	return d.String()
+}
+
+type dumper struct {
+	strings.Builder
+	spans bool
+}
+
+// node writes header line of node, whose prefix is already written, and its
+// children indented under it.
+func (d *dumper) node(v reflect.Value, indent string) {
+	if isNil(v) {
+		d.WriteString("nil\n")
+		return
+	}
+
+	v = elem(v)
+	d.WriteString(v.Type().Name())
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); isScalar(f.Type()) {
+			d.WriteString(" " + scalar(f))
+		}
+	}
+	if d.spans {
+		if span := v.FieldByName("Loc"); span.IsValid() {
+			fmt.Fprintf(d, " @%s", span.Interface().(token.Span).Start)
+		}
+	}
+	d.WriteString("\n")
+
+	for i := 0; i < v.NumField(); i++ {
+		f, name := v.Field(i), v.Type().Field(i).Name
+		if isScalar(f.Type()) || f.Type() == spanType || isNil(f) {
+			continue
+		}
+
+		if f.Kind() == reflect.Slice {
+			if f.Len() == 0 {
+				continue
+			}
+			fmt.Fprintf(d, "%s  %s:\n", indent, name)
+			for j := 0; j < f.Len(); j++ {
+				d.WriteString(indent + "    - ")
+				d.node(f.Index(j), indent+"      ")
+			}
+			continue
+		}
+
+		fmt.Fprintf(d, "%s  %s: ", indent, name)
+		d.node(f, indent+"  ")
+	}
+}
+
+// DumpSExpr returns tree of given node as a single S-expression, which
+// ReadSExpr reads back. Each node is a list of its type and fields in
+// declared order without spans, eg `(BinaryExpr PLUS (Ident "a") nil)`;
+// lists of nodes are in brackets.
+func DumpSExpr(node Node) string {
+	var b strings.Builder
+	sexpr(&b, reflect.ValueOf(node))
+	return b.String()
+}
+
+func sexpr(b *strings.Builder, v reflect.Value) {
+	switch {
+	case !v.IsValid():
+		b.WriteString("nil")
+	case isScalar(v.Type()):
+		b.WriteString(scalar(v))
+	case v.Kind() == reflect.Slice:
+		b.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			sexpr(b, v.Index(i))
+		}
+		b.WriteString("]")
+	case isNil(v):
+		b.WriteString("nil")
+	default:
+		v = elem(v)
+		b.WriteString("(" + v.Type().Name())
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() != spanType {
+				b.WriteString(" ")
+				sexpr(b, f)
+			}
+		}
+		b.WriteString(")")
+	}
+}
+
+// Equal returns if given trees have the same shape and values, ignoring
+// spans. It's used to compare parsed trees with ones read by ReadSExpr.
+func Equal(a, b Node) bool {
+	return equal(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func equal(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equal(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equal(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if a.Type() == spanType {
+			return true
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !equal(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a.Interface() == b.Interface()
+}
+
+func isScalar(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t == tokenIDType
+}
+
+func scalar(v reflect.Value) string {
+	if v.Type() == tokenIDType {
+		return token.TokenIDString[token.TokenID(v.Int())]
+	}
+
+	return strconv.Quote(v.String())
+}
+
+// elem returns struct of given node, which is a pointer to it, possibly in an
+// interface.
+func elem(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	return v.Elem()
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Slice:
+		return v.IsNil()
+	}
+
+	return !v.IsValid()
+}
@@ -0,0 +1,104 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/token"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func pos(line, column int) token.Span {
+	p := token.Pos{Line: line, Column: column}
+	return token.Span{Start: p, End: p}
+}
+
+// blink is `blink(13)`.
+func blink() *CallExpr {
+	return &CallExpr{
+		Loc:  pos(1, 1),
+		Fun:  &Ident{Loc: pos(1, 1), Name: "blink"},
+		Args: []Expr{&BasicLit{Loc: pos(1, 7), Kind: token.INTEGER, Value: "13"}},
+	}
+}
+
+func TestDump(t *testing.T) {
+	Convey("Dump", t, func() {
+		Convey("It dumps nodes as indented text", func() {
+			stmt := &IfStmt{
+				Cond: &Ident{Name: "on"},
+				Then: &BlockStmt{Stmts: []Stmt{&ExprStmt{X: blink()}}},
+			}
+			So(Dump(stmt), ShouldEqual, `IfStmt
+  Cond: Ident "on"
+  Then: BlockStmt
+    Stmts:
+      - ExprStmt
+          X: CallExpr
+            Fun: Ident "blink"
+            Args:
+              - BasicLit INTEGER "13"
+`)
+		})
+
+		Convey("It dumps spans of nodes", func() {
+			So(DumpSpans(blink()), ShouldEqual, `CallExpr @1:1
+  Fun: Ident "blink" @1:1
+  Args:
+    - BasicLit INTEGER "13" @1:7
+`)
+		})
+
+		Convey("It dumps nodes as S-expressions", func() {
+			So(DumpSExpr(blink()), ShouldEqual, `(CallExpr (Ident "blink") [(BasicLit INTEGER "13")])`)
+			So(DumpSExpr(&ReturnStmt{}), ShouldEqual, `(ReturnStmt nil)`)
+			So(DumpSExpr(nil), ShouldEqual, `nil`)
+		})
+	})
+
+	Convey("ReadSExpr", t, func() {
+		Convey("It reads what DumpSExpr writes", func() {
+			node, err := ReadSExpr(DumpSExpr(blink()))
+			So(err, ShouldBeNil)
+			So(Equal(node, blink()), ShouldBeTrue)
+
+			node, err = ReadSExpr(`
+(BinaryExpr PLUS
+  (Ident "a")
+  (UnaryExpr MINUS (BasicLit INTEGER "1")))`)
+			So(err, ShouldBeNil)
+			So(SExpr(node.(Expr)), ShouldEqual, "(+ a (- 1))")
+		})
+
+		Convey("It reads strings with escapes", func() {
+			node, err := ReadSExpr(`(BasicLit STRING "a \"b\"\n")`)
+			So(err, ShouldBeNil)
+			So(node.(*BasicLit).Value, ShouldEqual, "a \"b\"\n")
+		})
+
+		Convey("It reports malformed trees", func() {
+			for src, message := range map[string]string{
+				`(Ident "a"`:                "offset 10: expected ')'",
+				`(Widget)`:                  "offset 7: unknown node Widget",
+				`(UnaryExpr NOPE nil)`:      "offset 15: unknown token NOPE",
+				`(ExprStmt (ExprStmt nil))`: "offset 19: ExprStmt where Expr is expected",
+				`(Ident "a") x`:             `offset 12: unexpected "x" after tree`,
+				`(Ident a)`:                 "offset 7: expected string",
+			} {
+				_, err := ReadSExpr(src)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, message)
+			}
+		})
+	})
+
+	Convey("Equal", t, func() {
+		Convey("It ignores spans", func() {
+			a, b := blink(), blink()
+			b.Args[0].(*BasicLit).Loc = pos(2, 1)
+			So(Equal(a, b), ShouldBeTrue)
+
+			b.Args[0].(*BasicLit).Value = "12"
+			So(Equal(a, b), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// ExprString returns given expression as it'd be written in source, eg for
+// messages. Parentheses are only where the source has them.
+func ExprString(x Expr) string {
+	switch x := x.(type) {
+	case *Ident:
+		return x.Name
+	case *BasicLit:
+		if x.Kind == token.STRING {
+			return fmt.Sprintf("%q", x.Value)
+		}
+		return x.Value
+	case *ParenExpr:
+		return "(" + ExprString(x.X) + ")"
+	case *UnaryExpr:
+		return OpNames[x.Op] + ExprString(x.X)
+	case *BinaryExpr:
+		return ExprString(x.X) + " " + OpNames[x.Op] + " " + ExprString(x.Y)
+	case *CallExpr:
+		return ExprString(x.Fun) + "(" + exprList(x.Args) + ")"
+	case *IndexExpr:
+		return ExprString(x.X) + "[" + ExprString(x.Index) + "]"
+	case *SelectorExpr:
+		return ExprString(x.X) + "." + x.Sel.Name
+	case *ArrayLit:
+		return "[" + exprList(x.Elems) + "]"
+	case *ArrayType:
+		return "[" + ExprString(x.Len) + "]" + ExprString(x.Elem)
+	}
+
+	return fmt.Sprintf("<%T>", x)
+}
+
+func exprList(xs []Expr) string {
+	parts := make([]string, len(xs))
+	for i, x := range xs {
+		parts[i] = ExprString(x)
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,23 @@
+package ast
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExprString(t *testing.T) {
+	Convey("ExprString", t, func() {
+		Convey("It writes expressions like source", func() {
+			for src, want := range map[string]string{
+				`(BinaryExpr PLUS (Ident "a") (ParenExpr (BinaryExpr STAR (Ident "b") (Ident "c"))))`: "a + (b * c)",
+				`(UnaryExpr BANG (CallExpr (Ident "ready") [(BasicLit INTEGER "1") (Ident "x")]))`:    "!ready(1, x)",
+				`(IndexExpr (SelectorExpr (Ident "p") (Ident "data")) (BasicLit INTEGER "0"))`:        "p.data[0]",
+				`(BinaryExpr AND (Ident "a") (ArrayLit [(BasicLit STRING "s")]))`:                     `a and ["s"]`,
+				`(ArrayType (BasicLit INTEGER "4") (Ident "u8"))`:                                     "[4]u8",
+			} {
+				So(ExprString(read(src).(Expr)), ShouldEqual, want)
+			}
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// nodeTypes are struct types of nodes keyed by name, for ReadSExpr.
+var nodeTypes = map[string]reflect.Type{}
+
+// tokenIDs are tokens keyed by name, for ReadSExpr.
+var tokenIDs = map[string]token.TokenID{}
+
+func init() {
+	for _, node := range []Node{
+		&File{},
+		&Ident{}, &BasicLit{}, &ParenExpr{}, &UnaryExpr{}, &BinaryExpr{}, &CallExpr{},
+		&SelectorExpr{}, &IndexExpr{}, &ArrayLit{}, &ArrayType{},
+		&VarDecl{}, &ConstDecl{}, &AssignStmt{}, &ExprStmt{}, &BlockStmt{}, &IfStmt{}, &ForStmt{},
+		&WhileStmt{}, &LoopStmt{}, &LabeledStmt{}, &BranchStmt{}, &ReturnStmt{},
+		&SwitchStmt{}, &CaseClause{}, &BadStmt{}, &AtomicStmt{},
+		&FuncDecl{}, &Param{}, &ImportDecl{}, &BadDecl{}, &StructDecl{}, &Field{},
+		&EnumDecl{}, &EnumMember{}, &RegDecl{}, &RegBit{}, &Attr{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodeTypes[t.Name()] = t
+	}
+
+	for id, name := range token.TokenIDString {
+		tokenIDs[name] = id
+	}
+}
+
+// ReadSExpr reads a tree written by DumpSExpr. Nodes of the tree have no
+// spans, so it's compared with parsed trees with Equal.
+func ReadSExpr(src string) (node Node, err error) {
+	r := &reader{src: src}
+	defer func() {
+		if e := recover(); e != nil {
+			readErr, ok := e.(readError)
+			if !ok {
+				panic(e)
+			}
+			node, err = nil, readErr
+		}
+	}()
+
+	v := r.value(nodeType)
+	if r.skipSpace(); r.offset < len(r.src) {
+		r.errorf("unexpected %q after tree", r.src[r.offset:])
+	}
+	if v.IsNil() {
+		return nil, nil
+	}
+
+	return v.Interface().(Node), nil
+}
+
+type readError struct {
+	offset  int
+	message string
+}
+
+func (e readError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.offset, e.message)
+}
+
+type reader struct {
+	src    string
+	offset int
+}
+
+// value reads a value of given type.
+func (r *reader) value(t reflect.Type) reflect.Value {
+	r.skipSpace()
+
+	switch {
+	case t == tokenIDType:
+		name := r.atom()
+		id, ok := tokenIDs[name]
+		if !ok {
+			r.errorf("unknown token %s", name)
+		}
+		return reflect.ValueOf(id)
+	case t.Kind() == reflect.String:
+		quoted, err := strconv.QuotedPrefix(r.src[r.offset:])
+		if err != nil {
+			r.errorf("expected string")
+		}
+		r.offset += len(quoted)
+		s, _ := strconv.Unquote(quoted)
+		return reflect.ValueOf(s)
+	case t.Kind() == reflect.Slice:
+		r.expect('[')
+		slice := reflect.Zero(t)
+		for r.skipSpace(); !r.match(']'); r.skipSpace() {
+			slice = reflect.Append(slice, r.value(t.Elem()))
+		}
+		return slice
+	}
+
+	if strings.HasPrefix(r.src[r.offset:], "nil") {
+		r.offset += len("nil")
+		return reflect.Zero(t)
+	}
+
+	r.expect('(')
+	name := r.atom()
+	nt, ok := nodeTypes[name]
+	if !ok {
+		r.errorf("unknown node %s", name)
+	}
+
+	node := reflect.New(nt)
+	if !node.Type().AssignableTo(t) {
+		r.errorf("%s where %s is expected", name, strings.TrimPrefix(t.String(), "ast."))
+	}
+
+	for i := 0; i < nt.NumField(); i++ {
+		if f := node.Elem().Field(i); f.Type() != spanType {
+			f.Set(r.value(f.Type()))
+		}
+	}
+	r.skipSpace()
+	r.expect(')')
+
+	v := reflect.New(t).Elem()
+	v.Set(node)
+	return v
+}
+
+func (r *reader) atom() string {
+	start := r.offset
+	for r.offset < len(r.src) {
+		c := rune(r.src[r.offset])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			break
+		}
+		r.offset++
+	}
+
+	if start == r.offset {
+		r.errorf("expected name")
+	}
+	return r.src[start:r.offset]
+}
+
+func (r *reader) skipSpace() {
+	for r.offset < len(r.src) && unicode.IsSpace(rune(r.src[r.offset])) {
+		r.offset++
+	}
+}
+
+func (r *reader) match(c byte) bool {
+	if r.offset < len(r.src) && r.src[r.offset] == c {
+		r.offset++
+		return true
+	}
+
+	return false
+}
+
+func (r *reader) expect(c byte) {
+	if !r.match(c) {
+		r.errorf("expected %q", c)
+	}
+}
+
+func (r *reader) errorf(format string, args ...interface{}) {
+	panic(readError{r.offset, fmt.Sprintf(format, args...)})
+}
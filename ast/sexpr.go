@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// OpNames are how operators are written in source.
+var OpNames = map[token.TokenID]string{
+	token.PLUS:            "+",
+	token.MINUS:           "-",
+	token.STAR:            "*",
+	token.SLASH:           "/",
+	token.PERCENT:         "%",
+	token.AMPERSAND:       "&",
+	token.PIPE:            "|",
+	token.CARET:           "^",
+	token.TILDE:           "~",
+	token.LESS_LESS:       "<<",
+	token.GREATER_GREATER: ">>",
+	token.BANG:            "!",
+	token.EQUAL_EQUAL:     "==",
+	token.BANG_EQUAL:      "!=",
+	token.LESS:            "<",
+	token.LESS_EQUAL:      "<=",
+	token.GREATER:         ">",
+	token.GREATER_EQUAL:   ">=",
+	token.AND:             "and",
+	token.OR:              "or",
+}
+
+// SExpr returns given expression as an S-expression, eg `a + b * c` is
+// `(+ a (* b c))`. It's used to check shape of parsed expressions.
+func SExpr(x Expr) string {
+	switch x := x.(type) {
+	case *Ident:
+		return x.Name
+	case *BasicLit:
+		if x.Kind == token.STRING {
+			return fmt.Sprintf("%q", x.Value)
+		}
+		return x.Value
+	case *ParenExpr:
+		return list("paren", x.X)
+	case *UnaryExpr:
+		return list(OpNames[x.Op], x.X)
+	case *BinaryExpr:
+		return list(OpNames[x.Op], x.X, x.Y)
+	case *CallExpr:
+		return list("call", append([]Expr{x.Fun}, x.Args...)...)
+	case *IndexExpr:
+		return list("index", x.X, x.Index)
+	case *SelectorExpr:
+		return list(".", x.X, x.Sel)
+	case *ArrayLit:
+		return list("array", x.Elems...)
+	case *ArrayType:
+		return list("[]", x.Len, x.Elem)
+	}
+
+	return fmt.Sprintf("(unknown %T)", x)
+}
+
+func list(head string, xs ...Expr) string {
+	parts := []string{head}
+	for _, x := range xs {
+		parts = append(parts, SExpr(x))
+	}
+
+	return "(" + strings.Join(parts, " ") + ")"
+}
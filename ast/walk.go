@@ -0,0 +1,144 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Visitor's Visit is called for each node Walk visits. If it returns a
+// non-nil visitor w, Walk visits children of node with w, then calls
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk visits tree of given node depth first, children in the order of the
+// fields holding them. Children are found with reflection, so any node a
+// field or list holds is visited without Walk having to be taught about it.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	children(node, func(child reflect.Value) {
+		Walk(v, child.Interface().(Node))
+	})
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect visits tree of given node depth first, calling f for each node;
+// children of a node are only visited if f returns true for it. After the
+// children f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Parents returns parent of each node in tree of given node; the root has
+// none.
+func Parents(root Node) map[Node]Node {
+	parents := map[Node]Node{}
+
+	var stack []Node
+	Inspect(root, func(n Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+
+		if len(stack) > 0 {
+			parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+
+	return parents
+}
+
+// Cursor is a node being rewritten by Rewrite.
+type Cursor struct {
+	node   Node
+	parent Node
+
+	// field holds the node in its parent; it's not valid for the root.
+	field reflect.Value
+}
+
+// Node returns the node, or what it was replaced with.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns parent of the node, or nil for the root.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Replace replaces the node in its parent. If the new node has no span it
+// gets span of the node it replaces. It panics if the parent can't hold the
+// new node, eg if a statement replaces an expression.
+func (c *Cursor) Replace(node Node) {
+	if loc := reflect.ValueOf(node).Elem().FieldByName("Loc"); loc.IsValid() &&
+		!loc.Interface().(token.Span).IsValid() {
+		loc.Set(reflect.ValueOf(c.node.Span()))
+	}
+
+	if c.field.IsValid() {
+		if !reflect.TypeOf(node).AssignableTo(c.field.Type()) {
+			panic(fmt.Sprintf("ast: cannot replace %T with %T in %T", c.node, node, c.parent))
+		}
+		c.field.Set(reflect.ValueOf(node))
+	}
+
+	c.node = node
+}
+
+// Rewrite calls f for each node in tree of given node, children before their
+// parent, and returns the root, which f may have replaced.
+func Rewrite(root Node, f func(c *Cursor)) Node {
+	c := &Cursor{node: root}
+	rewrite(c, f)
+	return c.node
+}
+
+func rewrite(c *Cursor, f func(c *Cursor)) {
+	children(c.node, func(child reflect.Value) {
+		rewrite(&Cursor{node: child.Interface().(Node), parent: c.node, field: child}, f)
+	})
+	f(c)
+}
+
+// children calls f with each field of node that holds a child, and each
+// element of fields that hold lists of them, skipping nil ones. They're
+// settable, to replace the child.
+func children(node Node, f func(reflect.Value)) {
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case isNodeType(field.Type()):
+			if !field.IsNil() {
+				f(field)
+			}
+		case field.Kind() == reflect.Slice && isNodeType(field.Type().Elem()):
+			for j := 0; j < field.Len(); j++ {
+				if elem := field.Index(j); !elem.IsNil() {
+					f(elem)
+				}
+			}
+		}
+	}
+}
+
+// isNodeType returns if given type is a node, or an interface only nodes
+// implement, eg Expr.
+func isNodeType(t reflect.Type) bool {
+	return (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) && t.Implements(nodeType)
+}
@@ -0,0 +1,140 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/sent-hil/bitlang/token"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// read reads given S-expression, failing the test if it's malformed.
+func read(src string) Node {
+	node, err := ReadSExpr(src)
+	So(err, ShouldBeNil)
+	return node
+}
+
+// names returns names of nodes in tree in order Inspect visits them.
+func names(root Node) (names []string) {
+	Inspect(root, func(n Node) bool {
+		switch n := n.(type) {
+		case *Ident:
+			names = append(names, n.Name)
+		case *BasicLit:
+			names = append(names, n.Value)
+		case nil:
+		default:
+			names = append(names, reflect.TypeOf(n).Elem().Name())
+		}
+		return true
+	})
+	return names
+}
+
+func TestWalk(t *testing.T) {
+	Convey("Inspect", t, func() {
+		Convey("It visits children in order of fields", func() {
+			stmt := read(`(ForStmt
+  (VarDecl (Ident "i") nil [] (BasicLit INTEGER "0"))
+  (BinaryExpr LESS (Ident "i") (BasicLit INTEGER "8"))
+  nil
+  (BlockStmt [(BranchStmt BREAK (Ident "outer"))]))`)
+			So(names(stmt), ShouldResemble, []string{
+				"ForStmt", "VarDecl", "i", "0", "BinaryExpr", "i", "8",
+				"BlockStmt", "BranchStmt", "outer",
+			})
+		})
+
+		Convey("It skips children when told to", func() {
+			var visited []string
+			Inspect(blink(), func(n Node) bool {
+				if n != nil {
+					visited = append(visited, fmt.Sprintf("%T", n))
+				}
+				_, isCall := n.(*CallExpr)
+				return !isCall
+			})
+			So(visited, ShouldResemble, []string{"*ast.CallExpr"})
+		})
+
+		Convey("It knows how to walk every field of every node", func() {
+			for name, t := range nodeTypes {
+				for i := 0; i < t.NumField(); i++ {
+					f := t.Field(i)
+					known := isScalar(f.Type) || f.Type == spanType || isNodeType(f.Type) ||
+						(f.Type.Kind() == reflect.Slice && isNodeType(f.Type.Elem()))
+					So(fmt.Sprintf("%s.%s: %v", name, f.Name, known), ShouldEndWith, "true")
+				}
+			}
+		})
+	})
+
+	Convey("Parents", t, func() {
+		Convey("It links nodes to their parents", func() {
+			call := blink()
+			parents := Parents(call)
+			So(parents[call.Fun], ShouldEqual, call)
+			So(parents[call.Args[0]], ShouldEqual, call)
+			So(parents, ShouldNotContainKey, call)
+		})
+	})
+
+	Convey("Rewrite", t, func() {
+		// fold replaces additions of two integer literals with their sum
+		fold := func(c *Cursor) {
+			b, ok := c.Node().(*BinaryExpr)
+			if !ok || b.Op != token.PLUS {
+				return
+			}
+			x, xok := b.X.(*BasicLit)
+			y, yok := b.Y.(*BasicLit)
+			if xok && yok {
+				var n, m int
+				fmt.Sscan(x.Value, &n)
+				fmt.Sscan(y.Value, &m)
+				c.Replace(&BasicLit{Kind: token.INTEGER, Value: fmt.Sprint(n + m)})
+			}
+		}
+
+		Convey("It replaces nodes bottom up", func() {
+			root := read(`(ExprStmt (CallExpr (Ident "delay") [
+  (BinaryExpr PLUS (BinaryExpr PLUS (BasicLit INTEGER "1") (BasicLit INTEGER "2"))
+    (BasicLit INTEGER "3"))]))`)
+
+			root = Rewrite(root, fold)
+			So(DumpSExpr(root), ShouldEqual,
+				`(ExprStmt (CallExpr (Ident "delay") [(BasicLit INTEGER "6")]))`)
+		})
+
+		Convey("It keeps span of replaced node", func() {
+			sum := &BinaryExpr{
+				Loc: pos(2, 5),
+				Op:  token.PLUS,
+				X:   &BasicLit{Kind: token.INTEGER, Value: "1"},
+				Y:   &BasicLit{Kind: token.INTEGER, Value: "2"},
+			}
+			root := Rewrite(sum, fold)
+			So(root.Span(), ShouldResemble, pos(2, 5))
+		})
+
+		Convey("It gives parents of nodes", func() {
+			call := blink()
+			var parents []Node
+			Rewrite(call, func(c *Cursor) { parents = append(parents, c.Parent()) })
+			So(parents, ShouldResemble, []Node{call, call, nil})
+		})
+
+		Convey("It panics on replacements parent can't hold", func() {
+			call := blink()
+			So(func() {
+				Rewrite(call, func(c *Cursor) {
+					if _, ok := c.Node().(*Ident); ok {
+						c.Replace(&BadStmt{})
+					}
+				})
+			}, ShouldPanicWith, "ast: cannot replace *ast.Ident with *ast.BadStmt in *ast.CallExpr")
+		})
+	})
+}
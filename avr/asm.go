@@ -0,0 +1,41 @@
+package avr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Asm collects assembly in avr-as syntax.
+type Asm struct {
+	lines []string
+}
+
+// Emit appends an instruction, eg Emit("cpi", "r24", "3").
+func (a *Asm) Emit(op string, args ...string) {
+	line := "\t" + op
+	if len(args) > 0 {
+		line += "\t" + strings.Join(args, ", ")
+	}
+	a.lines = append(a.lines, line)
+}
+
+// Label appends a label.
+func (a *Asm) Label(name string) {
+	a.lines = append(a.lines, name+":")
+}
+
+// String returns the assembly, one line per instruction or label.
+func (a *Asm) String() string {
+	return strings.Join(a.lines, "\n") + "\n"
+}
+
+// Imm formats an immediate operand.
+func Imm(n int) string {
+	return strconv.Itoa(n)
+}
+
+// Hex formats an address or mask operand in hex, eg 0x05.
+func Hex(n int64) string {
+	return fmt.Sprintf("0x%02x", n)
+}
@@ -0,0 +1,24 @@
+package avr
+
+// Atomic blocks save SREG, which holds the global interrupt flag, and disable
+// interrupts with CLI; leaving one restores SREG, so interrupts are only
+// enabled again if they were before. SREG is saved on the stack, so nested
+// blocks, and returns and branches leaving several of them, pop their saves
+// in order.
+
+// LowerAtomicBegin emits the start of an atomic block. It clobbers r0.
+func LowerAtomicBegin(a *Asm) {
+	a.Emit("in", "r0", Hex(sregAddr))
+	a.Emit("cli")
+	a.Emit("push", "r0")
+}
+
+// LowerAtomicEnd emits leaving n nested atomic blocks: 1 at the end of a
+// block, or as many as a return or branch leaves. SREG is restored as it was
+// before the outermost of them. It clobbers r0.
+func LowerAtomicEnd(a *Asm, n int) {
+	for i := 0; i < n; i++ {
+		a.Emit("pop", "r0")
+	}
+	a.Emit("out", Hex(sregAddr), "r0")
+}
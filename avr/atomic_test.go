@@ -0,0 +1,29 @@
+package avr
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAtomic(t *testing.T) {
+	Convey("Atomic", t, func() {
+		Convey("It saves SREG and disables interrupts", func() {
+			a := &Asm{}
+			LowerAtomicBegin(a)
+			LowerAtomicEnd(a, 1)
+			So(a.String(), ShouldEqual, `	in	r0, 0x3f
+	cli
+	push	r0
+	pop	r0
+	out	0x3f, r0
+`)
+		})
+
+		Convey("It restores SREG of the outermost block it leaves", func() {
+			a := &Asm{}
+			LowerAtomicEnd(a, 2)
+			So(a.String(), ShouldEqual, "\tpop\tr0\n\tpop\tr0\n\tout\t0x3f, r0\n")
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package avr
+
+import "fmt"
+
+// Fixed-point values are integers counting in 1/2^frac, so they're added,
+// subtracted and compared as integers of their size, and converted by
+// shifting. Products and quotients need rescaling: a*b has 2*frac fraction
+// bits, so it's shifted right by frac, and a/b has none, so a is shifted left
+// by frac first. Both are done at twice the width so nothing overflows in
+// between.
+//
+// Operands and results are where avr-gcc passes them: a in r25:r24 (r24 for
+// 8-bit values), b in r23:r22 (r22), and the result in r25:r24 (r24).
+
+// FixedMulDiv returns if LowerFixedMul and LowerFixedDiv take fixed-point
+// values of given size in bytes. Sema rejects products and quotients of
+// other sizes, since 4-byte ones would need 64-bit intermediates.
+func FixedMulDiv(size int) bool {
+	return size == 1 || size == 2
+}
+
+// LowerFixedMul emits a signed multiply of fixed-point values of given size
+// in bytes, 1 or 2, with frac fraction bits. The product is truncated towards
+// minus infinity. It clobbers r18-r23, r26, r27, r30, r31 and r0, and clears
+// r1.
+func LowerFixedMul(a *Asm, size, frac int) {
+	switch size {
+	case 1:
+		// MULS only takes r16-r23
+		a.Emit("mov", "r20", "r24")
+		a.Emit("muls", "r20", "r22")
+		a.Emit("movw", "r26", "r0")
+		shiftProduct(a, []string{"r26", "r27"}, frac)
+		a.Emit("mov", "r24", productByte([]string{"r26", "r27"}, frac, 0))
+	case 2:
+		// 16x16 to 32-bit signed multiply, as in Atmel's AVR201, with the
+		// product in p3:p2:p1:p0 = r31:r30:r27:r26 and r19 kept zero
+		p := []string{"r26", "r27", "r30", "r31"}
+		a.Emit("movw", "r20", "r24")
+		a.Emit("clr", "r19")
+		a.Emit("muls", "r21", "r23")
+		a.Emit("movw", "r30", "r0")
+		a.Emit("mul", "r20", "r22")
+		a.Emit("movw", "r26", "r0")
+		for _, pair := range [][2]string{{"r21", "r22"}, {"r23", "r20"}} {
+			// signed high byte of one times unsigned low byte of other,
+			// added at p1
+			a.Emit("mulsu", pair[0], pair[1])
+			a.Emit("sbc", "r31", "r19")
+			a.Emit("add", "r27", "r0")
+			a.Emit("adc", "r30", "r1")
+			a.Emit("adc", "r31", "r19")
+		}
+		shiftProduct(a, p, frac)
+		a.Emit("mov", "r24", productByte(p, frac, 0))
+		a.Emit("mov", "r25", productByte(p, frac, 1))
+	default:
+		panic(fmt.Sprintf("avr: no fixed-point multiply of %d bytes", size))
+	}
+
+	a.Emit("clr", "r1")
+}
+
+// shiftProduct shifts product bytes p, lowest first, right by frac%8 bits;
+// whole bytes are skipped by productByte.
+func shiftProduct(a *Asm, p []string, frac int) {
+	for i := 0; i < frac%8; i++ {
+		a.Emit("asr", p[len(p)-1])
+		for j := len(p) - 2; j >= 0; j-- {
+			a.Emit("ror", p[j])
+		}
+	}
+}
+
+// productByte returns register with byte i of the product shifted right by
+// frac bits.
+func productByte(p []string, frac, i int) string {
+	return p[frac/8+i]
+}
+
+// LowerFixedDiv emits a signed divide of fixed-point values of given size in
+// bytes, 1 or 2, with frac fraction bits, by dividing a<<frac by b as 32-bit
+// integers with libgcc's __divmodsi4. The quotient is truncated towards
+// zero. It clobbers what __divmodsi4 does.
+func LowerFixedDiv(a *Asm, size, frac int) {
+	switch size {
+	case 1:
+		// divided as 16-bit values
+		signExtend(a, "r24", "r25")
+		signExtend(a, "r22", "r23")
+	case 2:
+	default:
+		panic(fmt.Sprintf("avr: no fixed-point divide of %d bytes", size))
+	}
+
+	// divisor b, sign extended, in r21:r18
+	a.Emit("movw", "r18", "r22")
+	signExtend(a, "r19", "r20", "r21")
+
+	// dividend a<<frac, sign extended, in r25:r22
+	a.Emit("movw", "r22", "r24")
+	signExtend(a, "r23", "r24", "r25")
+	dividend := []string{"r22", "r23", "r24", "r25"}
+	for i := 0; i < frac/8; i++ {
+		a.Emit("mov", "r25", "r24")
+		a.Emit("mov", "r24", "r23")
+		a.Emit("mov", "r23", "r22")
+		a.Emit("clr", "r22")
+	}
+	for i := 0; i < frac%8; i++ {
+		a.Emit("lsl", dividend[0])
+		for _, r := range dividend[1:] {
+			a.Emit("rol", r)
+		}
+	}
+
+	// quotient is in r21:r18
+	a.Emit("call", "__divmodsi4")
+	a.Emit("movw", "r24", "r18")
+}
+
+// signExtend fills registers to with the sign of register from.
+func signExtend(a *Asm, from string, to ...string) {
+	a.Emit("clr", to[0])
+	a.Emit("sbrc", from, "7")
+	a.Emit("com", to[0])
+	for _, r := range to[1:] {
+		a.Emit("mov", r, to[0])
+	}
+}
@@ -0,0 +1,97 @@
+package avr
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFixed(t *testing.T) {
+	Convey("Fixed", t, func() {
+		Convey("It multiplies q8.8 by taking middle bytes of the product", func() {
+			a := &Asm{}
+			LowerFixedMul(a, 2, 8)
+			So(a.String(), ShouldEqual, `	movw	r20, r24
+	clr	r19
+	muls	r21, r23
+	movw	r30, r0
+	mul	r20, r22
+	movw	r26, r0
+	mulsu	r21, r22
+	sbc	r31, r19
+	add	r27, r0
+	adc	r30, r1
+	adc	r31, r19
+	mulsu	r23, r20
+	sbc	r31, r19
+	add	r27, r0
+	adc	r30, r1
+	adc	r31, r19
+	mov	r24, r27
+	mov	r25, r30
+	clr	r1
+`)
+		})
+
+		Convey("It shifts products of other formats", func() {
+			a := &Asm{}
+			LowerFixedMul(a, 1, 4)
+			So(a.String(), ShouldEqual, `	mov	r20, r24
+	muls	r20, r22
+	movw	r26, r0
+	asr	r27
+	ror	r26
+	asr	r27
+	ror	r26
+	asr	r27
+	ror	r26
+	asr	r27
+	ror	r26
+	mov	r24, r26
+	clr	r1
+`)
+		})
+
+		Convey("It divides q8.8 as 32-bit integers", func() {
+			a := &Asm{}
+			LowerFixedDiv(a, 2, 8)
+			So(a.String(), ShouldEqual, `	movw	r18, r22
+	clr	r20
+	sbrc	r19, 7
+	com	r20
+	mov	r21, r20
+	movw	r22, r24
+	clr	r24
+	sbrc	r23, 7
+	com	r24
+	mov	r25, r24
+	mov	r25, r24
+	mov	r24, r23
+	mov	r23, r22
+	clr	r22
+	call	__divmodsi4
+	movw	r24, r18
+`)
+		})
+
+		Convey("It divides 8-bit formats as 16-bit ones", func() {
+			a := &Asm{}
+			LowerFixedDiv(a, 1, 4)
+			So(a.String(), ShouldStartWith, `	clr	r25
+	sbrc	r24, 7
+	com	r25
+	clr	r23
+	sbrc	r22, 7
+	com	r23
+	movw	r18, r22
+`)
+			So(a.String(), ShouldEndWith, `	lsl	r22
+	rol	r23
+	rol	r24
+	rol	r25
+	call	__divmodsi4
+	movw	r24, r18
+`)
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package avr
+
+// I/O registers are at data space addresses 0x20-0x5f. They can also be
+// read and written there with IN and OUT, at their address less 0x20, which
+// take half the space and time of LDS and STS. Bits of the lower 32 can be
+// set and cleared with SBI and CBI, and tested with SBIS and SBIC. Registers
+// above, in extended I/O space, are only reached with LDS and STS.
+const (
+	ioStart  = 0x20
+	ioEnd    = 0x60
+	bitIOEnd = 0x40
+)
+
+// IOAddr returns I/O space address of register at data space address addr,
+// for IN and OUT, and whether it has one.
+func IOAddr(addr int64) (int64, bool) {
+	if addr < ioStart || addr >= ioEnd {
+		return 0, false
+	}
+	return addr - ioStart, true
+}
+
+// BitAddressable returns whether bits of register at data space address addr
+// can be set and cleared with SBI and CBI.
+func BitAddressable(addr int64) bool {
+	return addr >= ioStart && addr < bitIOEnd
+}
+
+// LowerRegLoad emits a read of register at data space address addr into reg.
+func LowerRegLoad(a *Asm, reg string, addr int64) {
+	if io, ok := IOAddr(addr); ok {
+		a.Emit("in", reg, Hex(io))
+		return
+	}
+	a.Emit("lds", reg, Hex(addr))
+}
+
+// LowerRegStore emits a write of reg to register at data space address addr.
+func LowerRegStore(a *Asm, addr int64, reg string) {
+	if io, ok := IOAddr(addr); ok {
+		a.Emit("out", Hex(io), reg)
+		return
+	}
+	a.Emit("sts", Hex(addr), reg)
+}
+
+// LowerRegBit emits a write of bit of register at data space address addr,
+// setting it if set is true and clearing it otherwise. Bit addressable
+// registers use SBI or CBI. Others are read, masked and written back through
+// reg, which must be one of r16-r31 since ORI and ANDI only take those, and
+// is clobbered; that isn't atomic, so an interrupt changing the register in
+// between has its change lost.
+func LowerRegBit(a *Asm, addr, bit int64, set bool, reg string) {
+	if BitAddressable(addr) {
+		op := "cbi"
+		if set {
+			op = "sbi"
+		}
+		a.Emit(op, Hex(addr-ioStart), Imm(int(bit)))
+		return
+	}
+
+	LowerRegLoad(a, reg, addr)
+	if set {
+		a.Emit("ori", reg, Hex(1<<uint(bit)))
+	} else {
+		a.Emit("andi", reg, Hex(^(1<<uint(bit))&0xff))
+	}
+	LowerRegStore(a, addr, reg)
+}
+
+// LowerSkipIfBit emits a skip of the next instruction if bit of register at
+// data space address addr is set, or if it's clear when set is false. Bit
+// addressable registers are tested with SBIS or SBIC; others are read into
+// reg, which is clobbered, and tested with SBRS or SBRC.
+func LowerSkipIfBit(a *Asm, addr, bit int64, set bool, reg string) {
+	if BitAddressable(addr) {
+		op := "sbic"
+		if set {
+			op = "sbis"
+		}
+		a.Emit(op, Hex(addr-ioStart), Imm(int(bit)))
+		return
+	}
+
+	LowerRegLoad(a, reg, addr)
+	op := "sbrc"
+	if set {
+		op = "sbrs"
+	}
+	a.Emit(op, reg, Imm(int(bit)))
+}
@@ -0,0 +1,69 @@
+package avr
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIO(t *testing.T) {
+	Convey("IO", t, func() {
+		const (
+			PORTB  = 0x25
+			EIMSK  = 0x3d
+			TCCR0A = 0x44
+			TIMSK0 = 0x6e
+		)
+
+		Convey("It reads and writes I/O space with IN and OUT", func() {
+			a := &Asm{}
+			LowerRegLoad(a, "r24", TCCR0A)
+			LowerRegStore(a, PORTB, "r24")
+			So(a.String(), ShouldEqual, "\tin\tr24, 0x24\n\tout\t0x05, r24\n")
+		})
+
+		Convey("It reads and writes extended I/O space with LDS and STS", func() {
+			a := &Asm{}
+			LowerRegLoad(a, "r24", TIMSK0)
+			LowerRegStore(a, TIMSK0, "r24")
+			So(a.String(), ShouldEqual, "\tlds\tr24, 0x6e\n\tsts\t0x6e, r24\n")
+		})
+
+		Convey("It sets and clears bits of low I/O registers with SBI and CBI", func() {
+			a := &Asm{}
+			LowerRegBit(a, PORTB, 5, true, "r24")
+			LowerRegBit(a, EIMSK, 0, false, "r24")
+			So(a.String(), ShouldEqual, "\tsbi\t0x05, 5\n\tcbi\t0x1d, 0\n")
+		})
+
+		Convey("It masks bits of other registers", func() {
+			a := &Asm{}
+			LowerRegBit(a, TCCR0A, 1, true, "r24")
+			LowerRegBit(a, TIMSK0, 0, false, "r24")
+			So(a.String(), ShouldEqual, `	in	r24, 0x24
+	ori	r24, 0x02
+	out	0x24, r24
+	lds	r24, 0x6e
+	andi	r24, 0xfe
+	sts	0x6e, r24
+`)
+		})
+
+		Convey("It skips on bits", func() {
+			a := &Asm{}
+			LowerSkipIfBit(a, PORTB, 3, true, "r24")
+			LowerSkipIfBit(a, TIMSK0, 2, false, "r24")
+			So(a.String(), ShouldEqual, "\tsbis\t0x05, 3\n\tlds\tr24, 0x6e\n\tsbrc\tr24, 2\n")
+		})
+
+		Convey("It knows which registers are in I/O space", func() {
+			io, ok := IOAddr(0x5f)
+			So(ok, ShouldBeTrue)
+			So(io, ShouldEqual, 0x3f)
+			_, ok = IOAddr(0x60)
+			So(ok, ShouldBeFalse)
+			So(BitAddressable(0x3f), ShouldBeTrue)
+			So(BitAddressable(0x40), ShouldBeFalse)
+		})
+	})
+}
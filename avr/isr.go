@@ -0,0 +1,143 @@
+package avr
+
+import (
+	"strconv"
+	"strings"
+)
+
+// An interrupt can come between any two instructions, so its handler must
+// leave every register and SREG as it found them. Handlers only save the
+// registers their body uses, and SREG, which is saved through r0. R1 is kept
+// zero by compiled code, so it's saved and cleared only if the body uses it.
+// Calls can clobber every call-clobbered register, so a body with calls saves
+// all of them.
+
+// sregAddr is I/O space address of SREG.
+const sregAddr = 0x3f
+
+// callClobbered are registers a called function can change without saving,
+// in avr-gcc's ABI; r1 must be zero again when it returns.
+var callClobbered = []int{0, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 30, 31}
+
+// EpilogueLabel returns label that returns from handler name, for returns
+// in its body.
+func EpilogueLabel(name string) string {
+	return ".L" + name + "_epilogue"
+}
+
+// LowerISR emits handler name of an interrupt with given body, which must
+// fall through to its end or jump to EpilogueLabel(name) to return. It saves
+// registers the body uses and SREG, restores them and returns with RETI.
+func LowerISR(a *Asm, name string, body *Asm) {
+	used := usedRegs(body)
+	used[0] = true
+
+	// r1 is pushed first, like avr-gcc does
+	var saved []int
+	if used[1] {
+		saved = append(saved, 1)
+	}
+	for r, ok := range used {
+		if ok && r != 1 {
+			saved = append(saved, r)
+		}
+	}
+
+	a.Label(name)
+	for _, r := range saved {
+		a.Emit("push", reg(r))
+		if r == 0 {
+			a.Emit("in", "r0", Hex(sregAddr))
+			a.Emit("push", "r0")
+		}
+	}
+	if used[1] {
+		a.Emit("clr", "r1")
+	}
+
+	a.lines = append(a.lines, body.lines...)
+
+	a.Label(EpilogueLabel(name))
+	for i := len(saved) - 1; i >= 0; i-- {
+		if saved[i] == 0 {
+			a.Emit("pop", "r0")
+			a.Emit("out", Hex(sregAddr), "r0")
+		}
+		a.Emit("pop", reg(saved[i]))
+	}
+	a.Emit("reti")
+}
+
+func reg(n int) string {
+	return "r" + strconv.Itoa(n)
+}
+
+// usedRegs returns registers instructions of a read or write, including ones
+// used implicitly, like r0 and r1 by MUL.
+func usedRegs(a *Asm) (used [32]bool) {
+	for _, line := range a.lines {
+		fields := strings.Fields(strings.Replace(line, ",", " ", -1))
+		if len(fields) == 0 || strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+
+		op, args := fields[0], fields[1:]
+		switch op {
+		case "call", "rcall", "icall", "eicall":
+			for _, r := range callClobbered {
+				used[r] = true
+			}
+			used[1] = true
+		case "mul", "muls", "mulsu", "fmul", "fmuls", "fmulsu":
+			used[0], used[1] = true, true
+		case "lpm", "elpm", "spm":
+			if len(args) == 0 {
+				used[0] = true
+			}
+			used[30], used[31] = true, true
+		}
+
+		for _, arg := range args {
+			if low := pointer(arg); low >= 0 {
+				used[low], used[low+1] = true, true
+				continue
+			}
+
+			if !strings.HasPrefix(arg, "r") {
+				continue
+			}
+			n, err := strconv.Atoi(arg[1:])
+			if err != nil || n < 0 || n > 31 {
+				continue
+			}
+			used[n] = true
+			// pair instructions use the register after too
+			if op == "movw" || op == "adiw" || op == "sbiw" {
+				used[n+1] = true
+			}
+		}
+	}
+
+	return used
+}
+
+// pointer returns low register of pointer register X, Y or Z that operand
+// arg uses, eg -X, Z+ or Y+2, or -1 if it uses none.
+func pointer(arg string) int {
+	arg = strings.TrimPrefix(arg, "-")
+	if arg == "" {
+		return -1
+	}
+
+	low, ok := map[byte]int{'X': 26, 'Y': 28, 'Z': 30}[arg[0]]
+	if !ok {
+		return -1
+	}
+	if offset := arg[1:]; offset != "" && offset != "+" {
+		if _, err := strconv.Atoi(offset); err != nil || offset[0] != '+' {
+			return -1
+		}
+	}
+
+	return low
+}
@@ -0,0 +1,97 @@
+package avr
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestISR(t *testing.T) {
+	Convey("ISR", t, func() {
+		Convey("It saves SREG and registers the body uses", func() {
+			body := &Asm{}
+			body.Emit("lds", "r24", "ticks")
+			body.Emit("subi", "r24", "0xff")
+			body.Emit("sts", "ticks", "r24")
+
+			a := &Asm{}
+			LowerISR(a, "tick", body)
+			So(a.String(), ShouldEqual, `tick:
+	push	r0
+	in	r0, 0x3f
+	push	r0
+	push	r24
+	lds	r24, ticks
+	subi	r24, 0xff
+	sts	ticks, r24
+.Ltick_epilogue:
+	pop	r24
+	pop	r0
+	out	0x3f, r0
+	pop	r0
+	reti
+`)
+		})
+
+		Convey("It saves and clears r1 if the body uses it", func() {
+			body := &Asm{}
+			body.Emit("mul", "r24", "r22")
+			body.Emit("movw", "r24", "r0")
+
+			a := &Asm{}
+			LowerISR(a, "f", body)
+			So(a.String(), ShouldStartWith, "f:\n\tpush\tr1\n\tpush\tr0\n\tin\tr0, 0x3f\n\tpush\tr0\n\tpush\tr22\n\tpush\tr24\n\tpush\tr25\n\tclr\tr1\n")
+			So(a.String(), ShouldEndWith, "\tpop\tr0\n\tout\t0x3f, r0\n\tpop\tr0\n\tpop\tr1\n\treti\n")
+		})
+
+		Convey("It saves call-clobbered registers if the body calls", func() {
+			body := &Asm{}
+			body.Emit("call", "handle")
+
+			a := &Asm{}
+			LowerISR(a, "f", body)
+			for _, r := range []string{"r1", "r18", "r25", "r26", "r27", "r30", "r31"} {
+				So(a.String(), ShouldContainSubstring, "\tpush\t"+r+"\n")
+			}
+			So(a.String(), ShouldNotContainSubstring, "r28")
+		})
+
+		Convey("It finds registers used through pointers", func() {
+			body := &Asm{}
+			body.Emit("ld", "r18", "X+")
+			body.Emit("ldd", "r19", "Y+2")
+			body.Emit("rjmp", "Zero")
+
+			used := usedRegs(body)
+			So(used[26] && used[27] && used[28] && used[29], ShouldBeTrue)
+			So(used[30] || used[31], ShouldBeFalse)
+		})
+	})
+}
+
+func TestVectors(t *testing.T) {
+	Convey("Vectors", t, func() {
+		Convey("It numbers vectors as the datasheet does", func() {
+			n, ok := VectorNumber("TIMER1_COMPA")
+			So(ok, ShouldBeTrue)
+			So(n, ShouldEqual, 11)
+			n, _ = VectorNumber("SPM_READY")
+			So(n, ShouldEqual, 25)
+			_, ok = VectorNumber("RESET")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("It jumps to handlers from the vector table", func() {
+			a := &Asm{}
+			LowerVectorTable(a, map[string]string{"INT0": "button", "TIMER1_COMPA": "tick"})
+
+			lines := strings.Split(strings.TrimSpace(a.String()), "\n")
+			So(len(lines), ShouldEqual, 2+len(Vectors))
+			So(lines[2], ShouldEqual, "\tjmp\t__init")
+			So(lines[3], ShouldEqual, "\tjmp\tbutton")
+			So(lines[4], ShouldEqual, "\tjmp\t__bad_interrupt")
+			So(lines[2+11], ShouldEqual, "\tjmp\ttick")
+		})
+	})
+}
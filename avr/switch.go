@@ -0,0 +1,100 @@
+package avr
+
+// SwitchLowering is how a switch over a u8 is turned into branches.
+type SwitchLowering int
+
+const (
+	// CompareChain compares value with each case in turn.
+	CompareChain SwitchLowering = iota
+
+	// JumpTable indexes a table of jumps with value and jumps into it with
+	// IJMP.
+	JumpTable
+)
+
+// MinJumpTableCases is the fewest cases worth a jump table; below it a
+// compare chain is as small and fast.
+const MinJumpTableCases = 4
+
+// Case is a value of a switch, with the label to jump to when the switched
+// value equals it.
+type Case struct {
+	Value uint8
+	Label string
+}
+
+// ChooseSwitchLowering picks a jump table when there are enough cases and at
+// least half of the values between lowest and highest case are used, since
+// every unused value costs a word of table; otherwise a compare chain.
+func ChooseSwitchLowering(cases []Case) SwitchLowering {
+	if len(cases) < MinJumpTableCases {
+		return CompareChain
+	}
+
+	low, high := valueRange(cases)
+	if span := int(high) - int(low) + 1; len(cases)*2 < span {
+		return CompareChain
+	}
+
+	return JumpTable
+}
+
+// LowerSwitch emits a switch on value in reg, jumping to label of the case
+// equal to it, or to def if there's none. Table is the label to give the jump
+// table if one is used. Reg must be one of r16-r31, since CPI and SUBI only
+// take those, and it's clobbered. Cases must have distinct values.
+func LowerSwitch(a *Asm, reg string, cases []Case, def, table string) {
+	if ChooseSwitchLowering(cases) == CompareChain {
+		for _, c := range cases {
+			a.Emit("cpi", reg, Imm(int(c.Value)))
+			a.Emit("breq", c.Label)
+		}
+		a.Emit("rjmp", def)
+		return
+	}
+
+	low, high := valueRange(cases)
+	labels := make([]string, int(high)-int(low)+1)
+	for i := range labels {
+		labels[i] = def
+	}
+	for _, c := range cases {
+		labels[c.Value-low] = c.Label
+	}
+
+	// values below low wrap around to above high, so one unsigned compare
+	// sends both to default
+	if low != 0 {
+		a.Emit("subi", reg, Imm(int(low)))
+	}
+	if len(labels) < 256 {
+		a.Emit("cpi", reg, Imm(len(labels)))
+		a.Emit("brsh", def)
+	}
+
+	// Z = word address of table + value; r1 is always zero by convention
+	a.Emit("ldi", "r30", "lo8(pm("+table+"))")
+	a.Emit("ldi", "r31", "hi8(pm("+table+"))")
+	a.Emit("add", "r30", reg)
+	a.Emit("adc", "r31", "r1")
+	a.Emit("ijmp")
+
+	a.Label(table)
+	for _, label := range labels {
+		a.Emit("rjmp", label)
+	}
+}
+
+func valueRange(cases []Case) (low, high uint8) {
+	low, high = 255, 0
+	for _, c := range cases {
+		if c.Value < low {
+			low = c.Value
+		}
+		if c.Value > high {
+			high = c.Value
+		}
+	}
+
+	return low, high
+}
@@ -0,0 +1,53 @@
+package avr
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSwitch(t *testing.T) {
+	Convey("Switch", t, func() {
+		Convey("It compares few cases in a chain", func() {
+			cases := []Case{{1, "one"}, {2, "two"}}
+			So(ChooseSwitchLowering(cases), ShouldEqual, CompareChain)
+
+			a := &Asm{}
+			LowerSwitch(a, "r24", cases, "other", "table")
+			So(a.String(), ShouldEqual, `	cpi	r24, 1
+	breq	one
+	cpi	r24, 2
+	breq	two
+	rjmp	other
+`)
+		})
+
+		Convey("It compares sparse cases in a chain", func() {
+			cases := []Case{{0, "a"}, {10, "b"}, {100, "c"}, {200, "d"}}
+			So(ChooseSwitchLowering(cases), ShouldEqual, CompareChain)
+		})
+
+		Convey("It jumps through a table for dense cases", func() {
+			cases := []Case{{2, "idle"}, {3, "run"}, {5, "done"}, {6, "error"}}
+			So(ChooseSwitchLowering(cases), ShouldEqual, JumpTable)
+
+			a := &Asm{}
+			LowerSwitch(a, "r24", cases, "other", "table")
+			So(a.String(), ShouldEqual, `	subi	r24, 2
+	cpi	r24, 5
+	brsh	other
+	ldi	r30, lo8(pm(table))
+	ldi	r31, hi8(pm(table))
+	add	r30, r24
+	adc	r31, r1
+	ijmp
+table:
+	rjmp	idle
+	rjmp	run
+	rjmp	other
+	rjmp	done
+	rjmp	error
+`)
+		})
+	})
+}
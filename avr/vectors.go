@@ -0,0 +1,56 @@
+package avr
+
+// Vectors are the interrupt vectors of the ATmega328P, by number, as named in
+// its datasheet with spaces as underscores. Vector 0 is reset, which jumps to
+// the startup code and can't be handled.
+var Vectors = []string{
+	"RESET",
+	"INT0", "INT1",
+	"PCINT0", "PCINT1", "PCINT2",
+	"WDT",
+	"TIMER2_COMPA", "TIMER2_COMPB", "TIMER2_OVF",
+	"TIMER1_CAPT", "TIMER1_COMPA", "TIMER1_COMPB", "TIMER1_OVF",
+	"TIMER0_COMPA", "TIMER0_COMPB", "TIMER0_OVF",
+	"SPI_STC",
+	"USART_RX", "USART_UDRE", "USART_TX",
+	"ADC",
+	"EE_READY",
+	"ANALOG_COMP",
+	"TWI",
+	"SPM_READY",
+}
+
+// VectorNumber returns number of vector with given name, and whether it's one
+// that can be handled.
+func VectorNumber(name string) (int, bool) {
+	for i, v := range Vectors[1:] {
+		if v == name {
+			return i + 1, true
+		}
+	}
+
+	return 0, false
+}
+
+// Labels of the startup code that reset jumps to, and of the handler of
+// interrupts that have none, which restarts.
+const (
+	InitLabel         = "__init"
+	BadInterruptLabel = "__bad_interrupt"
+)
+
+// LowerVectorTable emits the vector table, jumping to labels of handlers,
+// keyed by vector name, or to BadInterruptLabel for vectors without one.
+// Each entry is a JMP, which takes 2 words as entries do on the ATmega328P.
+func LowerVectorTable(a *Asm, handlers map[string]string) {
+	a.Emit(".section", ".vectors", `"ax"`, "@progbits")
+	a.Label("__vectors")
+	a.Emit("jmp", InitLabel)
+	for _, v := range Vectors[1:] {
+		label, ok := handlers[v]
+		if !ok {
+			label = BadInterruptLabel
+		}
+		a.Emit("jmp", label)
+	}
+}
@@ -0,0 +1,233 @@
+package callgraph
+
+import (
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+)
+
+// Functions can't be used as values, so every call names the function it
+// calls and the graph is exact for the functions it's built of. Calls of
+// functions of other modules, eg lcd.print(x), aren't in it, since those
+// functions aren't known; they're kept as Func.Outside. Imports can't form
+// cycles, so such a call never leads back into the graph.
+
+// Graph is a call graph: functions, with the calls between them.
+type Graph struct {
+	// Funcs are in the order they were given to New.
+	Funcs []*Func
+
+	funcs map[*ast.FuncDecl]*Func
+
+	// Components are strongly connected components of the graph, each after
+	// the ones it calls.
+	Components []*Component
+}
+
+// Func is a function of the graph.
+type Func struct {
+	Decl *ast.FuncDecl
+
+	// Calls are calls it makes, in source order, and Callers calls of it.
+	Calls   []*Call
+	Callers []*Call
+
+	// Outside are calls it makes of functions of other modules, in source
+	// order.
+	Outside []*ast.CallExpr
+
+	// Component is the component it's in.
+	Component *Component
+
+	index int
+}
+
+// Name returns name of the function.
+func (f *Func) Name() string {
+	return f.Decl.Name.Name
+}
+
+// Call is a call of Callee in the body of Caller.
+type Call struct {
+	Caller *Func
+	Callee *Func
+	Site   *ast.CallExpr
+}
+
+// Component is a strongly connected component: functions that all call each
+// other, directly or not. Most functions are in a component of their own.
+type Component struct {
+	// Funcs are in the order of Graph.Funcs.
+	Funcs []*Func
+
+	// Recursive is if its functions call each other, or its only function
+	// calls itself.
+	Recursive bool
+}
+
+// New builds graph of given functions. Callee returns function a call calls,
+// or nil if it's not one of funcs, eg it's a conversion. Outside returns if
+// a call calls a function of another module.
+func New(funcs []*ast.FuncDecl, callee func(*ast.CallExpr) *ast.FuncDecl, outside func(*ast.CallExpr) bool) *Graph {
+	g := &Graph{funcs: map[*ast.FuncDecl]*Func{}}
+	for i, decl := range funcs {
+		f := &Func{Decl: decl, index: i}
+		g.Funcs = append(g.Funcs, f)
+		g.funcs[decl] = f
+	}
+
+	for _, f := range g.Funcs {
+		ast.Inspect(f.Decl.Body, func(n ast.Node) bool {
+			site, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if to := g.funcs[callee(site)]; to != nil {
+				call := &Call{Caller: f, Callee: to, Site: site}
+				f.Calls = append(f.Calls, call)
+				to.Callers = append(to.Callers, call)
+			} else if outside(site) {
+				f.Outside = append(f.Outside, site)
+			}
+			return true
+		})
+	}
+
+	g.components()
+	return g
+}
+
+// Func returns function of given declaration, or nil if it's not in the
+// graph.
+func (g *Graph) Func(decl *ast.FuncDecl) *Func {
+	return g.funcs[decl]
+}
+
+// components finds components with Tarjan's algorithm, which finds each
+// after the ones it calls.
+func (g *Graph) components() {
+	index := map[*Func]int{}
+	low := map[*Func]int{}
+	onStack := map[*Func]bool{}
+	var stack []*Func
+
+	var visit func(f *Func)
+	visit = func(f *Func) {
+		index[f] = len(index)
+		low[f] = index[f]
+		stack = append(stack, f)
+		onStack[f] = true
+
+		for _, call := range f.Calls {
+			to := call.Callee
+			if _, ok := index[to]; !ok {
+				visit(to)
+				low[f] = minInt(low[f], low[to])
+			} else if onStack[to] {
+				low[f] = minInt(low[f], index[to])
+			}
+		}
+
+		if low[f] != index[f] {
+			return
+		}
+
+		c := &Component{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			top.Component = c
+			c.Funcs = append([]*Func{top}, c.Funcs...)
+			if top == f {
+				break
+			}
+		}
+		sortFuncs(c.Funcs)
+		c.Recursive = len(c.Funcs) > 1 || f.calls(f)
+		g.Components = append(g.Components, c)
+	}
+
+	for _, f := range g.Funcs {
+		if _, ok := index[f]; !ok {
+			visit(f)
+		}
+	}
+}
+
+// calls returns if f calls to directly.
+func (f *Func) calls(to *Func) bool {
+	for _, call := range f.Calls {
+		if call.Callee == to {
+			return true
+		}
+	}
+	return false
+}
+
+func sortFuncs(funcs []*Func) {
+	for i := 1; i < len(funcs); i++ {
+		for j := i; j > 0 && funcs[j].index < funcs[j-1].index; j-- {
+			funcs[j], funcs[j-1] = funcs[j-1], funcs[j]
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Cycle returns the shortest chain of calls of recursive component c from its
+// first function back to it, eg f, g and f again, or nil if c isn't
+// recursive.
+func (c *Component) Cycle() []*Call {
+	if !c.Recursive {
+		return nil
+	}
+
+	start := c.Funcs[0]
+	via := map[*Func]*Call{}
+	queue := []*Func{start}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+
+		for _, call := range f.Calls {
+			to := call.Callee
+			if to.Component != c {
+				continue
+			}
+			if to == start {
+				cycle := []*Call{call}
+				for f != start {
+					cycle = append([]*Call{via[f]}, cycle...)
+					f = via[f].Caller
+				}
+				return cycle
+			}
+			if _, ok := via[to]; !ok {
+				via[to] = call
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CycleString returns given chain of calls as the names of the functions it
+// goes through, eg "f -> g -> f".
+func CycleString(cycle []*Call) string {
+	if len(cycle) == 0 {
+		return ""
+	}
+
+	names := []string{cycle[0].Caller.Name()}
+	for _, call := range cycle {
+		names = append(names, call.Callee.Name())
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,106 @@
+package callgraph
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// build parses given source and builds graph of its functions, resolving
+// calls by name; calls of selectors are of other modules.
+func build(src string) *Graph {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	var funcs []*ast.FuncDecl
+	byName := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			funcs = append(funcs, fn)
+			byName[fn.Name.Name] = fn
+		}
+	}
+
+	return New(funcs, func(call *ast.CallExpr) *ast.FuncDecl {
+		if id, ok := call.Fun.(*ast.Ident); ok {
+			return byName[id.Name]
+		}
+		return nil
+	}, func(call *ast.CallExpr) bool {
+		_, ok := call.Fun.(*ast.SelectorExpr)
+		return ok
+	})
+}
+
+// names returns names of components' functions, in order.
+func names(g *Graph) [][]string {
+	var names [][]string
+	for _, c := range g.Components {
+		var comp []string
+		for _, f := range c.Funcs {
+			comp = append(comp, f.Name())
+		}
+		names = append(names, comp)
+	}
+	return names
+}
+
+func TestCallGraph(t *testing.T) {
+	Convey("CallGraph", t, func() {
+		Convey("It adds calls and callers in source order", func() {
+			g := build(`
+fn main() { a(); b(); a(); u8(3); }
+fn a() { }
+fn b() { a(); }`)
+			main := g.Funcs[0]
+			So(len(main.Calls), ShouldEqual, 3)
+			So(main.Calls[1].Callee.Name(), ShouldEqual, "b")
+			So(len(g.Func(g.Funcs[1].Decl).Callers), ShouldEqual, 3)
+		})
+
+		Convey("It keeps calls of functions of other modules apart", func() {
+			g := build(`
+fn main() { lcd.print(1); a(); lcd.clear(); }
+fn a() { }`)
+			main := g.Funcs[0]
+			So(len(main.Calls), ShouldEqual, 1)
+			So(len(main.Outside), ShouldEqual, 2)
+			So(ast.ExprString(main.Outside[1].Fun), ShouldEqual, "lcd.clear")
+		})
+
+		Convey("It puts components after the ones they call", func() {
+			g := build(`
+fn main() { a(); }
+fn a() { b(); }
+fn b() { }`)
+			So(names(g), ShouldResemble, [][]string{{"b"}, {"a"}, {"main"}})
+			for _, c := range g.Components {
+				So(c.Recursive, ShouldBeFalse)
+				So(c.Cycle(), ShouldBeNil)
+			}
+		})
+
+		Convey("It finds functions that call themselves", func() {
+			g := build("fn f() { f(); }")
+			So(g.Components[0].Recursive, ShouldBeTrue)
+			So(CycleString(g.Components[0].Cycle()), ShouldEqual, "f -> f")
+		})
+
+		Convey("It finds cycles through several functions", func() {
+			g := build(`
+fn main() { b(); }
+fn a() { c(); }
+fn b() { a(); }
+fn c() { d(); b(); }
+fn d() { }`)
+			So(names(g), ShouldResemble, [][]string{{"d"}, {"a", "b", "c"}, {"main"}})
+
+			c := g.Components[1]
+			So(c.Recursive, ShouldBeTrue)
+			So(CycleString(c.Cycle()), ShouldEqual, "a -> c -> b -> a")
+			So(g.Funcs[0].Component.Recursive, ShouldBeFalse)
+		})
+	})
+}
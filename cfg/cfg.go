@@ -0,0 +1,369 @@
+package cfg
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Graph is the control-flow graph of a function body. Its blocks are in the
+// order they're built, with Entry first and Exit last.
+type Graph struct {
+	Blocks []*Block
+
+	// Entry is where the body starts, and Exit where returns and the end of
+	// the body go to. Exit has no nodes.
+	Entry *Block
+	Exit  *Block
+
+	// Unreachable are statements that start code no path reaches, eg the
+	// first statement after a return. Code they lead to isn't in it.
+	Unreachable []ast.Stmt
+
+	// FallsOff is if control can reach the end of the body without a
+	// return.
+	FallsOff bool
+}
+
+// Block is a basic block: nodes run one after the other, and then control
+// goes to one of Succs.
+type Block struct {
+	Index int
+
+	// Kind is what the block is of, eg "if.then" or "while.cond", for
+	// debugging.
+	Kind string
+
+	// Nodes are simple statements, ie not ones that contain other
+	// statements, and conditions and tags of the statements that end
+	// blocks. A block with more than one successor ends with its condition
+	// or tag: conditions go to their true block first, then false one.
+	Nodes []ast.Node
+
+	Succs []*Block
+	Preds []*Block
+
+	// Live is if a path from entry reaches the block.
+	Live bool
+
+	// labels are labels of edges to Succs, eg "true", for Dot.
+	labels []string
+
+	// stmt is the first statement that starts in the block.
+	stmt ast.Stmt
+}
+
+// builder builds a graph from statements, with cur the block being added to.
+type builder struct {
+	g   *Graph
+	cur *Block
+
+	// loops are enclosing loops, innermost last.
+	loops []*loop
+
+	facts Facts
+}
+
+// Facts are what checks found out that decides where control can go.
+type Facts interface {
+	// Exhaustive returns if a switch without a default case covers every
+	// value its tag can have, eg all members of an enum.
+	Exhaustive(stmt *ast.SwitchStmt) bool
+
+	// IsTrue returns if condition x is a constant true, eg of `while true`.
+	IsTrue(x ast.Expr) bool
+}
+
+// syntax are facts known without checks: no switch is exhaustive, and only
+// the literal true is true.
+type syntax struct{}
+
+func (syntax) Exhaustive(*ast.SwitchStmt) bool { return false }
+
+func (syntax) IsTrue(x ast.Expr) bool {
+	for {
+		paren, ok := x.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		x = paren.X
+	}
+
+	lit, ok := x.(*ast.BasicLit)
+	return ok && lit.Kind == token.TRUE
+}
+
+// loop is an enclosing loop, with where break and continue go.
+type loop struct {
+	label     *ast.Ident
+	breakTo   *Block
+	continues *Block
+}
+
+// New builds the graph of given function body. Facts can be nil, in which
+// case only what's known from syntax is used.
+func New(body *ast.BlockStmt, facts Facts) *Graph {
+	if facts == nil {
+		facts = syntax{}
+	}
+
+	b := &builder{g: &Graph{}, facts: facts}
+	b.g.Entry = b.newBlock("entry")
+	b.g.Exit = &Block{Kind: "exit"}
+	b.cur = b.g.Entry
+
+	b.stmts(body.Stmts)
+	end := b.cur
+	b.jump(b.g.Exit)
+
+	b.g.Exit.Index = len(b.g.Blocks)
+	b.g.Blocks = append(b.g.Blocks, b.g.Exit)
+
+	mark(b.g.Entry)
+	b.g.FallsOff = end.Live
+	for b.g.prune() {
+	}
+	for _, block := range b.g.Blocks {
+		if !block.Live && len(block.Preds) == 0 && block.stmt != nil {
+			b.g.Unreachable = append(b.g.Unreachable, block.stmt)
+		}
+	}
+
+	return b.g
+}
+
+// mark marks blocks reachable from given one as live.
+func mark(block *Block) {
+	if block.Live {
+		return
+	}
+
+	block.Live = true
+	for _, succ := range block.Succs {
+		mark(succ)
+	}
+}
+
+// prune removes empty blocks nothing goes to, eg the ones started after
+// returns at the end of blocks, returning if it removed any. Blocks that
+// start a statement are kept, so a loop after a return, which only jumps to
+// its head, is still reported unreachable.
+func (g *Graph) prune() bool {
+	var blocks []*Block
+	for _, block := range g.Blocks {
+		if block == g.Entry || block == g.Exit || len(block.Nodes) > 0 || len(block.Preds) > 0 || block.stmt != nil {
+			blocks = append(blocks, block)
+			continue
+		}
+
+		for _, succ := range block.Succs {
+			succ.Preds = removeBlock(succ.Preds, block)
+		}
+	}
+
+	for i, block := range blocks {
+		block.Index = i
+	}
+	pruned := len(blocks) < len(g.Blocks)
+	g.Blocks = blocks
+	return pruned
+}
+
+func removeBlock(blocks []*Block, block *Block) []*Block {
+	var kept []*Block
+	for _, b := range blocks {
+		if b != block {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+func (b *builder) newBlock(kind string) *Block {
+	block := &Block{Index: len(b.g.Blocks), Kind: kind}
+	b.g.Blocks = append(b.g.Blocks, block)
+	return block
+}
+
+// edge adds an edge with given label, which can be empty.
+func (b *builder) edge(from, to *Block, label string) {
+	from.Succs = append(from.Succs, to)
+	from.labels = append(from.labels, label)
+	to.Preds = append(to.Preds, from)
+}
+
+// jump ends current block with an edge to given one.
+func (b *builder) jump(to *Block) {
+	b.edge(b.cur, to, "")
+}
+
+// add adds node to current block.
+func (b *builder) add(node ast.Node) {
+	b.cur.Nodes = append(b.cur.Nodes, node)
+}
+
+func (b *builder) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		b.stmt(stmt, nil)
+	}
+}
+
+// stmt adds given statement; label is the label of it if it's a loop.
+func (b *builder) stmt(stmt ast.Stmt, label *ast.Ident) {
+	if _, ok := stmt.(*ast.BlockStmt); !ok && b.cur.stmt == nil {
+		b.cur.stmt = stmt
+	}
+
+	switch stmt := stmt.(type) {
+	case *ast.VarDecl, *ast.ConstDecl, *ast.AssignStmt, *ast.ExprStmt, *ast.BadStmt:
+		b.add(stmt)
+	case *ast.BlockStmt:
+		b.stmts(stmt.Stmts)
+	case *ast.AtomicStmt:
+		b.stmts(stmt.Body.Stmts)
+	case *ast.LabeledStmt:
+		b.stmt(stmt.Stmt, stmt.Label)
+	case *ast.IfStmt:
+		b.ifStmt(stmt)
+	case *ast.SwitchStmt:
+		b.switchStmt(stmt)
+	case *ast.ForStmt:
+		if stmt.Init != nil {
+			b.stmt(stmt.Init, nil)
+		}
+		b.loop(label, "for", stmt.Cond, stmt.Body, stmt.Post)
+	case *ast.WhileStmt:
+		b.loop(label, "while", stmt.Cond, stmt.Body, nil)
+	case *ast.LoopStmt:
+		b.loop(label, "loop", nil, stmt.Body, nil)
+	case *ast.ReturnStmt:
+		b.add(stmt)
+		b.jump(b.g.Exit)
+		b.cur = b.newBlock("unreachable")
+	case *ast.BranchStmt:
+		b.add(stmt)
+		if l := b.target(stmt.Label); l != nil {
+			if stmt.Tok == token.CONTINUE {
+				b.jump(l.continues)
+			} else {
+				b.jump(l.breakTo)
+			}
+		}
+		b.cur = b.newBlock("unreachable")
+	}
+}
+
+func (b *builder) ifStmt(stmt *ast.IfStmt) {
+	b.add(stmt.Cond)
+	cond := b.cur
+
+	then := b.newBlock("if.then")
+	var els *Block
+	if stmt.Else != nil {
+		els = b.newBlock("if.else")
+	}
+	done := b.newBlock("if.done")
+
+	b.edge(cond, then, "true")
+	b.cur = then
+	b.stmt(stmt.Then, nil)
+	b.jump(done)
+
+	if els != nil {
+		b.edge(cond, els, "false")
+		b.cur = els
+		b.stmt(stmt.Else, nil)
+		b.jump(done)
+	} else {
+		b.edge(cond, done, "false")
+	}
+
+	b.cur = done
+}
+
+func (b *builder) switchStmt(stmt *ast.SwitchStmt) {
+	b.add(stmt.Tag)
+	tag := b.cur
+
+	cases := make([]*Block, len(stmt.Cases))
+	for i := range stmt.Cases {
+		cases[i] = b.newBlock("switch.case")
+	}
+	done := b.newBlock("switch.done")
+
+	hasDefault := false
+	for i, clause := range stmt.Cases {
+		label := "default"
+		if clause.Values != nil {
+			label = exprList(clause.Values)
+		} else {
+			hasDefault = true
+		}
+
+		b.edge(tag, cases[i], label)
+		b.cur = cases[i]
+		b.stmt(clause.Body, nil)
+		b.jump(done)
+	}
+	if !hasDefault && !b.facts.Exhaustive(stmt) {
+		b.edge(tag, done, "no match")
+	}
+
+	b.cur = done
+}
+
+// loop adds a loop of given kind that runs body while cond is true, running
+// post after body and continues. Loops without a cond, or with a constant
+// true one, only end with a break.
+func (b *builder) loop(label *ast.Ident, kind string, cond ast.Expr, body *ast.BlockStmt, post ast.Stmt) {
+	head := b.newBlock(kind + ".cond")
+	if cond == nil {
+		head.Kind = kind + ".body"
+	}
+	b.jump(head)
+
+	start := head
+	if cond != nil {
+		start = b.newBlock(kind + ".body")
+	}
+	next := head
+	if post != nil {
+		next = b.newBlock(kind + ".post")
+	}
+	done := b.newBlock(kind + ".done")
+
+	if cond != nil {
+		b.cur = head
+		b.add(cond)
+		b.edge(head, start, "true")
+		if !b.facts.IsTrue(cond) {
+			b.edge(head, done, "false")
+		}
+	}
+
+	b.loops = append(b.loops, &loop{label: label, breakTo: done, continues: next})
+	b.cur = start
+	b.stmt(body, nil)
+	b.jump(next)
+	b.loops = b.loops[:len(b.loops)-1]
+
+	if post != nil {
+		b.cur = next
+		b.stmt(post, nil)
+		b.jump(head)
+	}
+
+	b.cur = done
+}
+
+// target returns loop a break or continue with given label, which can be
+// nil, goes to, or nil if there's no such loop.
+func (b *builder) target(label *ast.Ident) *loop {
+	for i := len(b.loops) - 1; i >= 0; i-- {
+		l := b.loops[i]
+		if label == nil || l.label != nil && l.label.Name == label.Name {
+			return l
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// build parses given function and builds its graph.
+func build(src string) *Graph {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	return New(file.Decls[len(file.Decls)-1].(*ast.FuncDecl).Body, nil)
+}
+
+// facts are Facts that say every switch is exhaustive and every condition
+// is true, or none.
+type facts bool
+
+func (f facts) Exhaustive(*ast.SwitchStmt) bool { return bool(f) }
+func (f facts) IsTrue(ast.Expr) bool            { return bool(f) }
+
+// edges returns edges of graph as "from->to", with kinds of blocks.
+func edges(g *Graph) []string {
+	var edges []string
+	for _, b := range g.Blocks {
+		for _, succ := range b.Succs {
+			edges = append(edges, fmt.Sprintf("%s->%s", b.Kind, succ.Kind))
+		}
+	}
+	return edges
+}
+
+func TestCFG(t *testing.T) {
+	Convey("CFG", t, func() {
+		Convey("It puts straight-line code in one block", func() {
+			g := build("fn f() -> u8 { var x: u8 = 1; x = x + 1; return x; }")
+			So(len(g.Blocks), ShouldEqual, 2)
+			So(len(g.Entry.Nodes), ShouldEqual, 3)
+			So(edges(g), ShouldResemble, []string{"entry->exit"})
+			So(g.FallsOff, ShouldBeFalse)
+		})
+
+		Convey("It splits ifs into branches that join", func() {
+			g := build("fn f(c: bool) { if c { f(c); } else { return; } f(c); }")
+			So(edges(g), ShouldResemble, []string{
+				"entry->if.then", "entry->if.else", "if.then->if.done", "if.else->exit", "if.done->exit",
+			})
+			So(ast.ExprString(g.Entry.Nodes[0].(ast.Expr)), ShouldEqual, "c")
+			So(g.FallsOff, ShouldBeTrue)
+		})
+
+		Convey("It links loops back to their condition", func() {
+			g := build(`
+fn f(n: u8) {
+  for var i: u8 = 0; i < n; i = i + 1 {
+    if i == 3 { continue; }
+    if i == 5 { break; }
+  }
+}`)
+			e := strings.Join(edges(g), " ")
+			So(e, ShouldContainSubstring, "entry->for.cond for.cond->for.body for.cond->for.done")
+			So(e, ShouldContainSubstring, "for.post->for.cond")
+			So(e, ShouldContainSubstring, "if.then->for.post")
+			So(e, ShouldContainSubstring, "if.then->for.done")
+		})
+
+		Convey("It follows labeled breaks out of nested loops", func() {
+			g := build("fn f() { outer: loop { while true { break outer; } } }")
+			So(edges(g), ShouldResemble, []string{
+				"entry->loop.body", "loop.body->while.cond", "loop.done->exit",
+				"while.cond->while.body", "while.body->loop.done",
+			})
+			So(g.FallsOff, ShouldBeTrue)
+		})
+
+		Convey("It knows loops without a way out don't end", func() {
+			So(build("fn f() -> u8 { loop { } }").FallsOff, ShouldBeFalse)
+			So(build("fn f() -> u8 { while true { } }").FallsOff, ShouldBeFalse)
+			So(build("fn f() -> u8 { for ;; { return 1; } }").FallsOff, ShouldBeFalse)
+			So(build("fn f(c: bool) -> u8 { while c { return 1; } }").FallsOff, ShouldBeTrue)
+		})
+
+		Convey("It only falls through switches without a default that aren't exhaustive", func() {
+			src := "enum E { A, B } fn f(e: E) -> u8 { switch e { case E.A { return 1; } case E.B { return 2; } } }"
+			So(build(src).FallsOff, ShouldBeTrue)
+
+			file, _ := parser.ParseString(src)
+			g := New(file.Decls[1].(*ast.FuncDecl).Body, facts(true))
+			So(g.FallsOff, ShouldBeFalse)
+
+			So(build("fn f(n: u8) -> u8 { switch n { case 1 { return 1; } default { return 0; } } }").FallsOff,
+				ShouldBeFalse)
+		})
+
+		Convey("It only leaves loops whose condition is constant true with a break", func() {
+			file, _ := parser.ParseString("fn f(c: bool) -> u8 { while c { } }")
+			body := file.Decls[0].(*ast.FuncDecl).Body
+			So(New(body, facts(false)).FallsOff, ShouldBeTrue)
+			So(New(body, facts(true)).FallsOff, ShouldBeFalse)
+		})
+
+		Convey("It finds the first statement of unreachable code", func() {
+			g := build(`
+fn f(c: bool) -> u8 {
+  while c {
+    break;
+    f(c);
+    f(c);
+  }
+  if c { return 1; } else { return 2; }
+  if c { f(c); }
+  return 3;
+}`)
+			var lines []int
+			for _, stmt := range g.Unreachable {
+				lines = append(lines, stmt.Span().Start.Line)
+			}
+			So(lines, ShouldResemble, []int{5, 9})
+			So(g.FallsOff, ShouldBeFalse)
+		})
+
+		Convey("It finds loops and ifs after returns and breaks", func() {
+			g := build(`
+fn f(c: bool) {
+  loop {
+    break;
+    while true { f(c); }
+  }
+  while c {
+    continue;
+    if c { f(c); }
+  }
+  return;
+  loop { f(c); }
+}`)
+			var lines []int
+			for _, stmt := range g.Unreachable {
+				lines = append(lines, stmt.Span().Start.Line)
+			}
+			So(lines, ShouldResemble, []int{5, 9, 12})
+		})
+	})
+}
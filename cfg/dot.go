@@ -0,0 +1,105 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Dot returns the graph in Graphviz DOT format, eg for `dot -Tsvg`, with
+// given name. Blocks are boxes listing their nodes; blocks no path reaches
+// are dashed.
+func (g *Graph) Dot(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", quote(name))
+	b.WriteString("\tnode [shape=box, fontname=monospace];\n")
+
+	for _, block := range g.Blocks {
+		label := fmt.Sprintf("%d: %s\\l", block.Index, block.Kind)
+		for _, node := range block.Nodes {
+			label += escape(NodeString(node)) + "\\l"
+		}
+
+		style := ""
+		if !block.Live {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\tb%d [label=\"%s\"%s];\n", block.Index, label, style)
+	}
+
+	for _, block := range g.Blocks {
+		for i, succ := range block.Succs {
+			if block.labels[i] == "" {
+				fmt.Fprintf(&b, "\tb%d -> b%d;\n", block.Index, succ.Index)
+				continue
+			}
+			fmt.Fprintf(&b, "\tb%d -> b%d [label=%s];\n", block.Index, succ.Index, quote(block.labels[i]))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// NodeString returns a node of a block as it'd be written in source, without
+// the terminator.
+func NodeString(node ast.Node) string {
+	switch node := node.(type) {
+	case ast.Expr:
+		return ast.ExprString(node)
+	case *ast.VarDecl:
+		return "var " + declString(node.Name, node.Type, node.Value)
+	case *ast.ConstDecl:
+		return "const " + declString(node.Name, node.Type, node.Value)
+	case *ast.AssignStmt:
+		return ast.ExprString(node.Target) + " = " + ast.ExprString(node.Value)
+	case *ast.ExprStmt:
+		return ast.ExprString(node.X)
+	case *ast.ReturnStmt:
+		if node.Value == nil {
+			return "return"
+		}
+		return "return " + ast.ExprString(node.Value)
+	case *ast.BranchStmt:
+		s := "break"
+		if node.Tok == token.CONTINUE {
+			s = "continue"
+		}
+		if node.Label != nil {
+			s += " " + node.Label.Name
+		}
+		return s
+	}
+
+	return fmt.Sprintf("<%T>", node)
+}
+
+func declString(name *ast.Ident, typ, value ast.Expr) string {
+	s := name.Name
+	if typ != nil {
+		s += ": " + ast.ExprString(typ)
+	}
+	if value != nil {
+		s += " = " + ast.ExprString(value)
+	}
+	return s
+}
+
+func exprList(xs []ast.Expr) string {
+	strs := make([]string, len(xs))
+	for i, x := range xs {
+		strs[i] = ast.ExprString(x)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// escape escapes quotes and backslashes of s for a DOT string.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
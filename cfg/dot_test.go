@@ -0,0 +1,49 @@
+package cfg
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDot(t *testing.T) {
+	Convey("Dot", t, func() {
+		Convey("It prints blocks with their nodes and labeled edges", func() {
+			g := build(`
+fn f(n: u8) -> u8 {
+  var s: u8 = 0;
+  while n > 0 { s = s + n; n = n - 1; }
+  switch s { case 1, 2 { return 1; } default { } }
+  return s;
+  n = 0;
+}`)
+			So(g.Dot("f"), ShouldEqual, `digraph "f" {
+	node [shape=box, fontname=monospace];
+	b0 [label="0: entry\lvar s: u8 = 0\l"];
+	b1 [label="1: while.cond\ln > 0\l"];
+	b2 [label="2: while.body\ls = s + n\ln = n - 1\l"];
+	b3 [label="3: while.done\ls\l"];
+	b4 [label="4: switch.case\lreturn 1\l"];
+	b5 [label="5: switch.case\l"];
+	b6 [label="6: switch.done\lreturn s\l"];
+	b7 [label="7: unreachable\ln = 0\l", style=dashed];
+	b8 [label="8: exit\l"];
+	b0 -> b1;
+	b1 -> b2 [label="true"];
+	b1 -> b3 [label="false"];
+	b2 -> b1;
+	b3 -> b4 [label="1, 2"];
+	b3 -> b5 [label="default"];
+	b4 -> b8;
+	b5 -> b6;
+	b6 -> b8;
+	b7 -> b8;
+}
+`)
+		})
+
+		Convey("It escapes quotes", func() {
+			So(quote(`say "hi"`), ShouldEqual, `"say \"hi\""`)
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package diag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Severity is how bad a diagnostic is.
+type Severity int
+
+const (
+	// Error is a problem that stops the program from being compiled.
+	Error Severity = iota
+
+	// Warning is likely a mistake, but doesn't stop compiling.
+	Warning
+)
+
+// Diagnostic is a message about a span of source. File is the name of the
+// file the span is in; it's empty when there's only one.
+type Diagnostic struct {
+	File     string
+	Span     token.Span
+	Severity Severity
+	Message  string
+}
+
+func (d *Diagnostic) Error() string {
+	msg := d.Message
+	if d.Severity == Warning {
+		msg = "warning: " + msg
+	}
+
+	if d.File != "" {
+		return fmt.Sprintf("%s:%s: %s", d.File, d.Span, msg)
+	}
+	return fmt.Sprintf("%s: %s", d.Span, msg)
+}
+
+// List is a list of diagnostics in the order they were reported.
+type List []*Diagnostic
+
+// Add appends a diagnostic at given span to the list.
+func (l *List) Add(span token.Span, format string, args ...interface{}) {
+	*l = append(*l, &Diagnostic{Span: span, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warn appends a warning at given span to the list.
+func (l *List) Warn(span token.Span, format string, args ...interface{}) {
+	*l = append(*l, &Diagnostic{
+		Span:     span,
+		Severity: Warning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// HasErrors returns if any diagnostic in the list is an error.
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFile sets file of diagnostics in the list that don't have one.
+func (l List) SetFile(name string) {
+	for _, d := range l {
+		if d.File == "" {
+			d.File = name
+		}
+	}
+}
+
+// Err returns the list as an error, or nil if it has no errors, ie it's empty
+// or only has warnings.
+func (l List) Err() error {
+	if !l.HasErrors() {
+		return nil
+	}
+	return l
+}
+
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
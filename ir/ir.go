@@ -0,0 +1,377 @@
+package ir
+
+import (
+	"fmt"
+	"math"
+)
+
+// The IR is in SSA form: every value is assigned once, by the instruction
+// that computes it, and where control flow joins, phi instructions choose
+// between values of the blocks it comes from. Values are scalars of explicit
+// width; arrays and structs live in memory, in globals or stack slots, and
+// are reached through pointers.
+//
+// Locals that are scalars are values, since nothing can take their address.
+// Globals are loaded and stored every time they're used, and loads and
+// stores of volatile globals and registers are marked volatile: passes must
+// keep every one of them, in order.
+
+// Type is the type of a value. Integers carry no sign: operations that
+// depend on it, like division and comparisons, come in signed and unsigned
+// variants.
+type Type int
+
+const (
+	// Void is the type of instructions that have no value, eg stores.
+	Void Type = iota
+
+	I1
+	I8
+	I16
+	I32
+
+	// I64 is only used in between, eg for products of 32-bit fixed-point
+	// values.
+	I64
+
+	F32
+
+	// Ptr is a data space address; the ATmega328's are 16 bits.
+	Ptr
+)
+
+var typeNames = map[Type]string{
+	Void: "void",
+	I1:   "i1",
+	I8:   "i8",
+	I16:  "i16",
+	I32:  "i32",
+	I64:  "i64",
+	F32:  "f32",
+	Ptr:  "ptr",
+}
+
+func (t Type) String() string { return typeNames[t] }
+
+// Bits returns width of a value of the type.
+func (t Type) Bits() int {
+	switch t {
+	case I1:
+		return 1
+	case I8:
+		return 8
+	case I16, Ptr:
+		return 16
+	case I32, F32:
+		return 32
+	case I64:
+		return 64
+	}
+	return 0
+}
+
+// Size returns bytes a value of the type takes in memory; an i1 takes a
+// byte.
+func (t Type) Size() int {
+	return (t.Bits() + 7) / 8
+}
+
+// IsInt returns if t is an integer type.
+func (t Type) IsInt() bool {
+	return t >= I1 && t <= I64
+}
+
+// IntType returns integer type of given size in bytes.
+func IntType(size int) Type {
+	switch size {
+	case 1:
+		return I8
+	case 2:
+		return I16
+	case 4:
+		return I32
+	case 8:
+		return I64
+	}
+	panic(fmt.Sprintf("ir: no integer type of %d bytes", size))
+}
+
+// Value is an operand of an instruction: a constant, a parameter, a global
+// or the result of an instruction.
+type Value interface {
+	Type() Type
+
+	// Ref returns how the value is written as an operand.
+	Ref() string
+}
+
+// Const is a constant. Integers are sign-extended from their width, so each
+// value has one representation; f32s are rounded to float32.
+type Const struct {
+	Typ   Type
+	Int   int64
+	Float float64
+}
+
+// IntConst returns integer constant of given type with value v, truncated to
+// the type's width.
+func IntConst(typ Type, v int64) *Const {
+	if typ == I1 {
+		return &Const{Typ: typ, Int: v & 1}
+	}
+	if bits := uint(typ.Bits()); bits < 64 {
+		v = v << (64 - bits) >> (64 - bits)
+	}
+	return &Const{Typ: typ, Int: v}
+}
+
+// FloatConst returns f32 constant v.
+func FloatConst(v float64) *Const {
+	return &Const{Typ: F32, Float: float64(float32(v))}
+}
+
+func (c *Const) Type() Type { return c.Typ }
+
+func (c *Const) Ref() string {
+	switch c.Typ {
+	case I1:
+		if c.Int != 0 {
+			return "true"
+		}
+		return "false"
+	case F32:
+		return formatFloat(c.Float)
+	}
+	return fmt.Sprint(c.Int)
+}
+
+// formatFloat formats v so it reads back as the same value, and can't be
+// taken for an integer.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	case math.IsNaN(v):
+		return "nan"
+	}
+
+	s := fmt.Sprint(v)
+	for _, r := range s {
+		if r == '.' || r == 'e' {
+			return s
+		}
+	}
+	return s + ".0"
+}
+
+// Undef is a value that's never defined, eg of a local read in code no path
+// reaches.
+type Undef struct {
+	Typ Type
+}
+
+func (u *Undef) Type() Type  { return u.Typ }
+func (u *Undef) Ref() string { return "undef" }
+
+// Param is a parameter of a function.
+type Param struct {
+	Name string
+	Typ  Type
+}
+
+func (p *Param) Type() Type  { return p.Typ }
+func (p *Param) Ref() string { return "%" + p.Name }
+
+// Global is a global variable, a value of its address.
+type Global struct {
+	Name string
+
+	// Size is in bytes. Init is its initial value, or nil if it's all
+	// zeros, in which case it goes in .bss.
+	Size int
+	Init []byte
+
+	// Volatile is if loads and stores of it are volatile.
+	Volatile bool
+}
+
+func (g *Global) Type() Type  { return Ptr }
+func (g *Global) Ref() string { return "@" + g.Name }
+
+// Instr is an instruction. What its operands and fields mean depends on its
+// Op; see the Op constants.
+type Instr struct {
+	Op Op
+
+	// Typ is type of its value, or Void if it has none.
+	Typ  Type
+	Args []Value
+
+	// ID numbers values of a function, for Ref.
+	ID    int
+	Block *Block
+
+	// Volatile is for loads and stores.
+	Volatile bool
+
+	// Size is bytes of alloca and copy.
+	Size int
+
+	// Callee is name of the function call calls.
+	Callee string
+
+	// Cases are values of a switch, one per successor of its block after
+	// the default one.
+	Cases []int64
+}
+
+func (i *Instr) Type() Type  { return i.Typ }
+func (i *Instr) Ref() string { return fmt.Sprintf("%%%d", i.ID) }
+
+// Block is a basic block: its instructions run one after the other, ending
+// with a terminator that goes to one of Succs. Phis come first, with an
+// operand for each of Preds, in order.
+type Block struct {
+	Index  int
+	Instrs []*Instr
+
+	Succs []*Block
+	Preds []*Block
+
+	Func *Func
+}
+
+// Name returns label of the block.
+func (b *Block) Name() string {
+	return fmt.Sprintf("b%d", b.Index)
+}
+
+// Terminator returns the last instruction of b if it's a terminator, or nil.
+func (b *Block) Terminator() *Instr {
+	if len(b.Instrs) == 0 {
+		return nil
+	}
+	if last := b.Instrs[len(b.Instrs)-1]; last.Op.IsTerminator() {
+		return last
+	}
+	return nil
+}
+
+// Func is a function. Its first block is where it starts.
+type Func struct {
+	Name   string
+	Params []*Param
+
+	// Result is type of what it returns, or Void. Functions returning an
+	// array or struct take where to put it as their first parameter, see
+	// ResultParam, and return nothing.
+	Result Type
+
+	// Interrupt is the vector the function handles, if it's an interrupt
+	// handler.
+	Interrupt string
+
+	Blocks []*Block
+
+	nextID int
+}
+
+// ResultParam is the name of the parameter a function returning an array or
+// struct takes, for where to put it.
+const ResultParam = ".ret"
+
+// NewBlock adds an empty block to f.
+func (f *Func) NewBlock() *Block {
+	b := &Block{Index: len(f.Blocks), Func: f}
+	f.Blocks = append(f.Blocks, b)
+	return b
+}
+
+// Renumber numbers blocks and values of f in order, and puts preds of each
+// block in the order of their blocks, reordering operands of phis to match.
+func (f *Func) Renumber() {
+	id := 0
+	for i, b := range f.Blocks {
+		b.Index = i
+		for _, instr := range b.Instrs {
+			if instr.Typ != Void {
+				instr.ID = id
+				id++
+			}
+		}
+	}
+	f.nextID = id
+
+	for _, b := range f.Blocks {
+		phiArgs := map[*Instr]map[*Block]Value{}
+		for _, phi := range b.Phis() {
+			phiArgs[phi] = map[*Block]Value{}
+			for i, pred := range b.Preds {
+				phiArgs[phi][pred] = phi.Args[i]
+			}
+		}
+
+		b.Preds = nil
+		for _, from := range f.Blocks {
+			for _, succ := range from.Succs {
+				if succ == b && !containsBlock(b.Preds, from) {
+					b.Preds = append(b.Preds, from)
+				}
+			}
+		}
+
+		for phi, args := range phiArgs {
+			phi.Args = phi.Args[:0]
+			for _, pred := range b.Preds {
+				phi.Args = append(phi.Args, args[pred])
+			}
+		}
+	}
+}
+
+// Phis returns the phis at the start of b.
+func (b *Block) Phis() []*Instr {
+	for i, instr := range b.Instrs {
+		if instr.Op != OpPhi {
+			return b.Instrs[:i]
+		}
+	}
+	return b.Instrs
+}
+
+func containsBlock(blocks []*Block, b *Block) bool {
+	for _, x := range blocks {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Module is the IR of a file: its globals and functions.
+type Module struct {
+	Globals []*Global
+	Funcs   []*Func
+}
+
+// Func returns function with given name, or nil if there's none.
+func (m *Module) Func(name string) *Func {
+	for _, f := range m.Funcs {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Global returns global with given name, or nil if there's none.
+func (m *Module) Global(name string) *Global {
+	for _, g := range m.Globals {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1322 @@
+package ir
+
+import (
+	"math"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/layout"
+	"github.com/sent-hil/bitlang/sema"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Lower builds the IR of a file checked without errors. Calls of functions
+// of imported modules can't be lowered yet, since their types aren't known
+// to checks of the file, and neither can globals whose values aren't
+// constant, since there's no startup code to compute them.
+func Lower(file *ast.File, info *sema.Info) (*Module, diag.List) {
+	l := &lowerer{
+		info:    info,
+		layouts: info.Layouts,
+		m:       &Module{},
+		globals: map[*sema.Object]*Global{},
+	}
+
+	for _, decl := range file.Decls {
+		if v, ok := decl.(*ast.VarDecl); ok {
+			l.global(v)
+		}
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			l.m.Funcs = append(l.m.Funcs, l.fn(fn))
+		}
+	}
+
+	return l.m, l.diags
+}
+
+type lowerer struct {
+	info    *sema.Info
+	layouts layout.Layouts
+	m       *Module
+	diags   diag.List
+
+	globals map[*sema.Object]*Global
+}
+
+// typeOf returns IR type of values of type t, or Void if they're arrays or
+// structs, which are kept in memory. Enums are u8s, and fixed-point values
+// integers of their size.
+func (l *lowerer) typeOf(t sema.Type) Type {
+	switch t := t.(type) {
+	case *sema.Basic:
+		switch t.Kind {
+		case sema.Bool:
+			return I1
+		case sema.F32:
+			return F32
+		case sema.UntypedInt:
+			return l.typeOf(sema.DefaultInt)
+		case sema.Invalid:
+			return Void
+		}
+		return IntType(t.Size)
+	case *sema.Fixed:
+		return IntType(t.Size())
+	case *sema.Enum:
+		return I8
+	}
+
+	return Void
+}
+
+// size returns bytes a value of type t takes in memory.
+func (l *lowerer) size(t sema.Type) int {
+	switch t := t.(type) {
+	case *sema.Array:
+		return int(t.Len) * l.size(t.Elem)
+	case *sema.Struct:
+		if s := l.layouts[t.Name]; s != nil {
+			return s.Size
+		}
+		return 0
+	}
+
+	return l.typeOf(t).Size()
+}
+
+func isAggregate(t sema.Type) bool {
+	switch t.(type) {
+	case *sema.Array, *sema.Struct:
+		return true
+	}
+	return false
+}
+
+// isSigned returns if values of numeric type t are signed.
+func isSigned(t sema.Type) bool {
+	switch t := t.(type) {
+	case *sema.Basic:
+		return t.Signed
+	case *sema.Fixed:
+		return true
+	}
+	return false
+}
+
+func isF32(t sema.Type) bool {
+	b, ok := t.(*sema.Basic)
+	return ok && b.Kind == sema.F32
+}
+
+// constant returns value of constant expression x as a value of type to,
+// and if x is constant.
+func (l *lowerer) constant(x ast.Expr, to sema.Type) (*Const, bool) {
+	typ := l.typeOf(to)
+	if typ == Void {
+		return nil, false
+	}
+	if _, ok := to.(*sema.Enum); ok {
+		to = sema.Typ[sema.U8]
+	}
+
+	if f, ok := l.info.Floats[x]; ok {
+		switch {
+		case isF32(to):
+			return FloatConst(f), true
+		case typ.IsInt():
+			if to, ok := to.(*sema.Fixed); ok {
+				raw, _ := to.Raw(f)
+				return IntConst(typ, raw), true
+			}
+			return IntConst(typ, int64(f)), true
+		}
+	}
+
+	v, ok := l.info.Values[x]
+	if !ok {
+		return nil, false
+	}
+
+	from, fromFixed := l.info.Types[x].(*sema.Fixed)
+	tf, toFixed := to.(*sema.Fixed)
+	switch {
+	case fromFixed && isF32(to):
+		return FloatConst(math.Ldexp(float64(v), -from.Frac)), true
+	case isF32(to):
+		return FloatConst(float64(v)), true
+	case fromFixed && toFixed:
+		v = shiftConst(v, tf.Frac-from.Frac)
+	case fromFixed:
+		v >>= uint(from.Frac)
+	case toFixed:
+		v <<= uint(tf.Frac)
+	}
+	return IntConst(typ, v), true
+}
+
+func shiftConst(v int64, n int) int64 {
+	if n < 0 {
+		return v >> uint(-n)
+	}
+	return v << uint(n)
+}
+
+// global adds global of given declaration to the module.
+func (l *lowerer) global(decl *ast.VarDecl) {
+	obj := l.info.Defs[decl.Name]
+	if obj == nil {
+		return
+	}
+
+	g := &Global{Name: decl.Name.Name, Size: l.size(obj.Type), Volatile: l.info.Volatile[obj]}
+	if decl.Value != nil {
+		init, ok := l.bytes(decl.Value, obj.Type)
+		if !ok {
+			l.diags.Add(decl.Value.Span(), "cannot lower value of global %s, it's not constant", decl.Name.Name)
+		}
+		for _, b := range init {
+			if b != 0 {
+				g.Init = init
+				break
+			}
+		}
+	}
+
+	l.globals[obj] = g
+	l.m.Globals = append(l.m.Globals, g)
+}
+
+// bytes returns constant x of type typ as it's stored in memory, least
+// significant byte first, and if it's constant.
+func (l *lowerer) bytes(x ast.Expr, typ sema.Type) ([]byte, bool) {
+	if lit, ok := unparen(x).(*ast.ArrayLit); ok {
+		var bytes []byte
+		for _, elem := range lit.Elems {
+			b, ok := l.bytes(elem, typ.(*sema.Array).Elem)
+			if !ok {
+				return nil, false
+			}
+			bytes = append(bytes, b...)
+		}
+		return bytes, true
+	}
+
+	c, ok := l.constant(x, typ)
+	if !ok {
+		return nil, false
+	}
+	bits := uint64(c.Int)
+	if c.Typ == F32 {
+		bits = uint64(math.Float32bits(float32(c.Float)))
+	}
+	bytes := make([]byte, c.Typ.Size())
+	for i := range bytes {
+		bytes[i] = byte(bits >> (8 * uint(i)))
+	}
+	return bytes, true
+}
+
+func unparen(x ast.Expr) ast.Expr {
+	for {
+		paren, ok := x.(*ast.ParenExpr)
+		if !ok {
+			return x
+		}
+		x = paren.X
+	}
+}
+
+// fn lowers a function.
+func (l *lowerer) fn(decl *ast.FuncDecl) *Func {
+	sig := l.info.Defs[decl.Name].Type.(*sema.Func)
+	b := &builder{
+		lowerer:    l,
+		sig:        sig,
+		fn:         &Func{Name: decl.Name.Name, Interrupt: l.info.Interrupts[decl]},
+		defs:       map[*sema.Object]map[*Block]Value{},
+		sealed:     map[*Block]bool{},
+		incomplete: map[*Block][]pendingPhi{},
+		slots:      map[*sema.Object]Value{},
+	}
+	entry := b.newBlock()
+	b.seal(entry)
+	b.cur = entry
+
+	if sig.Result != nil {
+		b.fn.Result = l.typeOf(sig.Result)
+		if isAggregate(sig.Result) {
+			b.result = &Param{Name: ResultParam, Typ: Ptr}
+			b.fn.Params = append(b.fn.Params, b.result)
+		}
+	}
+	for _, p := range decl.Params {
+		obj := l.info.Defs[p.Name]
+		param := &Param{Name: p.Name.Name, Typ: l.typeOf(obj.Type)}
+		if isAggregate(obj.Type) {
+			// arguments are copies the caller makes
+			param.Typ = Ptr
+			b.slots[obj] = param
+		} else {
+			b.write(obj, entry, param)
+		}
+		b.fn.Params = append(b.fn.Params, param)
+	}
+
+	b.stmts(decl.Body.Stmts)
+	if b.fn.Result == Void {
+		b.emit(OpReturn, Void)
+	} else {
+		// checks made sure every path returns
+		b.emit(OpUnreachable, Void)
+	}
+
+	b.finish()
+	return b.fn
+}
+
+// builder builds the IR of a function, turning locals that are scalars into
+// values as it goes, as in Braun et al.'s "Simple and Efficient Construction
+// of Static Single Assignment Form". A local read in a block that didn't
+// assign it is looked up in its preds, through a phi if there's more than
+// one. Blocks whose preds aren't all known yet, like heads of loops, aren't
+// sealed: their phis get operands once they are.
+type builder struct {
+	*lowerer
+
+	fn  *Func
+	sig *sema.Func
+
+	// cur is the block being added to.
+	cur *Block
+
+	// defs are values locals have at the end of blocks that assigned or
+	// read them.
+	defs       map[*sema.Object]map[*Block]Value
+	sealed     map[*Block]bool
+	incomplete map[*Block][]pendingPhi
+
+	// slots are addresses of locals and parameters that are arrays or
+	// structs.
+	slots map[*sema.Object]Value
+
+	// result is where a function returning an array or struct puts it.
+	result *Param
+
+	// loops are enclosing loops, innermost last.
+	loops []*loop
+
+	// atomics are values of OpIntSave of enclosing atomic blocks, innermost
+	// last.
+	atomics []Value
+}
+
+// pendingPhi is a phi of a block that isn't sealed, for local obj.
+type pendingPhi struct {
+	obj *sema.Object
+	phi *Instr
+}
+
+// loop is an enclosing loop, with where break and continue go.
+type loop struct {
+	label     *ast.Ident
+	breakTo   *Block
+	continues *Block
+}
+
+func (b *builder) newBlock() *Block {
+	return b.fn.NewBlock()
+}
+
+// emit adds an instruction to the current block.
+func (b *builder) emit(op Op, typ Type, args ...Value) *Instr {
+	i := &Instr{Op: op, Typ: typ, Args: args, Block: b.cur}
+	b.cur.Instrs = append(b.cur.Instrs, i)
+	return i
+}
+
+// link adds an edge from block from to block to.
+func link(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	if !containsBlock(to.Preds, from) {
+		to.Preds = append(to.Preds, from)
+	}
+}
+
+func (b *builder) jump(to *Block) {
+	b.emit(OpJump, Void)
+	link(b.cur, to)
+}
+
+func (b *builder) branch(cond Value, then, els *Block) {
+	b.emit(OpBranch, Void, cond)
+	link(b.cur, then)
+	link(b.cur, els)
+}
+
+// dead starts a block no path reaches, for code after a return, break or
+// continue.
+func (b *builder) dead() {
+	b.cur = b.newBlock()
+	b.seal(b.cur)
+}
+
+// write records v as value of local obj at the end of block.
+func (b *builder) write(obj *sema.Object, block *Block, v Value) {
+	if b.defs[obj] == nil {
+		b.defs[obj] = map[*Block]Value{}
+	}
+	b.defs[obj][block] = v
+}
+
+// read returns value of local obj at the end of block.
+func (b *builder) read(obj *sema.Object, block *Block) Value {
+	if v, ok := b.defs[obj][block]; ok {
+		return v
+	}
+
+	typ := b.typeOf(obj.Type)
+	var v Value
+	switch {
+	case !b.sealed[block]:
+		phi := b.newPhi(block, typ)
+		b.incomplete[block] = append(b.incomplete[block], pendingPhi{obj, phi})
+		v = phi
+	case len(block.Preds) == 0:
+		// checks made sure locals are assigned before they're read, so
+		// this is code no path reaches
+		v = &Undef{Typ: typ}
+	case len(block.Preds) == 1:
+		v = b.read(obj, block.Preds[0])
+	default:
+		phi := b.newPhi(block, typ)
+		// recorded first, so loops end at it
+		b.write(obj, block, phi)
+		b.phiArgs(obj, phi)
+		v = phi
+	}
+
+	b.write(obj, block, v)
+	return v
+}
+
+func (b *builder) newPhi(block *Block, typ Type) *Instr {
+	phi := &Instr{Op: OpPhi, Typ: typ, Block: block}
+	n := len(block.Phis())
+	block.Instrs = append(block.Instrs, nil)
+	copy(block.Instrs[n+1:], block.Instrs[n:])
+	block.Instrs[n] = phi
+	return phi
+}
+
+// phiArgs adds operands to phi of local obj, its values at the end of each
+// pred.
+func (b *builder) phiArgs(obj *sema.Object, phi *Instr) {
+	for _, pred := range phi.Block.Preds {
+		phi.Args = append(phi.Args, b.read(obj, pred))
+	}
+}
+
+// seal records all preds of block are known, giving its phis operands.
+func (b *builder) seal(block *Block) {
+	for _, p := range b.incomplete[block] {
+		b.phiArgs(p.obj, p.phi)
+	}
+	delete(b.incomplete, block)
+	b.sealed[block] = true
+}
+
+// alloca returns a new stack slot of given size. Slots are in the entry
+// block, so loops don't grow the stack.
+func (b *builder) alloca(size int) *Instr {
+	entry := b.fn.Blocks[0]
+	i := &Instr{Op: OpAlloca, Typ: Ptr, Size: size, Block: entry}
+
+	n := 0
+	for n < len(entry.Instrs) && entry.Instrs[n].Op == OpAlloca {
+		n++
+	}
+	entry.Instrs = append(entry.Instrs, nil)
+	copy(entry.Instrs[n+1:], entry.Instrs[n:])
+	entry.Instrs[n] = i
+	return i
+}
+
+// finish drops blocks no path reaches and phis that aren't needed, and
+// numbers what's left.
+func (b *builder) finish() {
+	f := b.fn
+	for _, block := range f.Blocks {
+		if !b.sealed[block] {
+			b.seal(block)
+		}
+	}
+
+	order := postorder(f)
+	f.Blocks = f.Blocks[:0]
+	for n := len(order) - 1; n >= 0; n-- {
+		f.Blocks = append(f.Blocks, order[n])
+	}
+	f.Renumber()
+
+	simplifyPhis(f)
+	f.Renumber()
+}
+
+// simplifyPhis replaces phis that choose between one value and themselves
+// by the value, and drops phis whose values aren't used.
+func simplifyPhis(f *Func) {
+	for {
+		phi, same := trivialPhi(f)
+		if phi == nil {
+			break
+		}
+		replaceUses(f, phi, same)
+		removeInstr(phi)
+	}
+
+	// phis used by other instructions, directly or through other phis
+	used := map[*Instr]bool{}
+	var use func(v Value)
+	use = func(v Value) {
+		phi, ok := v.(*Instr)
+		if !ok || phi.Op != OpPhi || used[phi] {
+			return
+		}
+		used[phi] = true
+		for _, arg := range phi.Args {
+			use(arg)
+		}
+	}
+	for _, block := range f.Blocks {
+		for _, instr := range block.Instrs[len(block.Phis()):] {
+			for _, arg := range instr.Args {
+				use(arg)
+			}
+		}
+	}
+	for _, block := range f.Blocks {
+		for _, phi := range block.Phis() {
+			if !used[phi] {
+				removeInstr(phi)
+			}
+		}
+	}
+}
+
+// trivialPhi returns a phi of f that only chooses between itself and one
+// other value, with that value, which is undefined if there's none.
+func trivialPhi(f *Func) (*Instr, Value) {
+	for _, block := range f.Blocks {
+	phis:
+		for _, phi := range block.Phis() {
+			var same Value
+			for _, arg := range phi.Args {
+				if arg == phi || same != nil && sameValue(arg, same) {
+					continue
+				}
+				if same != nil {
+					continue phis
+				}
+				same = arg
+			}
+			if same == nil {
+				same = &Undef{Typ: phi.Typ}
+			}
+			return phi, same
+		}
+	}
+
+	return nil, nil
+}
+
+func sameValue(a, b Value) bool {
+	if a == b {
+		return true
+	}
+	ca, ok1 := a.(*Const)
+	cb, ok2 := b.(*Const)
+	return ok1 && ok2 && *ca == *cb
+}
+
+// replaceUses makes instructions of f that use old use v instead.
+func replaceUses(f *Func, old, v Value) {
+	for _, block := range f.Blocks {
+		for _, instr := range block.Instrs {
+			for n, arg := range instr.Args {
+				if arg == old {
+					instr.Args[n] = v
+				}
+			}
+		}
+	}
+}
+
+// removeInstr removes i from its block.
+func removeInstr(i *Instr) {
+	instrs := i.Block.Instrs
+	for n, x := range instrs {
+		if x == i {
+			i.Block.Instrs = append(instrs[:n:n], instrs[n+1:]...)
+			return
+		}
+	}
+}
+
+func (b *builder) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		b.stmt(stmt, nil)
+	}
+}
+
+// stmt lowers given statement; label is the label of it if it's a loop.
+func (b *builder) stmt(stmt ast.Stmt, label *ast.Ident) {
+	switch stmt := stmt.(type) {
+	case *ast.VarDecl:
+		b.varDecl(stmt)
+	case *ast.ConstDecl:
+		// constants are folded where they're used
+	case *ast.AssignStmt:
+		b.assign(stmt.Target, stmt.Value)
+	case *ast.ExprStmt:
+		b.value(stmt.X)
+	case *ast.BlockStmt:
+		b.stmts(stmt.Stmts)
+	case *ast.AtomicStmt:
+		saved := b.emit(OpIntSave, I8)
+		b.atomics = append(b.atomics, saved)
+		b.stmts(stmt.Body.Stmts)
+		b.atomics = b.atomics[:len(b.atomics)-1]
+		b.emit(OpIntRestore, Void, saved)
+	case *ast.LabeledStmt:
+		b.stmt(stmt.Stmt, stmt.Label)
+	case *ast.IfStmt:
+		b.ifStmt(stmt)
+	case *ast.SwitchStmt:
+		b.switchStmt(stmt)
+	case *ast.ForStmt:
+		if stmt.Init != nil {
+			b.stmt(stmt.Init, nil)
+		}
+		b.loop(label, stmt.Cond, stmt.Body, stmt.Post)
+	case *ast.WhileStmt:
+		b.loop(label, stmt.Cond, stmt.Body, nil)
+	case *ast.LoopStmt:
+		b.loop(label, nil, stmt.Body, nil)
+	case *ast.ReturnStmt:
+		b.returnStmt(stmt)
+	case *ast.BranchStmt:
+		b.branchStmt(stmt)
+	}
+}
+
+func (b *builder) varDecl(decl *ast.VarDecl) {
+	obj := b.info.Defs[decl.Name]
+	if isAggregate(obj.Type) {
+		slot := b.alloca(b.size(obj.Type))
+		b.slots[obj] = slot
+		if decl.Value != nil {
+			b.store(slot, decl.Value, obj.Type, false)
+		}
+		return
+	}
+
+	if decl.Value != nil {
+		b.write(obj, b.cur, b.valueAs(decl.Value, obj.Type))
+	}
+}
+
+// assign lowers an assignment of x to target.
+func (b *builder) assign(target, x ast.Expr) {
+	typ := b.info.Types[target]
+	target = unparen(target)
+
+	if acc := b.info.Accesses[target]; acc != nil {
+		if acc.Bit != nil {
+			b.writeBit(acc, x)
+			return
+		}
+		b.emit(OpStore, Void, regAddr(acc), b.valueAs(x, typ)).Volatile = true
+		return
+	}
+
+	if id, ok := target.(*ast.Ident); ok && !isAggregate(typ) {
+		obj := b.info.Uses[id]
+		if g := b.globals[obj]; g != nil {
+			b.emit(OpStore, Void, g, b.valueAs(x, typ)).Volatile = g.Volatile
+		} else {
+			b.write(obj, b.cur, b.valueAs(x, typ))
+		}
+		return
+	}
+
+	addr, volatile := b.addr(target)
+	b.store(addr, x, typ, volatile)
+}
+
+// store stores x as a value of type typ at addr.
+func (b *builder) store(addr Value, x ast.Expr, typ sema.Type, volatile bool) {
+	if lit, ok := unparen(x).(*ast.ArrayLit); ok {
+		elem := typ.(*sema.Array).Elem
+		for n, e := range lit.Elems {
+			b.store(b.offset(addr, n*b.size(elem)), e, elem, volatile)
+		}
+		return
+	}
+
+	if isAggregate(typ) {
+		b.emit(OpCopy, Void, addr, b.value(x)).Size = b.size(typ)
+		return
+	}
+	b.emit(OpStore, Void, addr, b.valueAs(x, typ)).Volatile = volatile
+}
+
+func regAddr(acc *sema.Access) *Const {
+	return IntConst(Ptr, acc.Reg.Addr)
+}
+
+// readBit reads a bit of a register, as an i1.
+func (b *builder) readBit(acc *sema.Access) Value {
+	reg := b.emit(OpLoad, I8, regAddr(acc))
+	reg.Volatile = true
+	masked := b.emit(OpAnd, I8, reg, IntConst(I8, 1<<uint(acc.Bit.Bit)))
+	return b.emit(OpNe, I1, masked, IntConst(I8, 0))
+}
+
+// writeBit sets a bit of a register to x, reading the register and writing
+// it back.
+func (b *builder) writeBit(acc *sema.Access, x ast.Expr) {
+	v := b.valueAs(x, sema.Typ[sema.Bool])
+	mask := int64(1) << uint(acc.Bit.Bit)
+
+	reg := b.emit(OpLoad, I8, regAddr(acc))
+	reg.Volatile = true
+	var set Value
+	switch {
+	case isConst(v, 1):
+		set = b.emit(OpOr, I8, reg, IntConst(I8, mask))
+	case isConst(v, 0):
+		set = b.emit(OpAnd, I8, reg, IntConst(I8, ^mask))
+	default:
+		cleared := b.emit(OpAnd, I8, reg, IntConst(I8, ^mask))
+		var bit Value = b.emit(OpZExt, I8, v)
+		if acc.Bit.Bit > 0 {
+			bit = b.emit(OpShl, I8, bit, IntConst(I8, acc.Bit.Bit))
+		}
+		set = b.emit(OpOr, I8, cleared, bit)
+	}
+	b.emit(OpStore, Void, regAddr(acc), set).Volatile = true
+}
+
+func isConst(v Value, n int64) bool {
+	c, ok := v.(*Const)
+	return ok && c.Typ.IsInt() && c.Int == n
+}
+
+func (b *builder) ifStmt(stmt *ast.IfStmt) {
+	cond := b.value(stmt.Cond)
+	then, done := b.newBlock(), b.newBlock()
+	els := done
+	if stmt.Else != nil {
+		els = b.newBlock()
+	}
+	b.branch(cond, then, els)
+	b.seal(then)
+
+	b.cur = then
+	b.stmts(stmt.Then.Stmts)
+	b.jump(done)
+
+	if stmt.Else != nil {
+		b.seal(els)
+		b.cur = els
+		b.stmt(stmt.Else, nil)
+		b.jump(done)
+	}
+
+	b.seal(done)
+	b.cur = done
+}
+
+func (b *builder) switchStmt(stmt *ast.SwitchStmt) {
+	tag := b.value(stmt.Tag)
+	sw := b.info.Switches[stmt]
+
+	cases := make([]*Block, len(stmt.Cases))
+	for n := range cases {
+		cases[n] = b.newBlock()
+	}
+	done := b.newBlock()
+
+	dflt := done
+	if sw.Default >= 0 {
+		dflt = cases[sw.Default]
+	}
+	i := b.emit(OpSwitch, Void, tag)
+	link(b.cur, dflt)
+	for n, values := range sw.Values {
+		for _, v := range values {
+			i.Cases = append(i.Cases, IntConst(tag.Type(), v).Int)
+			link(b.cur, cases[n])
+		}
+	}
+
+	for n, clause := range stmt.Cases {
+		b.seal(cases[n])
+		b.cur = cases[n]
+		b.stmts(clause.Body.Stmts)
+		b.jump(done)
+	}
+
+	b.seal(done)
+	b.cur = done
+}
+
+// loop lowers a loop that runs body while cond is true, running post after
+// body and continues. Loops without a cond, or with a constant true one,
+// only end with a break.
+func (b *builder) loop(label *ast.Ident, cond ast.Expr, body *ast.BlockStmt, post ast.Stmt) {
+	head := b.newBlock()
+	b.jump(head)
+	b.cur = head
+
+	done := b.newBlock()
+	next := head
+	if post != nil {
+		next = b.newBlock()
+	}
+
+	if cond != nil && !b.info.IsTrue(cond) {
+		start := b.newBlock()
+		b.branch(b.value(cond), start, done)
+		b.seal(start)
+		b.cur = start
+	}
+
+	b.loops = append(b.loops, &loop{label: label, breakTo: done, continues: next})
+	b.stmts(body.Stmts)
+	b.jump(next)
+	b.loops = b.loops[:len(b.loops)-1]
+
+	if post != nil {
+		b.seal(next)
+		b.cur = next
+		b.stmt(post, nil)
+		b.jump(head)
+	}
+
+	b.seal(head)
+	b.seal(done)
+	b.cur = done
+}
+
+func (b *builder) returnStmt(stmt *ast.ReturnStmt) {
+	var v Value
+	if stmt.Value != nil {
+		if b.result != nil {
+			b.store(b.result, stmt.Value, b.sig.Result, false)
+		} else {
+			v = b.valueAs(stmt.Value, b.sig.Result)
+		}
+	}
+
+	b.leaveAtomics(stmt)
+	if v != nil {
+		b.emit(OpReturn, Void, v)
+	} else {
+		b.emit(OpReturn, Void)
+	}
+	b.dead()
+}
+
+func (b *builder) branchStmt(stmt *ast.BranchStmt) {
+	var target *loop
+	for n := len(b.loops) - 1; n >= 0; n-- {
+		l := b.loops[n]
+		if stmt.Label == nil || l.label != nil && l.label.Name == stmt.Label.Name {
+			target = l
+			break
+		}
+	}
+
+	b.leaveAtomics(stmt)
+	if stmt.Tok == token.CONTINUE {
+		b.jump(target.continues)
+	} else {
+		b.jump(target.breakTo)
+	}
+	b.dead()
+}
+
+// leaveAtomics restores interrupts as they were before the outermost atomic
+// block stmt leaves, if it leaves any.
+func (b *builder) leaveAtomics(stmt ast.Stmt) {
+	if n := b.info.AtomicExits[stmt]; n > 0 {
+		b.emit(OpIntRestore, Void, b.atomics[len(b.atomics)-n])
+	}
+}
+
+// valueAs returns value of scalar expression x as a value of type to.
+func (b *builder) valueAs(x ast.Expr, to sema.Type) Value {
+	if c, ok := b.constant(x, to); ok {
+		return c
+	}
+	return b.convert(b.value(x), b.info.Types[x], to)
+}
+
+// value returns value of expression x as a value of its type, or its
+// address if it's an array or struct.
+func (b *builder) value(x ast.Expr) Value {
+	typ := b.info.Types[x]
+	if c, ok := b.constant(x, typ); ok {
+		return c
+	}
+
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return b.value(x.X)
+	case *ast.Ident:
+		return b.ident(x)
+	case *ast.UnaryExpr:
+		return b.unary(x)
+	case *ast.BinaryExpr:
+		return b.binary(x)
+	case *ast.CallExpr:
+		return b.call(x)
+	case *ast.SelectorExpr:
+		if acc := b.info.Accesses[x]; acc != nil {
+			return b.readBit(acc)
+		}
+	}
+
+	addr, volatile := b.addr(x)
+	if isAggregate(typ) {
+		return addr
+	}
+	load := b.emit(OpLoad, b.typeOf(typ), addr)
+	load.Volatile = volatile
+	return load
+}
+
+func (b *builder) ident(id *ast.Ident) Value {
+	typ := b.info.Types[id]
+	if acc := b.info.Accesses[id]; acc != nil {
+		load := b.emit(OpLoad, I8, regAddr(acc))
+		load.Volatile = true
+		return load
+	}
+
+	obj := b.info.Uses[id]
+	if g := b.globals[obj]; g != nil {
+		if isAggregate(typ) {
+			return g
+		}
+		load := b.emit(OpLoad, b.typeOf(typ), g)
+		load.Volatile = g.Volatile
+		return load
+	}
+	if slot := b.slots[obj]; slot != nil {
+		return slot
+	}
+	return b.read(obj, b.cur)
+}
+
+// addr returns address of x, an array or struct, or an element or field of
+// one, and if it's in a volatile global.
+func (b *builder) addr(x ast.Expr) (Value, bool) {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return b.addr(x.X)
+	case *ast.Ident:
+		obj := b.info.Uses[x]
+		if g := b.globals[obj]; g != nil {
+			return g, g.Volatile
+		}
+		return b.slots[obj], false
+	case *ast.SelectorExpr:
+		base, volatile := b.addr(x.X)
+		s, ok := b.info.Types[x.X].(*sema.Struct)
+		if !ok {
+			b.diags.Add(x.Span(), "cannot lower %s, it's not a field of a struct", ast.ExprString(x))
+			return base, volatile
+		}
+		offset, ok := b.layouts.Offsetof(s.Name, x.Sel.Name)
+		if !ok {
+			b.diags.Add(x.Span(), "cannot lower %s, struct %s has no layout", ast.ExprString(x), s.Name)
+			return base, volatile
+		}
+		return b.offset(base, offset), volatile
+	case *ast.IndexExpr:
+		base, volatile := b.addr(x.X)
+		arr := b.info.Types[x.X].(*sema.Array)
+		index := b.index(x)
+		if c, ok := index.(*Const); ok {
+			return b.offset(base, int(c.Int)*b.size(arr.Elem)), volatile
+		}
+		if size := b.size(arr.Elem); size > 1 {
+			index = b.emit(OpMul, I16, index, IntConst(I16, int64(size)))
+		}
+		return b.emit(OpPtrAdd, Ptr, base, index), volatile
+	}
+
+	// calls of functions returning arrays or structs
+	return b.value(x), false
+}
+
+// offset returns addr plus n.
+func (b *builder) offset(addr Value, n int) Value {
+	if n == 0 {
+		return addr
+	}
+	return b.emit(OpPtrAdd, Ptr, addr, IntConst(I16, int64(n)))
+}
+
+// index returns index of x as an i16, checking it's in range first if it
+// has to be checked at runtime.
+func (b *builder) index(x *ast.IndexExpr) Value {
+	typ := b.info.Types[x.Index]
+	if c, ok := b.constant(x.Index, typ); ok {
+		return IntConst(I16, c.Int)
+	}
+
+	v := b.value(x.Index)
+	if v.Type().Bits() < 16 {
+		v = b.resize(v, I16, isSigned(typ))
+	}
+
+	if n, ok := b.info.BoundsChecks[x]; ok {
+		// negative indexes are out of range too, as unsigned numbers
+		inRange := b.emit(OpULt, I1, v, IntConst(v.Type(), n))
+		ok, fail := b.newBlock(), b.newBlock()
+		b.branch(inRange, ok, fail)
+		b.seal(ok)
+		b.seal(fail)
+
+		b.cur = fail
+		b.emit(OpCall, Void).Callee = b.info.PanicHandler
+		b.emit(OpUnreachable, Void)
+		b.cur = ok
+	}
+
+	return b.resize(v, I16, isSigned(typ))
+}
+
+func (b *builder) unary(x *ast.UnaryExpr) Value {
+	typ := b.info.Types[x]
+	v := b.valueAs(x.X, typ)
+
+	switch {
+	case x.Op == token.MINUS && isF32(typ):
+		return b.emit(OpFNeg, F32, v)
+	case x.Op == token.MINUS:
+		return b.emit(OpNeg, v.Type(), v)
+	}
+	return b.emit(OpNot, v.Type(), v)
+}
+
+func (b *builder) binary(x *ast.BinaryExpr) Value {
+	if x.Op == token.AND || x.Op == token.OR {
+		return b.logical(x)
+	}
+
+	xt, yt := b.info.Types[x.X], b.info.Types[x.Y]
+	if x.Op == token.LESS_LESS || x.Op == token.GREATER_GREATER {
+		v := b.valueAs(x.X, xt)
+		count := b.resize(b.valueAs(x.Y, yt), v.Type(), false)
+		op := OpShl
+		if x.Op == token.GREATER_GREATER {
+			op = OpLShr
+			if isSigned(xt) {
+				op = OpAShr
+			}
+		}
+		return b.emit(op, v.Type(), v, count)
+	}
+
+	// fixed-point values multiplied or divided by integers are scaled as
+	// integers
+	xf, xFixed := xt.(*sema.Fixed)
+	yf, yFixed := yt.(*sema.Fixed)
+	if xFixed && sema.IsInteger(yt) && (x.Op == token.STAR || x.Op == token.SLASH) {
+		return b.scale(x, x.X, x.Y, xf)
+	}
+	if yFixed && sema.IsInteger(xt) && x.Op == token.STAR {
+		return b.scale(x, x.Y, x.X, yf)
+	}
+
+	typ := operandType(xt, yt)
+	v, w := b.valueAs(x.X, typ), b.valueAs(x.Y, typ)
+	if f, ok := typ.(*sema.Fixed); ok && (x.Op == token.STAR || x.Op == token.SLASH) {
+		return b.fixedMulDiv(x.Op, v, w, f)
+	}
+	return b.emit(opOf(x.Op, typ), resultType(x.Op, v.Type()), v, w)
+}
+
+// operandType returns type both operands of a binary operation are used
+// as: the one the other widens to.
+func operandType(xt, yt sema.Type) sema.Type {
+	if xb, ok := xt.(*sema.Basic); ok {
+		if yb, ok := yt.(*sema.Basic); ok && sema.IsInteger(xb) && sema.IsInteger(yb) && sema.Widens(xb, yb) {
+			return yt
+		}
+	}
+	if xf, ok := xt.(*sema.Fixed); ok {
+		if yf, ok := yt.(*sema.Fixed); ok && xf.Widens(yf) {
+			return yt
+		}
+	}
+	return xt
+}
+
+func resultType(op token.TokenID, typ Type) Type {
+	switch op {
+	case token.EQUAL_EQUAL, token.BANG_EQUAL, token.LESS, token.LESS_EQUAL, token.GREATER,
+		token.GREATER_EQUAL:
+		return I1
+	}
+	return typ
+}
+
+// opOf returns IR operation of binary operator op on operands of type typ.
+func opOf(op token.TokenID, typ sema.Type) Op {
+	signed, float := isSigned(typ), isF32(typ)
+	pick := func(unsigned, signedOp, floatOp Op) Op {
+		switch {
+		case float:
+			return floatOp
+		case signed:
+			return signedOp
+		}
+		return unsigned
+	}
+
+	switch op {
+	case token.PLUS:
+		return pick(OpAdd, OpAdd, OpFAdd)
+	case token.MINUS:
+		return pick(OpSub, OpSub, OpFSub)
+	case token.STAR:
+		return pick(OpMul, OpMul, OpFMul)
+	case token.SLASH:
+		return pick(OpUDiv, OpSDiv, OpFDiv)
+	case token.PERCENT:
+		return pick(OpURem, OpSRem, OpInvalid)
+	case token.AMPERSAND:
+		return OpAnd
+	case token.PIPE:
+		return OpOr
+	case token.CARET:
+		return OpXor
+	case token.EQUAL_EQUAL:
+		return pick(OpEq, OpEq, OpFEq)
+	case token.BANG_EQUAL:
+		return pick(OpNe, OpNe, OpFNe)
+	case token.LESS:
+		return pick(OpULt, OpSLt, OpFLt)
+	case token.LESS_EQUAL:
+		return pick(OpULe, OpSLe, OpFLe)
+	case token.GREATER:
+		return pick(OpUGt, OpSGt, OpFGt)
+	case token.GREATER_EQUAL:
+		return pick(OpUGe, OpSGe, OpFGe)
+	}
+
+	return OpInvalid
+}
+
+// scale lowers x, fixed-point value fx of type f multiplied or divided by
+// integer n.
+func (b *builder) scale(x *ast.BinaryExpr, fx, n ast.Expr, f *sema.Fixed) Value {
+	v := b.valueAs(fx, f)
+	m := b.resize(b.valueAs(n, b.info.Types[n]), v.Type(), isSigned(b.info.Types[n]))
+	if x.Op == token.SLASH {
+		return b.emit(OpSDiv, v.Type(), v, m)
+	}
+	return b.emit(OpMul, v.Type(), v, m)
+}
+
+// fixedMulDiv multiplies or divides fixed-point values v and w of type f, at
+// twice their width so nothing overflows in between. A product has twice
+// the fraction bits, so it's shifted back right, and a dividend is shifted
+// left first so the quotient keeps them.
+func (b *builder) fixedMulDiv(op token.TokenID, v, w Value, f *sema.Fixed) Value {
+	typ := v.Type()
+	wide := IntType(2 * typ.Size())
+	v, w = b.resize(v, wide, true), b.resize(w, wide, true)
+	frac := IntConst(wide, int64(f.Frac))
+
+	var r Value
+	if op == token.STAR {
+		r = b.emit(OpAShr, wide, b.emit(OpMul, wide, v, w), frac)
+	} else {
+		r = b.emit(OpSDiv, wide, b.emit(OpShl, wide, v, frac), w)
+	}
+	return b.resize(r, typ, true)
+}
+
+// logical lowers and and or, which only evaluate their right operand if the
+// left one doesn't decide their value.
+func (b *builder) logical(x *ast.BinaryExpr) Value {
+	left := b.value(x.X)
+	from := b.cur
+	right, done := b.newBlock(), b.newBlock()
+	if x.Op == token.AND {
+		b.branch(left, right, done)
+	} else {
+		b.branch(left, done, right)
+	}
+	b.seal(right)
+
+	b.cur = right
+	v := b.value(x.Y)
+	b.jump(done)
+	b.seal(done)
+
+	b.cur = done
+	phi := b.newPhi(done, I1)
+	for _, pred := range done.Preds {
+		if pred == from {
+			phi.Args = append(phi.Args, IntConst(I1, boolInt(x.Op == token.OR)))
+		} else {
+			phi.Args = append(phi.Args, v)
+		}
+	}
+	return phi
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (b *builder) call(call *ast.CallExpr) Value {
+	var obj *sema.Object
+	if id, ok := call.Fun.(*ast.Ident); ok {
+		obj = b.info.Uses[id]
+	}
+
+	if obj != nil && obj.Kind == sema.TypeObj {
+		return b.valueAs(call.Args[0], obj.Type)
+	}
+	if obj == nil || obj.Kind != sema.FuncObj {
+		b.diags.Add(call.Loc, "cannot lower call of %s, it's not a function of the file", ast.ExprString(call.Fun))
+		return &Undef{Typ: b.typeOf(b.info.Types[call])}
+	}
+
+	sig := obj.Type.(*sema.Func)
+	var args []Value
+	var result Value
+	if sig.Result != nil && isAggregate(sig.Result) {
+		slot := b.alloca(b.size(sig.Result))
+		args = append(args, slot)
+		result = slot
+	}
+	for n, arg := range call.Args {
+		typ := sig.Params[n]
+		if isAggregate(typ) {
+			slot := b.alloca(b.size(typ))
+			b.store(slot, arg, typ, false)
+			args = append(args, slot)
+			continue
+		}
+		args = append(args, b.valueAs(arg, typ))
+	}
+
+	typ := Void
+	if sig.Result != nil && result == nil {
+		typ = b.typeOf(sig.Result)
+	}
+	i := b.emit(OpCall, typ, args...)
+	i.Callee = obj.Name
+	if result != nil {
+		return result
+	}
+	return i
+}
+
+// convert converts v of type from to type to, eg for an assignment of a u8
+// to a u16, or a conversion.
+func (b *builder) convert(v Value, from, to sema.Type) Value {
+	if sema.Identical(from, to) {
+		return v
+	}
+	if _, ok := from.(*sema.Enum); ok {
+		from = sema.Typ[sema.U8]
+	}
+	if _, ok := to.(*sema.Enum); ok {
+		to = sema.Typ[sema.U8]
+	}
+
+	typ := b.typeOf(to)
+	ff, fromFixed := from.(*sema.Fixed)
+	tf, toFixed := to.(*sema.Fixed)
+	switch {
+	case fromFixed && toFixed:
+		if typ.Bits() > v.Type().Bits() {
+			return b.shift(b.resize(v, typ, true), tf.Frac-ff.Frac)
+		}
+		return b.resize(b.shift(v, tf.Frac-ff.Frac), typ, true)
+	case fromFixed && isF32(to):
+		f := b.emit(OpSIToFP, F32, v)
+		return b.emit(OpFMul, F32, f, FloatConst(math.Ldexp(1, -ff.Frac)))
+	case fromFixed:
+		// rounds towards minus infinity, like conversions of constants
+		return b.resize(b.shift(v, -ff.Frac), typ, true)
+	case toFixed && isF32(from):
+		f := b.emit(OpFMul, F32, v, FloatConst(math.Ldexp(1, tf.Frac)))
+		return b.emit(OpFPToSI, typ, f)
+	case toFixed:
+		return b.shift(b.resize(v, typ, isSigned(from)), tf.Frac)
+	case isF32(from) && isF32(to):
+		return v
+	case isF32(from):
+		if isSigned(to) {
+			return b.emit(OpFPToSI, typ, v)
+		}
+		return b.emit(OpFPToUI, typ, v)
+	case isF32(to):
+		if isSigned(from) {
+			return b.emit(OpSIToFP, F32, v)
+		}
+		return b.emit(OpUIToFP, F32, v)
+	}
+
+	return b.resize(v, typ, isSigned(from))
+}
+
+// resize truncates or extends integer v to type to, extending with copies
+// of the sign bit if it's signed.
+func (b *builder) resize(v Value, to Type, signed bool) Value {
+	from := v.Type()
+	if c, ok := v.(*Const); ok && from != to {
+		if !signed && from.Bits() < 64 {
+			return IntConst(to, c.Int&(1<<uint(from.Bits())-1))
+		}
+		return IntConst(to, c.Int)
+	}
+
+	switch {
+	case from == to:
+		return v
+	case to.Bits() < from.Bits():
+		return b.emit(OpTrunc, to, v)
+	case signed:
+		return b.emit(OpSExt, to, v)
+	}
+	return b.emit(OpZExt, to, v)
+}
+
+// shift shifts fixed-point v left by n bits, or right, keeping its sign, if
+// n is negative.
+func (b *builder) shift(v Value, n int) Value {
+	switch {
+	case n > 0:
+		return b.emit(OpShl, v.Type(), v, IntConst(v.Type(), int64(n)))
+	case n < 0:
+		return b.emit(OpAShr, v.Type(), v, IntConst(v.Type(), int64(-n)))
+	}
+	return v
+}
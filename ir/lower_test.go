@@ -0,0 +1,360 @@
+package ir
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/parser"
+	"github.com/sent-hil/bitlang/sema"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// lower parses, checks and lowers given source, and verifies the IR.
+func lower(src string) *Module {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	info, diags := sema.Check(file, &sema.Config{BoundsCheck: true, SoftFloat: true})
+	So(diags.HasErrors(), ShouldBeFalse)
+
+	m, diags := Lower(file, info)
+	So(diags, ShouldBeEmpty)
+	So(Verify(m), ShouldBeNil)
+	return m
+}
+
+func TestLower(t *testing.T) {
+	Convey("Lower", t, func() {
+		Convey("It turns locals into values with phis where loops join", func() {
+			m := lower(`
+fn sum(n: u8) -> u16 {
+  var s: u16 = 0;
+  for var i: u8 = 0; i < n; i = i + 1 { s = s + i; }
+  return s;
+}`)
+			So(m.String(), ShouldEqual, `func @sum(%n: i8) -> i16 {
+b0:
+  jmp b1
+b1:
+  %0 = phi i8 [0, b0], [%5, b3]
+  %1 = phi i16 [0, b0], [%4, b3]
+  %2 = ult i8 %0, %n
+  br %2, b2, b4
+b2:
+  %3 = zext i8 %0 to i16
+  %4 = add i16 %1, %3
+  jmp b3
+b3:
+  %5 = add i8 %0, 1
+  jmp b1
+b4:
+  ret i16 %1
+}
+`)
+		})
+
+		Convey("It reads and writes registers and their bits with volatile loads and stores", func() {
+			m := lower(`
+reg PORTB @ 0x25 { PB5: bit 5 }
+reg PINB @ 0x23 { PINB5: bit 5 }
+fn blink() { PORTB.PB5 = !PINB.PINB5; PORTB.PB5 = true; PORTB = PORTB | 1; }`)
+			So(m.String(), ShouldEqual, `func @blink() {
+b0:
+  %0 = load volatile i8, 35
+  %1 = and i8 %0, 32
+  %2 = ne i8 %1, 0
+  %3 = not i1 %2
+  %4 = load volatile i8, 37
+  %5 = and i8 %4, -33
+  %6 = zext i1 %3 to i8
+  %7 = shl i8 %6, 5
+  %8 = or i8 %5, %7
+  store volatile i8 %8, 37
+  %9 = load volatile i8, 37
+  %10 = or i8 %9, 32
+  store volatile i8 %10, 37
+  %11 = load volatile i8, 37
+  %12 = or i8 %11, 1
+  store volatile i8 %12, 37
+  ret
+}
+`)
+		})
+
+		Convey("It lowers globals, bounds checks, atomic blocks and interrupt handlers", func() {
+			m := lower(`
+var ticks: u16 volatile = 300;
+var buf: [4]u8 = [1, 2, 3, 4];
+var count: u8;
+fn tick() interrupt(TIMER1_COMPA) { ticks = ticks + 1; }
+fn get(i: u8) -> u8 { return buf[i]; }
+fn now() -> u16 { var t: u16; atomic { t = ticks; } return t; }`)
+			So(m.String(), ShouldEqual, `@ticks = volatile global 2 x"2c01"
+@buf = global 4 x"01020304"
+@count = global 1
+
+func @tick() interrupt TIMER1_COMPA {
+b0:
+  %0 = load volatile i16, @ticks
+  %1 = add i16 %0, 1
+  store volatile i16 %1, @ticks
+  ret
+}
+
+func @get(%i: i8) -> i8 {
+b0:
+  %0 = zext i8 %i to i16
+  %1 = ult i16 %0, 4
+  br %1, b1, b2
+b1:
+  %2 = ptradd @buf, %0
+  %3 = load i8, %2
+  ret i8 %3
+b2:
+  call @__bitlang_panic()
+  unreachable
+}
+
+func @now() -> i16 {
+b0:
+  %0 = intsave
+  %1 = load volatile i16, @ticks
+  intrestore %0
+  ret i16 %1
+}
+`)
+		})
+
+		Convey("It restores interrupts when returns leave atomic blocks", func() {
+			m := lower("fn f(c: bool) -> u8 { atomic { if c { return 1; } } return 2; }")
+			So(m.String(), ShouldEqual, `func @f(%c: i1) -> i8 {
+b0:
+  %0 = intsave
+  br %c, b1, b2
+b1:
+  intrestore %0
+  ret i8 1
+b2:
+  intrestore %0
+  ret i8 2
+}
+`)
+		})
+
+		Convey("It multiplies and divides fixed-point values at twice their width", func() {
+			m := lower(`
+fn f(a: q8.8, b: q8.8, n: i8) -> q8.8 { return a * b / b + a * n; }
+fn g(a: q8.8) -> i16 { return i16(a); }
+fn h(a: q4.4) -> f32 { var b: q8.8 = a; return f32(b); }`)
+			So(m.String(), ShouldEqual, `func @f(%a: i16, %b: i16, %n: i8) -> i16 {
+b0:
+  %0 = sext i16 %a to i32
+  %1 = sext i16 %b to i32
+  %2 = mul i32 %0, %1
+  %3 = ashr i32 %2, 8
+  %4 = trunc i32 %3 to i16
+  %5 = sext i16 %4 to i32
+  %6 = sext i16 %b to i32
+  %7 = shl i32 %5, 8
+  %8 = sdiv i32 %7, %6
+  %9 = trunc i32 %8 to i16
+  %10 = sext i8 %n to i16
+  %11 = mul i16 %a, %10
+  %12 = add i16 %9, %11
+  ret i16 %12
+}
+
+func @g(%a: i16) -> i16 {
+b0:
+  %0 = ashr i16 %a, 8
+  ret i16 %0
+}
+
+func @h(%a: i8) -> f32 {
+b0:
+  %0 = sext i8 %a to i16
+  %1 = shl i16 %0, 4
+  %2 = sitofp i16 %1 to f32
+  %3 = fmul f32 %2, 0.00390625
+  ret f32 %3
+}
+`)
+		})
+
+		Convey("It lowers switches and short-circuits logical operators", func() {
+			m := lower(`
+enum State { Idle, Running, Done }
+fn f(s: State, c: bool, d: bool) -> u8 {
+  var x: u8 = 0;
+  switch s {
+    case State.Idle { x = 1; }
+    case State.Running, State.Done { if c and d { return 9; } }
+  }
+  return x;
+}`)
+			So(m.String(), ShouldEqual, `func @f(%s: i8, %c: i1, %d: i1) -> i8 {
+b0:
+  switch i8 %s, b7 [0: b1, 1: b2, 2: b2]
+b1:
+  jmp b7
+b2:
+  br %c, b3, b4
+b3:
+  jmp b4
+b4:
+  %0 = phi i1 [false, b2], [%d, b3]
+  br %0, b5, b6
+b5:
+  ret i8 9
+b6:
+  jmp b7
+b7:
+  %1 = phi i8 [0, b0], [1, b1], [0, b6]
+  ret i8 %1
+}
+`)
+		})
+
+		Convey("It passes and returns structs and arrays through memory", func() {
+			m := lower(`
+struct Point { x: u8, y: i16 }
+fn mk(x: u8) -> Point { var p: Point; p.x = x; p.y = 2; return p; }
+fn sum(a: [2]u8) -> u8 { return a[0] + a[1]; }
+fn use() -> i16 { var p: Point = mk(3); var b: [2]u8 = [1, 2]; return p.y + i16(sum(b)); }`)
+			So(m.String(), ShouldEqual, `func @mk(%.ret: ptr, %x: i8) {
+b0:
+  %0 = alloca 3
+  store i8 %x, %0
+  %1 = ptradd %0, 1
+  store i16 2, %1
+  copy %.ret, %0, 3
+  ret
+}
+
+func @sum(%a: ptr) -> i8 {
+b0:
+  %0 = load i8, %a
+  %1 = ptradd %a, 1
+  %2 = load i8, %1
+  %3 = add i8 %0, %2
+  ret i8 %3
+}
+
+func @use() -> i16 {
+b0:
+  %0 = alloca 3
+  %1 = alloca 3
+  %2 = alloca 2
+  %3 = alloca 2
+  call @mk(ptr %1, i8 3)
+  copy %0, %1, 3
+  store i8 1, %2
+  %4 = ptradd %2, 1
+  store i8 2, %4
+  %5 = ptradd %0, 1
+  %6 = load i16, %5
+  copy %3, %2, 2
+  %7 = call i8 @sum(ptr %3)
+  %8 = zext i8 %7 to i16
+  %9 = add i16 %6, %8
+  ret i16 %9
+}
+`)
+		})
+
+		Convey("It checks bounds of array fields and takes their len", func() {
+			m := lower(`
+struct P { n: u8, data: [3]u8 }
+var p: P;
+fn get(i: u8) -> u16 { return u16(p.data[i]) + len(p.data); }`)
+			So(m.String(), ShouldEqual, `@p = global 4
+
+func @get(%i: i8) -> i16 {
+b0:
+  %0 = ptradd @p, 1
+  %1 = zext i8 %i to i16
+  %2 = ult i16 %1, 3
+  br %2, b1, b2
+b1:
+  %3 = ptradd %0, %1
+  %4 = load i8, %3
+  %5 = zext i8 %4 to i16
+  %6 = add i16 %5, 3
+  ret i16 %6
+b2:
+  call @__bitlang_panic()
+  unreachable
+}
+`)
+		})
+
+		Convey("It breaks and continues labeled loops", func() {
+			m := lower(`
+fn f(n: u8) -> u8 {
+  outer: loop { loop { if n > 3 { break outer; } n = n + 1; if n == 2 { continue outer; } } }
+  return n;
+}`)
+			So(m.String(), ShouldEqual, `func @f(%n: i8) -> i8 {
+b0:
+  jmp b1
+b1:
+  %0 = phi i8 [%n, b0], [%3, b6]
+  jmp b2
+b2:
+  %1 = phi i8 [%0, b1], [%3, b7]
+  %2 = ugt i8 %1, 3
+  br %2, b3, b5
+b3:
+  jmp b4
+b4:
+  ret i8 %1
+b5:
+  %3 = add i8 %1, 1
+  %4 = eq i8 %3, 2
+  br %4, b6, b7
+b6:
+  jmp b1
+b7:
+  jmp b2
+}
+`)
+		})
+
+		Convey("It reports what it can't lower", func() {
+			file, _ := parser.ParseString(`
+import "spi";
+var g: u8 = h();
+fn h() -> u8 { spi.Send(1); return 1; }`)
+			info, _ := sema.Check(file, nil)
+			_, diags := Lower(file, info)
+			So(diags.Error(), ShouldEqual, "3:13: cannot lower value of global g, it's not constant\n"+
+				"4:16: cannot lower call of spi.Send, it's not a function of the file")
+		})
+
+		Convey("It lowers fields of enum types", func() {
+			m := lower(`
+enum State { A, B }
+struct S { s: State, x: u8 }
+var g: S;
+fn main() { g.s = State.B; g.x = 1; }`)
+			So(m.String(), ShouldEqual, `@g = global 2
+
+func @main() {
+b0:
+  store i8 1, @g
+  %0 = ptradd @g, 1
+  store i8 1, %0
+  ret
+}
+`)
+		})
+
+		Convey("It reports fields of structs without a layout instead of panicking", func() {
+			file, _ := parser.ParseString("struct T { a: u8, t: T } var g: T; fn f() { g.a = 1; }")
+			info, diags := sema.Check(file, nil)
+			So(diags.Error(), ShouldEqual, "1:8: struct T contains itself")
+
+			_, diags = Lower(file, info)
+			So(diags.Error(), ShouldEqual, "1:45: cannot lower g.a, struct T has no layout")
+		})
+	})
+}
@@ -0,0 +1,205 @@
+package ir
+
+// Op is what an instruction does.
+type Op int
+
+const (
+	OpInvalid Op = iota
+
+	// OpPhi is the operand for the pred its block was entered from.
+	OpPhi
+
+	// Binary operations take two operands of the instruction's type. Shifts
+	// by the width of the type or more are undefined.
+	OpAdd
+	OpSub
+	OpMul
+	OpSDiv
+	OpUDiv
+	OpSRem
+	OpURem
+	OpAnd
+	OpOr
+	OpXor
+	OpShl
+	OpLShr
+	OpAShr
+	OpFAdd
+	OpFSub
+	OpFMul
+	OpFDiv
+
+	// Unary operations take an operand of the instruction's type. OpNot
+	// flips every bit, so it's also logical not of an i1.
+	OpNeg
+	OpNot
+	OpFNeg
+
+	// Comparisons take two operands of the same type and are i1s.
+	OpEq
+	OpNe
+	OpSLt
+	OpSLe
+	OpSGt
+	OpSGe
+	OpULt
+	OpULe
+	OpUGt
+	OpUGe
+	OpFEq
+	OpFNe
+	OpFLt
+	OpFLe
+	OpFGt
+	OpFGe
+
+	// Conversions take an operand of another type: integers are truncated
+	// to narrower ones and extended to wider ones, with zeros or copies of
+	// the sign bit, and converted to and from f32, rounding towards zero.
+	OpTrunc
+	OpZExt
+	OpSExt
+	OpSIToFP
+	OpUIToFP
+	OpFPToSI
+	OpFPToUI
+
+	// OpAlloca is a ptr to Size bytes of the function's stack frame.
+	OpAlloca
+
+	// OpPtrAdd is its ptr operand plus its i16 operand.
+	OpPtrAdd
+
+	// OpLoad loads a value of the instruction's type from its ptr operand,
+	// and OpStore stores its second operand there. They're volatile if
+	// they're of a register or volatile global.
+	OpLoad
+	OpStore
+
+	// OpCopy copies Size bytes from its second ptr operand to its first.
+	OpCopy
+
+	// OpCall calls Callee with its operands.
+	OpCall
+
+	// OpIntSave is an i8 of whether interrupts are enabled, and disables
+	// them; OpIntRestore takes one and enables them again if they were.
+	// They start and end atomic blocks.
+	OpIntSave
+	OpIntRestore
+
+	// Terminators end blocks. OpJump goes to the only successor, OpBranch to
+	// the first if its i1 operand is true and the second if not, and
+	// OpSwitch to the successor after the first whose case equals its
+	// operand, or the first if none does. OpReturn returns its operand if
+	// it has one, and OpUnreachable can't be reached, eg after a call of
+	// the panic handler.
+	OpJump
+	OpBranch
+	OpSwitch
+	OpReturn
+	OpUnreachable
+)
+
+var opNames = map[Op]string{
+	OpInvalid:     "invalid",
+	OpPhi:         "phi",
+	OpAdd:         "add",
+	OpSub:         "sub",
+	OpMul:         "mul",
+	OpSDiv:        "sdiv",
+	OpUDiv:        "udiv",
+	OpSRem:        "srem",
+	OpURem:        "urem",
+	OpAnd:         "and",
+	OpOr:          "or",
+	OpXor:         "xor",
+	OpShl:         "shl",
+	OpLShr:        "lshr",
+	OpAShr:        "ashr",
+	OpFAdd:        "fadd",
+	OpFSub:        "fsub",
+	OpFMul:        "fmul",
+	OpFDiv:        "fdiv",
+	OpNeg:         "neg",
+	OpNot:         "not",
+	OpFNeg:        "fneg",
+	OpEq:          "eq",
+	OpNe:          "ne",
+	OpSLt:         "slt",
+	OpSLe:         "sle",
+	OpSGt:         "sgt",
+	OpSGe:         "sge",
+	OpULt:         "ult",
+	OpULe:         "ule",
+	OpUGt:         "ugt",
+	OpUGe:         "uge",
+	OpFEq:         "feq",
+	OpFNe:         "fne",
+	OpFLt:         "flt",
+	OpFLe:         "fle",
+	OpFGt:         "fgt",
+	OpFGe:         "fge",
+	OpTrunc:       "trunc",
+	OpZExt:        "zext",
+	OpSExt:        "sext",
+	OpSIToFP:      "sitofp",
+	OpUIToFP:      "uitofp",
+	OpFPToSI:      "fptosi",
+	OpFPToUI:      "fptoui",
+	OpAlloca:      "alloca",
+	OpPtrAdd:      "ptradd",
+	OpLoad:        "load",
+	OpStore:       "store",
+	OpCopy:        "copy",
+	OpCall:        "call",
+	OpIntSave:     "intsave",
+	OpIntRestore:  "intrestore",
+	OpJump:        "jmp",
+	OpBranch:      "br",
+	OpSwitch:      "switch",
+	OpReturn:      "ret",
+	OpUnreachable: "unreachable",
+}
+
+func (op Op) String() string { return opNames[op] }
+
+// IsBinary returns if op is a binary operation.
+func (op Op) IsBinary() bool { return op >= OpAdd && op <= OpFDiv }
+
+// IsUnary returns if op is a unary operation.
+func (op Op) IsUnary() bool { return op >= OpNeg && op <= OpFNeg }
+
+// IsComparison returns if op is a comparison.
+func (op Op) IsComparison() bool { return op >= OpEq && op <= OpFGe }
+
+// IsConversion returns if op is a conversion.
+func (op Op) IsConversion() bool { return op >= OpTrunc && op <= OpFPToUI }
+
+// IsFloat returns if op is an operation on f32s.
+func (op Op) IsFloat() bool {
+	switch op {
+	case OpFAdd, OpFSub, OpFMul, OpFDiv, OpFNeg, OpFEq, OpFNe, OpFLt, OpFLe, OpFGt, OpFGe:
+		return true
+	}
+	return false
+}
+
+// IsTerminator returns if op ends a block.
+func (op Op) IsTerminator() bool { return op >= OpJump && op <= OpUnreachable }
+
+// HasSideEffects returns if an instruction of op must be kept even if its
+// value isn't used. Loads are only kept if they're volatile, see
+// Instr.HasSideEffects.
+func (op Op) HasSideEffects() bool {
+	switch op {
+	case OpStore, OpCopy, OpCall, OpIntSave, OpIntRestore:
+		return true
+	}
+	return op.IsTerminator()
+}
+
+// HasSideEffects returns if i must be kept even if its value isn't used.
+func (i *Instr) HasSideEffects() bool {
+	return i.Op.HasSideEffects() || i.Op == OpLoad && i.Volatile
+}
@@ -0,0 +1,643 @@
+package ir
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Parse parses a module in the textual format String prints, eg to test a
+// pass with IR written by hand. Values and blocks can be named anything,
+// and can be used before they're defined, but names aren't kept: once
+// parsed they're numbered in order, as Renumber does. What String prints is
+// that normal form, so only text String printed reads back as the same
+// text; other text reads back as its normal form. Each operand of a phi
+// names the pred it's for; preds are in the order Renumber puts them.
+// Operands of values must have the type they're written with. The module
+// isn't verified, see Verify, and is nil if there are errors.
+func Parse(src string) (*Module, diag.List) {
+	tokens, bad := scan(src)
+	p := &irParser{tokens: tokens, m: &Module{}}
+	for _, t := range bad {
+		p.diags.Add(t.span, "unexpected %s", t.describe())
+	}
+
+	for p.skipNewlines(); !p.check(tokEOF, ""); p.skipNewlines() {
+		p.decl()
+	}
+	p.resolveGlobals()
+
+	if p.diags.HasErrors() {
+		return nil, p.diags
+	}
+	return p.m, p.diags
+}
+
+type irParser struct {
+	tokens  []irToken
+	current int
+	diags   diag.List
+
+	m *Module
+
+	// globalRefs are operands naming globals, which can be declared after
+	// they're used.
+	globalRefs []*unresolved
+
+	// f is the function being parsed.
+	f *funcParser
+}
+
+// funcParser is the state of a function being parsed.
+type funcParser struct {
+	f    *Func
+	name irToken
+	cur  *Block
+
+	// values are parameters and instructions by name, and refs operands
+	// naming them.
+	values map[string]Value
+	refs   []*unresolved
+
+	// blocks are blocks by label, and labels the labels they were first
+	// used or defined with, in order.
+	blocks  map[string]*Block
+	labels  []irToken
+	defined map[*Block]bool
+
+	// phis are phis with the labels each of their operands is for.
+	phis []phiPreds
+}
+
+type phiPreds struct {
+	phi    *Instr
+	labels []irToken
+}
+
+// unresolved is an operand naming a value or global, till it's known what
+// that is.
+type unresolved struct {
+	name   string
+	typ    Type
+	span   token.Span
+	global bool
+}
+
+func (u *unresolved) Type() Type { return u.typ }
+func (u *unresolved) Ref() string {
+	if u.global {
+		return "@" + u.name
+	}
+	return "%" + u.name
+}
+
+type bailout struct{}
+
+func (p *irParser) peek() irToken {
+	return p.tokens[p.current]
+}
+
+func (p *irParser) advance() irToken {
+	t := p.tokens[p.current]
+	if t.kind != tokEOF {
+		p.current++
+	}
+	return t
+}
+
+// check returns if current token is of given kind and, if text isn't empty,
+// is text.
+func (p *irParser) check(kind tokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && (text == "" || t.text == text)
+}
+
+// match advances if current token is given name or punctuation.
+func (p *irParser) match(kind tokenKind, text string) bool {
+	if p.check(kind, text) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+// expect advances if current token is of given kind and text, else it
+// reports an error; what describes what was expected, eg "label".
+func (p *irParser) expect(kind tokenKind, text, what string) irToken {
+	if !p.check(kind, text) {
+		p.errorf(p.peek().span, "expected %s, found %s", what, p.peek().describe())
+	}
+	return p.advance()
+}
+
+func (p *irParser) punct(text string) {
+	p.expect(tokPunct, text, strconv.Quote(text))
+}
+
+// errorf records an error and unwinds to the enclosing line.
+func (p *irParser) errorf(span token.Span, format string, args ...interface{}) {
+	p.diags.Add(span, format, args...)
+	panic(bailout{})
+}
+
+func (p *irParser) skipNewlines() {
+	for p.match(tokNewline, "") {
+	}
+}
+
+// skipLine skips tokens till after the next newline.
+func (p *irParser) skipLine() {
+	for !p.check(tokEOF, "") && p.advance().kind != tokNewline {
+	}
+}
+
+// line runs parse, which parses a line, and skips the rest of the line if
+// it fails.
+func (p *irParser) line(parse func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isBailout := r.(bailout); !isBailout {
+				panic(r)
+			}
+			p.skipLine()
+			ok = false
+		}
+	}()
+
+	parse()
+	if !p.check(tokEOF, "") {
+		p.expect(tokNewline, "", "newline")
+	}
+	return true
+}
+
+// decl parses a global or function.
+func (p *irParser) decl() {
+	if p.check(tokName, "func") {
+		p.fn()
+		return
+	}
+
+	p.line(func() {
+		if !p.check(tokGlobal, "") {
+			p.errorf(p.peek().span, "expected global or func, found %s", p.peek().describe())
+		}
+		p.global()
+	})
+}
+
+// global parses `@name = [volatile] global size [x"hex"]`.
+func (p *irParser) global() {
+	name := p.advance()
+	p.punct("=")
+	g := &Global{Name: name.text, Volatile: p.match(tokName, "volatile")}
+	p.expect(tokName, "global", "global")
+	g.Size = int(p.integer())
+
+	if t := p.peek(); t.kind == tokBytes {
+		p.advance()
+		init, err := hex.DecodeString(t.text)
+		if err != nil {
+			p.errorf(t.span, "invalid value %s of global", t.describe())
+		}
+		g.Init = init
+	}
+
+	if p.m.Global(g.Name) != nil {
+		p.diags.Add(name.span, "@%s already defined", g.Name)
+	}
+	p.m.Globals = append(p.m.Globals, g)
+}
+
+// integer parses an integer.
+func (p *irParser) integer() int64 {
+	t := p.expect(tokNumber, "", "integer")
+	n, err := strconv.ParseInt(t.text, 0, 64)
+	if err != nil {
+		p.errorf(t.span, "invalid integer %s", t.describe())
+	}
+	return n
+}
+
+var types = map[string]Type{}
+var ops = map[string]Op{}
+
+func init() {
+	for typ, name := range typeNames {
+		if typ != Void {
+			types[name] = typ
+		}
+	}
+	for op, name := range opNames {
+		if op != OpInvalid {
+			ops[name] = op
+		}
+	}
+}
+
+// typ parses a type.
+func (p *irParser) typ() Type {
+	t := p.peek()
+	typ, ok := types[t.text]
+	if t.kind != tokName || !ok {
+		p.errorf(t.span, "expected type, found %s", t.describe())
+	}
+	p.advance()
+	return typ
+}
+
+// fn parses a function, from its header to its closing brace.
+func (p *irParser) fn() {
+	p.f = &funcParser{
+		f:       &Func{},
+		values:  map[string]Value{},
+		blocks:  map[string]*Block{},
+		defined: map[*Block]bool{},
+	}
+	defer func() { p.f = nil }()
+
+	if !p.line(p.header) {
+		// skip the body too
+		for !p.check(tokEOF, "") && !p.check(tokPunct, "}") {
+			p.skipLine()
+		}
+		p.line(func() { p.match(tokPunct, "}") })
+		return
+	}
+
+	for p.skipNewlines(); !p.check(tokEOF, "") && !p.check(tokPunct, "}"); p.skipNewlines() {
+		p.line(p.blockOrInstr)
+	}
+	p.line(func() { p.punct("}") })
+
+	p.finishFunc()
+	if p.m.Func(p.f.f.Name) != nil {
+		p.diags.Add(p.f.name.span, "@%s already defined", p.f.f.Name)
+	}
+	p.m.Funcs = append(p.m.Funcs, p.f.f)
+}
+
+// header parses `func @name(%param: type, ...) [-> type] [interrupt
+// vector] {`.
+func (p *irParser) header() {
+	f := p.f.f
+	p.expect(tokName, "func", "func")
+	p.f.name = p.expect(tokGlobal, "", "function name")
+	f.Name = p.f.name.text
+
+	p.punct("(")
+	for !p.check(tokPunct, ")") {
+		if len(f.Params) > 0 {
+			p.punct(",")
+		}
+		name := p.expect(tokLocal, "", "parameter")
+		p.punct(":")
+		param := &Param{Name: name.text, Typ: p.typ()}
+		p.define(name, param)
+		f.Params = append(f.Params, param)
+	}
+	p.punct(")")
+
+	if p.match(tokPunct, "->") {
+		f.Result = p.typ()
+	}
+	if p.match(tokName, "interrupt") {
+		f.Interrupt = p.expect(tokName, "", "interrupt vector").text
+	}
+	p.punct("{")
+}
+
+// define names value v of the function being parsed.
+func (p *irParser) define(name irToken, v Value) {
+	if _, ok := p.f.values[name.text]; ok {
+		p.errorf(name.span, "%%%s already defined", name.text)
+	}
+	p.f.values[name.text] = v
+}
+
+// block returns block of given label, adding it if it's not used yet.
+func (p *irParser) block(label irToken) *Block {
+	b := p.f.blocks[label.text]
+	if b == nil {
+		b = &Block{Func: p.f.f}
+		p.f.blocks[label.text] = b
+		p.f.labels = append(p.f.labels, label)
+	}
+	return b
+}
+
+// label parses label of a block an instruction goes to.
+func (p *irParser) label() *Block {
+	return p.block(p.expect(tokName, "", "label"))
+}
+
+// blockOrInstr parses a label starting a block, or an instruction.
+func (p *irParser) blockOrInstr() {
+	if t := p.peek(); t.kind == tokName && p.tokens[p.current+1].text == ":" {
+		p.advance()
+		p.advance()
+		b := p.block(t)
+		if p.f.defined[b] {
+			p.errorf(t.span, "block %s already defined", t.text)
+		}
+		p.f.defined[b] = true
+		b.Index = len(p.f.f.Blocks)
+		p.f.f.Blocks = append(p.f.f.Blocks, b)
+		p.f.cur = b
+		return
+	}
+
+	start := p.peek()
+	if p.f.cur == nil {
+		p.errorf(start.span, "instruction before first block")
+	}
+	if term := p.f.cur.Terminator(); term != nil {
+		p.errorf(start.span, "instruction after %s, which ends the block", term.Op)
+	}
+
+	var name *irToken
+	if start.kind == tokLocal {
+		p.advance()
+		p.punct("=")
+		name = &start
+	}
+
+	t := p.peek()
+	op, ok := ops[t.text]
+	if t.kind != tokName || !ok {
+		p.errorf(t.span, "expected instruction, found %s", t.describe())
+	}
+	p.advance()
+
+	i := &Instr{Op: op, Block: p.f.cur}
+	p.instr(i)
+
+	switch {
+	case name == nil && i.Typ != Void:
+		p.errorf(t.span, "value of %s must be named", op)
+	case name != nil && i.Typ == Void:
+		p.errorf(name.span, "%s has no value", op)
+	case name != nil:
+		p.define(*name, i)
+	}
+	p.f.cur.Instrs = append(p.f.cur.Instrs, i)
+}
+
+// instr parses operands of i, and whatever else its op takes.
+func (p *irParser) instr(i *Instr) {
+	switch op := i.Op; {
+	case op == OpPhi:
+		i.Typ = p.typ()
+		preds := phiPreds{phi: i}
+		for {
+			p.punct("[")
+			i.Args = append(i.Args, p.operand(i.Typ))
+			p.punct(",")
+			preds.labels = append(preds.labels, p.expect(tokName, "", "label"))
+			p.punct("]")
+			if !p.match(tokPunct, ",") {
+				break
+			}
+		}
+		p.f.phis = append(p.f.phis, preds)
+	case op.IsBinary(), op.IsComparison():
+		typ := p.typ()
+		i.Typ = typ
+		if op.IsComparison() {
+			i.Typ = I1
+		}
+		x := p.operand(typ)
+		p.punct(",")
+		i.Args = []Value{x, p.operand(typ)}
+	case op.IsUnary():
+		i.Typ = p.typ()
+		i.Args = []Value{p.operand(i.Typ)}
+	case op.IsConversion():
+		x := p.operand(p.typ())
+		p.expect(tokName, "to", "to")
+		i.Typ = p.typ()
+		i.Args = []Value{x}
+	case op == OpAlloca:
+		i.Typ = Ptr
+		i.Size = int(p.integer())
+	case op == OpPtrAdd:
+		i.Typ = Ptr
+		x := p.operand(Ptr)
+		p.punct(",")
+		i.Args = []Value{x, p.operand(I16)}
+	case op == OpLoad:
+		i.Volatile = p.match(tokName, "volatile")
+		i.Typ = p.typ()
+		p.punct(",")
+		i.Args = []Value{p.operand(Ptr)}
+	case op == OpStore:
+		i.Volatile = p.match(tokName, "volatile")
+		v := p.operand(p.typ())
+		p.punct(",")
+		i.Args = []Value{p.operand(Ptr), v}
+	case op == OpCopy:
+		dst := p.operand(Ptr)
+		p.punct(",")
+		src := p.operand(Ptr)
+		p.punct(",")
+		i.Args = []Value{dst, src}
+		i.Size = int(p.integer())
+	case op == OpCall:
+		if !p.check(tokGlobal, "") {
+			i.Typ = p.typ()
+		}
+		i.Callee = p.expect(tokGlobal, "", "function name").text
+		p.punct("(")
+		for !p.check(tokPunct, ")") {
+			if len(i.Args) > 0 {
+				p.punct(",")
+			}
+			i.Args = append(i.Args, p.operand(p.typ()))
+		}
+		p.punct(")")
+	case op == OpIntSave:
+		i.Typ = I8
+	case op == OpIntRestore:
+		i.Args = []Value{p.operand(I8)}
+	case op == OpJump:
+		p.succ(p.label())
+	case op == OpBranch:
+		i.Args = []Value{p.operand(I1)}
+		p.punct(",")
+		then := p.label()
+		p.punct(",")
+		p.succ(then)
+		p.succ(p.label())
+	case op == OpSwitch:
+		typ := p.typ()
+		i.Args = []Value{p.operand(typ)}
+		p.punct(",")
+		p.succ(p.label())
+		p.punct("[")
+		for !p.check(tokPunct, "]") {
+			if len(i.Cases) > 0 {
+				p.punct(",")
+			}
+			i.Cases = append(i.Cases, IntConst(typ, p.integer()).Int)
+			p.punct(":")
+			p.succ(p.label())
+		}
+		p.punct("]")
+	case op == OpReturn:
+		if !p.check(tokNewline, "") && !p.check(tokEOF, "") {
+			i.Args = []Value{p.operand(p.typ())}
+		}
+	}
+}
+
+// succ adds b to successors of the block being parsed.
+func (p *irParser) succ(b *Block) {
+	p.f.cur.Succs = append(p.f.cur.Succs, b)
+}
+
+// operand parses an operand of type typ.
+func (p *irParser) operand(typ Type) Value {
+	t := p.advance()
+	switch {
+	case t.kind == tokLocal:
+		u := &unresolved{name: t.text, typ: typ, span: t.span}
+		p.f.refs = append(p.f.refs, u)
+		return u
+	case t.kind == tokGlobal:
+		u := &unresolved{name: t.text, typ: Ptr, span: t.span, global: true}
+		p.globalRefs = append(p.globalRefs, u)
+		return u
+	case t.kind == tokName && t.text == "undef":
+		return &Undef{Typ: typ}
+	case t.kind == tokName && typ == I1 && (t.text == "true" || t.text == "false"):
+		return IntConst(I1, boolInt(t.text == "true"))
+	case t.kind == tokNumber && typ == F32, t.kind == tokName && typ == F32 && (t.text == "inf" || t.text == "nan"):
+		f, err := strconv.ParseFloat(t.text, 32)
+		if err == nil {
+			return FloatConst(f)
+		}
+	case t.kind == tokNumber && (typ.IsInt() || typ == Ptr):
+		n, err := strconv.ParseInt(t.text, 0, 64)
+		if err == nil {
+			return IntConst(typ, n)
+		}
+	case t.kind == tokNewline || t.kind == tokEOF || t.kind == tokPunct:
+		p.errorf(t.span, "expected operand, found %s", t.describe())
+	}
+
+	p.errorf(t.span, "invalid %s operand %s", typ, t.describe())
+	return nil
+}
+
+// finishFunc resolves operands and labels of the function being parsed,
+// links blocks with their preds, puts operands of phis in the order of
+// preds, and numbers blocks and values.
+func (p *irParser) finishFunc() {
+	f := p.f.f
+	if len(f.Blocks) == 0 {
+		p.diags.Add(p.f.name.span, "@%s has no blocks", f.Name)
+		return
+	}
+	for _, label := range p.f.labels {
+		if !p.f.defined[p.f.blocks[label.text]] {
+			p.diags.Add(label.span, "undefined block %s", label.text)
+		}
+	}
+
+	for _, u := range p.f.refs {
+		if _, ok := p.f.values[u.name]; !ok {
+			p.diags.Add(u.span, "undefined value %%%s", u.name)
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			for n, arg := range i.Args {
+				if u, ok := arg.(*unresolved); ok && !u.global {
+					if v, ok := p.f.values[u.name]; ok {
+						if v.Type() != u.typ {
+							p.diags.Add(u.span, "%%%s must be %s, found %s", u.name, u.typ, v.Type())
+						}
+						i.Args[n] = v
+					}
+				}
+			}
+		}
+	}
+
+	for _, b := range f.Blocks {
+		for _, succ := range b.Succs {
+			if !containsBlock(succ.Preds, b) {
+				succ.Preds = append(succ.Preds, b)
+			}
+		}
+	}
+	for _, phi := range p.f.phis {
+		p.orderPhi(phi.phi, phi.labels)
+	}
+
+	f.Renumber()
+}
+
+// orderPhi puts operands of phi in the order of preds of its block, given
+// labels of the pred each is for.
+func (p *irParser) orderPhi(phi *Instr, labels []irToken) {
+	b := phi.Block
+	args := map[*Block]Value{}
+	for n, label := range labels {
+		pred := p.f.blocks[label.text]
+		switch {
+		case pred == nil || !containsBlock(b.Preds, pred):
+			p.diags.Add(label.span, "%s isn't a pred of %s", label.text, labelOf(p.f.blocks, b))
+			continue
+		case args[pred] != nil:
+			p.diags.Add(label.span, "phi has two operands for %s", label.text)
+			continue
+		}
+		args[pred] = phi.Args[n]
+	}
+
+	phi.Args = phi.Args[:0]
+	for _, pred := range b.Preds {
+		arg := args[pred]
+		if arg == nil {
+			p.diags.Add(labels[0].span, "phi has no operand for pred %s", labelOf(p.f.blocks, pred))
+			arg = &Undef{Typ: phi.Typ}
+		}
+		phi.Args = append(phi.Args, arg)
+	}
+}
+
+// labelOf returns label b was named by.
+func labelOf(blocks map[string]*Block, b *Block) string {
+	for label, x := range blocks {
+		if x == b {
+			return label
+		}
+	}
+	return b.Name()
+}
+
+// resolveGlobals resolves operands naming globals.
+func (p *irParser) resolveGlobals() {
+	for _, u := range p.globalRefs {
+		if p.m.Global(u.name) == nil {
+			p.diags.Add(u.span, "undefined global @%s", u.name)
+		}
+	}
+
+	for _, f := range p.m.Funcs {
+		for _, b := range f.Blocks {
+			for _, i := range b.Instrs {
+				for n, arg := range i.Args {
+					if u, ok := arg.(*unresolved); ok && u.global {
+						if g := p.m.Global(u.name); g != nil {
+							i.Args[n] = g
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ir
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Parse", t, func() {
+		Convey("It reads back what String prints", func() {
+			for _, src := range []string{
+				`
+var ticks: u16 volatile = 300;
+var buf: [4]u8 = [1, 2, 3, 4];
+fn tick() interrupt(TIMER1_COMPA) { ticks = ticks + 1; }
+fn get(i: u8) -> u8 { return buf[i]; }
+fn now() -> u16 { var t: u16; atomic { t = ticks; } return t; }`,
+				`
+reg PORTB @ 0x25 { PB5: bit 5 }
+fn sum(n: u8) -> u16 {
+  var s: u16 = 0;
+  for var i: u8 = 0; i < n; i = i + 1 { s = s + i; PORTB.PB5 = !PORTB.PB5; }
+  return s;
+}`,
+				`
+enum State { Idle, Running, Done }
+fn f(s: State, c: bool, d: bool) -> u8 {
+  var x: u8 = 0;
+  switch s { case State.Idle { x = 1; } case State.Running, State.Done { if c and d { return 9; } } }
+  return x;
+}`,
+				`
+struct Point { x: u8, y: i16 }
+fn mk(x: u8) -> Point { var p: Point; p.x = x; p.y = -2; return p; }
+fn use() -> i16 { var p: Point = mk(3); return p.y; }
+fn scale(a: q8.8, b: f32) -> f32 { return f32(a) * b + 0.1 - f32(-a); }`,
+			} {
+				text := lower(src).String()
+				m, diags := Parse(text)
+				So(diags, ShouldBeEmpty)
+				So(Verify(m), ShouldBeNil)
+				So(m.String(), ShouldEqual, text)
+			}
+		})
+
+		Convey("It reads values and blocks named anything into the normal form", func() {
+			m, diags := Parse(`
+; counts down to zero
+func @count.down(%n: i8) -> i8 {
+entry:
+  jmp loop
+loop:
+  %i = phi i8 [%next, body], [%n, entry]
+  %done = eq i8 %i, 0
+  br %done, exit, body
+body:
+  %next = sub i8 %i, 1
+  call @lcd.Print(i8 %next, ptr @out)
+  jmp loop
+exit:
+  ret i8 %i
+}
+
+@out = global 1
+`)
+			So(diags, ShouldBeEmpty)
+			So(Verify(m), ShouldBeNil)
+			So(m.String(), ShouldEqual, `@out = global 1
+
+func @count.down(%n: i8) -> i8 {
+b0:
+  jmp b1
+b1:
+  %0 = phi i8 [%n, b0], [%2, b2]
+  %1 = eq i8 %0, 0
+  br %1, b3, b2
+b2:
+  %2 = sub i8 %0, 1
+  call @lcd.Print(i8 %2, ptr @out)
+  jmp b1
+b3:
+  ret i8 %0
+}
+`)
+
+			again, diags := Parse(m.String())
+			So(diags, ShouldBeEmpty)
+			So(again.String(), ShouldEqual, m.String())
+		})
+
+		Convey("It reports syntax errors and carries on with the next line", func() {
+			_, diags := Parse(`func @f(%a: i8) -> i8 {
+b0:
+  %0 = add i9 %a, 1
+  %1 = mul i8 %a 2
+  ret i8 %a
+}
+@g = global`)
+			So(diags.Error(), ShouldEqual, "3:12: expected type, found \"i9\"\n"+
+				"4:18: expected \",\", found \"2\"\n"+
+				"7:12: expected integer, found end of file")
+		})
+
+		Convey("It reports undefined and misused names", func() {
+			for src, message := range map[string]string{
+				"func @f() {\nb0:\n  jmp b1\n}":                              "3:7: undefined block b1",
+				"func @f() -> i8 {\nb0:\n  ret i8 %x\n}":                     "3:10: undefined value %x",
+				"func @f() -> i8 {\nb0:\n  %0 = load i8, @g\n  ret i8 %0\n}": "3:17: undefined global @g",
+				"func @f(%a: i8) {\nb0:\n  %a = add i8 %a, 1\n  ret\n}":      "3:3: %a already defined",
+				"func @f() {\nb0:\n  add i8 1, 2\n  ret\n}":                  "3:3: value of add must be named",
+				"func @f() {\nb0:\n  %0 = store i8 1, 2\n  ret\n}":           "3:3: store has no value",
+				"func @f() {\nb0:\n  ret\n  ret\n}":                          "4:3: instruction after ret, which ends the block",
+				"func @f() {\n}":                                             "1:6: @f has no blocks",
+				"func @f() {\n  ret\nb0:\n  ret\n}":                          "2:3: instruction before first block",
+				"func @f(%c: i1) -> i8 {\nb0:\n  br %c, b1, b2\nb1:\n  jmp b2\nb2:\n  %0 = phi i8 [1, b0], [2, b0]\n  ret i8 %0\n}": "7:28: phi has two operands for b0\n7:19: phi has no operand for pred b1",
+				"func @f(%c: i1) -> i8 {\nb0:\n  br %c, b1, b2\nb1:\n  jmp b2\nb2:\n  %0 = phi i8 [1, b0]\n  ret i8 %0\n}":          "7:19: phi has no operand for pred b1",
+				"func @f() -> i8 {\nb0:\n  jmp b1\nb1:\n  %0 = phi i8 [1, b1]\n  ret i8 %0\n}":                                      "5:19: b1 isn't a pred of b1\n5:19: phi has no operand for pred b0",
+				"func @f(%a: i16) -> i8 {\nb0:\n  %0 = add i8 %a, 1\n  ret i8 %0\n}":                                                "3:15: %a must be i8, found i16",
+				"func @f(%a: i8, %b: i16) -> i1 {\nb0:\n  %0 = eq i8 %a, %b\n  ret i1 %0\n}":                                        "3:18: %b must be i8, found i16",
+				"func @f() -> i1 {\nb0:\n  ret i1 2.5\n}":                                                                           "3:10: invalid i1 operand \"2.5\"",
+			} {
+				_, diags := Parse(src)
+				So(diags.Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String returns the module in the textual format, globals first, eg
+//
+//	@count = volatile global 2
+//
+//	func @bump(%n: i16) -> i16 {
+//	b0:
+//	  %0 = add i16 %n, 1
+//	  ret i16 %0
+//	}
+func (m *Module) String() string {
+	var b strings.Builder
+	for _, g := range m.Globals {
+		b.WriteString(g.String())
+		b.WriteString("\n")
+	}
+
+	for i, f := range m.Funcs {
+		if i > 0 || len(m.Globals) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(f.String())
+	}
+
+	return b.String()
+}
+
+func (g *Global) String() string {
+	s := g.Ref() + " = "
+	if g.Volatile {
+		s += "volatile "
+	}
+	s += fmt.Sprintf("global %d", g.Size)
+	if g.Init != nil {
+		s += fmt.Sprintf(" x\"%x\"", g.Init)
+	}
+	return s
+}
+
+func (f *Func) String() string {
+	var b strings.Builder
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = p.Ref() + ": " + p.Typ.String()
+	}
+	fmt.Fprintf(&b, "func @%s(%s)", f.Name, strings.Join(params, ", "))
+	if f.Result != Void {
+		fmt.Fprintf(&b, " -> %s", f.Result)
+	}
+	if f.Interrupt != "" {
+		fmt.Fprintf(&b, " interrupt %s", f.Interrupt)
+	}
+	b.WriteString(" {\n")
+
+	for _, block := range f.Blocks {
+		fmt.Fprintf(&b, "%s:\n", block.Name())
+		for _, instr := range block.Instrs {
+			fmt.Fprintf(&b, "  %s\n", instr)
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (i *Instr) String() string {
+	s := ""
+	if i.Typ != Void {
+		s = i.Ref() + " = "
+	}
+	s += i.Op.String()
+
+	arg := func(n int) string { return i.Args[n].Ref() }
+	switch op := i.Op; {
+	case op == OpPhi:
+		edges := make([]string, len(i.Args))
+		for n := range i.Args {
+			edges[n] = fmt.Sprintf("[%s, %s]", arg(n), i.Block.Preds[n].Name())
+		}
+		s += fmt.Sprintf(" %s %s", i.Typ, strings.Join(edges, ", "))
+	case op.IsBinary():
+		s += fmt.Sprintf(" %s %s, %s", i.Typ, arg(0), arg(1))
+	case op.IsComparison():
+		s += fmt.Sprintf(" %s %s, %s", i.Args[0].Type(), arg(0), arg(1))
+	case op.IsUnary():
+		s += fmt.Sprintf(" %s %s", i.Typ, arg(0))
+	case op.IsConversion():
+		s += fmt.Sprintf(" %s %s to %s", i.Args[0].Type(), arg(0), i.Typ)
+	case op == OpAlloca:
+		s += fmt.Sprintf(" %d", i.Size)
+	case op == OpPtrAdd:
+		s += fmt.Sprintf(" %s, %s", arg(0), arg(1))
+	case op == OpLoad:
+		s += volatile(i) + fmt.Sprintf(" %s, %s", i.Typ, arg(0))
+	case op == OpStore:
+		s += volatile(i) + fmt.Sprintf(" %s %s, %s", i.Args[1].Type(), arg(1), arg(0))
+	case op == OpCopy:
+		s += fmt.Sprintf(" %s, %s, %d", arg(0), arg(1), i.Size)
+	case op == OpCall:
+		if i.Typ != Void {
+			s += " " + i.Typ.String()
+		}
+		args := make([]string, len(i.Args))
+		for n, a := range i.Args {
+			args[n] = a.Type().String() + " " + a.Ref()
+		}
+		s += fmt.Sprintf(" @%s(%s)", i.Callee, strings.Join(args, ", "))
+	case op == OpIntRestore:
+		s += " " + arg(0)
+	case op == OpJump:
+		s += " " + i.Block.Succs[0].Name()
+	case op == OpBranch:
+		s += fmt.Sprintf(" %s, %s, %s", arg(0), i.Block.Succs[0].Name(), i.Block.Succs[1].Name())
+	case op == OpSwitch:
+		cases := make([]string, len(i.Cases))
+		for n, c := range i.Cases {
+			cases[n] = fmt.Sprintf("%d: %s", c, i.Block.Succs[n+1].Name())
+		}
+		s += fmt.Sprintf(" %s %s, %s [%s]", i.Args[0].Type(), arg(0), i.Block.Succs[0].Name(),
+			strings.Join(cases, ", "))
+	case op == OpReturn:
+		if len(i.Args) > 0 {
+			s += fmt.Sprintf(" %s %s", i.Args[0].Type(), arg(0))
+		}
+	}
+
+	return s
+}
+
+func volatile(i *Instr) string {
+	if i.Volatile {
+		return " volatile"
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package ir
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrint(t *testing.T) {
+	Convey("Print", t, func() {
+		Convey("It prints constants so they read back as the same value", func() {
+			So(IntConst(I8, 255).Ref(), ShouldEqual, "-1")
+			So(IntConst(I16, 0x12345).Ref(), ShouldEqual, "9029")
+			So(IntConst(I1, 3).Ref(), ShouldEqual, "true")
+			So(FloatConst(2).Ref(), ShouldEqual, "2.0")
+			So(FloatConst(0.1).Ref(), ShouldEqual, "0.10000000149011612")
+			So(FloatConst(1e20).Ref(), ShouldEqual, "1.0000000200408773e+20")
+			So(FloatConst(math.Inf(-1)).Ref(), ShouldEqual, "-inf")
+		})
+
+		Convey("It prints result types of binary ops and operand types of comparisons", func() {
+			a := &Param{Name: "a", Typ: I16}
+			add := &Instr{Op: OpAdd, Typ: I8, Args: []Value{a, IntConst(I8, 1)}}
+			So(add.String(), ShouldEqual, "%0 = add i8 %a, 1")
+
+			lt := &Instr{Op: OpULt, Typ: I1, Args: []Value{a, IntConst(I16, 1)}, ID: 1}
+			So(lt.String(), ShouldEqual, "%1 = ult i16 %a, 1")
+		})
+
+		Convey("It prints globals and functions", func() {
+			f := &Func{Name: "pick", Params: []*Param{{Name: "n", Typ: I8}}, Result: I8}
+			entry, one, done := f.NewBlock(), f.NewBlock(), f.NewBlock()
+
+			sw := &Instr{Op: OpSwitch, Args: []Value{f.Params[0]}, Block: entry, Cases: []int64{1, 2}}
+			entry.Instrs = []*Instr{sw}
+			entry.Succs = []*Block{done, one, one}
+			one.Preds = []*Block{entry}
+			one.Instrs = []*Instr{{Op: OpJump, Block: one}}
+			one.Succs = []*Block{done}
+
+			done.Preds = []*Block{entry, one}
+			phi := &Instr{Op: OpPhi, Typ: I8, Args: []Value{IntConst(I8, 0), f.Params[0]}, Block: done}
+			done.Instrs = []*Instr{phi, {Op: OpReturn, Args: []Value{phi}, Block: done}}
+			f.Renumber()
+
+			m := &Module{
+				Globals: []*Global{{Name: "flags", Size: 2, Init: []byte{1, 0}, Volatile: true}},
+				Funcs:   []*Func{f},
+			}
+			So(Verify(m), ShouldBeNil)
+			So(m.String(), ShouldEqual, `@flags = volatile global 2 x"0100"
+
+func @pick(%n: i8) -> i8 {
+b0:
+  switch i8 %n, b2 [1: b1, 2: b1]
+b1:
+  jmp b2
+b2:
+  %0 = phi i8 [0, b0], [%n, b1]
+  ret i8 %0
+}
+`)
+		})
+	})
+}
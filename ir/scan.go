@@ -0,0 +1,191 @@
+package ir
+
+import (
+	"fmt"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// tokenKind is the kind of a token of the textual format.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+
+	// tokName is a keyword, type, op or label, eg ret, i8 or b0.
+	tokName
+
+	// tokLocal is a %name, tokGlobal a @name; text of them is the name.
+	tokLocal
+	tokGlobal
+
+	// tokNumber is an integer or float, with its sign.
+	tokNumber
+
+	// tokBytes is x"hex" of a global's value; text of it is the hex.
+	tokBytes
+
+	// tokPunct is one of = , : ( ) [ ] { } ->
+	tokPunct
+)
+
+type irToken struct {
+	kind tokenKind
+	text string
+	span token.Span
+}
+
+// describe returns how the token is shown in errors.
+func (t irToken) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "newline"
+	case tokLocal:
+		return fmt.Sprintf("%q", "%"+t.text)
+	case tokGlobal:
+		return fmt.Sprintf("%q", "@"+t.text)
+	case tokBytes:
+		return fmt.Sprintf("%q", "x\""+t.text+"\"")
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// scanner splits source of the textual format into tokens. Newlines are
+// tokens, since every instruction takes a line; ; starts a comment that
+// runs to the end of the line.
+type scanner struct {
+	src  []rune
+	off  int
+	pos  token.Pos
+	errs []irToken
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// scan returns tokens of src, ending with tokEOF, and runes that don't start
+// a token.
+func scan(src string) ([]irToken, []irToken) {
+	s := &scanner{src: []rune(src), pos: token.Pos{Line: 1, Column: 1}}
+	var tokens []irToken
+	for {
+		t := s.next()
+		tokens = append(tokens, t)
+		if t.kind == tokEOF {
+			return tokens, s.errs
+		}
+	}
+}
+
+func (s *scanner) peek(n int) rune {
+	if s.off+n < len(s.src) {
+		return s.src[s.off+n]
+	}
+	return 0
+}
+
+func (s *scanner) advance() rune {
+	r := s.src[s.off]
+	s.off++
+	s.pos.Offset++
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
+	return r
+}
+
+// name advances over runes of a name and returns them.
+func (s *scanner) name() string {
+	start := s.off
+	for s.off < len(s.src) && isNameRune(s.src[s.off]) {
+		s.advance()
+	}
+	return string(s.src[start:s.off])
+}
+
+func (s *scanner) next() irToken {
+	for s.off < len(s.src) {
+		switch r := s.peek(0); {
+		case r == ' ' || r == '\t' || r == '\r':
+			s.advance()
+			continue
+		case r == ';':
+			for s.off < len(s.src) && s.peek(0) != '\n' {
+				s.advance()
+			}
+			continue
+		}
+		break
+	}
+
+	start := s.pos
+	t := irToken{}
+	switch r := s.peek(0); {
+	case s.off >= len(s.src):
+		t.kind = tokEOF
+	case r == '\n':
+		s.advance()
+		t.kind, t.text = tokNewline, "\n"
+	case r == '%' || r == '@':
+		s.advance()
+		t.kind, t.text = tokLocal, s.name()
+		if r == '@' {
+			t.kind = tokGlobal
+		}
+	case r == 'x' && s.peek(1) == '"':
+		s.advance()
+		s.advance()
+		t.kind = tokBytes
+		from := s.off
+		for s.off < len(s.src) && s.peek(0) != '"' && s.peek(0) != '\n' {
+			s.advance()
+		}
+		t.text = string(s.src[from:s.off])
+		if s.peek(0) == '"' {
+			s.advance()
+		}
+	case r == '-' && s.peek(1) == '>':
+		s.advance()
+		s.advance()
+		t.kind, t.text = tokPunct, "->"
+	case r == '-' || isDigit(r):
+		// numbers like -1, 0.5, 1e+20 and -inf
+		t.kind = tokNumber
+		from := s.off
+		s.advance()
+		for s.off < len(s.src) {
+			r := s.peek(0)
+			prev := s.src[s.off-1]
+			if !isNameRune(r) && !((r == '+' || r == '-') && (prev == 'e' || prev == 'E')) {
+				break
+			}
+			s.advance()
+		}
+		t.text = string(s.src[from:s.off])
+	case isNameRune(r):
+		t.kind, t.text = tokName, s.name()
+	default:
+		s.advance()
+		t.kind, t.text = tokPunct, string(r)
+		switch r {
+		case '=', ',', ':', '(', ')', '[', ']', '{', '}':
+		default:
+			s.errs = append(s.errs, irToken{tokPunct, t.text, token.Span{Start: start, End: s.pos}})
+			return s.next()
+		}
+	}
+
+	t.span = token.Span{Start: start, End: s.pos}
+	return t
+}
@@ -0,0 +1,478 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Verify checks m is well formed, returning what's wrong with it, if
+// anything:
+//
+//   - blocks end with a terminator, and have the successors it goes to;
+//   - preds of blocks are the blocks they're successors of, each once;
+//   - phis come first in blocks, with an operand for each pred;
+//   - operands are of the types their instructions need, and calls of
+//     functions of m match their parameters;
+//   - each value is assigned once, by an instruction of the function, whose
+//     block dominates where it's used, ie every path to the use goes
+//     through it; a phi's operands are used at the end of their preds.
+func Verify(m *Module) error {
+	v := &verifier{m: m}
+	for _, f := range m.Funcs {
+		v.fn(f)
+	}
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(v.errs, "\n"))
+}
+
+type verifier struct {
+	m    *Module
+	f    *Func
+	errs []string
+
+	// pos are where instructions of f are in their blocks.
+	pos map[*Instr]int
+
+	idom map[*Block]*Block
+}
+
+func (v *verifier) errorf(b *Block, i *Instr, format string, args ...interface{}) {
+	prefix := "@" + v.f.Name + ": "
+	if b != nil {
+		prefix += b.Name() + ": "
+	}
+	if i != nil {
+		if i.Typ != Void {
+			prefix += i.Ref() + " = "
+		}
+		prefix += i.Op.String() + ": "
+	}
+	v.errs = append(v.errs, prefix+fmt.Sprintf(format, args...))
+}
+
+func (v *verifier) fn(f *Func) {
+	v.f = f
+	v.pos = map[*Instr]int{}
+	if len(f.Blocks) == 0 {
+		v.errorf(nil, nil, "function has no blocks")
+		return
+	}
+	if len(f.Blocks[0].Preds) > 0 {
+		v.errorf(f.Blocks[0], nil, "entry block has preds")
+	}
+
+	ids := map[int]bool{}
+	for i, b := range f.Blocks {
+		if b.Index != i || b.Func != f {
+			v.errorf(b, nil, "block is numbered %d but is block %d of the function", b.Index, i)
+		}
+		for n, instr := range b.Instrs {
+			v.pos[instr] = n
+			if instr.Typ == Void {
+				continue
+			}
+			if ids[instr.ID] {
+				v.errorf(b, instr, "value numbered %d is assigned twice", instr.ID)
+			}
+			ids[instr.ID] = true
+		}
+	}
+
+	for _, b := range f.Blocks {
+		v.block(b)
+	}
+	if len(v.errs) > 0 {
+		// dominators need a well formed graph
+		return
+	}
+
+	v.idom = dominators(f)
+	for _, b := range f.Blocks {
+		for _, instr := range b.Instrs {
+			v.uses(b, instr)
+		}
+	}
+}
+
+func (v *verifier) block(b *Block) {
+	if b.Terminator() == nil {
+		v.errorf(b, nil, "block doesn't end with a terminator")
+	}
+
+	phis := true
+	for n, instr := range b.Instrs {
+		if instr.Block != b {
+			v.errorf(b, instr, "instruction isn't of its block")
+		}
+		if instr.Op.IsTerminator() && n != len(b.Instrs)-1 {
+			v.errorf(b, instr, "terminator isn't last in its block")
+		}
+		if instr.Op == OpPhi && !phis {
+			v.errorf(b, instr, "phi after other instructions")
+		}
+		phis = phis && instr.Op == OpPhi
+		v.instr(b, instr)
+	}
+
+	for _, succ := range b.Succs {
+		if succ.Func != v.f {
+			v.errorf(b, nil, "successor isn't a block of the function")
+		} else if !containsBlock(succ.Preds, b) {
+			v.errorf(succ, nil, "preds don't have %s, which goes to it", b.Name())
+		}
+	}
+	for n, pred := range b.Preds {
+		if !containsBlock(pred.Succs, b) {
+			v.errorf(b, nil, "pred %s doesn't go to it", pred.Name())
+		}
+		if containsBlock(b.Preds[:n], pred) {
+			v.errorf(b, nil, "pred %s is there twice", pred.Name())
+		}
+	}
+}
+
+// instr checks operands of instr are of the types it needs.
+func (v *verifier) instr(b *Block, i *Instr) {
+	for _, arg := range i.Args {
+		if arg == nil {
+			v.errorf(b, i, "operand is missing")
+			return
+		}
+	}
+
+	args := func(types ...Type) bool {
+		if len(i.Args) != len(types) {
+			v.errorf(b, i, "takes %d operands, found %d", len(types), len(i.Args))
+			return false
+		}
+		for n, t := range types {
+			if i.Args[n].Type() != t {
+				v.errorf(b, i, "operand %d must be %s, found %s", n+1, t, i.Args[n].Type())
+				return false
+			}
+		}
+		return true
+	}
+	result := func(t Type) {
+		if i.Typ != t {
+			v.errorf(b, i, "must be %s, found %s", t, i.Typ)
+		}
+	}
+	succs := func(n int) {
+		if len(b.Succs) != n {
+			v.errorf(b, i, "needs %d successors, block has %d", n, len(b.Succs))
+		}
+	}
+
+	op := i.Op
+	switch {
+	case op == OpPhi:
+		if len(i.Args) != len(b.Preds) {
+			v.errorf(b, i, "has %d operands for %d preds", len(i.Args), len(b.Preds))
+			return
+		}
+		for n, arg := range i.Args {
+			if arg.Type() != i.Typ {
+				v.errorf(b, i, "operand for %s must be %s, found %s", b.Preds[n].Name(), i.Typ, arg.Type())
+			}
+		}
+	case op.IsBinary(), op.IsUnary():
+		v.operandType(b, i, i.Typ)
+		if op.IsBinary() {
+			args(i.Typ, i.Typ)
+		} else {
+			args(i.Typ)
+		}
+	case op.IsComparison():
+		result(I1)
+		if len(i.Args) == 2 && args(i.Args[0].Type(), i.Args[0].Type()) {
+			v.operandType(b, i, i.Args[0].Type())
+		} else if len(i.Args) != 2 {
+			v.errorf(b, i, "takes 2 operands, found %d", len(i.Args))
+		}
+	case op.IsConversion():
+		if len(i.Args) != 1 {
+			v.errorf(b, i, "takes 1 operand, found %d", len(i.Args))
+			return
+		}
+		v.conversion(b, i, i.Args[0].Type(), i.Typ)
+	case op == OpAlloca:
+		result(Ptr)
+		args()
+		if i.Size <= 0 {
+			v.errorf(b, i, "size must be positive, found %d", i.Size)
+		}
+		if b != v.f.Blocks[0] {
+			v.errorf(b, i, "stack slots must be in the entry block")
+		}
+	case op == OpPtrAdd:
+		result(Ptr)
+		args(Ptr, I16)
+	case op == OpLoad:
+		if i.Typ == Void || i.Typ == I64 {
+			v.errorf(b, i, "can't load a %s", i.Typ)
+		}
+		args(Ptr)
+	case op == OpStore:
+		result(Void)
+		if len(i.Args) != 2 {
+			v.errorf(b, i, "takes 2 operands, found %d", len(i.Args))
+		} else if args(Ptr, i.Args[1].Type()) && i.Args[1].Type() == Void {
+			v.errorf(b, i, "stored value has none")
+		}
+	case op == OpCopy:
+		result(Void)
+		args(Ptr, Ptr)
+		if i.Size <= 0 {
+			v.errorf(b, i, "size must be positive, found %d", i.Size)
+		}
+	case op == OpCall:
+		v.call(b, i)
+	case op == OpIntSave:
+		result(I8)
+		args()
+	case op == OpIntRestore:
+		result(Void)
+		args(I8)
+	case op == OpJump:
+		args()
+		succs(1)
+	case op == OpBranch:
+		args(I1)
+		succs(2)
+	case op == OpSwitch:
+		if len(i.Args) != 1 || !i.Args[0].Type().IsInt() {
+			v.errorf(b, i, "takes an integer operand")
+		}
+		succs(len(i.Cases) + 1)
+		seen := map[int64]bool{}
+		for _, c := range i.Cases {
+			if seen[c] {
+				v.errorf(b, i, "case %d is there twice", c)
+			}
+			seen[c] = true
+		}
+	case op == OpReturn:
+		if v.f.Result == Void {
+			args()
+		} else {
+			args(v.f.Result)
+		}
+		succs(0)
+	case op == OpUnreachable:
+		args()
+		succs(0)
+	default:
+		v.errorf(b, i, "unknown op %d", op)
+	}
+
+	if op != OpCall && !op.IsTerminator() && op != OpStore && op != OpCopy && op != OpIntRestore && i.Typ == Void {
+		v.errorf(b, i, "must have a value")
+	}
+}
+
+// operandType checks t is a type operation of i is defined on.
+func (v *verifier) operandType(b *Block, i *Instr, t Type) {
+	switch {
+	case i.Op.IsFloat():
+		if t != F32 {
+			v.errorf(b, i, "is only defined on f32, found %s", t)
+		}
+	case i.Op == OpEq, i.Op == OpNe:
+		if !t.IsInt() && t != Ptr {
+			v.errorf(b, i, "is only defined on integers and ptr, found %s", t)
+		}
+	default:
+		if !t.IsInt() {
+			v.errorf(b, i, "is only defined on integers, found %s", t)
+		}
+	}
+}
+
+func (v *verifier) conversion(b *Block, i *Instr, from, to Type) {
+	ok := false
+	switch i.Op {
+	case OpTrunc:
+		ok = from.IsInt() && to.IsInt() && to.Bits() < from.Bits()
+	case OpZExt, OpSExt:
+		ok = from.IsInt() && to.IsInt() && to.Bits() > from.Bits()
+	case OpSIToFP, OpUIToFP:
+		ok = from.IsInt() && to == F32
+	case OpFPToSI, OpFPToUI:
+		ok = from == F32 && to.IsInt()
+	}
+	if !ok {
+		v.errorf(b, i, "can't convert %s to %s", from, to)
+	}
+}
+
+func (v *verifier) call(b *Block, i *Instr) {
+	if i.Callee == "" {
+		v.errorf(b, i, "has no callee")
+		return
+	}
+
+	f := v.m.Func(i.Callee)
+	if f == nil {
+		// functions of other modules are checked when they're linked
+		return
+	}
+	if i.Typ != f.Result {
+		v.errorf(b, i, "@%s returns %s, found %s", f.Name, f.Result, i.Typ)
+	}
+	if len(i.Args) != len(f.Params) {
+		v.errorf(b, i, "@%s takes %d arguments, found %d", f.Name, len(f.Params), len(i.Args))
+		return
+	}
+	for n, p := range f.Params {
+		if t := i.Args[n].Type(); t != p.Typ {
+			v.errorf(b, i, "argument %s of @%s must be %s, found %s", p.Ref(), f.Name, p.Typ, t)
+		}
+	}
+}
+
+// uses checks operands of instr are defined where it uses them.
+func (v *verifier) uses(b *Block, instr *Instr) {
+	for n, arg := range instr.Args {
+		switch arg := arg.(type) {
+		case *Param:
+			if !containsParam(v.f.Params, arg) {
+				v.errorf(b, instr, "%s isn't a parameter of the function", arg.Ref())
+			}
+		case *Global:
+			if v.m.Global(arg.Name) != arg {
+				v.errorf(b, instr, "%s isn't a global of the module", arg.Ref())
+			}
+		case *Instr:
+			def := arg
+			if _, ok := v.pos[def]; !ok || def.Block.Func != v.f {
+				v.errorf(b, instr, "%s isn't an instruction of the function", def.Ref())
+				continue
+			}
+			if def.Typ == Void {
+				v.errorf(b, instr, "%s has no value", def.Op)
+				continue
+			}
+
+			switch {
+			case instr.Op == OpPhi:
+				if pred := b.Preds[n]; !v.dominates(def.Block, pred) {
+					v.errorf(b, instr, "%s doesn't dominate end of pred %s", def.Ref(), pred.Name())
+				}
+			case def.Block == b:
+				if v.pos[def] >= v.pos[instr] {
+					v.errorf(b, instr, "%s is used before it's assigned", def.Ref())
+				}
+			case !v.dominates(def.Block, b):
+				v.errorf(b, instr, "%s doesn't dominate its use", def.Ref())
+			}
+		}
+	}
+}
+
+func containsParam(params []*Param, p *Param) bool {
+	for _, x := range params {
+		if x == p {
+			return true
+		}
+	}
+	return false
+}
+
+// dominates returns if a dominates b. Blocks no path reaches are dominated
+// by every block, since there's no path to them that avoids it.
+func (v *verifier) dominates(a, b *Block) bool {
+	if _, ok := v.idom[b]; !ok {
+		return true
+	}
+	for {
+		if a == b {
+			return true
+		}
+		up := v.idom[b]
+		if up == b {
+			return false
+		}
+		b = up
+	}
+}
+
+// dominators returns immediate dominators of blocks of f a path from entry
+// reaches; entry's is itself. It's the algorithm of Cooper, Harvey and
+// Kennedy's "A Simple, Fast Dominance Algorithm".
+func dominators(f *Func) map[*Block]*Block {
+	order := postorder(f)
+	num := map[*Block]int{}
+	for n, b := range order {
+		num[b] = n
+	}
+
+	entry := f.Blocks[0]
+	idom := map[*Block]*Block{entry: entry}
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for num[a] < num[b] {
+				a = idom[a]
+			}
+			for num[b] < num[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for n := len(order) - 1; n >= 0; n-- {
+			b := order[n]
+			if b == entry {
+				continue
+			}
+
+			var dom *Block
+			for _, pred := range b.Preds {
+				if _, ok := idom[pred]; !ok {
+					continue
+				}
+				if dom == nil {
+					dom = pred
+				} else {
+					dom = intersect(pred, dom)
+				}
+			}
+			if dom != nil && idom[b] != dom {
+				idom[b] = dom
+				changed = true
+			}
+		}
+	}
+
+	return idom
+}
+
+// postorder returns blocks of f a path from entry reaches, each after the
+// blocks it goes to, but for back edges of loops. Successors are visited last
+// to first, so the reverse is in the order code is written, eg then blocks
+// before else blocks.
+func postorder(f *Func) []*Block {
+	var order []*Block
+	seen := map[*Block]bool{}
+
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		seen[b] = true
+		for n := len(b.Succs) - 1; n >= 0; n-- {
+			if succ := b.Succs[n]; !seen[succ] {
+				visit(succ)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(f.Blocks[0])
+
+	return order
+}
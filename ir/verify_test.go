@@ -0,0 +1,57 @@
+package ir
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerify(t *testing.T) {
+	Convey("Verify", t, func() {
+		Convey("It reports blocks without terminators", func() {
+			m := lower("fn f(a: u8) -> u8 { return a + 1; }")
+			b := m.Funcs[0].Blocks[0]
+			b.Instrs = b.Instrs[:len(b.Instrs)-1]
+			So(Verify(m).Error(), ShouldEqual, "@f: b0: block doesn't end with a terminator")
+		})
+
+		Convey("It reports operands of the wrong type", func() {
+			m := lower("fn f(a: u8, b: u16) -> u16 { return b + u16(a); }")
+			add := m.Funcs[0].Blocks[0].Instrs[1]
+			add.Args[1] = m.Funcs[0].Params[0]
+			So(Verify(m).Error(), ShouldEqual, "@f: b0: %1 = add: operand 2 must be i16, found i8")
+		})
+
+		Convey("It reports uses of values that don't dominate them", func() {
+			m := lower(`
+fn f(c: bool, a: u8) -> u8 {
+  var x: u8 = 0;
+  if c { x = a + 1; }
+  return x;
+}`)
+			f := m.Funcs[0]
+			ret := f.Blocks[2].Terminator()
+			ret.Args[0] = f.Blocks[1].Instrs[0]
+			So(Verify(m).Error(), ShouldEqual, "@f: b2: ret: %0 doesn't dominate its use")
+		})
+
+		Convey("It reports phis without an operand for each pred", func() {
+			m := lower(`
+fn f(c: bool, a: u8) -> u8 {
+  var x: u8 = 0;
+  if c { x = a + 1; }
+  return x;
+}`)
+			phi := m.Funcs[0].Blocks[2].Instrs[0]
+			phi.Args = phi.Args[:1]
+			So(Verify(m).Error(), ShouldEqual, "@f: b2: %1 = phi: has 1 operands for 2 preds")
+		})
+
+		Convey("It reports calls that don't match the function", func() {
+			m := lower("fn g(a: u8) -> u8 { return a; } fn f() -> u8 { return g(1); }")
+			call := m.Funcs[1].Blocks[0].Instrs[0]
+			call.Args[0] = IntConst(I16, 1)
+			So(Verify(m).Error(), ShouldEqual, "@f: b0: %0 = call: argument %a of @g must be i8, found i16")
+		})
+	})
+}
@@ -0,0 +1,360 @@
+package layout
+
+import (
+	"strconv"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Sizes are the sizes in bytes of builtin types on AVR. AVR can load any type
+// from any address, so builtin types don't need to be aligned.
+var Sizes = map[string]int{
+	"bool": 1,
+	"u8":   1,
+	"i8":   1,
+	"u16":  2,
+	"i16":  2,
+	"u32":  4,
+	"i32":  4,
+	"f32":  4,
+
+	"q1.7":   1,
+	"q4.4":   1,
+	"q1.15":  2,
+	"q8.8":   2,
+	"q1.31":  4,
+	"q16.16": 4,
+}
+
+// Struct is the memory layout of a struct.
+type Struct struct {
+	Name string
+
+	// Size is in bytes, including padding at the end to keep arrays of the
+	// struct aligned.
+	Size int
+
+	// Align is what offset of the struct must be a multiple of.
+	Align int
+
+	// Packed is if the struct was declared packed, ie without any padding.
+	Packed bool
+
+	Fields []*Field
+}
+
+// Field is the layout of a field of a struct.
+type Field struct {
+	Name   string
+	Offset int
+	Size   int
+	Align  int
+
+	// Struct is layout of the field's type if it's a struct, else nil.
+	Struct *Struct
+}
+
+// Field returns field of struct with given name, or nil if there's none.
+func (s *Struct) Field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Layouts are layouts of structs in a file, keyed by name.
+type Layouts map[string]*Struct
+
+// Offsetof returns offset of field at given path from start of named struct,
+// eg Offsetof("Packet", "header", "id") for p.header.id.
+func (l Layouts) Offsetof(name string, path ...string) (int, bool) {
+	s, ok := l[name]
+	if !ok {
+		return 0, false
+	}
+
+	offset := 0
+	for _, fieldName := range path {
+		if s == nil {
+			return 0, false
+		}
+
+		f := s.Field(fieldName)
+		if f == nil {
+			return 0, false
+		}
+
+		offset += f.Offset
+		s = f.Struct
+	}
+
+	return offset, true
+}
+
+// Types are what checks found out about types in a file that layouts
+// depend on.
+type Types interface {
+	// Len returns length of given array type, if it's valid.
+	Len(typ *ast.ArrayType) (int64, bool)
+
+	// Size returns size in bytes of given named type if it's valid and not a
+	// struct, eg of a builtin type or an enum.
+	Size(name *ast.Ident) (int, bool)
+}
+
+// syntax are types known without checks: builtin types, and arrays with
+// literal lengths.
+type syntax struct{}
+
+func (syntax) Len(typ *ast.ArrayType) (int64, bool) { return ArrayLen(typ) }
+
+func (syntax) Size(name *ast.Ident) (int, bool) {
+	size, ok := Sizes[name.Name]
+	return size, ok
+}
+
+// Compute computes layouts of structs declared in given file. Types can be
+// nil, in which case only what's known from syntax is used, and Compute
+// reports unknown types and structs declared twice itself; otherwise the
+// checks reported them. Structs with a field whose layout isn't known have
+// no layout.
+//
+// Fields are laid out in declared order without padding, unless a field is
+// given an align(N) attribute, which pads its offset to a multiple of N. A
+// struct's alignment is the largest of its fields, or N if it's given an
+// align(N) attribute, and its size is padded to a multiple of it. Structs
+// declared packed never have padding between fields.
+func Compute(file *ast.File, types Types) (Layouts, diag.List) {
+	c := &computer{
+		types:    types,
+		report:   types == nil,
+		decls:    map[string]*ast.StructDecl{},
+		layouts:  Layouts{},
+		failed:   map[string]bool{},
+		visiting: map[string]bool{},
+	}
+	if types == nil {
+		c.types = syntax{}
+	}
+
+	for _, decl := range file.Decls {
+		if s, ok := decl.(*ast.StructDecl); ok {
+			if prev, ok := c.decls[s.Name.Name]; ok {
+				if c.report {
+					c.diags.Add(s.Name.Loc, "struct %s already declared at %s",
+						s.Name.Name, prev.Name.Loc)
+				}
+				continue
+			}
+			c.decls[s.Name.Name] = s
+		}
+	}
+
+	for _, decl := range file.Decls {
+		if s, ok := decl.(*ast.StructDecl); ok && c.decls[s.Name.Name] == s {
+			c.compute(s)
+		}
+	}
+
+	return c.layouts, c.diags
+}
+
+type computer struct {
+	types Types
+
+	// report is if problems the checks find are reported, ie if no Types
+	// were given.
+	report bool
+
+	decls   map[string]*ast.StructDecl
+	layouts Layouts
+	diags   diag.List
+
+	// failed are structs that have no layout.
+	failed map[string]bool
+
+	// visiting are structs whose layout is being computed, to find structs
+	// that contain themselves.
+	visiting map[string]bool
+}
+
+func (c *computer) compute(decl *ast.StructDecl) *Struct {
+	name := decl.Name.Name
+	if s, ok := c.layouts[name]; ok || c.failed[name] {
+		return s
+	}
+
+	if c.visiting[name] {
+		c.diags.Add(decl.Name.Loc, "struct %s contains itself", name)
+		c.failed[name] = true
+		return nil
+	}
+	c.visiting[name] = true
+	defer delete(c.visiting, name)
+
+	s := &Struct{Name: name, Align: 1}
+	structAlign := 0
+	for _, attr := range decl.Attrs {
+		switch attr.Name.Name {
+		case "packed":
+			c.noArgs(attr)
+			s.Packed = true
+		case "align":
+			structAlign = c.alignArg(attr)
+		default:
+			c.diags.Add(attr.Loc, "unknown struct attribute %s", attr.Name.Name)
+		}
+	}
+
+	offset, ok := 0, true
+	for _, fieldDecl := range decl.Fields {
+		if s.Field(fieldDecl.Name.Name) != nil {
+			c.diags.Add(fieldDecl.Name.Loc, "duplicate field %s in struct %s",
+				fieldDecl.Name.Name, name)
+			continue
+		}
+
+		f := c.field(fieldDecl)
+		if f == nil {
+			ok = false
+			continue
+		}
+
+		if s.Packed {
+			f.Align = 1
+			for _, attr := range fieldDecl.Attrs {
+				if attr.Name.Name == "align" {
+					c.diags.Add(attr.Loc, "field %s cannot be aligned in packed struct %s",
+						f.Name, name)
+				}
+			}
+		}
+
+		f.Offset = roundUp(offset, f.Align)
+		offset = f.Offset + f.Size
+		if f.Align > s.Align {
+			s.Align = f.Align
+		}
+		s.Fields = append(s.Fields, f)
+	}
+
+	if structAlign > 0 {
+		s.Align = structAlign
+	}
+	s.Size = roundUp(offset, s.Align)
+
+	if !ok {
+		c.failed[name] = true
+		return nil
+	}
+	c.layouts[name] = s
+	return s
+}
+
+// field returns layout of given field without its offset, or nil if its
+// type is unknown.
+func (c *computer) field(decl *ast.Field) *Field {
+	f := &Field{Name: decl.Name.Name}
+
+	var ok bool
+	f.Size, f.Align, f.Struct, ok = c.typeLayout(decl.Type)
+	if !ok {
+		return nil
+	}
+
+	for _, attr := range decl.Attrs {
+		switch attr.Name.Name {
+		case "align":
+			if align := c.alignArg(attr); align > f.Align {
+				f.Align = align
+			}
+		default:
+			c.diags.Add(attr.Loc, "unknown field attribute %s", attr.Name.Name)
+		}
+	}
+
+	return f
+}
+
+// typeLayout returns size and alignment of given type, and its layout if
+// it's a struct. Arrays are laid out as their elements one after another.
+func (c *computer) typeLayout(typ ast.Expr) (size, align int, s *Struct, ok bool) {
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		if decl, ok := c.decls[typ.Name]; ok {
+			if s = c.compute(decl); s != nil {
+				return s.Size, s.Align, s, true
+			}
+			return 0, 0, nil, false
+		}
+
+		if size, ok := c.types.Size(typ); ok {
+			return size, 1, nil, true
+		}
+
+		if c.report {
+			c.diags.Add(typ.Loc, "unknown type %s", typ.Name)
+		}
+	case *ast.ArrayType:
+		length, ok := c.types.Len(typ)
+		if !ok {
+			if c.report {
+				c.diags.Add(typ.Len.Span(), "array length must be a constant")
+			}
+			return 0, 0, nil, false
+		}
+
+		size, align, _, ok := c.typeLayout(typ.Elem)
+		return int(length) * size, align, nil, ok
+	default:
+		if c.report {
+			c.diags.Add(typ.Span(), "unsupported type")
+		}
+	}
+
+	return 0, 0, nil, false
+}
+
+func (c *computer) noArgs(attr *ast.Attr) {
+	if len(attr.Args) > 0 {
+		c.diags.Add(attr.Loc, "%s takes no arguments", attr.Name.Name)
+	}
+}
+
+// alignArg returns N of align(N), or 0 if it's invalid.
+func (c *computer) alignArg(attr *ast.Attr) int {
+	if len(attr.Args) != 1 {
+		c.diags.Add(attr.Loc, "align takes one argument")
+		return 0
+	}
+
+	lit, ok := attr.Args[0].(*ast.BasicLit)
+	if ok {
+		if n, err := strconv.Atoi(lit.Value); err == nil && n > 0 && n&(n-1) == 0 {
+			return n
+		}
+	}
+
+	c.diags.Add(attr.Args[0].Span(), "alignment must be a power of two")
+	return 0
+}
+
+// ArrayLen returns length of given array type, if it's an integer literal.
+func ArrayLen(typ *ast.ArrayType) (int64, bool) {
+	lit, ok := typ.Len.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INTEGER {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(lit.Value, 0, 64)
+	return n, err == nil && n >= 0
+}
+
+func roundUp(n, multiple int) int {
+	return (n + multiple - 1) / multiple * multiple
+}
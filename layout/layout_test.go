@@ -0,0 +1,132 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func compute(src string) (Layouts, diag.List) {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	return Compute(file, nil)
+}
+
+func TestLayout(t *testing.T) {
+	Convey("Layout", t, func() {
+		Convey("It lays out fields without padding by default", func() {
+			layouts, diags := compute("struct Packet { id: u8, value: u16, flags: u8, crc: u32 }")
+			So(diags, ShouldBeEmpty)
+
+			p := layouts["Packet"]
+			So(p.Size, ShouldEqual, 8)
+			So(p.Align, ShouldEqual, 1)
+			So(p.Field("id").Offset, ShouldEqual, 0)
+			So(p.Field("value").Offset, ShouldEqual, 1)
+			So(p.Field("value").Size, ShouldEqual, 2)
+			So(p.Field("flags").Offset, ShouldEqual, 3)
+			So(p.Field("crc").Offset, ShouldEqual, 4)
+		})
+
+		Convey("It pads aligned fields", func() {
+			layouts, diags := compute("struct S { a: u8, b: u16 align(2), c: u8 }")
+			So(diags, ShouldBeEmpty)
+
+			s := layouts["S"]
+			So(s.Field("b").Offset, ShouldEqual, 2)
+			So(s.Field("c").Offset, ShouldEqual, 4)
+			So(s.Align, ShouldEqual, 2)
+			So(s.Size, ShouldEqual, 6)
+		})
+
+		Convey("It pads size of aligned structs", func() {
+			layouts, diags := compute("struct S align(4) { a: u8, b: u8 }")
+			So(diags, ShouldBeEmpty)
+			So(layouts["S"].Size, ShouldEqual, 4)
+			So(layouts["S"].Align, ShouldEqual, 4)
+		})
+
+		Convey("It lays out packed structs", func() {
+			layouts, diags := compute("struct Regs packed { ctrl: u8, data: u16 }")
+			So(diags, ShouldBeEmpty)
+			So(layouts["Regs"].Packed, ShouldBeTrue)
+			So(layouts["Regs"].Size, ShouldEqual, 3)
+		})
+
+		Convey("It lays out nested structs in any order", func() {
+			layouts, diags := compute(`
+struct Packet { kind: u8, header: Header }
+struct Header align(2) { id: u8, len: u16 }
+`)
+			So(diags, ShouldBeEmpty)
+
+			p := layouts["Packet"]
+			So(p.Field("header").Offset, ShouldEqual, 2)
+			So(p.Field("header").Size, ShouldEqual, 4)
+			So(p.Size, ShouldEqual, 6)
+
+			offset, ok := layouts.Offsetof("Packet", "header", "len")
+			So(ok, ShouldBeTrue)
+			So(offset, ShouldEqual, 3)
+
+			_, ok = layouts.Offsetof("Packet", "header", "missing")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("It ignores alignment of nested structs in packed structs", func() {
+			layouts, diags := compute(`
+struct Header align(2) { id: u8 }
+struct Packet packed { kind: u8, header: Header }
+`)
+			So(diags, ShouldBeEmpty)
+			So(layouts["Packet"].Field("header").Offset, ShouldEqual, 1)
+			So(layouts["Packet"].Size, ShouldEqual, 3)
+		})
+
+		Convey("It lays out arrays as their elements", func() {
+			layouts, diags := compute(`
+struct Point align(2) { x: u8 }
+struct Frame { len: u8, data: [8]u8, points: [3]Point, crc: u16 }
+`)
+			So(diags, ShouldBeEmpty)
+
+			f := layouts["Frame"]
+			So(f.Field("data").Offset, ShouldEqual, 1)
+			So(f.Field("data").Size, ShouldEqual, 8)
+			So(f.Field("points").Offset, ShouldEqual, 10)
+			So(f.Field("points").Size, ShouldEqual, 6)
+			So(f.Field("crc").Offset, ShouldEqual, 16)
+			So(f.Size, ShouldEqual, 18)
+		})
+
+		Convey("It leaves out structs with fields it can't lay out", func() {
+			layouts, diags := compute("struct S { a: u8, b: T } struct U { s: S } struct V { a: u8 }")
+			So(diags.Error(), ShouldEqual, "1:22: unknown type T")
+			So(layouts, ShouldContainKey, "V")
+			So(layouts, ShouldNotContainKey, "S")
+			So(layouts, ShouldNotContainKey, "U")
+		})
+
+		Convey("It reports problems with spans", func() {
+			for src, message := range map[string]string{
+				"struct S { a: T }":                     "1:15: unknown type T",
+				"struct S { a: u8, a: u8 }":             "1:19: duplicate field a in struct S",
+				"struct S { a: S }":                     "1:8: struct S contains itself",
+				"struct S { a: u8 } struct S { b: u8 }": "1:27: struct S already declared at 1:8",
+				"struct S align(3) { a: u8 }":           "1:16: alignment must be a power of two",
+				"struct S align { a: u8 }":              "1:10: align takes one argument",
+				"struct S volatile { a: u8 }":           "1:10: unknown struct attribute volatile",
+				"struct S packed { a: u16 align(2) }":   "1:26: field a cannot be aligned in packed struct S",
+				"struct S { a: u8 packed }":             "1:18: unknown field attribute packed",
+				"struct S packed(1) { a: u8 }":          "1:10: packed takes no arguments",
+				"struct S { a: [n]u8 }":                 "1:16: array length must be a constant",
+			} {
+				_, diags := compute(src)
+				So(diags.Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
@@ -1,8 +1,7 @@
 package lexer
 
 import (
-	"fmt"
-
+	"github.com/sent-hil/bitlang/diag"
 	"github.com/sent-hil/bitlang/runeio"
 	"github.com/sent-hil/bitlang/token"
 )
@@ -12,6 +11,7 @@ type Readable interface {
 	PeekSingleRune() (rune, error)
 	ReadRunes(uint) ([]rune, error)
 	ReadTill(func(rune) bool) []rune
+	Position() runeio.Position
 }
 
 type Lexable interface {
@@ -47,7 +47,10 @@ func (a *AnyLexer) LexAll() (tokens []*token.Token, err error) {
 		for _, lexerInitializer := range a.lexers {
 			if lexer := lexerInitializer(); lexer.Match(a.reader) {
 				unMatched = false
-				tokens = append(tokens, lexer.Lex(a.reader)...)
+				start := a.reader.Position()
+				lexed := lexer.Lex(a.reader)
+				setSpan(lexed, start, a.reader)
+				tokens = append(tokens, lexed...)
 				break
 			}
 		}
@@ -55,10 +58,30 @@ func (a *AnyLexer) LexAll() (tokens []*token.Token, err error) {
 		if unMatched {
 			char, err := a.reader.PeekSingleRune()
 			if err == nil {
-				return tokens, fmt.Errorf("Unmatched char: %s", char)
+				start := a.reader.Position()
+				a.reader.ReadRunes(1)
+				return tokens, &diag.Diagnostic{
+					Span:    token.Span{Start: toPos(start), End: toPos(a.reader.Position())},
+					Message: "unmatched char: " + string(char),
+				}
 			}
 		}
 	}
 
 	return tokens, err
 }
+
+// setSpan sets span from start till current position of reader on tokens that
+// weren't given one by their lexer.
+func setSpan(tokens []*token.Token, start runeio.Position, r Readable) {
+	span := token.Span{Start: toPos(start), End: toPos(r.Position())}
+	for _, t := range tokens {
+		if !t.Span.IsValid() {
+			t.Span = span
+		}
+	}
+}
+
+func toPos(p runeio.Position) token.Pos {
+	return token.Pos{Offset: p.Offset, Line: p.Line, Column: p.Column}
+}
@@ -49,3 +49,38 @@ func TestAnyLexer(t *testing.T) {
 		So(results[9].ID, ShouldEqual, token.IDENTIFIER)
 	})
 }
+
+func TestAnyLexerSpans(t *testing.T) {
+	Convey("AnyLexer spans", t, func() {
+		l := NewAnyLexer(runeio.NewReader(
+			strings.NewReader("// hi\nvar abc\n\"s\""),
+		))
+
+		results, err := l.LexAll()
+		So(err, ShouldEqual, nil)
+
+		Convey("It sets span of comments", func() {
+			So(results[0].ID, ShouldEqual, token.COMMENT)
+			So(results[0].Span.Start, ShouldResemble, token.Pos{Offset: 0, Line: 1, Column: 1})
+			So(results[0].Span.End, ShouldResemble, token.Pos{Offset: 5, Line: 1, Column: 6})
+		})
+
+		Convey("It sets span of newline after comment", func() {
+			So(results[1].ID, ShouldEqual, token.WHITESPACE)
+			So(results[1].Span.Start, ShouldResemble, token.Pos{Offset: 5, Line: 1, Column: 6})
+			So(results[1].Span.End, ShouldResemble, token.Pos{Offset: 6, Line: 2, Column: 1})
+		})
+
+		Convey("It sets span of tokens on later lines", func() {
+			So(results[4].Value, ShouldEqual, "abc")
+			So(results[4].Span.Start, ShouldResemble, token.Pos{Offset: 10, Line: 2, Column: 5})
+			So(results[4].Span.End, ShouldResemble, token.Pos{Offset: 13, Line: 2, Column: 8})
+		})
+
+		Convey("It includes quotes in span of strings", func() {
+			So(results[6].Value, ShouldEqual, "s")
+			So(results[6].Span.Start.Column, ShouldEqual, 1)
+			So(results[6].Span.End.Column, ShouldEqual, 4)
+		})
+	})
+}
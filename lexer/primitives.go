@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"io"
+	"strings"
 	"unicode"
 
 	"github.com/sent-hil/bitlang/token"
@@ -24,25 +25,31 @@ func (c *CommentLexer) Match(p Readable) bool {
 }
 
 // Lex lexes from after // to end of line. It can parse multi line comments,
-// but each line needs to be prefixed with //.
+// but each line needs to be prefixed with //. Since it returns more than one
+// token, it sets the span of each itself.
 func (c *CommentLexer) Lex(r Readable) (tokens []*token.Token) {
 	for c.Match(r) {
+		start := r.Position()
 		r.ReadRunes(2) // throwaway '//' at beginning of line
 
 		singleLine := r.ReadTill(
 			func(char rune) bool { return char != '\n' },
 		)
 
-		tokens = append(tokens, token.NewToken(token.COMMENT, string(singleLine)))
+		comment := token.NewToken(token.COMMENT, string(singleLine))
+		setSpan([]*token.Token{comment}, start, r)
+		tokens = append(tokens, comment)
 
 		// read '\n' at end of line and add to tokens
+		start = r.Position()
 		singleLine, err := r.ReadRunes(1)
 		if err != nil {
 			return tokens
 		}
 
-		tokens = append(tokens,
-			token.NewToken(token.WHITESPACE, string(singleLine)))
+		newline := token.NewToken(token.WHITESPACE, string(singleLine))
+		setSpan([]*token.Token{newline}, start, r)
+		tokens = append(tokens, newline)
 	}
 
 	return tokens
@@ -64,8 +71,17 @@ func (i *NumberLexer) Match(p Readable) bool {
 	return unicode.IsNumber(char)
 }
 
-// Lex lexes integers and floats.
+// Lex lexes integers and floats. Integers can be in hex, eg 0x25, or binary,
+// eg 0b00100000.
 func (i *NumberLexer) Lex(r Readable) (tokens []*token.Token) {
+	if prefix, err := r.PeekRunes(2); err == nil && prefix[0] == '0' {
+		if digit := radixDigit(prefix[1]); digit != nil {
+			r.ReadRunes(2)
+			accum := string(prefix) + string(r.ReadTill(digit))
+			return []*token.Token{token.NewToken(token.INTEGER, accum)}
+		}
+	}
+
 	hasDot := false
 	tokenId := token.INTEGER
 
@@ -94,6 +110,21 @@ func (i *NumberLexer) Lex(r Readable) (tokens []*token.Token) {
 	return tokens
 }
 
+// radixDigit returns what matches digits of integers with given prefix
+// after 0, or nil if it's not one.
+func radixDigit(prefix rune) func(rune) bool {
+	switch prefix {
+	case 'x', 'X':
+		return func(char rune) bool {
+			return unicode.IsDigit(char) || strings.ContainsRune("abcdefABCDEF", char)
+		}
+	case 'b', 'B':
+		return func(char rune) bool { return char == '0' || char == '1' }
+	}
+
+	return nil
+}
+
 type StringLexer struct{}
 
 func NewStringLexer() Lexable {
@@ -135,10 +166,6 @@ func (s *StringLexer) Lex(r Readable) (tokens []*token.Token) {
 			accum += string(chars[0])
 		}
 	}
-
-	r.ReadRunes(1) // throwaway " at end of line
-
-	return []*token.Token{token.NewToken(token.STRING, accum)}
 }
 
 type IdentifierLexer struct{}
@@ -147,21 +174,21 @@ func NewIdentifierLexer() Lexable {
 	return &IdentifierLexer{}
 }
 
-// Match matches if first character is a number.
+// Match matches if first character is a letter or underscore.
 func (i *IdentifierLexer) Match(p Readable) bool {
 	char, err := p.PeekSingleRune()
 	if err != nil {
 		return false
 	}
 
-	return unicode.IsLetter(char)
+	return unicode.IsLetter(char) || char == '_'
 }
 
 // Lex lexes from start till space, tab, end of line or carriage return.
 func (i *IdentifierLexer) Lex(r Readable) []*token.Token {
 	accum := r.ReadTill(
 		func(char rune) bool {
-			return unicode.IsLetter(char) || unicode.IsNumber(char)
+			return unicode.IsLetter(char) || unicode.IsNumber(char) || char == '_'
 		},
 	)
 
@@ -97,6 +97,18 @@ func TestNumberLexer(t *testing.T) {
 				So(lexed[0].ID, ShouldEqual, token.FLOAT)
 			})
 
+			Convey("It returns hex and binary integers", func() {
+				for src, value := range map[string]string{
+					"0x25;":       "0x25",
+					"0XfF)":       "0XfF",
+					"0b00100000 ": "0b00100000",
+				} {
+					lexed := l.Lex(newRuneReader(src))
+					So(lexed[0].Value, ShouldEqual, value)
+					So(lexed[0].ID, ShouldEqual, token.INTEGER)
+				}
+			})
+
 			Convey("It does not lex anything after 1st dot", func() {
 				lexmes := l.Lex(newRuneReader("1234.5.6"))
 				So(lexmes[0].Value, ShouldEqual, "1234.5")
@@ -202,6 +214,10 @@ func TestIdentifierLexer(t *testing.T) {
 			Convey("It returns chars with numbers", func() {
 				So(l.Lex(newRuneReader("hello1"))[0].Value, ShouldEqual, "hello1")
 			})
+
+			Convey("It returns chars with underscores", func() {
+				So(l.Lex(newRuneReader("_pin_13 "))[0].Value, ShouldEqual, "_pin_13")
+			})
 		})
 	})
 }
@@ -11,16 +11,27 @@ var SymbolsMap = map[string]token.TokenID{
 	")": token.RIGHT_PAREN,
 	"{": token.LEFT_BRACE,
 	"}": token.RIGHT_BRACE,
+	"[": token.LEFT_BRACKET,
+	"]": token.RIGHT_BRACKET,
 	",": token.COMMA,
+	":": token.COLON,
 	".": token.DOT,
 	"-": token.MINUS,
 	"+": token.PLUS,
 	";": token.SEMICOLON,
 	"/": token.SLASH,
+	"*": token.STAR,
 	"!": token.BANG,
 	"=": token.EQUAL,
 	"<": token.LESS,
 	">": token.GREATER,
+	"#": token.HASH,
+	"&": token.AMPERSAND,
+	"|": token.PIPE,
+	"^": token.CARET,
+	"~": token.TILDE,
+	"%": token.PERCENT,
+	"@": token.AT,
 }
 
 var SymbolsNested = map[string]token.TokenID{
@@ -28,6 +39,9 @@ var SymbolsNested = map[string]token.TokenID{
 	"==": token.EQUAL_EQUAL,
 	"<=": token.LESS_EQUAL,
 	">=": token.GREATER_EQUAL,
+	"->": token.ARROW,
+	"<<": token.LESS_LESS,
+	">>": token.GREATER_GREATER,
 }
 
 type SymbolLexer struct{}
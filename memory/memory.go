@@ -0,0 +1,431 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/callgraph"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/layout"
+	"github.com/sent-hil/bitlang/sema"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// SRAM of the ATmega328 is shared by globals and the stack, which grows down
+// towards them, so a program that needs more than there is overwrites its
+// globals without any warning at runtime. Globals given a value other than
+// zero are in .data, which startup code copies from flash, and others are in
+// .bss, which it clears.
+//
+// The stack is at its deepest when main code is in its deepest chain of
+// calls and an interrupt comes, whose handler then goes into its deepest
+// chain. AVR disables interrupts while a handler runs, and atomic blocks
+// restore them as they were, so handlers are taken not to nest; a handler
+// that enables them by writing SREG itself can go deeper. Till there's a
+// code generator to say exactly, frames of functions are estimated as their
+// return address, parameters, locals and SREG saved by atomic blocks.
+// Functions of other modules aren't known here, so calls of them only count
+// their return address and arguments. Report.String says which of these
+// assumptions a program relies on.
+
+// DefaultSRAM is bytes of SRAM of the ATmega328.
+const DefaultSRAM = 2048
+
+const (
+	// returnAddr is bytes a call or interrupt pushes; the ATmega328's
+	// program counter is 16 bits.
+	returnAddr = 2
+
+	// handlerSaves is most bytes a handler pushes to save what it changes,
+	// every register and SREG; see avr.LowerISR.
+	handlerSaves = 32 + 1
+)
+
+// Config configures the check.
+type Config struct {
+	// SRAM is bytes of SRAM the board has; 0 means DefaultSRAM.
+	SRAM int
+
+	// Warn makes a program that needs more SRAM than the board has a
+	// warning instead of an error.
+	Warn bool
+}
+
+// Report is how much SRAM a program needs, in bytes.
+type Report struct {
+	Data int
+	BSS  int
+
+	// Stack is the worst-case depth of the stack: Main in its deepest chain
+	// of calls, MainPath, plus Handler, the deepest handler in its deepest
+	// chain, HandlerPath.
+	Stack       int
+	Main        int
+	MainPath    []string
+	Handler     int
+	HandlerPath []string
+
+	// Recursive are functions that call themselves, directly or not, that
+	// aren't declared recursive, so their depth can't be known; they're
+	// counted as if they didn't recurse.
+	Recursive []string
+
+	// Outside are functions of other modules that are called, in the order
+	// they're first called; only their return address and arguments are
+	// counted.
+	Outside []string
+
+	// SRAM is what the board has.
+	SRAM int
+}
+
+// Total returns bytes the program needs.
+func (r *Report) Total() int {
+	return r.Data + r.BSS + r.Stack
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".data  %5d bytes\n", r.Data)
+	fmt.Fprintf(&b, ".bss   %5d bytes\n", r.BSS)
+	fmt.Fprintf(&b, "stack  %5d bytes", r.Stack)
+	if len(r.MainPath) > 0 {
+		fmt.Fprintf(&b, ", %s", strings.Join(r.MainPath, " -> "))
+	}
+	if len(r.HandlerPath) > 0 {
+		fmt.Fprintf(&b, ", interrupted by %s", strings.Join(r.HandlerPath, " -> "))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "total  %5d of %d bytes, %d%%\n", r.Total(), r.SRAM, r.Total()*100/r.SRAM)
+
+	if len(r.HandlerPath) > 0 {
+		b.WriteString("assuming handlers don't enable interrupts, so they don't nest\n")
+	}
+	if len(r.Outside) > 0 {
+		fmt.Fprintf(&b, "assuming calls of %s only push their arguments\n", strings.Join(r.Outside, ", "))
+	}
+
+	return b.String()
+}
+
+// Check measures SRAM given checked file needs, and reports if it's more
+// than the board has. Config can be nil.
+func Check(file *ast.File, info *sema.Info, config *Config) (*Report, diag.List) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	m := &measurer{
+		info:    info,
+		layouts: info.Layouts,
+		depths:  map[*callgraph.Component]*depth{},
+		report:  &Report{SRAM: config.SRAM},
+	}
+	if m.report.SRAM == 0 {
+		m.report.SRAM = DefaultSRAM
+	}
+
+	for _, decl := range file.Decls {
+		if v, ok := decl.(*ast.VarDecl); ok {
+			m.global(v)
+		}
+	}
+	m.stack()
+
+	r := m.report
+	if r.Total() > r.SRAM {
+		format := "program needs %d bytes of SRAM, more than the %d the board has (.data %d, .bss %d, stack %d)"
+		if config.Warn {
+			m.diags.Warn(m.largest(), format, r.Total(), r.SRAM, r.Data, r.BSS, r.Stack)
+		} else {
+			m.diags.Add(m.largest(), format, r.Total(), r.SRAM, r.Data, r.BSS, r.Stack)
+		}
+	}
+
+	return r, m.diags
+}
+
+type measurer struct {
+	info    *sema.Info
+	layouts layout.Layouts
+	report  *Report
+	diags   diag.List
+
+	depths map[*callgraph.Component]*depth
+
+	// biggest is the largest global, with its size, and mainRoot and
+	// handlerRoot start the deepest chains of main code and handler.
+	biggest     *ast.VarDecl
+	biggestSize int
+	mainRoot    *ast.FuncDecl
+	handlerRoot *ast.FuncDecl
+}
+
+// depth is the deepest the stack gets in a call into a component, with the
+// chain of calls it goes on to.
+type depth struct {
+	bytes int
+	path  []string
+}
+
+// global adds global of given declaration to .data or .bss.
+func (m *measurer) global(decl *ast.VarDecl) {
+	obj := m.info.Defs[decl.Name]
+	if obj == nil {
+		return
+	}
+
+	size := m.size(obj.Type, decl.Name)
+	if m.isZero(decl.Value) {
+		m.report.BSS += size
+	} else {
+		m.report.Data += size
+	}
+	if m.biggest == nil || size > m.biggestSize {
+		m.biggest, m.biggestSize = decl, size
+	}
+}
+
+// isZero returns if x is nil, a constant zero or an array of them.
+func (m *measurer) isZero(x ast.Expr) bool {
+	if x == nil {
+		return true
+	}
+
+	if lit, ok := x.(*ast.ArrayLit); ok {
+		for _, elem := range lit.Elems {
+			if !m.isZero(elem) {
+				return false
+			}
+		}
+		return true
+	}
+
+	v, ok := m.info.Values[x]
+	return ok && v == 0
+}
+
+// size returns size of a value of given type in bytes, reporting at x, what
+// the value is of, structs that have no layout.
+func (m *measurer) size(typ sema.Type, x ast.Expr) int {
+	switch typ := typ.(type) {
+	case *sema.Basic:
+		return typ.Size
+	case *sema.Fixed:
+		return typ.Size()
+	case *sema.Enum:
+		return 1
+	case *sema.Array:
+		return int(typ.Len) * m.size(typ.Elem, x)
+	case *sema.Struct:
+		if s := m.layouts[typ.Name]; s != nil {
+			return s.Size
+		}
+		m.diags.Add(x.Span(), "cannot measure %s, struct %s has no layout", ast.ExprString(x), typ.Name)
+	}
+
+	return 0
+}
+
+// frame returns bytes fn's own frame takes: its return address, parameters,
+// locals and SREG saved by its deepest nested atomic blocks.
+func (m *measurer) frame(fn *ast.FuncDecl) int {
+	bytes := returnAddr
+	for _, p := range fn.Params {
+		if obj := m.info.Defs[p.Name]; obj != nil {
+			bytes += m.size(obj.Type, p.Name)
+		}
+	}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if v, ok := n.(*ast.VarDecl); ok {
+			if obj := m.info.Defs[v.Name]; obj != nil {
+				bytes += m.size(obj.Type, v.Name)
+			}
+		}
+		return true
+	})
+
+	return bytes + atomics(fn.Body)
+}
+
+// atomics returns how many atomic blocks nest in each other at most in
+// given node. Each pushes SREG while it runs, see avr.LowerAtomicBegin.
+func atomics(node ast.Node) int {
+	most := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		if a, ok := n.(*ast.AtomicStmt); ok {
+			if d := 1 + atomics(a.Body); d > most {
+				most = d
+			}
+			return false
+		}
+		return true
+	})
+
+	return most
+}
+
+// outside returns the deepest the stack gets from calls f makes of
+// functions of other modules, counting their return address and arguments.
+func (m *measurer) outside(f *callgraph.Func) *depth {
+	var deepest *depth
+	for _, call := range f.Outside {
+		name := ast.ExprString(call.Fun)
+		if !contains(m.report.Outside, name) {
+			m.report.Outside = append(m.report.Outside, name)
+		}
+
+		d := &depth{bytes: returnAddr, path: []string{name}}
+		for _, arg := range call.Args {
+			d.bytes += m.size(m.info.Types[arg], arg)
+		}
+		if deepest == nil || d.bytes > deepest.bytes {
+			deepest = d
+		}
+	}
+
+	return deepest
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// depth returns the deepest the stack gets from a call into component c,
+// with the chain of calls it goes on to after it. Components come after
+// those they call, so it only recurses through the ones that don't call each
+// other.
+func (m *measurer) depth(c *callgraph.Component) *depth {
+	if d, ok := m.depths[c]; ok {
+		return d
+	}
+
+	d := &depth{}
+	for _, f := range c.Funcs {
+		d.bytes += m.frame(f.Decl)
+	}
+	d.bytes *= m.times(c)
+
+	var deepest *depth
+	for _, f := range c.Funcs {
+		for _, call := range f.Calls {
+			if call.Callee.Component == c {
+				continue
+			}
+			if cd := m.depth(call.Callee.Component); deepest == nil || cd.bytes > deepest.bytes {
+				deepest = &depth{bytes: cd.bytes, path: append([]string{m.name(call.Callee)}, cd.path...)}
+			}
+		}
+		if od := m.outside(f); od != nil && (deepest == nil || od.bytes > deepest.bytes) {
+			deepest = od
+		}
+	}
+	if deepest != nil {
+		d.bytes += deepest.bytes
+		d.path = deepest.path
+	}
+
+	m.depths[c] = d
+	return d
+}
+
+// times returns how many times frames of component c can be on the stack at
+// once: the depth its functions are declared recursive with, or once if it
+// isn't recursive or its depth isn't known.
+func (m *measurer) times(c *callgraph.Component) int {
+	if !c.Recursive {
+		return 1
+	}
+
+	n := int64(0)
+	for _, f := range c.Funcs {
+		if d := m.info.Recursive[f.Decl]; d > n {
+			n = d
+		}
+	}
+	if n == 0 {
+		return 1
+	}
+	return int(n)
+}
+
+// name returns name of f for a chain of calls, with how deep it goes if it's
+// declared recursive.
+func (m *measurer) name(f *callgraph.Func) string {
+	if n := m.times(f.Component); n > 1 {
+		return fmt.Sprintf("%s (recursive, %d deep)", f.Name(), n)
+	}
+	return f.Name()
+}
+
+// stack finds worst-case depth of the stack. Main code starts at functions
+// that aren't handlers and that nothing else calls, like the entry points.
+func (m *measurer) stack() {
+	r := m.report
+	for _, c := range m.info.CallGraph.Components {
+		if c.Recursive && m.times(c) == 1 {
+			f := c.Funcs[0]
+			r.Recursive = append(r.Recursive, f.Name())
+			m.diags.Warn(f.Decl.Name.Loc, "stack depth can't be known, %s is recursive", f.Name())
+		}
+	}
+
+	for _, f := range m.info.CallGraph.Funcs {
+		path := func(d *depth) []string {
+			return append([]string{m.name(f)}, d.path...)
+		}
+
+		if m.info.Interrupts[f.Decl] != "" {
+			d := m.depth(f.Component)
+			if bytes := handlerSaves + d.bytes; bytes > r.Handler {
+				r.Handler, r.HandlerPath = bytes, path(d)
+				m.handlerRoot = f.Decl
+			}
+		} else if !calledFromOutside(f) {
+			if d := m.depth(f.Component); d.bytes > r.Main {
+				r.Main, r.MainPath = d.bytes, path(d)
+				m.mainRoot = f.Decl
+			}
+		}
+	}
+
+	r.Stack = r.Main + r.Handler
+}
+
+// calledFromOutside returns if a function outside f's component calls it.
+func calledFromOutside(f *callgraph.Func) bool {
+	for _, call := range f.Callers {
+		if call.Caller.Component != f.Component {
+			return true
+		}
+	}
+	return false
+}
+
+// largest returns where to report a program that needs more SRAM than the
+// board has: at the name of what takes the most of it, the largest global
+// or the function starting the deepest chain of main code or handler.
+func (m *measurer) largest() token.Span {
+	var at *ast.Ident
+	most := 0
+	if m.biggest != nil {
+		at, most = m.biggest.Name, m.biggestSize
+	}
+	if m.mainRoot != nil && m.report.Main > most {
+		at, most = m.mainRoot.Name, m.report.Main
+	}
+	if m.handlerRoot != nil && m.report.Handler > most {
+		at = m.handlerRoot.Name
+	}
+
+	if at == nil {
+		return token.Span{}
+	}
+	return at.Loc
+}
@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/parser"
+	"github.com/sent-hil/bitlang/sema"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// check parses, checks and measures given source.
+func check(src string, config *Config) (*Report, diag.List) {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	info, diags := sema.Check(file, nil)
+	So(diags.Err(), ShouldBeNil)
+
+	return Check(file, info, config)
+}
+
+func TestMemory(t *testing.T) {
+	Convey("Memory", t, func() {
+		Convey("It puts globals with a value other than zero in .data", func() {
+			r, diags := check(`
+struct Point { x: u8, y: u16 }
+var a: u8 = 1;
+var b: u16;
+var zeros: [10]u8 = [0, 0, 0, 0, 0, 0, 0, 0, 0, 0];
+var p: Point;
+var gain: q8.8 = 1.5;
+var on = false;
+reg PORTB @ 0x25;
+const LIMIT: u16 = 1000;
+`, nil)
+			So(diags, ShouldBeEmpty)
+			So(r.Data, ShouldEqual, 3)
+			So(r.BSS, ShouldEqual, 2+10+3+1)
+		})
+
+		Convey("It measures structs with fields of any checked type", func() {
+			r, diags := check(`
+const N = 100;
+enum State { A, B }
+struct S { s: State, buf: [N]u8 }
+var g: [10]S;
+`, nil)
+			So(diags, ShouldBeEmpty)
+			So(r.BSS, ShouldEqual, 1010)
+		})
+
+		Convey("It reports structs it can't measure", func() {
+			file, _ := parser.ParseString("struct T { a: u8, t: T } var g: [2]T;")
+			info, _ := sema.Check(file, nil)
+			_, diags := Check(file, info, nil)
+			So(diags.Error(), ShouldEqual, "1:30: cannot measure g, struct T has no layout")
+		})
+
+		Convey("It adds the deepest handler to the deepest chain of main code", func() {
+			r, diags := check(`
+var count: u16 = 0;
+fn tick() interrupt(TIMER1_COMPA) { bump(); }
+fn bump() { atomic { count = count + 1; } }
+fn draw(n: u8) { var buf: [8]u8 = [1, 2, 3, 4, 5, 6, 7, 8]; put(buf[n]); }
+fn put(v: u8) { }
+fn setup() { put(0); }
+fn loop() { draw(1); }
+`, nil)
+			So(diags, ShouldBeEmpty)
+			So(r.Main, ShouldEqual, 2+(2+1+8)+(2+1))
+			So(r.MainPath, ShouldResemble, []string{"loop", "draw", "put"})
+			So(r.Handler, ShouldEqual, 33+2+(2+1))
+			So(r.HandlerPath, ShouldResemble, []string{"tick", "bump"})
+			So(r.Stack, ShouldEqual, r.Main+r.Handler)
+			So(r.String(), ShouldEqual, ""+
+				".data      0 bytes\n"+
+				".bss       2 bytes\n"+
+				"stack     54 bytes, loop -> draw -> put, interrupted by tick -> bump\n"+
+				"total     56 of 2048 bytes, 2%\n"+
+				"assuming handlers don't enable interrupts, so they don't nest\n")
+		})
+
+		Convey("It counts SREG saved by nested atomic blocks", func() {
+			r, diags := check(`
+var count: u8 = 0;
+fn loop() { atomic { count = 1; atomic { count = 2; } } atomic { count = 3; } }
+`, nil)
+			So(diags, ShouldBeEmpty)
+			So(r.Main, ShouldEqual, 2+2)
+		})
+
+		Convey("It counts calls of functions of other modules as their arguments", func() {
+			r, diags := check(`
+import "drivers/lcd";
+fn draw(v: u8) { }
+fn loop() { var n: u16 = 1; draw(1); lcd.print(n, n); lcd.clear(); }
+`, nil)
+			So(diags, ShouldBeEmpty)
+			So(r.Main, ShouldEqual, (2+2)+(2+2+2))
+			So(r.MainPath, ShouldResemble, []string{"loop", "lcd.print"})
+			So(r.Outside, ShouldResemble, []string{"lcd.print", "lcd.clear"})
+			So(r.String(), ShouldEndWith, "assuming calls of lcd.print, lcd.clear only push their arguments\n")
+		})
+
+		Convey("It counts recursive functions as deep as they're declared", func() {
+			r, diags := check(`
+fn f(n: u8) -> u8 recursive(4) { if n == 0 { return 0; } return g(n - 1); }
+fn g(n: u8) -> u8 { return f(n); }
+fn loop() { var x = f(3); }
+`, nil)
+			So(diags, ShouldBeEmpty)
+			So(r.Main, ShouldEqual, (2+1)+4*((2+1)+(2+1)))
+			So(r.MainPath, ShouldResemble, []string{"loop", "f (recursive, 4 deep)"})
+		})
+
+		Convey("It warns about recursion it can't measure", func() {
+			file, _ := parser.ParseString(`
+fn f(n: u8) -> u8 { if n == 0 { return 0; } return f(n - 1); }
+fn loop() { var x = f(3); }
+`)
+			info, _ := sema.Check(file, nil)
+			r, diags := Check(file, info, nil)
+			So(diags.Error(), ShouldEqual, "2:4: warning: stack depth can't be known, f is recursive")
+			So(r.Recursive, ShouldResemble, []string{"f"})
+		})
+
+		Convey("It reports programs that need more SRAM than the board has", func() {
+			src := "var buf: [1000]u8; fn loop() { buf[0] = 1; }"
+			_, diags := check(src, nil)
+			So(diags, ShouldBeEmpty)
+
+			_, diags = check(src, &Config{SRAM: 512})
+			So(diags.Error(), ShouldEqual,
+				"1:5: program needs 1002 bytes of SRAM, more than the 512 the board has (.data 0, .bss 1000, stack 2)")
+			So(diags.HasErrors(), ShouldBeTrue)
+
+			_, diags = check("var n: u8; fn loop() { var buf: [600]u8; buf[0] = n; }", &Config{SRAM: 512})
+			So(diags.Error(), ShouldStartWith, "1:15: program needs 603 bytes of SRAM")
+
+			_, diags = check(src, &Config{SRAM: 512, Warn: true})
+			So(diags.HasErrors(), ShouldBeFalse)
+			So(len(diags), ShouldEqual, 1)
+		})
+	})
+}
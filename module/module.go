@@ -0,0 +1,260 @@
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/parser"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Ext is the extension of source files; other files in a module's directory
+// are ignored.
+const Ext = ".bit"
+
+// Module is a directory of source files that share top level names.
+type Module struct {
+	// Path is the path the module is imported by, or empty for the main
+	// module.
+	Path string
+	Dir  string
+
+	Files []*File
+
+	// Decls are top level declarations of all the files, keyed by name.
+	Decls map[string]ast.Decl
+}
+
+// File is a parsed source file of a module.
+type File struct {
+	Name string
+	AST  *ast.File
+
+	// Imports are modules the file imports, keyed by the name they're used
+	// by, ie last element of their path.
+	Imports map[string]*Module
+}
+
+// Loader loads modules and the modules they import, each only once.
+type Loader struct {
+	// Roots are directories import paths are looked up in, in order, eg
+	// import "drivers/lcd" is the first of <root>/drivers/lcd that exists.
+	Roots []string
+
+	modules map[string]*Module
+
+	// loading are paths of modules being loaded, in the order they were
+	// imported, to find import cycles.
+	loading []string
+
+	diags diag.List
+}
+
+// NewLoader is the required initializer for Loader.
+func NewLoader(roots ...string) *Loader {
+	return &Loader{Roots: roots, modules: map[string]*Module{}}
+}
+
+// LoadMain loads module in given directory as the main module, along with
+// modules it imports.
+func (l *Loader) LoadMain(dir string) (*Module, diag.List) {
+	m := l.loadDir("", dir)
+	return m, l.diags
+}
+
+// resolve returns directory of module with given import path.
+func (l *Loader) resolve(importPath string) (string, error) {
+	if importPath == "" || path.IsAbs(importPath) || path.Clean(importPath) != importPath ||
+		strings.HasPrefix(importPath, "../") {
+		return "", fmt.Errorf("invalid import path %q", importPath)
+	}
+
+	for _, root := range l.Roots {
+		dir := filepath.Join(root, filepath.FromSlash(importPath))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find module %q in %s", importPath,
+		strings.Join(l.Roots, ", "))
+}
+
+// load returns module with given import path, loading it if it hasn't been.
+func (l *Loader) load(importPath string) (*Module, error) {
+	for i, p := range l.loading {
+		if p == importPath {
+			cycle := append(append([]string{}, l.loading[i:]...), importPath)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if m, ok := l.modules[importPath]; ok {
+		return m, nil
+	}
+
+	dir, err := l.resolve(importPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.loadDir(importPath, dir), nil
+}
+
+// loadDir parses files of module in given directory and loads modules they
+// import.
+func (l *Loader) loadDir(importPath, dir string) *Module {
+	m := &Module{Path: importPath, Dir: dir, Decls: map[string]ast.Decl{}}
+	l.modules[importPath] = m
+
+	l.loading = append(l.loading, importPath)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		l.diags = append(l.diags, &diag.Diagnostic{File: dir, Message: err.Error()})
+		return m
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != Ext {
+			continue
+		}
+
+		name := filepath.Join(dir, info.Name())
+		if f := l.parseFile(name); f != nil {
+			m.Files = append(m.Files, f)
+		}
+	}
+
+	for _, f := range m.Files {
+		l.declare(m, f)
+		l.importAll(f)
+	}
+	for _, f := range m.Files {
+		l.checkRefs(f)
+	}
+
+	return m
+}
+
+func (l *Loader) parseFile(name string) *File {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		l.diags = append(l.diags, &diag.Diagnostic{File: name, Message: err.Error()})
+		return nil
+	}
+
+	file, diags := parser.ParseString(string(src))
+	diags.SetFile(name)
+	l.diags = append(l.diags, diags...)
+	if file == nil {
+		return nil
+	}
+
+	return &File{Name: name, AST: file, Imports: map[string]*Module{}}
+}
+
+// declare adds top level declarations of file to its module.
+func (l *Loader) declare(m *Module, f *File) {
+	for _, decl := range f.AST.Decls {
+		name := DeclName(decl)
+		if name == nil {
+			continue
+		}
+
+		if prev, ok := m.Decls[name.Name]; ok {
+			l.errorf(f, name.Loc, "%s already declared at %s", name.Name, l.where(m, prev))
+			continue
+		}
+		m.Decls[name.Name] = decl
+	}
+}
+
+// importAll loads modules imported by file.
+func (l *Loader) importAll(f *File) {
+	for _, decl := range f.AST.Decls {
+		imp, ok := decl.(*ast.ImportDecl)
+		if !ok {
+			continue
+		}
+
+		importPath := imp.Path.Value
+		name := path.Base(importPath)
+		if prev, ok := f.Imports[name]; ok && imp.Name == nil {
+			l.errorf(f, imp.Path.Loc, "%s already imported from %q", name, prev.Path)
+			continue
+		}
+
+		m, err := l.load(importPath)
+		if err != nil {
+			l.errorf(f, imp.Path.Loc, "%s", err)
+			continue
+		}
+		// names of modules imported as _ can't be used
+		if imp.Name == nil {
+			f.Imports[name] = m
+		}
+	}
+}
+
+func (l *Loader) errorf(f *File, span token.Span, format string, args ...interface{}) {
+	l.diags = append(l.diags, &diag.Diagnostic{
+		File:    f.Name,
+		Span:    span,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// where returns file and position of given declaration of module.
+func (l *Loader) where(m *Module, decl ast.Decl) string {
+	for _, f := range m.Files {
+		for _, d := range f.AST.Decls {
+			if d == decl {
+				return fmt.Sprintf("%s:%s", f.Name, DeclName(decl).Loc)
+			}
+		}
+	}
+
+	return DeclName(decl).Loc.String()
+}
+
+// Modules returns all loaded modules sorted by import path, with the main
+// module first.
+func (l *Loader) Modules() []*Module {
+	var modules []*Module
+	for _, m := range l.modules {
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
+
+	return modules
+}
+
+// DeclName returns name of given top level declaration, or nil if it
+// doesn't declare a name.
+func DeclName(decl ast.Decl) *ast.Ident {
+	switch decl := decl.(type) {
+	case *ast.VarDecl:
+		return decl.Name
+	case *ast.ConstDecl:
+		return decl.Name
+	case *ast.FuncDecl:
+		return decl.Name
+	case *ast.StructDecl:
+		return decl.Name
+	case *ast.EnumDecl:
+		return decl.Name
+	case *ast.RegDecl:
+		return decl.Name
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sent-hil/bitlang/diag"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// load writes given files, keyed by path, to a temporary directory and loads
+// its "main" directory with the directory as root.
+func load(files map[string]string) (*Loader, *Module, diag.List, string) {
+	root, err := ioutil.TempDir("", "bitlang")
+	So(err, ShouldBeNil)
+
+	for name, src := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		So(os.MkdirAll(filepath.Dir(name), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(name, []byte(src), 0644), ShouldBeNil)
+	}
+
+	l := NewLoader(root)
+	m, diags := l.LoadMain(filepath.Join(root, "main"))
+	return l, m, diags, root
+}
+
+func TestModule(t *testing.T) {
+	Convey("Module", t, func() {
+		Convey("It loads imported modules", func() {
+			l, m, diags, root := load(map[string]string{
+				"main/main.bit": `
+import "drivers/lcd";
+fn setup() { lcd.Init(); }
+`,
+				"main/loop.bit":        "fn loop() { lcd.Print(1); }",
+				"drivers/lcd/lcd.bit":  `import "drivers/spi"; fn Init() { spi.Send(0); }`,
+				"drivers/lcd/text.bit": "fn Print(c: u8) { clear(); } fn clear() {}",
+				"drivers/lcd/README":   "not source",
+				"drivers/spi/spi.bit":  "fn Send(b: u8) {}",
+			})
+			defer os.RemoveAll(root)
+			So(diags, ShouldBeEmpty)
+
+			So(len(m.Files), ShouldEqual, 2)
+			So(m.Decls, ShouldContainKey, "setup")
+			So(m.Decls, ShouldContainKey, "loop")
+
+			lcd := m.Files[1].Imports["lcd"]
+			So(lcd.Path, ShouldEqual, "drivers/lcd")
+			So(len(lcd.Files), ShouldEqual, 2)
+			So(lcd.Decls, ShouldContainKey, "clear")
+
+			modules := l.Modules()
+			So(len(modules), ShouldEqual, 3)
+			So(modules[0], ShouldEqual, m)
+			So(modules[2].Path, ShouldEqual, "drivers/spi")
+		})
+
+		Convey("It loads modules imported as _ without naming them", func() {
+			l, m, diags, root := load(map[string]string{
+				"main/main.bit":        `import _ "drivers/uart"; fn setup() {}`,
+				"drivers/uart/isr.bit": "fn rx() interrupt(USART_RX) {}",
+			})
+			defer os.RemoveAll(root)
+			So(diags, ShouldBeEmpty)
+
+			So(m.Files[0].Imports, ShouldBeEmpty)
+			So(len(l.Modules()), ShouldEqual, 2)
+		})
+
+		Convey("It reports import cycles with their path", func() {
+			_, _, diags, root := load(map[string]string{
+				"main/main.bit": `import "a"; fn setup() {}`,
+				"a/a.bit":       `import "b";`,
+				"b/b.bit":       `import "a";`,
+			})
+			defer os.RemoveAll(root)
+
+			So(diags.Error(), ShouldEqual,
+				filepath.Join(root, "b/b.bit")+`:1:8: import cycle: a -> b -> a`)
+		})
+
+		Convey("It reports modules that can't be found", func() {
+			_, _, diags, root := load(map[string]string{
+				"main/main.bit": `import "drivers/missing";`,
+			})
+			defer os.RemoveAll(root)
+
+			So(diags.Error(), ShouldEqual, filepath.Join(root, "main/main.bit")+
+				`:1:8: cannot find module "drivers/missing" in `+root)
+		})
+
+		Convey("It reports use of names that aren't exported", func() {
+			_, _, diags, root := load(map[string]string{
+				"main/main.bit": `import "lcd"; fn setup() { lcd.clear(); lcd.Missing(); }`,
+				"lcd/lcd.bit":   "fn clear() {}",
+			})
+			defer os.RemoveAll(root)
+
+			name := filepath.Join(root, "main/main.bit")
+			So(diags.Error(), ShouldEqual, name+":1:32: lcd.clear is not exported\n"+
+				name+":1:45: lcd.Missing is not declared")
+		})
+
+		Convey("It reports names declared in more than one file", func() {
+			_, _, diags, root := load(map[string]string{
+				"main/a.bit": "fn blink() {}",
+				"main/b.bit": "var blink = 1;",
+			})
+			defer os.RemoveAll(root)
+
+			So(diags.Error(), ShouldEqual, filepath.Join(root, "main/b.bit")+
+				":1:5: blink already declared at "+filepath.Join(root, "main/a.bit")+":1:4")
+		})
+
+		Convey("It reports parse errors with file name", func() {
+			_, _, diags, root := load(map[string]string{
+				"main/main.bit": `fn setup() {} import "lcd";`,
+			})
+			defer os.RemoveAll(root)
+
+			So(diags.Error(), ShouldEqual, filepath.Join(root, "main/main.bit")+
+				":1:15: imports must come before other declarations")
+		})
+
+		Convey("It reports invalid import paths", func() {
+			_, _, diags, root := load(map[string]string{
+				"main/main.bit": `import "../secrets";`,
+			})
+			defer os.RemoveAll(root)
+
+			So(diags.Error(), ShouldEndWith, `invalid import path "../secrets"`)
+		})
+	})
+}
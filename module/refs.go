@@ -0,0 +1,31 @@
+package module
+
+import "github.com/sent-hil/bitlang/ast"
+
+// checkRefs checks names file uses from modules it imports, eg lcd.Print,
+// are declared by the module and exported.
+func (l *Loader) checkRefs(f *File) {
+	ast.Inspect(f.AST, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		name, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		m, ok := f.Imports[name.Name]
+		if !ok {
+			return true
+		}
+
+		if _, ok := m.Decls[sel.Sel.Name]; !ok {
+			l.errorf(f, sel.Sel.Loc, "%s.%s is not declared", name.Name, sel.Sel.Name)
+		} else if !ast.IsExported(sel.Sel.Name) {
+			l.errorf(f, sel.Sel.Loc, "%s.%s is not exported", name.Name, sel.Sel.Name)
+		}
+		return false
+	})
+}
@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Precedence is how tightly an operator binds its operands; operators with
+// higher precedence bind tighter.
+type Precedence int
+
+const (
+	PrecLowest Precedence = iota
+	PrecOr
+	PrecAnd
+	PrecEquality
+	PrecComparison
+	// bit operators are grouped like in Go: | and ^ with +, and & and
+	// shifts with *, so `flags & MASK == 0` tests the masked bits
+	PrecTerm
+	PrecFactor
+	PrecPrefix
+	PrecPostfix
+)
+
+// Associativity decides how operators of same precedence group, ie if
+// `a - b - c` is `(a - b) - c` or `a - (b - c)`.
+type Associativity int
+
+const (
+	LeftAssoc Associativity = iota
+	RightAssoc
+)
+
+// prefixParseFn parses an expression that starts with given token.
+type prefixParseFn func(p *Parser, t *token.Token) ast.Expr
+
+// infixParseFn parses an expression that continues after left with given
+// token; it's used for binary and postfix operators.
+type infixParseFn func(p *Parser, left ast.Expr, t *token.Token) ast.Expr
+
+// InfixRule is the entry for an infix or postfix operator in the table.
+type InfixRule struct {
+	Precedence    Precedence
+	Associativity Associativity
+	parse         infixParseFn
+}
+
+var (
+	// prefixRules are tokens that can start an expression.
+	prefixRules map[token.TokenID]prefixParseFn
+
+	// InfixRules are tokens that can continue an expression, keyed by token.
+	// Postfix operators like calls bind tightest, so they're here too.
+	InfixRules map[token.TokenID]InfixRule
+)
+
+func init() {
+	prefixRules = map[token.TokenID]prefixParseFn{
+		token.IDENTIFIER:   parseIdent,
+		token.INTEGER:      parseBasicLit,
+		token.FLOAT:        parseBasicLit,
+		token.STRING:       parseBasicLit,
+		token.TRUE:         parseBasicLit,
+		token.FALSE:        parseBasicLit,
+		token.NIL:          parseBasicLit,
+		token.LEFT_PAREN:   parseParen,
+		token.LEFT_BRACKET: parseArrayLit,
+		token.BANG:         parseUnary,
+		token.MINUS:        parseUnary,
+		token.TILDE:        parseUnary,
+	}
+
+	InfixRules = map[token.TokenID]InfixRule{
+		token.OR:              {PrecOr, LeftAssoc, parseBinary},
+		token.AND:             {PrecAnd, LeftAssoc, parseBinary},
+		token.EQUAL_EQUAL:     {PrecEquality, LeftAssoc, parseBinary},
+		token.BANG_EQUAL:      {PrecEquality, LeftAssoc, parseBinary},
+		token.LESS:            {PrecComparison, LeftAssoc, parseBinary},
+		token.LESS_EQUAL:      {PrecComparison, LeftAssoc, parseBinary},
+		token.GREATER:         {PrecComparison, LeftAssoc, parseBinary},
+		token.GREATER_EQUAL:   {PrecComparison, LeftAssoc, parseBinary},
+		token.PLUS:            {PrecTerm, LeftAssoc, parseBinary},
+		token.MINUS:           {PrecTerm, LeftAssoc, parseBinary},
+		token.PIPE:            {PrecTerm, LeftAssoc, parseBinary},
+		token.CARET:           {PrecTerm, LeftAssoc, parseBinary},
+		token.STAR:            {PrecFactor, LeftAssoc, parseBinary},
+		token.SLASH:           {PrecFactor, LeftAssoc, parseBinary},
+		token.PERCENT:         {PrecFactor, LeftAssoc, parseBinary},
+		token.AMPERSAND:       {PrecFactor, LeftAssoc, parseBinary},
+		token.LESS_LESS:       {PrecFactor, LeftAssoc, parseBinary},
+		token.GREATER_GREATER: {PrecFactor, LeftAssoc, parseBinary},
+		token.LEFT_PAREN:      {PrecPostfix, LeftAssoc, parseCall},
+		token.LEFT_BRACKET:    {PrecPostfix, LeftAssoc, parseIndex},
+		token.DOT:             {PrecPostfix, LeftAssoc, parseSelector},
+	}
+}
+
+func (p *Parser) expression() ast.Expr {
+	return p.parseExpr(PrecLowest)
+}
+
+// parseExpr parses an expression whose operators all bind tighter than
+// given precedence.
+func (p *Parser) parseExpr(prec Precedence) ast.Expr {
+	prefix, ok := prefixRules[p.peek().ID]
+	if !ok {
+		p.errorf(p.peek().Span, "expected expression, found %s", describe(p.peek()))
+	}
+
+	left := prefix(p, p.advance())
+	for {
+		rule, ok := InfixRules[p.peek().ID]
+		if !ok || rule.Precedence <= prec {
+			return left
+		}
+
+		left = rule.parse(p, left, p.advance())
+	}
+}
+
+func parseIdent(p *Parser, t *token.Token) ast.Expr {
+	return p.fixedName(&ast.Ident{Loc: t.Span, Name: t.Value})
+}
+
+func parseBasicLit(p *Parser, t *token.Token) ast.Expr {
+	return &ast.BasicLit{Loc: t.Span, Kind: t.ID, Value: t.Value}
+}
+
+func parseParen(p *Parser, t *token.Token) ast.Expr {
+	x := p.expression()
+	end := p.expect(token.RIGHT_PAREN, "after expression")
+
+	return &ast.ParenExpr{Loc: t.Span.To(end.Span), X: x}
+}
+
+// parseArrayLit parses `[a, b, c]`; the comma after the last element is
+// optional.
+func parseArrayLit(p *Parser, t *token.Token) ast.Expr {
+	lit := &ast.ArrayLit{}
+	for !p.check(token.RIGHT_BRACKET) {
+		lit.Elems = append(lit.Elems, p.expression())
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	end := p.expect(token.RIGHT_BRACKET, "after array elements")
+	lit.Loc = t.Span.To(end.Span)
+
+	return lit
+}
+
+func parseUnary(p *Parser, t *token.Token) ast.Expr {
+	x := p.parseExpr(PrecPrefix)
+	return &ast.UnaryExpr{Loc: t.Span.To(x.Span()), Op: t.ID, X: x}
+}
+
+func parseBinary(p *Parser, left ast.Expr, t *token.Token) ast.Expr {
+	rule := InfixRules[t.ID]
+
+	// right associative operators parse operands of same precedence on their
+	// right, left associative ones leave them for the caller
+	prec := rule.Precedence
+	if rule.Associativity == RightAssoc {
+		prec--
+	}
+
+	right := p.parseExpr(prec)
+	return &ast.BinaryExpr{Loc: left.Span().To(right.Span()), Op: t.ID, X: left, Y: right}
+}
+
+func parseCall(p *Parser, left ast.Expr, t *token.Token) ast.Expr {
+	call := &ast.CallExpr{Fun: left}
+	if !p.check(token.RIGHT_PAREN) {
+		for {
+			call.Args = append(call.Args, p.expression())
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+
+	end := p.expect(token.RIGHT_PAREN, "after arguments")
+	call.Loc = left.Span().To(end.Span)
+
+	return call
+}
+
+func parseIndex(p *Parser, left ast.Expr, t *token.Token) ast.Expr {
+	index := p.expression()
+	end := p.expect(token.RIGHT_BRACKET, "after index")
+
+	return &ast.IndexExpr{Loc: left.Span().To(end.Span), X: left, Index: index}
+}
+
+func parseSelector(p *Parser, left ast.Expr, t *token.Token) ast.Expr {
+	sel := p.ident()
+	return &ast.SelectorExpr{Loc: left.Span().To(sel.Loc), X: left, Sel: sel}
+}
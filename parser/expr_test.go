@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpressions(t *testing.T) {
+	Convey("Expressions", t, func() {
+		Convey("It parses by precedence", func() {
+			for src, expected := range map[string]string{
+				"a + b * c == d and e":    "(and (== (+ a (* b c)) d) e)",
+				"a or b and c":            "(or a (and b c))",
+				"a < b == c >= d":         "(== (< a b) (>= c d))",
+				"a * b + c / d":           "(+ (* a b) (/ c d))",
+				"-a * b":                  "(* (- a) b)",
+				"!a == b":                 "(== (! a) b)",
+				"-f(x)":                   "(- (call f x))",
+				"(a + b) * c":             "(* (paren (+ a b)) c)",
+				`print("hi")`:             `(call print "hi")`,
+				"a.b.c":                   "(. (. a b) c)",
+				"a.b(c)[d]":               "(index (call (. a b) c) d)",
+				"f(a, b + 1)(c)":          "(call (call f a (+ b 1)) c)",
+				"buf[i + 1] * 2":          "(* (index buf (+ i 1)) 2)",
+				"!!done":                  "(! (! done))",
+				"a - b - c":               "(- (- a b) c)",
+				"a == b != c":             "(!= (== a b) c)",
+				"x.y[0].z":                "(. (index (. x y) 0) z)",
+				"true and false or nil":   "(or (and true false) nil)",
+				"1.5 * -2":                "(* 1.5 (- 2))",
+				"pins[led.index](on, 13)": "(call (index pins (. led index)) on 13)",
+				"[1, 2, a + 1]":           "(array 1 2 (+ a 1))",
+				"[]":                      "(array)",
+				"[[1], [2,]][0][0]":       "(index (index (array (array 1) (array 2)) 0) 0)",
+			} {
+				So(ast.SExpr(parseExpr(src)), ShouldEqual, expected)
+			}
+		})
+
+		Convey("It uses associativity from the table", func() {
+			rule := InfixRules[token.MINUS]
+			defer func() { InfixRules[token.MINUS] = rule }()
+
+			right := rule
+			right.Associativity = RightAssoc
+			InfixRules[token.MINUS] = right
+
+			So(ast.SExpr(parseExpr("a - b - c")), ShouldEqual, "(- a (- b c))")
+		})
+
+		Convey("It has postfix operators binding tightest", func() {
+			for _, id := range []token.TokenID{token.LEFT_PAREN, token.LEFT_BRACKET, token.DOT} {
+				So(InfixRules[id].Precedence, ShouldEqual, PrecPostfix)
+			}
+		})
+
+		Convey("It sets span of expressions", func() {
+			x := parseExpr("a + b[1]").(*ast.BinaryExpr)
+			So(x.Span().Start.Column, ShouldEqual, 12)
+			So(x.Span().End.Column, ShouldEqual, 20)
+			So(x.Y.Span().Start.Column, ShouldEqual, 16)
+		})
+
+		Convey("It reports unclosed index", func() {
+			_, diags := ParseString("fn f() { a[1; }")
+			So(diags.Error(), ShouldEqual, `1:13: expected ] after index, found ";"`)
+		})
+
+		Convey("It reports operators without operands", func() {
+			_, diags := ParseString("fn f() { a + ; }")
+			So(diags.Error(), ShouldEqual, `1:14: expected expression, found ";"`)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestGolden parses each testdata/*.bit and compares dump of its tree with
+// the .golden file next to it. Run with -update to rewrite them after a
+// change to the parser, and review the diff.
+func TestGolden(t *testing.T) {
+	Convey("Golden", t, func() {
+		sources, err := filepath.Glob("testdata/*.bit")
+		So(err, ShouldBeNil)
+		So(sources, ShouldNotBeEmpty)
+
+		for _, source := range sources {
+			src, err := ioutil.ReadFile(source)
+			So(err, ShouldBeNil)
+
+			file, diags := ParseString(string(src))
+			So(diags, ShouldBeEmpty)
+
+			golden := strings.TrimSuffix(source, ".bit") + ".golden"
+			if *update {
+				So(ioutil.WriteFile(golden, []byte(ast.Dump(file)), 0644), ShouldBeNil)
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			So(err, ShouldBeNil)
+			So(ast.Dump(file), ShouldEqual, string(want))
+
+			// the S-expression form reads back to the same tree
+			read, err := ast.ReadSExpr(ast.DumpSExpr(file))
+			So(err, ShouldBeNil)
+			So(ast.Equal(read, file), ShouldBeTrue)
+		}
+	})
+}
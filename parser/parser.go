@@ -0,0 +1,796 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/lexer"
+	"github.com/sent-hil/bitlang/runeio"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Parser is a recursive descent parser that builds an ast.File from tokens
+// returned by AnyLexer.
+//
+// On an error the parser unwinds to the enclosing statement or declaration,
+// records a diagnostic, and skips tokens till a likely start of the next one,
+// so that a single error doesn't hide the ones after it.
+type Parser struct {
+	// tokens are the tokens to be parsed without whitespace and comments; it
+	// always ends with EOF.
+	tokens  []*token.Token
+	current int
+
+	// importsDone is set once a declaration other than an import is parsed.
+	importsDone bool
+
+	diags diag.List
+}
+
+// bailout is used to unwind the parser to the enclosing statement or
+// declaration on an error.
+type bailout struct{}
+
+// NewParser is the required initializer for Parser.
+func NewParser(tokens []*token.Token) *Parser {
+	var significant []*token.Token
+	for _, t := range tokens {
+		if t.ID != token.WHITESPACE && t.ID != token.COMMENT {
+			significant = append(significant, t)
+		}
+	}
+
+	if n := len(significant); n == 0 || significant[n-1].ID != token.EOF {
+		var end token.Pos
+		if len(tokens) > 0 {
+			end = tokens[len(tokens)-1].Span.End
+		}
+		eof := token.NewToken(token.EOF, "")
+		eof.Span = token.Span{Start: end, End: end}
+		significant = append(significant, eof)
+	}
+
+	return &Parser{tokens: significant}
+}
+
+// ParseString lexes and parses given source as a file. File is nil only if
+// source couldn't be lexed.
+func ParseString(src string) (*ast.File, diag.List) {
+	tokens, err := lexer.NewAnyLexer(runeio.NewReader(strings.NewReader(src))).LexAll()
+	if err != nil {
+		var d *diag.Diagnostic
+		if !errors.As(err, &d) {
+			d = &diag.Diagnostic{Message: err.Error()}
+		}
+		return nil, diag.List{d}
+	}
+
+	return NewParser(tokens).ParseFile()
+}
+
+// ParseFile parses all the tokens as a file. It always returns a file; parts
+// that couldn't be parsed are ast.BadDecl and ast.BadStmt nodes, with the
+// errors in returned diagnostics.
+func (p *Parser) ParseFile() (*ast.File, diag.List) {
+	start := p.peek().Span
+	file := &ast.File{}
+	for !p.check(token.EOF) {
+		file.Decls = append(file.Decls, p.declaration())
+	}
+	file.Loc = start.To(p.peek().Span)
+
+	return file, p.diags
+}
+
+// ----------------------------------------------------------------------------
+// Declarations
+
+// declaration parses a declaration, recovering from errors in it by skipping
+// to start of the next one.
+func (p *Parser) declaration() (decl ast.Decl) {
+	start := p.current
+	defer func() {
+		if r := recover(); r != nil {
+			p.unwound(r)
+			p.synchronize(start, token.IMPORT, token.VAR, token.CONST, token.FN, token.STRUCT,
+				token.ENUM, token.REG)
+			decl = &ast.BadDecl{Loc: p.skipped(start)}
+		}
+	}()
+
+	return p.parseDecl()
+}
+
+func (p *Parser) parseDecl() ast.Decl {
+	if !p.check(token.IMPORT) {
+		p.importsDone = true
+	}
+
+	switch p.peek().ID {
+	case token.IMPORT:
+		return p.importDecl()
+	case token.VAR:
+		decl := p.varDecl()
+		p.expect(token.SEMICOLON, "after variable declaration")
+		return decl
+	case token.CONST:
+		decl := p.constDecl()
+		p.expect(token.SEMICOLON, "after constant declaration")
+		return decl
+	case token.FN:
+		return p.funcDecl()
+	case token.STRUCT:
+		return p.structDecl()
+	case token.ENUM:
+		return p.enumDecl()
+	case token.REG:
+		return p.regDecl()
+	}
+
+	p.errorf(p.peek().Span, "expected declaration, found %s", describe(p.peek()))
+	return nil
+}
+
+// importDecl parses `import "path";` or `import _ "path";`, which must come
+// before any other declaration.
+func (p *Parser) importDecl() *ast.ImportDecl {
+	start := p.expect(token.IMPORT, "")
+	if p.importsDone {
+		p.errorf(start.Span, "imports must come before other declarations")
+	}
+
+	var name *ast.Ident
+	if p.check(token.IDENTIFIER) && p.peekNext().ID == token.STRING {
+		name = p.ident()
+		if name.Name != "_" {
+			p.errorf(name.Loc, "import can only be named _, found %s", name.Name)
+		}
+	}
+
+	t := p.expect(token.STRING, "path after import")
+	path := &ast.BasicLit{Loc: t.Span, Kind: t.ID, Value: t.Value}
+	end := p.expect(token.SEMICOLON, "after import")
+
+	return &ast.ImportDecl{Loc: start.Span.To(end.Span), Name: name, Path: path}
+}
+
+// varDecl parses `var name: type attrs = value`, without the terminator;
+// either the type or the value can be left out.
+func (p *Parser) varDecl() *ast.VarDecl {
+	start := p.expect(token.VAR, "")
+	decl := &ast.VarDecl{Name: p.ident()}
+	if p.match(token.COLON) {
+		decl.Type = p.typeExpr()
+	}
+	decl.Attrs = p.attrs()
+	if p.match(token.EQUAL) {
+		decl.Value = p.expression()
+	}
+	decl.Loc = start.Span.To(p.previous().Span)
+
+	return decl
+}
+
+// constDecl parses `const name: type = value`, without the terminator; the
+// type can be left out.
+func (p *Parser) constDecl() *ast.ConstDecl {
+	start := p.expect(token.CONST, "")
+	decl := &ast.ConstDecl{Name: p.ident()}
+	if p.match(token.COLON) {
+		decl.Type = p.typeExpr()
+	}
+	p.expect(token.EQUAL, "in constant declaration")
+	decl.Value = p.expression()
+	decl.Loc = start.Span.To(decl.Value.Span())
+
+	return decl
+}
+
+// funcDecl parses `fn name(a: u8, b: u16) -> u8 attrs { ... }`; the result
+// type is left out for functions that don't return a value.
+func (p *Parser) funcDecl() *ast.FuncDecl {
+	start := p.expect(token.FN, "")
+	decl := &ast.FuncDecl{Name: p.funcName()}
+
+	p.expect(token.LEFT_PAREN, "after function name")
+	if !p.check(token.RIGHT_PAREN) {
+		for {
+			decl.Params = append(decl.Params, p.param())
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+	p.expect(token.RIGHT_PAREN, "after parameters")
+
+	if p.match(token.ARROW) {
+		decl.Result = p.typeExpr()
+	}
+	decl.Attrs = p.attrs()
+
+	decl.Body = p.block()
+	decl.Loc = start.Span.To(decl.Body.Loc)
+
+	return decl
+}
+
+// funcName parses name of a function. Entry point loop is named by a
+// keyword, so it's allowed as a function name too.
+func (p *Parser) funcName() *ast.Ident {
+	if t := p.peek(); p.match(token.LOOP) {
+		return &ast.Ident{Loc: t.Span, Name: t.Value}
+	}
+
+	return p.ident()
+}
+
+// structDecl parses `struct Name attrs { name: type attrs, ... }`; the
+// comma after the last field is optional.
+func (p *Parser) structDecl() *ast.StructDecl {
+	start := p.expect(token.STRUCT, "")
+	decl := &ast.StructDecl{Name: p.ident(), Attrs: p.attrs()}
+
+	p.expect(token.LEFT_BRACE, "after struct name")
+	for !p.check(token.RIGHT_BRACE) {
+		name := p.ident()
+		p.expect(token.COLON, "after field name")
+		field := &ast.Field{Name: name, Type: p.typeExpr(), Attrs: p.attrs()}
+		field.Loc = name.Loc.To(p.previous().Span)
+		decl.Fields = append(decl.Fields, field)
+
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	end := p.expect(token.RIGHT_BRACE, "after fields")
+	decl.Loc = start.Span.To(end.Span)
+
+	return decl
+}
+
+// enumDecl parses `enum Name { A, B = 5, C }`; the comma after the last
+// member is optional.
+func (p *Parser) enumDecl() *ast.EnumDecl {
+	start := p.expect(token.ENUM, "")
+	decl := &ast.EnumDecl{Name: p.ident()}
+
+	p.expect(token.LEFT_BRACE, "after enum name")
+	for !p.check(token.RIGHT_BRACE) {
+		member := &ast.EnumMember{Name: p.ident()}
+		if p.match(token.EQUAL) {
+			member.Value = p.expression()
+		}
+		member.Loc = member.Name.Loc.To(p.previous().Span)
+		decl.Members = append(decl.Members, member)
+
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	end := p.expect(token.RIGHT_BRACE, "after enum members")
+	decl.Loc = start.Span.To(end.Span)
+
+	return decl
+}
+
+// regDecl parses `reg NAME @ address { A: bit 0, B: bit 1 }`; the comma
+// after the last bit is optional, and registers without named bits can leave
+// out the braces and end with a semicolon instead.
+func (p *Parser) regDecl() *ast.RegDecl {
+	start := p.expect(token.REG, "")
+	decl := &ast.RegDecl{Name: p.ident()}
+
+	p.expect(token.AT, "after register name")
+	decl.Addr = p.expression()
+
+	if end := p.peek(); p.match(token.SEMICOLON) {
+		decl.Loc = start.Span.To(end.Span)
+		return decl
+	}
+
+	p.expect(token.LEFT_BRACE, "after register address")
+	for !p.check(token.RIGHT_BRACE) {
+		b := &ast.RegBit{Name: p.ident()}
+		p.expect(token.COLON, "after bit name")
+		if t := p.peek(); t.ID != token.IDENTIFIER || t.Value != "bit" {
+			p.errorf(t.Span, "expected bit after bit name, found %s", describe(t))
+		}
+		p.advance()
+		b.Bit = p.expression()
+		b.Loc = b.Name.Loc.To(b.Bit.Span())
+		decl.Bits = append(decl.Bits, b)
+
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	end := p.expect(token.RIGHT_BRACE, "after register bits")
+	decl.Loc = start.Span.To(end.Span)
+
+	return decl
+}
+
+// attrs parses attributes, eg `packed align(2)`.
+func (p *Parser) attrs() (attrs []*ast.Attr) {
+	for p.check(token.IDENTIFIER) {
+		attr := &ast.Attr{Name: p.ident()}
+		if p.match(token.LEFT_PAREN) {
+			for !p.check(token.RIGHT_PAREN) {
+				attr.Args = append(attr.Args, p.expression())
+				if !p.match(token.COMMA) {
+					break
+				}
+			}
+			p.expect(token.RIGHT_PAREN, "after attribute arguments")
+		}
+		attr.Loc = attr.Name.Loc.To(p.previous().Span)
+		attrs = append(attrs, attr)
+	}
+
+	return attrs
+}
+
+// param parses `name: type`.
+func (p *Parser) param() *ast.Param {
+	name := p.ident()
+	p.expect(token.COLON, "after parameter name")
+	typ := p.typeExpr()
+
+	return &ast.Param{Loc: name.Loc.To(typ.Span()), Name: name, Type: typ}
+}
+
+// typeExpr parses a type, which is either a name, eg u8, or an array of
+// them, eg [4]u8.
+func (p *Parser) typeExpr() ast.Expr {
+	if start := p.peek(); p.match(token.LEFT_BRACKET) {
+		length := p.expression()
+		p.expect(token.RIGHT_BRACKET, "after array length")
+		elem := p.typeExpr()
+		return &ast.ArrayType{Loc: start.Span.To(elem.Span()), Len: length, Elem: elem}
+	}
+
+	if !p.check(token.IDENTIFIER) {
+		p.errorf(p.peek().Span, "expected type, found %s", describe(p.peek()))
+	}
+
+	return p.fixedName(p.ident())
+}
+
+// fixedName returns name of the fixed-point type starting with id, like
+// q8.8, which is lexed as name, dot and integer. Other names are returned as
+// is.
+func (p *Parser) fixedName(id *ast.Ident) *ast.Ident {
+	dot, frac := p.peek(), p.peekNext()
+	if !isFixedPrefix(id.Name) || dot.ID != token.DOT || frac.ID != token.INTEGER ||
+		dot.Span.Start != id.Loc.End || frac.Span.Start != dot.Span.End {
+		return id
+	}
+
+	p.advance()
+	p.advance()
+	return &ast.Ident{Loc: id.Loc.To(frac.Span), Name: id.Name + "." + frac.Value}
+}
+
+// isFixedPrefix returns if name is q followed by digits, like q8 of q8.8.
+func isFixedPrefix(name string) bool {
+	if len(name) < 2 || name[0] != 'q' {
+		return false
+	}
+
+	for _, c := range name[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ----------------------------------------------------------------------------
+// Statements
+
+// statement parses a statement, recovering from errors in it by skipping to
+// start of the next one.
+func (p *Parser) statement() (stmt ast.Stmt) {
+	start := p.current
+	defer func() {
+		if r := recover(); r != nil {
+			p.unwound(r)
+			p.synchronize(start, token.VAR, token.CONST, token.IF, token.FOR, token.WHILE,
+				token.LOOP, token.RETURN, token.SWITCH, token.ATOMIC)
+			stmt = &ast.BadStmt{Loc: p.skipped(start)}
+		}
+	}()
+
+	return p.parseStmt()
+}
+
+func (p *Parser) parseStmt() ast.Stmt {
+	switch p.peek().ID {
+	case token.VAR:
+		decl := p.varDecl()
+		p.terminator()
+		return decl
+	case token.CONST:
+		decl := p.constDecl()
+		p.terminator()
+		return decl
+	case token.IF:
+		return p.ifStmt()
+	case token.FOR, token.WHILE, token.LOOP:
+		return p.loopStmt()
+	case token.BREAK, token.CONTINUE:
+		stmt := p.branchStmt()
+		p.terminator()
+		return stmt
+	case token.RETURN:
+		return p.returnStmt()
+	case token.SWITCH:
+		return p.switchStmt()
+	case token.ATOMIC:
+		start := p.advance()
+		body := p.block()
+		return &ast.AtomicStmt{Loc: start.Span.To(body.Loc), Body: body}
+	case token.LEFT_BRACE:
+		return p.block()
+	case token.IDENTIFIER:
+		if p.peekNext().ID == token.COLON {
+			return p.labeledStmt()
+		}
+	}
+
+	stmt := p.simpleStmt()
+	p.terminator()
+
+	return stmt
+}
+
+// terminator expects a semicolon at end of a statement; it can be left out
+// before the closing brace of a block.
+func (p *Parser) terminator() {
+	if p.check(token.RIGHT_BRACE) {
+		return
+	}
+
+	p.expect(token.SEMICOLON, "after statement")
+}
+
+// simpleStmt parses an assignment or an expression statement.
+func (p *Parser) simpleStmt() ast.Stmt {
+	x := p.expression()
+	if !p.match(token.EQUAL) {
+		return &ast.ExprStmt{Loc: x.Span(), X: x}
+	}
+
+	switch x.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr:
+	default:
+		p.errorf(x.Span(), "cannot assign to expression")
+	}
+
+	value := p.expression()
+	return &ast.AssignStmt{Loc: x.Span().To(value.Span()), Target: x, Value: value}
+}
+
+func (p *Parser) block() *ast.BlockStmt {
+	start := p.expect(token.LEFT_BRACE, "")
+
+	block := &ast.BlockStmt{}
+	for !p.check(token.RIGHT_BRACE) && !p.check(token.EOF) {
+		block.Stmts = append(block.Stmts, p.statement())
+	}
+
+	end := p.expect(token.RIGHT_BRACE, "at end of block")
+	block.Loc = start.Span.To(end.Span)
+
+	return block
+}
+
+// ifStmt parses `if cond { ... } else ...`.
+func (p *Parser) ifStmt() *ast.IfStmt {
+	start := p.expect(token.IF, "")
+
+	stmt := &ast.IfStmt{Cond: p.expression(), Then: p.block()}
+	stmt.Loc = start.Span.To(stmt.Then.Loc)
+
+	if p.match(token.ELSE) {
+		if p.check(token.IF) {
+			stmt.Else = p.ifStmt()
+		} else {
+			stmt.Else = p.block()
+		}
+		stmt.Loc = start.Span.To(stmt.Else.Span())
+	}
+
+	return stmt
+}
+
+// labeledStmt parses `label: loop`; only loops can have labels.
+func (p *Parser) labeledStmt() *ast.LabeledStmt {
+	label := p.ident()
+	p.expect(token.COLON, "after label")
+	if !p.check(token.FOR) && !p.check(token.WHILE) && !p.check(token.LOOP) {
+		p.errorf(p.peek().Span, "expected loop after label, found %s", describe(p.peek()))
+	}
+
+	stmt := p.loopStmt()
+	return &ast.LabeledStmt{Loc: label.Loc.To(stmt.Span()), Label: label, Stmt: stmt}
+}
+
+// loopStmt parses a for, while or loop statement.
+func (p *Parser) loopStmt() ast.Stmt {
+	switch p.peek().ID {
+	case token.WHILE:
+		return p.whileStmt()
+	case token.LOOP:
+		start := p.advance()
+		body := p.block()
+		return &ast.LoopStmt{Loc: start.Span.To(body.Loc), Body: body}
+	}
+
+	return p.forStmt()
+}
+
+// whileStmt parses `while cond { ... }`.
+func (p *Parser) whileStmt() *ast.WhileStmt {
+	start := p.expect(token.WHILE, "")
+	stmt := &ast.WhileStmt{Cond: p.expression()}
+	stmt.Body = p.block()
+	stmt.Loc = start.Span.To(stmt.Body.Loc)
+
+	return stmt
+}
+
+// branchStmt parses `break` or `continue` with an optional label, without
+// the terminator.
+func (p *Parser) branchStmt() *ast.BranchStmt {
+	t := p.advance()
+	stmt := &ast.BranchStmt{Loc: t.Span, Tok: t.ID}
+	if p.check(token.IDENTIFIER) {
+		stmt.Label = p.ident()
+		stmt.Loc = t.Span.To(stmt.Label.Loc)
+	}
+
+	return stmt
+}
+
+// forStmt parses `for init; cond; post { ... }`; any of the clauses can be
+// left out.
+func (p *Parser) forStmt() *ast.ForStmt {
+	start := p.expect(token.FOR, "")
+
+	stmt := &ast.ForStmt{}
+	if !p.check(token.SEMICOLON) {
+		if p.check(token.VAR) {
+			stmt.Init = p.varDecl()
+		} else {
+			stmt.Init = p.simpleStmt()
+		}
+	}
+	p.expect(token.SEMICOLON, "after for loop initializer")
+
+	if !p.check(token.SEMICOLON) {
+		stmt.Cond = p.expression()
+	}
+	p.expect(token.SEMICOLON, "after for loop condition")
+
+	if !p.check(token.LEFT_BRACE) {
+		stmt.Post = p.simpleStmt()
+	}
+
+	stmt.Body = p.block()
+	stmt.Loc = start.Span.To(stmt.Body.Loc)
+
+	return stmt
+}
+
+// switchStmt parses `switch tag { case a, b { ... } default { ... } }`.
+func (p *Parser) switchStmt() *ast.SwitchStmt {
+	start := p.expect(token.SWITCH, "")
+	stmt := &ast.SwitchStmt{Tag: p.expression()}
+
+	p.expect(token.LEFT_BRACE, "after switch value")
+	for !p.check(token.RIGHT_BRACE) && !p.check(token.EOF) {
+		clauseStart := p.peek()
+		clause := &ast.CaseClause{}
+		switch {
+		case p.match(token.DEFAULT):
+		case p.match(token.CASE):
+			for {
+				clause.Values = append(clause.Values, p.expression())
+				if !p.match(token.COMMA) {
+					break
+				}
+			}
+		default:
+			p.errorf(p.peek().Span, "expected case or default, found %s", describe(p.peek()))
+		}
+
+		clause.Body = p.block()
+		clause.Loc = clauseStart.Span.To(clause.Body.Loc)
+		stmt.Cases = append(stmt.Cases, clause)
+	}
+	end := p.expect(token.RIGHT_BRACE, "after cases")
+	stmt.Loc = start.Span.To(end.Span)
+
+	return stmt
+}
+
+func (p *Parser) returnStmt() *ast.ReturnStmt {
+	start := p.expect(token.RETURN, "")
+
+	stmt := &ast.ReturnStmt{}
+	if !p.check(token.SEMICOLON) && !p.check(token.RIGHT_BRACE) {
+		stmt.Value = p.expression()
+	}
+	stmt.Loc = start.Span.To(p.previous().Span)
+	p.terminator()
+
+	return stmt
+}
+
+func (p *Parser) ident() *ast.Ident {
+	t := p.expect(token.IDENTIFIER, "")
+	return &ast.Ident{Loc: t.Span, Name: t.Value}
+}
+
+// ----------------------------------------------------------------------------
+// Helpers
+
+func (p *Parser) peek() *token.Token {
+	return p.tokens[p.current]
+}
+
+// peekNext returns the token after the current one.
+func (p *Parser) peekNext() *token.Token {
+	if p.current+1 < len(p.tokens) {
+		return p.tokens[p.current+1]
+	}
+
+	return p.peek()
+}
+
+func (p *Parser) previous() *token.Token {
+	return p.tokens[p.current-1]
+}
+
+// advance returns current token and moves to next one; it stays at EOF.
+func (p *Parser) advance() *token.Token {
+	t := p.peek()
+	if t.ID != token.EOF {
+		p.current++
+	}
+
+	return t
+}
+
+func (p *Parser) check(id token.TokenID) bool {
+	return p.peek().ID == id
+}
+
+// match advances if current token is any of given ids.
+func (p *Parser) match(ids ...token.TokenID) bool {
+	for _, id := range ids {
+		if p.check(id) {
+			p.advance()
+			return true
+		}
+	}
+
+	return false
+}
+
+// expect advances if current token is given id, else it reports an error;
+// context describes where the token was expected, eg "after arguments".
+func (p *Parser) expect(id token.TokenID, context string) *token.Token {
+	if p.check(id) {
+		return p.advance()
+	}
+
+	msg := fmt.Sprintf("expected %s", tokenNames[id])
+	if context != "" {
+		msg += " " + context
+	}
+	p.errorf(p.peek().Span, "%s, found %s", msg, describe(p.peek()))
+
+	return nil
+}
+
+// errorf records an error and unwinds to the enclosing statement or
+// declaration.
+func (p *Parser) errorf(span token.Span, format string, args ...interface{}) {
+	p.diags.Add(span, format, args...)
+	panic(bailout{})
+}
+
+// unwound checks value recovered while unwinding is from errorf, and panics
+// again with it if it isn't.
+func (p *Parser) unwound(r interface{}) {
+	if _, ok := r.(bailout); !ok {
+		panic(r)
+	}
+}
+
+// synchronize skips tokens till after a semicolon, after a block, before a
+// closing brace of an enclosing block or before any of given keywords. Tokens
+// inside braces are skipped as a whole, so body of a statement that failed is
+// skipped with it, even if the error was inside it. It always skips at least
+// one token if the failed statement started at the current one, so the parser
+// makes progress.
+func (p *Parser) synchronize(start int, keywords ...token.TokenID) {
+	// braces the failed statement opened before the error are still open
+	depth := 0
+	for _, t := range p.tokens[start:p.current] {
+		switch t.ID {
+		case token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_BRACE:
+			depth--
+		}
+	}
+	if depth < 0 {
+		depth = 0
+	}
+
+	if p.current == start {
+		p.advance()
+	}
+	for !p.check(token.EOF) {
+		if depth == 0 {
+			if p.previous().ID == token.SEMICOLON || p.check(token.RIGHT_BRACE) {
+				return
+			}
+			for _, id := range keywords {
+				if p.check(id) {
+					return
+				}
+			}
+		}
+
+		switch p.advance().ID {
+		case token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_BRACE:
+			if depth--; depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+// skipped returns span of tokens from given index till current one.
+func (p *Parser) skipped(start int) token.Span {
+	if start >= p.current {
+		return p.peek().Span
+	}
+
+	return p.tokens[start].Span.To(p.previous().Span)
+}
+
+// tokenNames are used in errors when describing expected tokens; they're
+// how tokens are written in source.
+var tokenNames = map[token.TokenID]string{
+	token.IDENTIFIER: "name",
+	token.STRING:     "string",
+}
+
+func init() {
+	for _, values := range []map[string]token.TokenID{
+		lexer.SymbolsMap, lexer.SymbolsNested, token.KeywordsList,
+	} {
+		for value, id := range values {
+			tokenNames[id] = value
+		}
+	}
+}
+
+// describe returns how given token is shown in errors.
+func describe(t *token.Token) string {
+	if t.ID == token.EOF {
+		return "end of file"
+	}
+
+	return fmt.Sprintf("%q", t.Value)
+}
@@ -0,0 +1,474 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// parseBody parses given statements as body of a function and returns them.
+func parseBody(src string) []ast.Stmt {
+	file, diags := ParseString("fn main() {" + src + "}")
+	So(diags, ShouldBeEmpty)
+
+	return file.Decls[0].(*ast.FuncDecl).Body.Stmts
+}
+
+// parseExpr parses given expression.
+func parseExpr(src string) ast.Expr {
+	return parseBody(src + ";")[0].(*ast.ExprStmt).X
+}
+
+func TestParser(t *testing.T) {
+	Convey("Parser", t, func() {
+		Convey("Declarations", func() {
+			Convey("It parses var declarations", func() {
+				file, diags := ParseString("var a = 1; var b;")
+				So(diags, ShouldBeEmpty)
+				So(len(file.Decls), ShouldEqual, 2)
+
+				a := file.Decls[0].(*ast.VarDecl)
+				So(a.Name.Name, ShouldEqual, "a")
+				So(a.Value.(*ast.BasicLit).Value, ShouldEqual, "1")
+
+				b := file.Decls[1].(*ast.VarDecl)
+				So(b.Name.Name, ShouldEqual, "b")
+				So(b.Value, ShouldBeNil)
+			})
+
+			Convey("It parses function declarations", func() {
+				file, diags := ParseString("fn add(a: u8, b: u16) -> u8 { return a + b; }")
+				So(diags, ShouldBeEmpty)
+
+				fn := file.Decls[0].(*ast.FuncDecl)
+				So(fn.Name.Name, ShouldEqual, "add")
+				So(len(fn.Params), ShouldEqual, 2)
+				So(fn.Params[0].Name.Name, ShouldEqual, "a")
+				So(fn.Params[0].Type.(*ast.Ident).Name, ShouldEqual, "u8")
+				So(fn.Params[1].Name.Name, ShouldEqual, "b")
+				So(fn.Params[1].Type.(*ast.Ident).Name, ShouldEqual, "u16")
+				So(fn.Result.(*ast.Ident).Name, ShouldEqual, "u8")
+				So(len(fn.Body.Stmts), ShouldEqual, 1)
+			})
+
+			Convey("It parses functions without parameters or result", func() {
+				file, diags := ParseString("fn setup() {}")
+				So(diags, ShouldBeEmpty)
+				So(file.Decls[0].(*ast.FuncDecl).Params, ShouldBeEmpty)
+				So(file.Decls[0].(*ast.FuncDecl).Result, ShouldBeNil)
+			})
+
+			Convey("It parses entry point loop though its name is a keyword", func() {
+				file, diags := ParseString("fn loop() { loop { } }")
+				So(diags, ShouldBeEmpty)
+				So(file.Decls[0].(*ast.FuncDecl).Name.Name, ShouldEqual, "loop")
+			})
+
+			Convey("It parses attributes of functions", func() {
+				file, diags := ParseString("fn tick() interrupt(TIMER1_COMPA) { } fn f() -> u8 inline { return 1; }")
+				So(diags, ShouldBeEmpty)
+
+				tick := file.Decls[0].(*ast.FuncDecl)
+				So(len(tick.Attrs), ShouldEqual, 1)
+				So(tick.Attrs[0].Name.Name, ShouldEqual, "interrupt")
+				So(tick.Attrs[0].Args[0].(*ast.Ident).Name, ShouldEqual, "TIMER1_COMPA")
+
+				f := file.Decls[1].(*ast.FuncDecl)
+				So(f.Result.(*ast.Ident).Name, ShouldEqual, "u8")
+				So(f.Attrs[0].Name.Name, ShouldEqual, "inline")
+			})
+
+			Convey("It sets span of parameters from name till type", func() {
+				file, _ := ParseString("fn f(pin: u8) {}")
+				span := file.Decls[0].(*ast.FuncDecl).Params[0].Span()
+				So(span.Start.Column, ShouldEqual, 6)
+				So(span.End.Column, ShouldEqual, 13)
+			})
+
+			Convey("It parses var declarations with types", func() {
+				file, diags := ParseString("var p: Packet; var n: u8 = 1;")
+				So(diags, ShouldBeEmpty)
+				So(file.Decls[0].(*ast.VarDecl).Type.(*ast.Ident).Name, ShouldEqual, "Packet")
+				So(file.Decls[1].(*ast.VarDecl).Value.(*ast.BasicLit).Value, ShouldEqual, "1")
+			})
+
+			Convey("It parses array types", func() {
+				file, diags := ParseString("var grid: [2][3]u8;")
+				So(diags, ShouldBeEmpty)
+
+				outer := file.Decls[0].(*ast.VarDecl).Type.(*ast.ArrayType)
+				So(outer.Len.(*ast.BasicLit).Value, ShouldEqual, "2")
+				inner := outer.Elem.(*ast.ArrayType)
+				So(inner.Len.(*ast.BasicLit).Value, ShouldEqual, "3")
+				So(inner.Elem.(*ast.Ident).Name, ShouldEqual, "u8")
+			})
+
+			Convey("It parses fixed-point type names", func() {
+				file, diags := ParseString("var a: q8.8 = q1.15(b);")
+				So(diags, ShouldBeEmpty)
+
+				a := file.Decls[0].(*ast.VarDecl)
+				So(a.Type.(*ast.Ident).Name, ShouldEqual, "q8.8")
+				So(a.Type.Span().End.Column, ShouldEqual, 12)
+				So(a.Value.(*ast.CallExpr).Fun.(*ast.Ident).Name, ShouldEqual, "q1.15")
+
+				_, diags = ParseString("var c = q8 . 8;")
+				So(diags.Error(), ShouldEqual, `1:14: expected name, found "8"`)
+			})
+
+			Convey("It parses const declarations", func() {
+				file, diags := ParseString("const LED = 5; const MASK: u8 = bit(LED); fn f() { const N = 2; }")
+				So(diags, ShouldBeEmpty)
+
+				led := file.Decls[0].(*ast.ConstDecl)
+				So(led.Name.Name, ShouldEqual, "LED")
+				So(led.Type, ShouldBeNil)
+
+				mask := file.Decls[1].(*ast.ConstDecl)
+				So(mask.Type.(*ast.Ident).Name, ShouldEqual, "u8")
+				So(len(mask.Value.(*ast.CallExpr).Args), ShouldEqual, 1)
+
+				body := file.Decls[2].(*ast.FuncDecl).Body.Stmts
+				So(body[0].(*ast.ConstDecl).Name.Name, ShouldEqual, "N")
+			})
+
+			Convey("It reports const declarations without a value", func() {
+				_, diags := ParseString("const A: u8;")
+				So(diags.Error(), ShouldContainSubstring, "in constant declaration")
+			})
+
+			Convey("It parses attributes of variables", func() {
+				file, diags := ParseString("var ticks: u16 volatile = 0; var flag volatile;")
+				So(diags, ShouldBeEmpty)
+
+				ticks := file.Decls[0].(*ast.VarDecl)
+				So(ticks.Type.(*ast.Ident).Name, ShouldEqual, "u16")
+				So(ticks.Attrs[0].Name.Name, ShouldEqual, "volatile")
+				So(ticks.Value.(*ast.BasicLit).Value, ShouldEqual, "0")
+				So(file.Decls[1].(*ast.VarDecl).Attrs[0].Name.Name, ShouldEqual, "volatile")
+			})
+
+			Convey("It parses struct declarations", func() {
+				file, diags := ParseString("struct Packet packed align(2) { id: u8, value: u16 align(2), }")
+				So(diags, ShouldBeEmpty)
+
+				s := file.Decls[0].(*ast.StructDecl)
+				So(s.Name.Name, ShouldEqual, "Packet")
+				So(len(s.Attrs), ShouldEqual, 2)
+				So(s.Attrs[0].Name.Name, ShouldEqual, "packed")
+				So(s.Attrs[1].Args[0].(*ast.BasicLit).Value, ShouldEqual, "2")
+
+				So(len(s.Fields), ShouldEqual, 2)
+				So(s.Fields[0].Name.Name, ShouldEqual, "id")
+				So(s.Fields[1].Type.(*ast.Ident).Name, ShouldEqual, "u16")
+				So(s.Fields[1].Attrs[0].Name.Name, ShouldEqual, "align")
+			})
+
+			Convey("It parses enum declarations", func() {
+				file, diags := ParseString("enum State { Idle, Running = 4, Done, }")
+				So(diags, ShouldBeEmpty)
+
+				e := file.Decls[0].(*ast.EnumDecl)
+				So(e.Name.Name, ShouldEqual, "State")
+				So(len(e.Members), ShouldEqual, 3)
+				So(e.Members[0].Value, ShouldBeNil)
+				So(e.Members[1].Value.(*ast.BasicLit).Value, ShouldEqual, "4")
+				So(e.Members[2].Name.Name, ShouldEqual, "Done")
+			})
+
+			Convey("It parses register declarations", func() {
+				file, diags := ParseString("reg PORTB @ 0x25 { PB0: bit 0, PB5: bit 5, } reg TIMSK0 @ 0x6e;")
+				So(diags, ShouldBeEmpty)
+
+				portb := file.Decls[0].(*ast.RegDecl)
+				So(portb.Name.Name, ShouldEqual, "PORTB")
+				So(portb.Addr.(*ast.BasicLit).Value, ShouldEqual, "0x25")
+				So(len(portb.Bits), ShouldEqual, 2)
+				So(portb.Bits[1].Name.Name, ShouldEqual, "PB5")
+				So(portb.Bits[1].Bit.(*ast.BasicLit).Value, ShouldEqual, "5")
+
+				timsk := file.Decls[1].(*ast.RegDecl)
+				So(timsk.Bits, ShouldBeEmpty)
+				So(timsk.Loc.Start.Column, ShouldEqual, 46)
+				So(timsk.Loc.End.Column, ShouldEqual, 64)
+			})
+
+			Convey("It reports register bits without bit", func() {
+				_, diags := ParseString("reg PORTB @ 0x25 { PB5: 5 }")
+				So(diags.Error(), ShouldEqual, `1:25: expected bit after bit name, found "5"`)
+			})
+
+			Convey("It parses imports", func() {
+				file, diags := ParseString(`import "drivers/lcd"; import "spi"; fn setup() {}`)
+				So(diags, ShouldBeEmpty)
+				So(file.Decls[0].(*ast.ImportDecl).Path.Value, ShouldEqual, "drivers/lcd")
+				So(file.Decls[1].(*ast.ImportDecl).Path.Value, ShouldEqual, "spi")
+			})
+
+			Convey("It parses imports named _", func() {
+				file, diags := ParseString(`import _ "drivers/uart";`)
+				So(diags, ShouldBeEmpty)
+				imp := file.Decls[0].(*ast.ImportDecl)
+				So(imp.Name.Name, ShouldEqual, "_")
+				So(imp.Path.Value, ShouldEqual, "drivers/uart")
+
+				_, diags = ParseString(`import uart "drivers/uart";`)
+				So(diags.Error(), ShouldEqual, "1:8: import can only be named _, found uart")
+			})
+
+			Convey("It ignores comments and whitespace", func() {
+				file, diags := ParseString("// counter\nvar count = 0;\n")
+				So(diags, ShouldBeEmpty)
+				So(len(file.Decls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("Statements", func() {
+			Convey("It parses assignments", func() {
+				stmt := parseBody("a = 1;")[0].(*ast.AssignStmt)
+				So(stmt.Target.(*ast.Ident).Name, ShouldEqual, "a")
+				So(stmt.Value.(*ast.BasicLit).Value, ShouldEqual, "1")
+			})
+
+			Convey("It parses assignments to fields", func() {
+				stmt := parseBody("led.pin = 13;")[0].(*ast.AssignStmt)
+				So(stmt.Target.(*ast.SelectorExpr).Sel.Name, ShouldEqual, "pin")
+			})
+
+			Convey("It parses switch statements", func() {
+				stmt := parseBody(`
+switch state {
+case State.Idle, State.Done { start(); }
+default { }
+}`)[0].(*ast.SwitchStmt)
+				So(stmt.Tag.(*ast.Ident).Name, ShouldEqual, "state")
+				So(len(stmt.Cases), ShouldEqual, 2)
+				So(len(stmt.Cases[0].Values), ShouldEqual, 2)
+				So(stmt.Cases[0].Values[1].(*ast.SelectorExpr).Sel.Name, ShouldEqual, "Done")
+				So(len(stmt.Cases[0].Body.Stmts), ShouldEqual, 1)
+				So(stmt.Cases[1].Values, ShouldBeNil)
+			})
+
+			Convey("It parses atomic blocks", func() {
+				stmt := parseBody("atomic { n = ticks; return n; }")[0].(*ast.AtomicStmt)
+				So(len(stmt.Body.Stmts), ShouldEqual, 2)
+				So(stmt.Loc.End.Column, ShouldEqual, 43)
+			})
+
+			Convey("It parses while and loop statements", func() {
+				stmts := parseBody("while a < 3 { a = a + 1; } loop { poll(); }")
+				So(ast.SExpr(stmts[0].(*ast.WhileStmt).Cond), ShouldEqual, "(< a 3)")
+				So(len(stmts[1].(*ast.LoopStmt).Body.Stmts), ShouldEqual, 1)
+			})
+
+			Convey("It parses labeled loops and branches", func() {
+				stmts := parseBody("outer: loop { for ;; { continue outer; } break; }")
+				labeled := stmts[0].(*ast.LabeledStmt)
+				So(labeled.Label.Name, ShouldEqual, "outer")
+
+				body := labeled.Stmt.(*ast.LoopStmt).Body.Stmts
+				cont := body[0].(*ast.ForStmt).Body.Stmts[0].(*ast.BranchStmt)
+				So(cont.Tok, ShouldEqual, token.CONTINUE)
+				So(cont.Label.Name, ShouldEqual, "outer")
+				So(body[1].(*ast.BranchStmt).Label, ShouldBeNil)
+			})
+
+			Convey("It parses expression statements", func() {
+				stmt := parseBody("blink();")[0].(*ast.ExprStmt)
+				So(stmt.X.(*ast.CallExpr).Fun.(*ast.Ident).Name, ShouldEqual, "blink")
+			})
+
+			Convey("It parses if statements", func() {
+				stmt := parseBody("if a { b(); }")[0].(*ast.IfStmt)
+				So(stmt.Cond.(*ast.Ident).Name, ShouldEqual, "a")
+				So(len(stmt.Then.Stmts), ShouldEqual, 1)
+				So(stmt.Else, ShouldBeNil)
+			})
+
+			Convey("It parses if else chains", func() {
+				stmt := parseBody("if a { } else if b { } else { c(); }")[0].(*ast.IfStmt)
+				elseIf := stmt.Else.(*ast.IfStmt)
+				So(elseIf.Cond.(*ast.Ident).Name, ShouldEqual, "b")
+				So(len(elseIf.Else.(*ast.BlockStmt).Stmts), ShouldEqual, 1)
+			})
+
+			Convey("It parses for loops", func() {
+				stmt := parseBody("for var i = 0; i < 10; i = i + 1 { }")[0].(*ast.ForStmt)
+				So(stmt.Init.(*ast.VarDecl).Name.Name, ShouldEqual, "i")
+				So(stmt.Cond.(*ast.BinaryExpr).Op, ShouldEqual, token.LESS)
+				So(stmt.Post, ShouldHaveSameTypeAs, &ast.AssignStmt{})
+			})
+
+			Convey("It parses for loops without clauses", func() {
+				stmt := parseBody("for ;; { }")[0].(*ast.ForStmt)
+				So(stmt.Init, ShouldBeNil)
+				So(stmt.Cond, ShouldBeNil)
+				So(stmt.Post, ShouldBeNil)
+			})
+
+			Convey("It parses return statements", func() {
+				stmts := parseBody("return; return 1")
+				So(stmts[0].(*ast.ReturnStmt).Value, ShouldBeNil)
+				So(stmts[1].(*ast.ReturnStmt).Value.(*ast.BasicLit).Value, ShouldEqual, "1")
+			})
+
+			Convey("It parses nested blocks", func() {
+				stmt := parseBody("{ var a = 1; { a = 2; } }")[0].(*ast.BlockStmt)
+				So(len(stmt.Stmts), ShouldEqual, 2)
+			})
+
+			Convey("It allows semicolon to be left out before }", func() {
+				So(len(parseBody("a(); b()")), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Expressions", func() {
+			Convey("It parses literals", func() {
+				for src, kind := range map[string]token.TokenID{
+					"1":       token.INTEGER,
+					"1.5":     token.FLOAT,
+					`"hello"`: token.STRING,
+					"true":    token.TRUE,
+					"false":   token.FALSE,
+					"nil":     token.NIL,
+				} {
+					So(parseExpr(src).(*ast.BasicLit).Kind, ShouldEqual, kind)
+				}
+			})
+
+			Convey("It parses multiplication before addition", func() {
+				x := parseExpr("a + b * c").(*ast.BinaryExpr)
+				So(x.Op, ShouldEqual, token.PLUS)
+				So(x.Y.(*ast.BinaryExpr).Op, ShouldEqual, token.STAR)
+			})
+
+			Convey("It parses binary operators left associative", func() {
+				x := parseExpr("a - b - c").(*ast.BinaryExpr)
+				So(x.X.(*ast.BinaryExpr).Op, ShouldEqual, token.MINUS)
+				So(x.Y.(*ast.Ident).Name, ShouldEqual, "c")
+			})
+
+			Convey("It parses comparisons before logical operators", func() {
+				x := parseExpr("a == b and c or d").(*ast.BinaryExpr)
+				So(x.Op, ShouldEqual, token.OR)
+				and := x.X.(*ast.BinaryExpr)
+				So(and.Op, ShouldEqual, token.AND)
+				So(and.X.(*ast.BinaryExpr).Op, ShouldEqual, token.EQUAL_EQUAL)
+			})
+
+			Convey("It parses bit operators like Go", func() {
+				x := parseExpr("a | b & c").(*ast.BinaryExpr)
+				So(x.Op, ShouldEqual, token.PIPE)
+				So(x.Y.(*ast.BinaryExpr).Op, ShouldEqual, token.AMPERSAND)
+
+				x = parseExpr("a << 1 + b").(*ast.BinaryExpr)
+				So(x.Op, ShouldEqual, token.PLUS)
+				So(x.X.(*ast.BinaryExpr).Op, ShouldEqual, token.LESS_LESS)
+
+				x = parseExpr("a ^ b == c % d").(*ast.BinaryExpr)
+				So(x.Op, ShouldEqual, token.EQUAL_EQUAL)
+				So(x.X.(*ast.BinaryExpr).Op, ShouldEqual, token.CARET)
+				So(x.Y.(*ast.BinaryExpr).Op, ShouldEqual, token.PERCENT)
+
+				So(parseExpr("~a").(*ast.UnaryExpr).Op, ShouldEqual, token.TILDE)
+			})
+
+			Convey("It parses unary operators", func() {
+				x := parseExpr("!-a").(*ast.UnaryExpr)
+				So(x.Op, ShouldEqual, token.BANG)
+				So(x.X.(*ast.UnaryExpr).Op, ShouldEqual, token.MINUS)
+			})
+
+			Convey("It parses parens", func() {
+				x := parseExpr("(a + b) * c").(*ast.BinaryExpr)
+				So(x.X.(*ast.ParenExpr).X.(*ast.BinaryExpr).Op, ShouldEqual, token.PLUS)
+			})
+
+			Convey("It parses calls with arguments", func() {
+				x := parseExpr("write(13, high)").(*ast.CallExpr)
+				So(len(x.Args), ShouldEqual, 2)
+			})
+
+			Convey("It parses field accesses and calls on them", func() {
+				x := parseExpr("serial.port.write()").(*ast.CallExpr)
+				sel := x.Fun.(*ast.SelectorExpr)
+				So(sel.Sel.Name, ShouldEqual, "write")
+				So(sel.X.(*ast.SelectorExpr).Sel.Name, ShouldEqual, "port")
+			})
+		})
+
+		Convey("Spans", func() {
+			Convey("It sets span of nodes", func() {
+				file, diags := ParseString("var a = 1;\nfn f() {\n  b = a + 2;\n}")
+				So(diags, ShouldBeEmpty)
+
+				v := file.Decls[0].(*ast.VarDecl)
+				So(v.Span().Start, ShouldResemble, token.Pos{Offset: 0, Line: 1, Column: 1})
+				So(v.Span().End, ShouldResemble, token.Pos{Offset: 9, Line: 1, Column: 10})
+
+				fn := file.Decls[1].(*ast.FuncDecl)
+				So(fn.Span().Start.Line, ShouldEqual, 2)
+				So(fn.Span().End.Line, ShouldEqual, 4)
+
+				assign := fn.Body.Stmts[0].(*ast.AssignStmt)
+				So(assign.Span().Start, ShouldResemble, token.Pos{Offset: 22, Line: 3, Column: 3})
+				So(assign.Value.Span().Start.Column, ShouldEqual, 7)
+				So(assign.Value.Span().End.Column, ShouldEqual, 12)
+			})
+		})
+
+		Convey("Errors", func() {
+			Convey("It reports missing semicolons", func() {
+				_, diags := ParseString("var a = 1")
+				So(diags.Error(), ShouldEqual, `1:10: expected ; after variable declaration, found end of file`)
+			})
+
+			Convey("It reports statements at top level", func() {
+				_, diags := ParseString("a = 1;")
+				So(diags.Error(), ShouldEqual, `1:1: expected declaration, found "a"`)
+			})
+
+			Convey("It reports missing expressions", func() {
+				_, diags := ParseString("fn f() { a = ; }")
+				So(diags.Error(), ShouldEqual, `1:14: expected expression, found ";"`)
+			})
+
+			Convey("It reports assignments to non assignable expressions", func() {
+				_, diags := ParseString("fn f() { a() = 1; }")
+				So(diags.Error(), ShouldEqual, `1:10: cannot assign to expression`)
+			})
+
+			Convey("It reports parameters without types", func() {
+				_, diags := ParseString("fn f(a) {}")
+				So(diags.Error(), ShouldEqual, `1:7: expected : after parameter name, found ")"`)
+			})
+
+			Convey("It reports missing result types", func() {
+				_, diags := ParseString("fn f() -> {}")
+				So(diags.Error(), ShouldEqual, `1:11: expected type, found "{"`)
+			})
+
+			Convey("It reports clauses that aren't cases", func() {
+				_, diags := ParseString("fn f() { switch a { a(); } }")
+				So(diags.Error(), ShouldEqual, `1:21: expected case or default, found "a"`)
+			})
+
+			Convey("It reports labels on statements that aren't loops", func() {
+				_, diags := ParseString("fn f() { outer: if a { } }")
+				So(diags.Error(), ShouldEqual, `1:17: expected loop after label, found "if"`)
+			})
+
+			Convey("It reports imports without a path", func() {
+				_, diags := ParseString("import lcd;")
+				So(diags.Error(), ShouldEqual, `1:8: expected string path after import, found "lcd"`)
+			})
+
+			Convey("It reports unclosed blocks", func() {
+				_, diags := ParseString("fn f() { a();")
+				So(diags.Error(), ShouldEqual, `1:14: expected } at end of block, found end of file`)
+			})
+		})
+	})
+}
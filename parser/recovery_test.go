@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecovery(t *testing.T) {
+	Convey("Recovery", t, func() {
+		Convey("It reports every error in a file", func() {
+			file, diags := ParseString(`
+fn setup() {
+  var a = 1
+  var b = 2;
+  b = ;
+  blink();
+}
+
+var = 3;
+
+fn loop() {
+  if a + { b(); }
+  return a
+}
+`)
+			So(len(diags), ShouldEqual, 4)
+			So(diags[0].Error(), ShouldEqual, `4:3: expected ; after statement, found "var"`)
+			So(diags[1].Error(), ShouldEqual, `5:7: expected expression, found ";"`)
+			So(diags[2].Error(), ShouldEqual, `9:5: expected name, found "="`)
+			So(diags[3].Error(), ShouldEqual, `12:10: expected expression, found "{"`)
+
+			So(len(file.Decls), ShouldEqual, 3)
+		})
+
+		Convey("It keeps statements around a bad one", func() {
+			file, diags := ParseString("fn f() { a(); b = ; c(); }")
+			So(len(diags), ShouldEqual, 1)
+
+			stmts := file.Decls[0].(*ast.FuncDecl).Body.Stmts
+			So(len(stmts), ShouldEqual, 3)
+			So(stmts[0], ShouldHaveSameTypeAs, &ast.ExprStmt{})
+			So(stmts[1], ShouldHaveSameTypeAs, &ast.BadStmt{})
+			So(stmts[2], ShouldHaveSameTypeAs, &ast.ExprStmt{})
+		})
+
+		Convey("It gives bad statements span of skipped tokens", func() {
+			file, _ := ParseString("fn f() { b = ; c(); }")
+
+			bad := file.Decls[0].(*ast.FuncDecl).Body.Stmts[0]
+			So(bad.Span().Start.Column, ShouldEqual, 10)
+			So(bad.Span().End.Column, ShouldEqual, 15)
+		})
+
+		Convey("It skips body of a statement that failed", func() {
+			file, diags := ParseString("fn f() { if a + { var x = 1; return x; } c(); }")
+			So(len(diags), ShouldEqual, 1)
+
+			stmts := file.Decls[0].(*ast.FuncDecl).Body.Stmts
+			So(len(stmts), ShouldEqual, 2)
+			So(stmts[0], ShouldHaveSameTypeAs, &ast.BadStmt{})
+			So(stmts[1], ShouldHaveSameTypeAs, &ast.ExprStmt{})
+		})
+
+		Convey("It synchronizes on statement keywords", func() {
+			file, diags := ParseString("fn f() { a b c if d { } }")
+			So(len(diags), ShouldEqual, 1)
+
+			stmts := file.Decls[0].(*ast.FuncDecl).Body.Stmts
+			So(len(stmts), ShouldEqual, 2)
+			So(stmts[1], ShouldHaveSameTypeAs, &ast.IfStmt{})
+		})
+
+		Convey("It skips body of a declaration that failed", func() {
+			file, diags := ParseString("fn f( { var a = 1; return a; } fn g() {}")
+			So(len(diags), ShouldEqual, 1)
+			So(len(file.Decls), ShouldEqual, 2)
+			So(file.Decls[0], ShouldHaveSameTypeAs, &ast.BadDecl{})
+			So(file.Decls[1].(*ast.FuncDecl).Name.Name, ShouldEqual, "g")
+		})
+
+		Convey("It skips the rest of a block the failed part opened", func() {
+			file, diags := ParseString("struct P { x: 5, y: u8 } fn g() {}")
+			So(diags.Error(), ShouldEqual, `1:15: expected type, found "5"`)
+			So(len(file.Decls), ShouldEqual, 2)
+			So(file.Decls[0], ShouldHaveSameTypeAs, &ast.BadDecl{})
+			So(file.Decls[1].(*ast.FuncDecl).Name.Name, ShouldEqual, "g")
+		})
+
+		Convey("It makes progress on stray tokens", func() {
+			file, diags := ParseString("} ) var a = 1;")
+			So(len(diags), ShouldEqual, 1)
+			So(file.Decls[1].(*ast.VarDecl).Name.Name, ShouldEqual, "a")
+		})
+
+		Convey("It reports lexer errors as diagnostics", func() {
+			file, diags := ParseString("var a = 1 $ 2;")
+			So(file, ShouldBeNil)
+			So(diags.Error(), ShouldEqual, "1:11: unmatched char: $")
+			So(diags[0].Span.End.Column, ShouldEqual, 12)
+		})
+	})
+}
@@ -0,0 +1,229 @@
+package preprocessor
+
+import (
+	"strconv"
+
+	"github.com/sent-hil/bitlang/token"
+)
+
+// evaluator evaluates the condition of #if and #elif directives. Conditions
+// can use integers, true, false, defined names, defined(NAME), comparisons,
+// !, and, or and parens. Like in C, names that aren't defined are 0.
+type evaluator struct {
+	p      *Preprocessor
+	tokens []*token.Token
+	index  int
+
+	// expanding is names currently being evaluated, to stop a define that
+	// refers to itself from recursing forever.
+	expanding map[string]bool
+}
+
+// evaluate returns value of the condition; any value other than 0 is true.
+func (e *evaluator) evaluate() int64 {
+	value, ok := e.or()
+	if !ok {
+		return 0
+	}
+
+	if t := e.peek(); t != nil {
+		e.p.diags.Add(t.Span, "unexpected %s in condition", t.Value)
+		return 0
+	}
+
+	return value
+}
+
+func (e *evaluator) or() (int64, bool) {
+	left, ok := e.and()
+	for ok && e.match(token.OR) {
+		var right int64
+		right, ok = e.and()
+		left = boolInt(left != 0 || right != 0)
+	}
+
+	return left, ok
+}
+
+func (e *evaluator) and() (int64, bool) {
+	left, ok := e.comparison()
+	for ok && e.match(token.AND) {
+		var right int64
+		right, ok = e.comparison()
+		left = boolInt(left != 0 && right != 0)
+	}
+
+	return left, ok
+}
+
+func (e *evaluator) comparison() (int64, bool) {
+	left, ok := e.unary()
+	for ok {
+		t := e.peek()
+		if t == nil {
+			break
+		}
+
+		var compare func(a, b int64) bool
+		switch t.ID {
+		case token.EQUAL_EQUAL:
+			compare = func(a, b int64) bool { return a == b }
+		case token.BANG_EQUAL:
+			compare = func(a, b int64) bool { return a != b }
+		case token.LESS:
+			compare = func(a, b int64) bool { return a < b }
+		case token.LESS_EQUAL:
+			compare = func(a, b int64) bool { return a <= b }
+		case token.GREATER:
+			compare = func(a, b int64) bool { return a > b }
+		case token.GREATER_EQUAL:
+			compare = func(a, b int64) bool { return a >= b }
+		default:
+			return left, ok
+		}
+		e.index++
+
+		var right int64
+		right, ok = e.unary()
+		left = boolInt(compare(left, right))
+	}
+
+	return left, ok
+}
+
+func (e *evaluator) unary() (int64, bool) {
+	switch {
+	case e.match(token.BANG):
+		value, ok := e.unary()
+		return boolInt(value == 0), ok
+	case e.match(token.MINUS):
+		value, ok := e.unary()
+		return -value, ok
+	}
+
+	return e.primary()
+}
+
+func (e *evaluator) primary() (int64, bool) {
+	t := e.next()
+	if t == nil {
+		last := e.tokens[len(e.tokens)-1]
+		e.p.diags.Add(last.Span, "expected value after %s", last.Value)
+		return 0, false
+	}
+
+	switch t.ID {
+	case token.TRUE:
+		return 1, true
+	case token.FALSE:
+		return 0, true
+	case token.INTEGER:
+		value, err := strconv.ParseInt(t.Value, 0, 64)
+		if err != nil {
+			e.p.diags.Add(t.Span, "invalid integer %s in condition", t.Value)
+			return 0, false
+		}
+		return value, true
+	case token.LEFT_PAREN:
+		value, ok := e.or()
+		if ok && !e.match(token.RIGHT_PAREN) {
+			e.p.diags.Add(t.Span, "unclosed ( in condition")
+			return 0, false
+		}
+		return value, ok
+	case token.IDENTIFIER:
+		if t.Value == "defined" {
+			return e.defined(t)
+		}
+		return e.name(t)
+	}
+
+	e.p.diags.Add(t.Span, "unexpected %s in condition", t.Value)
+	return 0, false
+}
+
+// defined evaluates defined(NAME) or defined NAME.
+func (e *evaluator) defined(t *token.Token) (int64, bool) {
+	paren := e.match(token.LEFT_PAREN)
+
+	name := e.next()
+	if name == nil || name.ID != token.IDENTIFIER {
+		e.p.diags.Add(t.Span, "expected name after defined")
+		return 0, false
+	}
+
+	if paren && !e.match(token.RIGHT_PAREN) {
+		e.p.diags.Add(t.Span, "unclosed ( after defined")
+		return 0, false
+	}
+
+	_, ok := e.p.defines[name.Value]
+	return boolInt(ok), true
+}
+
+// name evaluates the value of a defined name.
+func (e *evaluator) name(t *token.Token) (int64, bool) {
+	d, ok := e.p.defines[t.Value]
+	if !ok {
+		return 0, true
+	}
+
+	if e.expanding[t.Value] {
+		e.p.diags.Add(t.Span, "%s is defined in terms of itself", t.Value)
+		return 0, false
+	}
+
+	e.expanding[t.Value] = true
+	defer delete(e.expanding, t.Value)
+
+	sub := &evaluator{p: e.p, tokens: d.tokens, expanding: e.expanding}
+	value, ok := sub.or()
+	if ok && sub.peek() != nil {
+		e.p.diags.Add(t.Span, "%s is not a constant expression", t.Value)
+		return 0, false
+	}
+
+	return value, ok
+}
+
+func (e *evaluator) peek() *token.Token {
+	if e.index >= len(e.tokens) {
+		return nil
+	}
+
+	return e.tokens[e.index]
+}
+
+func (e *evaluator) next() *token.Token {
+	t := e.peek()
+	if t != nil {
+		e.index++
+	}
+
+	return t
+}
+
+func (e *evaluator) match(id token.TokenID) bool {
+	if t := e.peek(); t != nil && t.ID == id {
+		e.index++
+		return true
+	}
+
+	return false
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func intToken(value int64, span token.Span) *token.Token {
+	return &token.Token{
+		ID:    token.INTEGER,
+		Value: strconv.FormatInt(value, 10),
+		Span:  span,
+	}
+}
@@ -0,0 +1,265 @@
+package preprocessor
+
+import (
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Config is the build configuration directives are evaluated against.
+type Config struct {
+	// Defines are build constants, eg {"BOARD_NANO": 1, "LED_PIN": 13}. They
+	// can be used in conditions and are substituted in source the same as ones
+	// declared with #define.
+	Defines map[string]int64
+}
+
+// Preprocessor is a filter that sits between AnyLexer and the parser. It
+// evaluates #if, #elif, #else and #endif directives against the build
+// configuration, dropping tokens in branches that aren't taken, and replaces
+// names declared with #define by their values.
+//
+// Directives need to be first on their line and end at the end of the line.
+type Preprocessor struct {
+	config  Config
+	defines map[string]*define
+	conds   []*cond
+	diags   diag.List
+}
+
+type define struct {
+	tokens []*token.Token
+
+	// span of #define directive; invalid if it's from Config.
+	span token.Span
+}
+
+// cond is an open #if directive.
+type cond struct {
+	span token.Span
+
+	// parentActive is if tokens around the #if are kept.
+	parentActive bool
+
+	// active is if current branch is kept, taken is if any branch was.
+	active bool
+	taken  bool
+
+	sawElse bool
+}
+
+// NewPreprocessor is the required initializer for Preprocessor.
+func NewPreprocessor(config Config) *Preprocessor {
+	return &Preprocessor{config: config}
+}
+
+// Process filters given tokens, returning the ones that should be parsed. It
+// reports malformed and unbalanced directives as diagnostics. Each call
+// starts over with only the defines of the build configuration, so files
+// processed one after the other don't see each other's.
+func (p *Preprocessor) Process(tokens []*token.Token) ([]*token.Token, diag.List) {
+	p.defines = map[string]*define{}
+	for name, value := range p.config.Defines {
+		p.defines[name] = &define{tokens: []*token.Token{intToken(value, token.Span{})}}
+	}
+	p.conds = nil
+	p.diags = nil
+
+	var out []*token.Token
+
+	atLineStart := true
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		if t.ID == token.HASH && atLineStart {
+			line := directiveLine(tokens, i+1)
+			p.directive(t, line)
+			i += len(line)
+			continue
+		}
+
+		switch {
+		case t.ID == token.WHITESPACE && t.Value == "\n":
+			atLineStart = true
+		case t.ID != token.WHITESPACE && t.ID != token.COMMENT:
+			atLineStart = false
+		}
+
+		if !p.active() {
+			continue
+		}
+
+		if t.ID == token.IDENTIFIER {
+			out = append(out, p.expand(t, t.Span, map[string]bool{})...)
+			continue
+		}
+
+		out = append(out, t)
+	}
+
+	for _, c := range p.conds {
+		p.diags.Add(c.span, "unterminated #if")
+	}
+	p.conds = nil
+
+	return out, p.diags
+}
+
+// directiveLine returns tokens from given index till end of line.
+func directiveLine(tokens []*token.Token, from int) []*token.Token {
+	to := from
+	for to < len(tokens) && !(tokens[to].ID == token.WHITESPACE && tokens[to].Value == "\n") {
+		to++
+	}
+
+	return tokens[from:to]
+}
+
+func (p *Preprocessor) active() bool {
+	if len(p.conds) == 0 {
+		return true
+	}
+
+	return p.conds[len(p.conds)-1].active
+}
+
+func (p *Preprocessor) directive(hash *token.Token, line []*token.Token) {
+	args := significant(line)
+	span := hash.Span
+	if len(args) > 0 {
+		span = hash.Span.To(args[len(args)-1].Span)
+	}
+
+	if len(args) == 0 {
+		p.diags.Add(span, "expected directive after #")
+		return
+	}
+
+	name, args := args[0], args[1:]
+	switch name.Value {
+	case "if":
+		c := &cond{span: span, parentActive: p.active()}
+		if c.parentActive {
+			c.active = p.condition(name, args)
+			c.taken = c.active
+		}
+		p.conds = append(p.conds, c)
+	case "elif":
+		c := p.top(span, "#elif")
+		if c == nil {
+			return
+		}
+		if c.sawElse {
+			p.diags.Add(span, "#elif after #else")
+		}
+		c.active = false
+		if c.parentActive && !c.taken {
+			c.active = p.condition(name, args)
+			c.taken = c.active
+		}
+	case "else":
+		c := p.top(span, "#else")
+		if c == nil {
+			return
+		}
+		if c.sawElse {
+			p.diags.Add(span, "#else after #else")
+		}
+		c.sawElse = true
+		c.active = c.parentActive && !c.taken
+		c.taken = true
+		p.noArgs(name, args)
+	case "endif":
+		if p.top(span, "#endif") == nil {
+			return
+		}
+		p.conds = p.conds[:len(p.conds)-1]
+		p.noArgs(name, args)
+	case "define":
+		if p.active() {
+			p.define(span, name, args)
+		}
+	default:
+		p.diags.Add(name.Span, "unknown directive #%s", name.Value)
+	}
+}
+
+// top returns the innermost open #if, reporting if there isn't one.
+func (p *Preprocessor) top(span token.Span, directive string) *cond {
+	if len(p.conds) == 0 {
+		p.diags.Add(span, "%s without #if", directive)
+		return nil
+	}
+
+	return p.conds[len(p.conds)-1]
+}
+
+func (p *Preprocessor) noArgs(name *token.Token, args []*token.Token) {
+	if len(args) > 0 {
+		p.diags.Add(args[0].Span, "unexpected %s after #%s", args[0].Value, name.Value)
+	}
+}
+
+func (p *Preprocessor) condition(name *token.Token, args []*token.Token) bool {
+	if len(args) == 0 {
+		p.diags.Add(name.Span, "expected condition after #%s", name.Value)
+		return false
+	}
+
+	e := &evaluator{p: p, tokens: args, expanding: map[string]bool{}}
+	return e.evaluate() != 0
+}
+
+func (p *Preprocessor) define(span token.Span, name *token.Token, args []*token.Token) {
+	if len(args) == 0 || args[0].ID != token.IDENTIFIER {
+		p.diags.Add(span, "expected name after #define")
+		return
+	}
+
+	ident, value := args[0], args[1:]
+	if existing, ok := p.defines[ident.Value]; ok {
+		if existing.span.IsValid() {
+			p.diags.Add(ident.Span, "%s already defined at %s", ident.Value, existing.span)
+		} else {
+			p.diags.Add(ident.Span, "%s already defined by build configuration", ident.Value)
+		}
+		return
+	}
+
+	// a define without a value is a flag
+	if len(value) == 0 {
+		value = []*token.Token{intToken(1, ident.Span)}
+	}
+
+	p.defines[ident.Value] = &define{tokens: value, span: span}
+}
+
+// expand returns tokens given identifier is defined as, or the identifier
+// itself if it isn't defined. Returned tokens are given span of where they're
+// used.
+func (p *Preprocessor) expand(t *token.Token, span token.Span, expanding map[string]bool) []*token.Token {
+	d, ok := p.defines[t.Value]
+	if t.ID != token.IDENTIFIER || !ok || expanding[t.Value] {
+		return []*token.Token{{ID: t.ID, Value: t.Value, Span: span}}
+	}
+
+	expanding[t.Value] = true
+	defer delete(expanding, t.Value)
+
+	var out []*token.Token
+	for _, dt := range d.tokens {
+		out = append(out, p.expand(dt, span, expanding)...)
+	}
+
+	return out
+}
+
+// significant returns given tokens without whitespace and comments.
+func significant(tokens []*token.Token) (out []*token.Token) {
+	for _, t := range tokens {
+		if t.ID != token.WHITESPACE && t.ID != token.COMMENT {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
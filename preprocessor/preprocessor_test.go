@@ -0,0 +1,206 @@
+package preprocessor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/lexer"
+	"github.com/sent-hil/bitlang/runeio"
+	"github.com/sent-hil/bitlang/token"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// lex returns tokens of given source.
+func lex(src string) []*token.Token {
+	tokens, err := lexer.NewAnyLexer(runeio.NewReader(strings.NewReader(src))).LexAll()
+	So(err, ShouldBeNil)
+	return tokens
+}
+
+// values returns values of given tokens other than whitespace and comments.
+func values(tokens []*token.Token) []string {
+	var values []string
+	for _, t := range tokens {
+		if t.ID != token.WHITESPACE && t.ID != token.COMMENT && t.ID != token.EOF {
+			values = append(values, t.Value)
+		}
+	}
+	return values
+}
+
+// process lexes and preprocesses given source, returning values of tokens
+// other than whitespace and comments.
+func process(config Config, src string) ([]string, diag.List) {
+	out, diags := NewPreprocessor(config).Process(lex(src))
+	return values(out), diags
+}
+
+func TestPreprocessor(t *testing.T) {
+	Convey("Preprocessor", t, func() {
+		uno := Config{Defines: map[string]int64{"BOARD_UNO": 1}}
+		nano := Config{Defines: map[string]int64{"BOARD_NANO": 1}}
+
+		Convey("It keeps tokens outside directives", func() {
+			values, diags := process(Config{}, "var a = 1;")
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"var", "a", "=", "1", ";"})
+		})
+
+		Convey("It keeps #if branch when condition is true", func() {
+			src := "#if BOARD_UNO\nvar a = 1;\n#endif\nvar b = 2;"
+			values, diags := process(uno, src)
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"var", "a", "=", "1", ";", "var", "b", "=", "2", ";"})
+		})
+
+		Convey("It drops #if branch when condition is false", func() {
+			src := "#if BOARD_UNO\nvar a = 1;\n#endif\nvar b = 2;"
+			values, diags := process(nano, src)
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"var", "b", "=", "2", ";"})
+		})
+
+		Convey("It takes first true branch of #elif chain", func() {
+			src := "#if BOARD_UNO\nuno\n#elif BOARD_NANO\nnano\n#else\nother\n#endif"
+
+			values, _ := process(uno, src)
+			So(values, ShouldResemble, []string{"uno"})
+
+			values, _ = process(nano, src)
+			So(values, ShouldResemble, []string{"nano"})
+
+			values, diags := process(Config{}, src)
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"other"})
+		})
+
+		Convey("It evaluates nested directives", func() {
+			src := "#if BOARD_UNO\n#if 0\na\n#else\nb\n#endif\n#else\n#if 1\nc\n#endif\n#endif"
+
+			values, diags := process(uno, src)
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"b"})
+
+			values, _ = process(nano, src)
+			So(values, ShouldResemble, []string{"c"})
+		})
+
+		Convey("It evaluates conditions", func() {
+			config := Config{Defines: map[string]int64{"PINS": 20}}
+			conds := map[string]bool{
+				"PINS == 20":                  true,
+				"PINS > 20":                   false,
+				"PINS >= 20 and PINS <= 20":   true,
+				"!(PINS < 14) or false":       true,
+				"defined(PINS)":               true,
+				"defined MISSING":             false,
+				"MISSING == 0":                true,
+				"!defined(PINS) or PINS != 1": true,
+			}
+
+			for cond, expected := range conds {
+				values, diags := process(config, "#if "+cond+"\nyes\n#endif")
+				So(diags, ShouldBeEmpty)
+				So(len(values) == 1, ShouldEqual, expected)
+			}
+		})
+
+		Convey("It replaces defines with their values", func() {
+			src := "#define LED_PIN 13\nwrite(LED_PIN);"
+			values, diags := process(Config{}, src)
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"write", "(", "13", ")", ";"})
+		})
+
+		Convey("It replaces defines from config", func() {
+			values, _ := process(uno, "var a = BOARD_UNO;")
+			So(values, ShouldResemble, []string{"var", "a", "=", "1", ";"})
+		})
+
+		Convey("It uses defines in later conditions", func() {
+			src := "#if BOARD_NANO\n#define LED_PIN 12\n#else\n#define LED_PIN 13\n#endif\n#if LED_PIN == 12\nnano\n#endif"
+			values, diags := process(nano, src)
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"nano"})
+		})
+
+		Convey("It gives replaced tokens span of where they're used", func() {
+			tokens, _ := lexer.NewAnyLexer(runeio.NewReader(
+				strings.NewReader("#define PIN 13\nPIN"),
+			)).LexAll()
+
+			out, _ := NewPreprocessor(Config{}).Process(tokens)
+			So(out[1].Value, ShouldEqual, "13")
+			So(out[1].Span.Start.Line, ShouldEqual, 2)
+		})
+
+		Convey("It ignores # that isn't first on its line", func() {
+			values, diags := process(Config{}, "a #if")
+			So(diags, ShouldBeEmpty)
+			So(values, ShouldResemble, []string{"a", "#", "if"})
+		})
+
+		Convey("It reports unterminated #if with its span", func() {
+			_, diags := process(uno, "a\n#if BOARD_UNO\nb")
+			So(len(diags), ShouldEqual, 1)
+			So(diags[0].Message, ShouldEqual, "unterminated #if")
+			So(diags[0].Span.Start.Line, ShouldEqual, 2)
+		})
+
+		Convey("It reports unbalanced directives", func() {
+			for src, message := range map[string]string{
+				"#endif":                        "#endif without #if",
+				"#else":                         "#else without #if",
+				"#elif 1":                       "#elif without #if",
+				"#if 1\n#else\n#elif 1\n#endif": "#elif after #else",
+				"#if 1\n#else\n#else\n#endif":   "#else after #else",
+			} {
+				_, diags := process(Config{}, src)
+				So(len(diags), ShouldEqual, 1)
+				So(diags[0].Message, ShouldEqual, message)
+			}
+		})
+
+		Convey("It reports malformed directives", func() {
+			for src, message := range map[string]string{
+				"#if\n#endif":                "expected condition after #if",
+				"#if (1\n#endif":             "unclosed ( in condition",
+				"#if 1 2\n#endif":            "unexpected 2 in condition",
+				"#include":                   "unknown directive #include",
+				"#define":                    "expected name after #define",
+				"#define A 1\n#define A 2":   "A already defined at 1:1",
+				"#define A A\n#if A\n#endif": "A is defined in terms of itself",
+			} {
+				_, diags := process(Config{}, src)
+				So(len(diags), ShouldEqual, 1)
+				So(diags[0].Message, ShouldEqual, message)
+			}
+		})
+
+		Convey("It only reports diagnostics of the tokens it's processing", func() {
+			p := NewPreprocessor(Config{})
+			_, diags := p.Process(lex("#endif"))
+			So(len(diags), ShouldEqual, 1)
+
+			_, diags = p.Process(lex("var a = 1;"))
+			So(diags, ShouldBeEmpty)
+		})
+
+		Convey("It starts each file over with the defines of the build configuration", func() {
+			p := NewPreprocessor(uno)
+			out, diags := p.Process(lex("#define LED_PIN 13\n#if 1\nLED_PIN"))
+			So(len(diags), ShouldEqual, 1)
+			So(values(out), ShouldResemble, []string{"13"})
+
+			out, diags = p.Process(lex("#define LED_PIN 12\nLED_PIN BOARD_UNO"))
+			So(diags, ShouldBeEmpty)
+			So(values(out), ShouldResemble, []string{"12", "1"})
+		})
+
+		Convey("It doesn't evaluate conditions in dropped branches", func() {
+			_, diags := process(Config{}, "#if 0\n#if (\n#endif\n#endif")
+			So(diags, ShouldBeEmpty)
+		})
+	})
+}
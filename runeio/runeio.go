@@ -22,11 +22,28 @@ type Reader struct {
 	// Runes is temporary buffer used to store runes that are peeked, but not
 	// yet read.
 	Runes []rune
+
+	// pos is the position of the next rune to be read.
+	pos Position
+}
+
+// Position is a location in the runes read by Reader. Line and Column start
+// at 1, Offset is the number of runes read before it.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
 }
 
 // NewReader is the required initializer for Reader.
 func NewReader(r RuneReader) *Reader {
-	return &Reader{r, []rune{}}
+	return &Reader{r, []rune{}, Position{Line: 1, Column: 1}}
+}
+
+// Position returns the position of the next rune to be read. Peek* methods
+// don't affect it.
+func (r *Reader) Position() Position {
+	return r.pos
 }
 
 // Discard skips the given n runes, returning number of runes discarded.
@@ -50,6 +67,10 @@ func (r *Reader) ReadRunes(n uint) (runes []rune, err error) {
 	runes = r.Runes[0:n]
 	r.Runes = r.Runes[n:]
 
+	for _, ru := range runes {
+		r.advance(ru)
+	}
+
 	return runes, err
 }
 
@@ -156,3 +177,14 @@ func (r *Reader) readFromReader(n uint) error {
 
 	return nil
 }
+
+// advance moves position past the given rune.
+func (r *Reader) advance(ru rune) {
+	r.pos.Offset++
+	if ru == '\n' {
+		r.pos.Line++
+		r.pos.Column = 1
+		return
+	}
+	r.pos.Column++
+}
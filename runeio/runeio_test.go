@@ -190,6 +190,28 @@ func TestRuneIo(t *testing.T) {
 			})
 		})
 
+		Convey("Position", func() {
+			Convey("It starts at first line and column", func() {
+				So(hw.Position(), ShouldResemble, Position{Offset: 0, Line: 1, Column: 1})
+			})
+
+			Convey("It does not move on peek", func() {
+				hw.PeekRunes(3)
+				So(hw.Position(), ShouldResemble, Position{Offset: 0, Line: 1, Column: 1})
+			})
+
+			Convey("It moves past read runes", func() {
+				hw.ReadRunes(3)
+				So(hw.Position(), ShouldResemble, Position{Offset: 3, Line: 1, Column: 4})
+			})
+
+			Convey("It moves to next line after newline", func() {
+				r := NewReader(bytes.NewBufferString("a\nbc"))
+				r.ReadRunes(3)
+				So(r.Position(), ShouldResemble, Position{Offset: 3, Line: 2, Column: 2})
+			})
+		})
+
 		Convey("Reset", func() {
 			Convey("It resets reader to given reader", func() {
 				nr := bytes.NewBufferString("New")
@@ -0,0 +1,141 @@
+package sema
+
+import (
+	"strconv"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// checkPanicHandler checks handler for failed runtime checks is declared
+// with the right signature.
+func (c *checker) checkPanicHandler(file *ast.File) {
+	if !c.config.BoundsCheck {
+		return
+	}
+
+	c.info.PanicHandler = c.config.PanicHandler
+	if c.info.PanicHandler == "" {
+		c.info.PanicHandler = DefaultPanicHandler
+		return
+	}
+
+	fn, ok := c.funcs[c.info.PanicHandler]
+	if !ok {
+		c.diags.Add(file.Loc, "panic handler %s is not declared", c.info.PanicHandler)
+		return
+	}
+
+	if len(fn.Params) > 0 || fn.Result != nil {
+		c.diags.Add(fn.Name.Loc, "panic handler %s must take no parameters and return nothing",
+			fn.Name.Name)
+	}
+}
+
+// arrayLen evaluates length of given array type, which is an integer
+// constant, eg a literal or a named constant.
+func (t *typer) arrayLen(typ *ast.ArrayType) (int64, bool) {
+	lt := t.value(typ.Len)
+	if isKind(lt, Invalid) {
+		return 0, false
+	}
+
+	n, ok := t.info.Values[typ.Len]
+	switch {
+	case !ok || !IsInteger(lt):
+		t.diags.Add(typ.Len.Span(), "array length must be a constant")
+		return 0, false
+	case n < 0:
+		t.diags.Add(typ.Len.Span(), "array length %d is negative", n)
+		return 0, false
+	}
+	return n, true
+}
+
+// arrayLit checks array literal lit used as a value of array type arr.
+func (t *typer) arrayLit(lit *ast.ArrayLit, arr *Array) {
+	if int64(len(lit.Elems)) != arr.Len {
+		t.diags.Add(lit.Loc, "array literal has %d elements, expected %d", len(lit.Elems), arr.Len)
+	}
+	for _, e := range lit.Elems {
+		t.assign(e, arr.Elem, "array literal")
+	}
+	t.info.Types[lit] = arr
+}
+
+func (t *typer) index(x *ast.IndexExpr) Type {
+	typ := t.value(x.X)
+	it := t.value(x.Index)
+	if !IsInteger(it) && !isKind(it, Invalid) {
+		t.diags.Add(x.Index.Span(), "index must be an integer, found %s (%s)",
+			ast.ExprString(x.Index), it)
+	}
+	if isKind(it, UntypedInt) {
+		t.defaultType(x.Index, it)
+	}
+
+	if isKind(typ, Invalid) {
+		return typ
+	}
+	arr, ok := typ.(*Array)
+	if !ok {
+		t.diags.Add(x.X.Span(), "cannot index %s (%s)", ast.ExprString(x.X), typ)
+		return Typ[Invalid]
+	}
+
+	// constant indexes are checked here, others at runtime if enabled
+	if i, ok := t.info.Values[x.Index]; ok && IsInteger(it) {
+		if i < 0 || i >= arr.Len {
+			t.diags.Add(x.Index.Span(), "index %d out of range for array of length %d", i, arr.Len)
+		}
+	} else if t.config.BoundsCheck {
+		t.info.BoundsChecks[x] = arr.Len
+	}
+	return arr.Elem
+}
+
+// len checks a call of builtin len, which evaluates to the length of its
+// array argument at compile time.
+func (t *typer) len(call *ast.CallExpr) Type {
+	for _, arg := range call.Args {
+		t.value(arg)
+	}
+	if len(call.Args) != 1 {
+		t.diags.Add(call.Loc, "len takes one argument")
+		return Typ[Invalid]
+	}
+
+	arg := call.Args[0]
+	switch typ := t.info.Types[arg].(type) {
+	case *Array:
+		t.info.Lens[call] = typ.Len
+		t.info.Values[call] = typ.Len
+		return Typ[UntypedInt]
+	case *Basic:
+		if typ.Kind == Invalid {
+			return typ
+		}
+	}
+
+	t.diags.Add(arg.Span(), "len of non-array %s", ast.ExprString(arg))
+	return Typ[Invalid]
+}
+
+// constInt returns value of given expression if it's an integer literal.
+func constInt(x ast.Expr) (int64, bool) {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return constInt(x.X)
+	case *ast.UnaryExpr:
+		if n, ok := constInt(x.X); ok && x.Op == token.MINUS {
+			return -n, true
+		}
+	case *ast.BasicLit:
+		if x.Kind == token.INTEGER {
+			n, err := strconv.ParseInt(x.Value, 0, 64)
+			return n, err == nil
+		}
+	}
+
+	return 0, false
+}
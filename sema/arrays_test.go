@@ -0,0 +1,165 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArrays(t *testing.T) {
+	Convey("Arrays", t, func() {
+		Convey("It accepts constant indexes in range", func() {
+			So(check(`
+var table: [4]u8 = [1, 2, 4, 8];
+fn f() -> u8 { return table[0] + table[3]; }
+`), ShouldBeEmpty)
+		})
+
+		Convey("It reports constant indexes out of range", func() {
+			diags := check(`
+var table: [4]u8;
+fn f() -> u8 { return table[4]; }
+`)
+			So(diags.Error(), ShouldEqual, "3:29: index 4 out of range for array of length 4")
+
+			diags = check("fn f() { var buf = [1, 2]; buf[-1] = 0; }")
+			So(diags.Error(), ShouldEqual, "1:32: index -1 out of range for array of length 2")
+		})
+
+		Convey("It uses innermost declaration of a name", func() {
+			diags := check(`
+var buf: [2]u8;
+fn f() { var buf: [8]u8; buf[7] = 1; }
+fn g(buf: [16]u8) { buf[7] = 1; }
+`)
+			So(diags.HasErrors(), ShouldBeFalse)
+		})
+
+		Convey("It reports array literals of wrong length", func() {
+			diags := check("var pins: [3]u8 = [2, 3];")
+			So(diags.Error(), ShouldEqual, "1:19: array literal has 2 elements, expected 3")
+		})
+
+		Convey("It evaluates array lengths of named constants", func() {
+			file, _ := parser.ParseString(`
+const N = 4;
+var g: [N]u8;
+struct S { data: [N * 2]u8 }
+fn f() -> u8 { const M: u8 = 3; var buf: [M]u8 = [1, 2, 3]; return len(g) + len(buf); }
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			So(info.Defs[file.Decls[1].(*ast.VarDecl).Name].Type.String(), ShouldEqual, "[4]u8")
+			So(info.Defs[file.Decls[2].(*ast.StructDecl).Name].Type.(*Struct).Fields[0].Type.String(),
+				ShouldEqual, "[8]u8")
+		})
+
+		Convey("It reports array lengths that aren't constant", func() {
+			diags := check("fn f(n: u8) { var buf: [n]u8; }")
+			So(diags.Error(), ShouldEqual, "1:25: array length must be a constant")
+
+			diags = check("const N = 2 - 3; var g: [N]u8; var h: [1.5]u8;")
+			So(diags.Error(), ShouldEqual, "1:26: array length -1 is negative\n1:40: array length must be a constant")
+		})
+
+		Convey("It evaluates len of arrays", func() {
+			file, _ := parser.ParseString("fn f(buf: [16]u8) -> u8 { return len(buf); }")
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			ret := file.Decls[0].(*ast.FuncDecl).Body.Stmts[0].(*ast.ReturnStmt)
+			So(info.Lens[ret.Value.(*ast.CallExpr)], ShouldEqual, 16)
+		})
+
+		Convey("It evaluates len of arrays that aren't variables", func() {
+			file, _ := parser.ParseString(`
+struct P { data: [6]u8 }
+var g: [3][5]u8;
+fn f(p: P) -> u8 { return len(p.data) + len(g[0]); }
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			var lens []int64
+			ast.Inspect(file, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					lens = append(lens, info.Lens[call])
+				}
+				return true
+			})
+			So(lens, ShouldResemble, []int64{6, 5})
+		})
+
+		Convey("It reports len of non-arrays", func() {
+			So(check("fn f(a: u8) -> u8 { return len(a); }").Error(), ShouldEqual,
+				"1:32: len of non-array a")
+			So(check("fn f(a: u8) -> u8 { return len(a, a); }").Error(), ShouldEqual,
+				"1:28: len takes one argument")
+			So(check("struct P { n: u8 } fn f(p: P) -> u8 { return len(p.n); }").Error(), ShouldEqual,
+				"1:50: len of non-array p.n")
+		})
+
+		Convey("Bounds checks", func() {
+			src := "var buf: [8]u8; fn f(i: u8) -> u8 { return buf[i] + buf[0]; }"
+
+			Convey("It doesn't check indexes at runtime by default", func() {
+				file, _ := parser.ParseString(src)
+				info, _ := Check(file, nil)
+				So(info.BoundsChecks, ShouldBeEmpty)
+			})
+
+			Convey("It checks indexes that aren't constant at runtime when enabled", func() {
+				file, _ := parser.ParseString(src)
+				info, diags := Check(file, &Config{BoundsCheck: true})
+				So(diags, ShouldBeEmpty)
+				So(len(info.BoundsChecks), ShouldEqual, 1)
+				So(info.PanicHandler, ShouldEqual, DefaultPanicHandler)
+
+				for x, length := range info.BoundsChecks {
+					So(x.Index.(*ast.Ident).Name, ShouldEqual, "i")
+					So(length, ShouldEqual, 8)
+				}
+			})
+
+			Convey("It checks indexes of fields and of elements", func() {
+				file, _ := parser.ParseString(`
+struct P { data: [4]u8 }
+var g: [2][3]u8;
+fn f(p: P, i: u8) -> u8 { return p.data[i] + g[i][i] + g[1][i]; }
+`)
+				info, diags := Check(file, &Config{BoundsCheck: true})
+				So(diags, ShouldBeEmpty)
+
+				var lengths []int64
+				ast.Inspect(file, func(n ast.Node) bool {
+					if x, ok := n.(*ast.IndexExpr); ok {
+						lengths = append(lengths, info.BoundsChecks[x])
+					}
+					return true
+				})
+				So(lengths, ShouldResemble, []int64{4, 3, 2, 3, 0})
+			})
+
+			Convey("It uses configured panic handler", func() {
+				file, _ := parser.ParseString(src + " fn trap() {}")
+				info, diags := Check(file, &Config{BoundsCheck: true, PanicHandler: "trap"})
+				So(diags, ShouldBeEmpty)
+				So(info.PanicHandler, ShouldEqual, "trap")
+			})
+
+			Convey("It reports panic handlers that aren't declared", func() {
+				file, _ := parser.ParseString(src)
+				_, diags := Check(file, &Config{BoundsCheck: true, PanicHandler: "trap"})
+				So(diags.Error(), ShouldEqual, "1:1: panic handler trap is not declared")
+			})
+
+			Convey("It reports panic handlers with wrong signature", func() {
+				file, _ := parser.ParseString(src + " fn trap(code: u8) {}")
+				_, diags := Check(file, &Config{BoundsCheck: true, PanicHandler: "trap"})
+				So(diags.Error(), ShouldEqual, "1:66: panic handler trap must take no parameters and return nothing")
+			})
+		})
+	})
+}
@@ -0,0 +1,413 @@
+package sema
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/cfg"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// assigns follows values of local variables and parameters along every path
+// through the control-flow graph of a function, see Info.CFGs. Locals
+// declared without a value hold whatever the last call left on the stack,
+// so using one before it's assigned on every path to the use is an error.
+// With Config.Unused it also finds locals and parameters that are never
+// used, and stores whose value is never read.
+//
+// Writing an element or field of a local counts as assigning all of it.
+type assigns struct {
+	*checker
+
+	g *cfg.Graph
+
+	// locals are locals and parameters of the function, with if they're
+	// used anywhere.
+	locals map[*Object]bool
+
+	// stores are values given to locals, in the order they're given, keyed
+	// by where they're given.
+	stores []*store
+	sites  map[ast.Node]*store
+
+	// entry is the state at the start of the body, and outs states at the
+	// ends of blocks gone over so far.
+	entry *flowState
+	outs  map[*cfg.Block]*flowState
+
+	state *flowState
+
+	// report is if uses are reported and stores they read marked, which is
+	// only done once states stop changing; errs are the uses reported.
+	report bool
+	errs   diag.List
+}
+
+// store is a value given to a local by its declaration or an assignment.
+type store struct {
+	obj  *Object
+	at   token.Span
+	read bool
+}
+
+// flowState is what's known at a point of a function: locals assigned on
+// every path to it, and stores that reach it on some path.
+type flowState struct {
+	assigned map[*Object]bool
+	stores   map[*Object][]*store
+
+	// dead is if no path reaches the point, eg after a return.
+	dead bool
+}
+
+func (c *checker) checkAssigns(fn *ast.FuncDecl) {
+	a := &assigns{
+		checker: c,
+		g:       c.info.CFGs[fn],
+		locals:  map[*Object]bool{},
+		sites:   map[ast.Node]*store{},
+		entry:   newFlowState(),
+		outs:    map[*cfg.Block]*flowState{},
+	}
+
+	for _, param := range fn.Params {
+		if obj := a.info.Defs[param.Name]; obj != nil {
+			a.locals[obj] = false
+			a.entry.assigned[obj] = true
+		}
+	}
+	for _, block := range a.g.Blocks {
+		for _, node := range block.Nodes {
+			if decl, ok := node.(*ast.VarDecl); ok {
+				if obj := a.info.Defs[decl.Name]; obj != nil {
+					a.locals[obj] = false
+				}
+			}
+		}
+	}
+
+	// go over live blocks till states at their ends stop changing, which
+	// they do since locals only get unassigned and stores only get added
+	for changed := true; changed; {
+		changed = false
+		for _, block := range a.g.Blocks {
+			if !block.Live {
+				continue
+			}
+			out := a.block(block, a.in(block))
+			if prev := a.outs[block]; prev == nil || !same(prev, out) {
+				a.outs[block] = out
+				changed = true
+			}
+		}
+	}
+
+	// then once more to report uses; uses in dead blocks still count as
+	// uses of locals
+	a.report = true
+	for _, block := range a.g.Blocks {
+		in := deadState()
+		if block.Live {
+			in = a.in(block)
+		}
+		a.block(block, in)
+	}
+
+	sort.SliceStable(a.errs, func(i, j int) bool {
+		return a.errs[i].Span.Start.Offset < a.errs[j].Span.Start.Offset
+	})
+	a.diags = append(a.diags, a.errs...)
+
+	if a.config.Unused {
+		a.reportUnused()
+	}
+}
+
+func newFlowState() *flowState {
+	return &flowState{assigned: map[*Object]bool{}, stores: map[*Object][]*store{}}
+}
+
+// deadState returns state of a point no path reaches.
+func deadState() *flowState {
+	s := newFlowState()
+	s.dead = true
+	return s
+}
+
+func (s *flowState) copy() *flowState {
+	c := newFlowState()
+	c.dead = s.dead
+	for obj := range s.assigned {
+		c.assigned[obj] = true
+	}
+	for obj, stores := range s.stores {
+		c.stores[obj] = stores
+	}
+
+	return c
+}
+
+// meet returns state at a point where paths with given states join: locals
+// assigned on all of them are assigned, and stores of any of them reach it.
+func meet(states ...*flowState) *flowState {
+	var live []*flowState
+	for _, s := range states {
+		if !s.dead {
+			live = append(live, s)
+		}
+	}
+	if len(live) == 0 {
+		return deadState()
+	}
+
+	m := live[0].copy()
+	for _, s := range live[1:] {
+		for obj := range m.assigned {
+			if !s.assigned[obj] {
+				delete(m.assigned, obj)
+			}
+		}
+		for obj, stores := range s.stores {
+			m.stores[obj] = union(m.stores[obj], stores)
+		}
+	}
+
+	return m
+}
+
+func union(a, b []*store) []*store {
+	for _, st := range b {
+		if !hasStore(a, st) {
+			a = append(a[:len(a):len(a)], st)
+		}
+	}
+
+	return a
+}
+
+func hasStore(stores []*store, st *store) bool {
+	for _, s := range stores {
+		if s == st {
+			return true
+		}
+	}
+	return false
+}
+
+// same returns if states a and b know the same.
+func same(a, b *flowState) bool {
+	if a.dead != b.dead || len(a.assigned) != len(b.assigned) || len(a.stores) != len(b.stores) {
+		return false
+	}
+	for obj := range a.assigned {
+		if !b.assigned[obj] {
+			return false
+		}
+	}
+	for obj, stores := range a.stores {
+		if len(stores) != len(b.stores[obj]) {
+			return false
+		}
+		for _, st := range stores {
+			if !hasStore(b.stores[obj], st) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// in returns state at the start of given live block: the entry state for
+// the entry block, and the meet of states at the ends of its predecessors
+// otherwise. Predecessors not gone over yet don't count.
+func (a *assigns) in(block *cfg.Block) *flowState {
+	if block == a.g.Entry {
+		return a.entry.copy()
+	}
+
+	var states []*flowState
+	for _, pred := range block.Preds {
+		if out := a.outs[pred]; out != nil {
+			states = append(states, out)
+		}
+	}
+	return meet(states...)
+}
+
+// block follows nodes of given block from state in, returning state at the
+// end of it.
+func (a *assigns) block(block *cfg.Block, in *flowState) *flowState {
+	a.state = in
+	for _, node := range block.Nodes {
+		switch node := node.(type) {
+		case *ast.VarDecl:
+			a.expr(node.Value)
+			obj := a.info.Defs[node.Name]
+			if obj == nil {
+				continue
+			}
+
+			// a declaration in a loop is a new variable every time round
+			delete(a.state.assigned, obj)
+			delete(a.state.stores, obj)
+			if node.Value != nil {
+				a.assign(obj, node.Value)
+			}
+		case *ast.AssignStmt:
+			a.expr(node.Value)
+			a.target(node.Target)
+		case *ast.ExprStmt:
+			a.expr(node.X)
+		case *ast.ReturnStmt:
+			a.expr(node.Value)
+		case ast.Expr:
+			// condition or tag
+			a.expr(node)
+		}
+	}
+
+	return a.state
+}
+
+// assign records a store to obj at given node.
+func (a *assigns) assign(obj *Object, at ast.Node) {
+	if a.state.dead {
+		return
+	}
+
+	st := a.sites[at]
+	if st == nil {
+		st = &store{obj: obj, at: at.Span()}
+		a.sites[at] = st
+		a.stores = append(a.stores, st)
+	}
+	a.state.assigned[obj] = true
+	a.state.stores[obj] = []*store{st}
+}
+
+// target follows target of an assignment. Assigning a whole local replaces
+// its value; assigning part of it only reads names in indexes.
+func (a *assigns) target(x ast.Expr) {
+	if id, ok := x.(*ast.Ident); ok {
+		if obj := a.info.Uses[id]; a.isLocal(obj) {
+			a.assign(obj, id)
+		}
+		return
+	}
+
+	for {
+		switch t := x.(type) {
+		case *ast.IndexExpr:
+			a.expr(t.Index)
+			x = t.X
+		case *ast.SelectorExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.Ident:
+			if obj := a.info.Uses[t]; a.isLocal(obj) {
+				a.locals[obj] = true
+				if !a.state.dead {
+					a.state.assigned[obj] = true
+				}
+			}
+			return
+		default:
+			a.expr(x)
+			return
+		}
+	}
+}
+
+func (a *assigns) isLocal(obj *Object) bool {
+	_, ok := a.locals[obj]
+	return ok
+}
+
+// expr follows reads of locals in given expression, which can be nil.
+func (a *assigns) expr(x ast.Expr) {
+	if x == nil {
+		return
+	}
+
+	ast.Inspect(x, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		obj := a.info.Uses[id]
+		if !a.isLocal(obj) {
+			return true
+		}
+		a.locals[obj] = true
+		if a.state.dead || !a.report {
+			return true
+		}
+
+		for _, st := range a.state.stores[obj] {
+			st.read = true
+		}
+		if !a.state.assigned[obj] {
+			a.errs.Add(id.Loc, "%s is used before it's assigned", id.Name)
+		}
+		return true
+	})
+}
+
+// reportUnused warns about locals and parameters that are never used, and
+// stores to used ones that are never read, in source order. Names starting
+// with _ aren't reported.
+func (a *assigns) reportUnused() {
+	var warnings diag.List
+	for obj, used := range a.locals {
+		switch {
+		case used || strings.HasPrefix(obj.Name, "_"):
+		case obj.Kind == ParamObj:
+			warnings.Warn(obj.Ident.Loc, "parameter %s is not used", obj.Name)
+		default:
+			warnings.Warn(obj.Ident.Loc, "%s declared and not used", obj.Name)
+		}
+	}
+
+	for _, st := range a.stores {
+		if !st.read && a.locals[st.obj] && !strings.HasPrefix(st.obj.Name, "_") {
+			warnings.Warn(st.at, "value assigned to %s is never read", st.obj.Name)
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Span.Start.Offset < warnings[j].Span.Start.Offset
+	})
+	a.diags = append(a.diags, warnings...)
+}
+
+// checkImports warns about modules imported and not used, with
+// Config.Unused. Modules imported as _ aren't reported.
+func (c *checker) checkImports(file *ast.File) {
+	if !c.config.Unused {
+		return
+	}
+
+	used := map[*Object]bool{}
+	for _, obj := range c.info.Uses {
+		used[obj] = true
+	}
+
+	scope := c.info.Scopes[file]
+	for _, decl := range file.Decls {
+		imp, ok := decl.(*ast.ImportDecl)
+		if !ok || imp.Name != nil {
+			continue
+		}
+
+		obj := scope.Lookup(path.Base(imp.Path.Value))
+		if obj != nil && obj.Decl == imp && !used[obj] {
+			c.diags.Warn(imp.Path.Loc, "%q imported and not used", imp.Path.Value)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// checkUnused parses and checks given source with warnings about unused
+// names.
+func checkUnused(src string) diag.List {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	_, diags = Check(file, &Config{Unused: true})
+	return diags
+}
+
+func TestAssigns(t *testing.T) {
+	Convey("Assigns", t, func() {
+		Convey("It accepts locals assigned on every path before they're used", func() {
+			So(check(`
+fn f(c: bool, n: u8) -> u8 {
+  var a: u8;
+  if c { a = 1; } else { a = 2; }
+  var b: u8;
+  switch n { case 1 { b = 1; } default { b = 2; } }
+  var d: u8;
+  if n > 9 { return 0; } else { d = n; }
+  var e: u8;
+  loop { if n > 3 { e = n; break; } n = n + 1; }
+  var g: u8;
+  while true { g = 1; break; }
+  var buf: [4]u8;
+  buf[0] = 1;
+  return a + b + d + e + g + buf[0];
+}`), ShouldBeEmpty)
+		})
+
+		Convey("It accepts locals assigned in every case of exhaustive switches", func() {
+			So(check(`
+enum State { Idle, Running }
+fn f(s: State) -> u8 {
+  var x: u8;
+  switch s { case State.Idle { x = 1; } case State.Running { x = 2; } }
+  return x;
+}`), ShouldBeEmpty)
+		})
+
+		Convey("It agrees with flow checks on loops with constant true conditions", func() {
+			So(check(`
+const FOREVER = true;
+fn f(n: u8) -> u8 {
+  var x: u8;
+  while FOREVER { if n > 3 { x = n; break; } n = n + 1; }
+  return x;
+}
+fn g() -> u8 { while FOREVER { } }`), ShouldBeEmpty)
+		})
+
+		Convey("It reports locals used before they're assigned on some path", func() {
+			for src, message := range map[string]string{
+				"fn f(c: bool) -> u8 { var x: u8; if c { x = 1; } return x; }":                 "1:57: x is used before it's assigned",
+				"fn f(n: u8) -> u8 { var x: u8; while n > 0 { x = n; n = n - 1; } return x; }": "1:73: x is used before it's assigned",
+				"fn f(n: u8) -> u8 { var x: u8; switch n { case 1 { x = 1; } } return x; }":    "1:70: x is used before it's assigned",
+				"fn f() -> u8 { var x: u8; x = x + 1; return x; }":                             "1:31: x is used before it's assigned",
+				"fn f() -> u8 { var b: [4]u8; return b[1]; }":                                  "1:37: b is used before it's assigned",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It follows breaks and continues out of nested loops", func() {
+			So(check(`
+fn f(n: u8) -> u8 {
+  var x: u8;
+  outer: loop {
+    loop { if n > 0 { continue outer; } x = 1; break outer; }
+  }
+  return x;
+}`), ShouldBeEmpty)
+
+			So(check(`
+fn f(n: u8) -> u8 {
+  var x: u8;
+  outer: loop {
+    loop { if n > 0 { break outer; } x = 1; break; }
+  }
+  return x;
+}`).Error(), ShouldEqual, "7:10: x is used before it's assigned")
+		})
+
+		Convey("It reports uses in source order", func() {
+			So(check(`
+fn f(c: bool, d: bool) -> u8 {
+  var x: u8;
+  var y: u8;
+  if c {
+    if d { return x; }
+  }
+  return y;
+}`).Error(), ShouldEqual, "6:19: x is used before it's assigned\n8:10: y is used before it's assigned")
+		})
+
+		Convey("It warns about unused locals, parameters and imports", func() {
+			So(checkUnused(`import "drivers/lcd";
+import "spi";
+fn f(a: u8, b: u8) -> u8 {
+  var x = 1;
+  var y: u8 = 3;
+  y = 4;
+  spi.Send(b);
+  return b;
+}`).Error(), ShouldEqual, `1:8: warning: "drivers/lcd" imported and not used`+"\n"+
+				"3:6: warning: parameter a is not used\n"+
+				"4:7: warning: x declared and not used\n"+
+				"5:7: warning: y declared and not used")
+		})
+
+		Convey("It warns about values that are never read", func() {
+			So(checkUnused(`
+fn f(c: bool) -> u8 {
+  var x: u8 = 1;
+  x = 2;
+  var s: u8 = 0;
+  for var i: u8 = 0; i < 4; i = i + 1 { s = s + i; }
+  var t: u8 = 0;
+  if c { t = 1; }
+  return x + s + t;
+}`).Error(), ShouldEqual, "3:15: warning: value assigned to x is never read")
+		})
+
+		Convey("It doesn't warn about names starting with _ or imports named _", func() {
+			So(checkUnused(`import _ "drivers/uart";
+fn f(_a: u8) {
+  var _x: u8 = 1;
+  _x = 2;
+}`), ShouldBeEmpty)
+		})
+	})
+}
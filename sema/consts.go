@@ -0,0 +1,342 @@
+package sema
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// Constants are evaluated while types are checked. An expression is constant
+// if it's made of literals, constants, enum members and calls of pure
+// builtins like len, bit and conversions. Values of constants are in
+// Info.Values, with bools as 0 or 1, and Info.Floats for untyped floats and
+// f32. Typed constants must fit in their type.
+
+func (t *typer) constDecl(decl *ast.ConstDecl) {
+	obj := t.info.Defs[decl.Name]
+	if obj == nil || obj.Type != nil {
+		return
+	}
+
+	t.inits[obj] = true
+	defer delete(t.inits, obj)
+
+	// errors in value, like overflows, already say why it's not constant
+	errors := len(t.diags)
+
+	var typ Type
+	if decl.Type != nil {
+		typ = t.typeOf(decl.Type)
+		if _, ok := typ.(*Array); ok {
+			t.diags.Add(decl.Type.Span(), "invalid constant type %s", typ)
+			typ = Typ[Invalid]
+		}
+		t.assign(decl.Value, typ, "constant declaration")
+	} else {
+		typ = t.value(decl.Value)
+	}
+
+	if !isKind(typ, Invalid) && !t.isConst(decl.Value) {
+		if len(t.diags) > errors {
+			typ = Typ[Invalid]
+		} else {
+			t.diags.Add(decl.Value.Span(), "%s is not constant", ast.ExprString(decl.Value))
+			typ = Typ[Invalid]
+		}
+	}
+	obj.Type = typ
+}
+
+// constIdent records value of constant obj as value of id.
+func (t *typer) constIdent(id *ast.Ident, obj *Object) {
+	decl := obj.Decl.(*ast.ConstDecl)
+	if isUntyped(obj.Type) {
+		t.copyConstant(id, decl.Value)
+		return
+	}
+
+	// value can be of a narrower type, eg `const A: u16 = B`
+	t.info.Types[id] = obj.Type
+	t.convertConst(id, decl.Value, obj.Type)
+}
+
+func (t *typer) isConst(x ast.Expr) bool {
+	if _, ok := t.info.Values[x]; ok {
+		return true
+	}
+	_, ok := t.info.Floats[x]
+	return ok
+}
+
+// real returns value of numeric constant x as a number, eg 1.5 for a q8.8
+// stored as 384.
+func (t *typer) real(x ast.Expr) float64 {
+	if f, ok := t.info.Types[x].(*Fixed); ok {
+		return math.Ldexp(float64(t.info.Values[x]), -f.Frac)
+	}
+	return t.constant(x)
+}
+
+// convertConst records value of typed constant x converted to type to as
+// value of dst, reporting if it doesn't fit. Fixed-point values convert to
+// integers rounding towards minus infinity, like shifting right does.
+func (t *typer) convertConst(dst, x ast.Expr, to Type) bool {
+	if _, ok := to.(*Enum); ok {
+		to = Typ[U8]
+	}
+
+	switch to := to.(type) {
+	case *Fixed:
+		raw, ok := to.Raw(t.real(x))
+		if !ok {
+			t.diags.Add(x.Span(), "constant %s overflows %s", t.constString(x), to)
+			return false
+		}
+		t.info.Values[dst] = raw
+	case *Basic:
+		if to.Kind == F32 {
+			t.info.Floats[dst] = t.real(x)
+			return true
+		}
+
+		v := t.info.Values[x]
+		if _, ok := t.info.Types[x].(*Fixed); ok {
+			v = int64(math.Floor(t.real(x)))
+		} else if f, ok := t.info.Floats[x]; ok {
+			v = int64(f)
+		}
+		if IsInteger(to) && !Representable(v, to) {
+			t.diags.Add(x.Span(), "constant %s overflows %s", t.constString(x), to)
+			return false
+		}
+		t.info.Values[dst] = v
+	}
+
+	return true
+}
+
+// checkRange reports constant value v of x that doesn't fit in its integer
+// type, and records it otherwise.
+func (t *typer) checkRange(x ast.Expr, typ Type, v int64) {
+	if b, ok := typ.(*Basic); ok && IsInteger(b) && !Representable(v, b) {
+		t.diags.Add(x.Span(), "constant %d overflows %s", v, b)
+		return
+	}
+	t.info.Values[x] = v
+}
+
+// foldUnary records value of unary expression of a constant of type typ.
+func (t *typer) foldUnary(x *ast.UnaryExpr, typ Type) {
+	if !t.isConst(x.X) {
+		return
+	}
+
+	v := t.info.Values[x.X]
+	switch {
+	case x.Op == token.BANG:
+		t.info.Values[x] = 1 - v
+	case x.Op == token.TILDE:
+		if b, ok := typ.(*Basic); ok && b.Kind != UntypedInt && !b.Signed {
+			_, max := Range(b)
+			t.info.Values[x] = ^v & max
+		} else {
+			t.info.Values[x] = ^v
+		}
+	case isKind(typ, UntypedFloat) || isKind(typ, F32):
+		t.info.Floats[x] = -t.info.Floats[x.X]
+	default:
+		if f, ok := typ.(*Fixed); ok {
+			if _, ok := f.Raw(-t.real(x.X)); !ok {
+				t.diags.Add(x.Span(), "constant %s overflows %s",
+					strconv.FormatFloat(-t.real(x.X), 'g', -1, 64), f)
+				return
+			}
+		}
+		t.checkRange(x, typ, -v)
+	}
+}
+
+// foldLogical records value of and or or of bool constants.
+func (t *typer) foldLogical(x *ast.BinaryExpr) {
+	a, ok1 := t.info.Values[x.X]
+	b, ok2 := t.info.Values[x.Y]
+	if !ok1 || !ok2 {
+		return
+	}
+
+	if x.Op == token.AND {
+		t.info.Values[x] = a & b
+	} else {
+		t.info.Values[x] = a | b
+	}
+}
+
+// fold records value of binary expression of constants whose operands are
+// used as type typ, reporting values that don't fit in it. Division of
+// integers truncates, like at runtime.
+func (t *typer) fold(x *ast.BinaryExpr, typ Type) {
+	if !t.isConst(x.X) || !t.isConst(x.Y) {
+		return
+	}
+
+	_, fixed := typ.(*Fixed)
+	real := fixed || isKind(typ, UntypedFloat) || isKind(typ, F32)
+
+	if isComparison(x.Op) {
+		cmp := compareInts(t.info.Values[x.X], t.info.Values[x.Y])
+		if real {
+			cmp = compare(t.real(x.X), t.real(x.Y))
+		}
+		t.info.Values[x] = boolValue(holds(x.Op, cmp))
+		return
+	}
+
+	if real {
+		a, b := t.real(x.X), t.real(x.Y)
+
+		var v float64
+		switch x.Op {
+		case token.PLUS:
+			v = a + b
+		case token.MINUS:
+			v = a - b
+		case token.STAR:
+			v = a * b
+		case token.SLASH:
+			v = a / b
+		default:
+			return
+		}
+
+		if f, ok := typ.(*Fixed); ok {
+			raw, ok := f.Raw(v)
+			if !ok {
+				t.diags.Add(x.Span(), "constant %s overflows %s", strconv.FormatFloat(v, 'g', -1, 64), f)
+				return
+			}
+			t.info.Values[x] = raw
+			return
+		}
+		t.info.Floats[x] = v
+		return
+	}
+
+	a, b := t.info.Values[x.X], t.info.Values[x.Y]
+
+	var v int64
+	switch x.Op {
+	case token.PLUS:
+		v = a + b
+	case token.MINUS:
+		v = a - b
+	case token.STAR:
+		v = a * b
+	case token.SLASH:
+		v = a / b
+	case token.PERCENT:
+		v = a % b
+	case token.AMPERSAND:
+		v = a & b
+	case token.PIPE:
+		v = a | b
+	case token.CARET:
+		v = a ^ b
+	case token.LESS_LESS:
+		if b >= 63 {
+			t.diags.Add(x.Span(), "constant %s overflows %s", ast.ExprString(x), typ)
+			return
+		}
+		v = a << uint(b)
+	case token.GREATER_GREATER:
+		if b >= 63 {
+			b = 63
+		}
+		v = a >> uint(b)
+	default:
+		return
+	}
+	t.checkRange(x, typ, v)
+}
+
+func compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// holds returns if comparison op holds for operands that compare as cmp.
+func holds(op token.TokenID, cmp int) bool {
+	switch op {
+	case token.EQUAL_EQUAL:
+		return cmp == 0
+	case token.BANG_EQUAL:
+		return cmp != 0
+	case token.LESS:
+		return cmp < 0
+	case token.LESS_EQUAL:
+		return cmp <= 0
+	case token.GREATER:
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bit checks a call of builtin bit, which returns an integer constant with
+// the given bit set, like _BV of avr-libc.
+func (t *typer) bit(call *ast.CallExpr) Type {
+	if len(call.Args) != 1 {
+		t.diags.Add(call.Loc, "bit takes one argument, found %d", len(call.Args))
+		for _, arg := range call.Args {
+			t.value(arg)
+		}
+		return Typ[Invalid]
+	}
+
+	arg := call.Args[0]
+	typ := t.value(arg)
+	switch {
+	case isKind(typ, Invalid):
+		return typ
+	case !IsInteger(typ):
+		t.diags.Add(arg.Span(), "bit needs an integer, found %s (%s)", ast.ExprString(arg), typ)
+		return Typ[Invalid]
+	case !t.isConst(arg):
+		t.diags.Add(arg.Span(), "argument to bit must be constant, found %s", ast.ExprString(arg))
+		return Typ[Invalid]
+	}
+
+	n := t.info.Values[arg]
+	if n < 0 || n > 31 {
+		t.diags.Add(arg.Span(), "bit %d out of range, must be 0 to 31", n)
+		return Typ[Invalid]
+	}
+	if isUntyped(typ) {
+		t.setType(arg, Typ[U8])
+	}
+
+	t.info.Values[call] = 1 << uint(n)
+	return Typ[UntypedInt]
+}
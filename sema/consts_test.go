@@ -0,0 +1,116 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConsts(t *testing.T) {
+	Convey("Consts", t, func() {
+		values := func(src string) []int64 {
+			file, _ := parser.ParseString(src)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			var values []int64
+			for _, decl := range file.Decls {
+				if c, ok := decl.(*ast.ConstDecl); ok {
+					values = append(values, info.Values[c.Value])
+				}
+			}
+			return values
+		}
+
+		Convey("It evaluates const declarations", func() {
+			So(values(`
+const A = 3;
+const B: u8 = A * 4 + 1;
+const C = i16(B) / 2 - 10;
+const D = (7 % 4) << 2;
+const E = -8 >> 1;
+`), ShouldResemble, []int64{3, 13, -4, 12, -4})
+		})
+
+		Convey("It evaluates constants declared later", func() {
+			So(values("const A = B + 1; const B: i16 = 2;"), ShouldResemble, []int64{3, 2})
+		})
+
+		Convey("It folds bit operators and bit", func() {
+			So(values(`
+const MASK: u8 = bit(5) | bit(1);
+const LOW = 240 ^ 255;
+const CLEAR: u8 = ~bit(5) & 255;
+const INV: u8 = ~MASK;
+`), ShouldResemble, []int64{34, 15, 223, 221})
+		})
+
+		Convey("It folds comparisons and logical operators to bools", func() {
+			So(values(`
+enum E { A, B }
+const X = 3 > 2 and !false;
+const Y = E.A == E.B or 1.5 < 1.25;
+`), ShouldResemble, []int64{1, 0})
+		})
+
+		Convey("It converts typed constants", func() {
+			So(values(`
+const H: q8.8 = 1.5;
+const I = i16(H) + 1;
+const Q = q4.4(I);
+const S = i8(-H);
+`), ShouldResemble, []int64{384, 2, 32, -2})
+		})
+
+		Convey("It clears masks of unsigned operands", func() {
+			So(check("fn f(p: u8) -> u8 { return p & ~bit(5) | bit(1); }"), ShouldBeEmpty)
+		})
+
+		Convey("It checks indexes that are constants", func() {
+			So(check("const I = 5; fn f(buf: [4]u8) -> u8 { return buf[I - 2]; }"), ShouldBeEmpty)
+			So(check("const I = 5; fn f(buf: [4]u8) -> u8 { return buf[I]; }").Error(), ShouldEqual,
+				"1:50: index 5 out of range for array of length 4")
+		})
+
+		Convey("It reports overflow and division by zero", func() {
+			for src, message := range map[string]string{
+				"const A: u8 = 200 + 100;":             "1:15: constant 300 overflows u8",
+				"const A: i8 = 64; const B = A * 2;":   "1:29: constant 128 overflows i8",
+				"const A: u16 = 1 << 16;":              "1:16: constant 65536 overflows u16",
+				"const A = 10 % 0;":                    "1:16: division by zero",
+				"const Z = 0; const A = 1 / Z;":        "1:28: division by zero",
+				"const A: q8.8 = 100; var b = A * 2;":  "1:30: constant 200 overflows q8.8",
+				"const A: i16 = 300; var b = u8(A);":   "1:32: constant 300 overflows u8",
+				"const A: q8.8 = -1.5; var b = u8(A);": "1:34: constant -1.5 overflows u8",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It reports misuses of constants", func() {
+			for src, message := range map[string]string{
+				"fn f(a: u8) { const K = a; }":            "1:25: a is not constant",
+				"const A = 1; fn f() { A = 2; }":          "1:23: cannot assign to A, it's a constant",
+				"const A = B; const B = A;":               "1:24: initialization of A refers to itself",
+				"const A: [2]u8 = 0;":                     "1:10: invalid constant type [2]u8",
+				"fn f(a: q8.8) -> q8.8 { return a & 1; }": "1:32: operator & not defined on a (q8.8)",
+				"fn f(a: u8) -> u8 { return a << -1; }":   "1:33: negative shift count -1",
+				"var x = bit(40);":                        "1:13: bit 40 out of range, must be 0 to 31",
+				"fn f(n: u8) { var x = bit(n); }":         "1:27: argument to bit must be constant, found n",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It types shifts as their left operand", func() {
+			So(check(`
+fn f(a: u8, n: u8) -> u16 {
+  var x: u8 = a << 2 >> n;
+  var y = 1 << n;
+  return u16(y);
+}`), ShouldBeEmpty)
+		})
+	})
+}
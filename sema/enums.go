@@ -0,0 +1,203 @@
+package sema
+
+import (
+	"strings"
+
+	"github.com/sent-hil/bitlang/ast"
+)
+
+// Enum is an enum type. Its values are stored as a u8.
+type Enum struct {
+	Name    string
+	Members []*EnumMember
+}
+
+// EnumMember is a member of an enum with its value.
+type EnumMember struct {
+	Name  string
+	Value int64
+}
+
+// Member returns member of enum with given name, or nil if there's none.
+func (e *Enum) Member(name string) *EnumMember {
+	for _, m := range e.Members {
+		if m.Name == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// Switch is what checks found out about a switch statement.
+type Switch struct {
+	// Enum is the enum switched over, or nil if cases are integers.
+	Enum *Enum
+
+	// Values are values of each case, in the order of the statement's cases;
+	// the default case has none.
+	Values [][]int64
+
+	// Default is index of the default case, or -1 if there's none.
+	Default int
+}
+
+// checkEnums collects enums declared in file, checking their members have
+// distinct names and values that fit in a u8.
+func (c *checker) checkEnums(file *ast.File) {
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.EnumDecl)
+		if !ok {
+			continue
+		}
+
+		// resolve reports enums declared twice
+		if _, ok := c.info.Enums[decl.Name.Name]; ok {
+			continue
+		}
+
+		enum := &Enum{Name: decl.Name.Name}
+		values := map[int64]string{}
+		next := int64(0)
+		for _, m := range decl.Members {
+			if enum.Member(m.Name.Name) != nil {
+				c.diags.Add(m.Name.Loc, "duplicate member %s in enum %s", m.Name.Name, enum.Name)
+				continue
+			}
+
+			value := next
+			if m.Value != nil {
+				n, ok := constInt(m.Value)
+				if !ok {
+					c.diags.Add(m.Value.Span(), "value of %s must be a constant", m.Name.Name)
+					continue
+				}
+				value = n
+			}
+
+			if value < 0 || value > 255 {
+				c.diags.Add(m.Loc, "value %d of %s doesn't fit in u8", value, m.Name.Name)
+				continue
+			}
+			if prev, ok := values[value]; ok {
+				c.diags.Add(m.Loc, "%s has same value %d as %s", m.Name.Name, value, prev)
+				continue
+			}
+
+			values[value] = m.Name.Name
+			enum.Members = append(enum.Members, &EnumMember{Name: m.Name.Name, Value: value})
+			next = value + 1
+		}
+
+		c.info.Enums[enum.Name] = enum
+	}
+}
+
+// checkSwitches checks switch statements of given function. A switch's
+// cases must be constants, or members of one enum, without duplicates. A
+// switch over an enum without a default case must cover all its members.
+func (c *checker) checkSwitches(fn *ast.FuncDecl) {
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if stmt, ok := n.(*ast.SwitchStmt); ok {
+			c.checkSwitch(stmt)
+		}
+		return true
+	})
+}
+
+func (c *checker) checkSwitch(stmt *ast.SwitchStmt) {
+	sw := &Switch{Default: -1}
+	seen := map[int64]ast.Expr{}
+	decided, bad := false, false
+
+	for i, clause := range stmt.Cases {
+		if clause.Values == nil {
+			if sw.Default >= 0 {
+				c.diags.Add(clause.Loc, "multiple default cases in switch")
+			}
+			sw.Default = i
+		}
+
+		var values []int64
+		for _, x := range clause.Values {
+			value, ok := c.caseValue(sw, &decided, x)
+			if !ok {
+				bad = true
+				continue
+			}
+
+			if prev, ok := seen[value]; ok {
+				c.diags.Add(x.Span(), "duplicate case %s, previously at %s",
+					ast.ExprString(x), prev.Span())
+				continue
+			}
+			seen[value] = x
+			values = append(values, value)
+		}
+		sw.Values = append(sw.Values, values)
+	}
+
+	// a bad case may be meant as one of the missing members
+	if sw.Enum != nil && sw.Default < 0 && !bad {
+		var missing []string
+		for _, m := range sw.Enum.Members {
+			if _, ok := seen[m.Value]; !ok {
+				missing = append(missing, m.Name)
+			}
+		}
+
+		if len(missing) > 0 {
+			c.diags.Add(stmt.Loc, "switch over %s is not exhaustive, missing %s",
+				sw.Enum.Name, strings.Join(missing, ", "))
+		}
+	}
+
+	c.info.Switches[stmt] = sw
+}
+
+// caseValue returns value of a case, which is either an enum member like
+// State.Idle or an integer constant. The first enum member decides which
+// enum the switch is over, or first integer that it's over integers.
+func (c *checker) caseValue(sw *Switch, decided *bool, x ast.Expr) (int64, bool) {
+	if sel, ok := x.(*ast.SelectorExpr); ok {
+		if name, ok := sel.X.(*ast.Ident); ok {
+			if enum, ok := c.info.Enums[name.Name]; ok {
+				if !*decided {
+					sw.Enum, *decided = enum, true
+				}
+				if sw.Enum != enum {
+					c.diags.Add(x.Span(), "case %s.%s in switch over %s",
+						name.Name, sel.Sel.Name, c.switchKind(sw))
+					return 0, false
+				}
+
+				m := enum.Member(sel.Sel.Name)
+				if m == nil {
+					c.diags.Add(sel.Sel.Loc, "enum %s has no member %s", enum.Name, sel.Sel.Name)
+					return 0, false
+				}
+				return m.Value, true
+			}
+		}
+	}
+
+	value, ok := constInt(x)
+	if !ok {
+		c.diags.Add(x.Span(), "case must be a constant or enum member")
+		return 0, false
+	}
+	if sw.Enum != nil {
+		c.diags.Add(x.Span(), "case %d in switch over %s", value, sw.Enum.Name)
+		return 0, false
+	}
+	*decided = true
+
+	return value, true
+}
+
+func (c *checker) switchKind(sw *Switch) string {
+	if sw.Enum != nil {
+		return sw.Enum.Name
+	}
+	return "integers"
+}
@@ -0,0 +1,92 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnums(t *testing.T) {
+	Convey("Enums", t, func() {
+		Convey("It numbers members from previous value", func() {
+			file, _ := parser.ParseString("enum State { Idle, Running = 4, Done }")
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			state := info.Enums["State"]
+			So(state.Member("Idle").Value, ShouldEqual, 0)
+			So(state.Member("Running").Value, ShouldEqual, 4)
+			So(state.Member("Done").Value, ShouldEqual, 5)
+		})
+
+		Convey("It reports bad members", func() {
+			for src, message := range map[string]string{
+				"enum E { A, A }":              "1:13: duplicate member A in enum E",
+				"enum E { A = 256 }":           "1:10: value 256 of A doesn't fit in u8",
+				"enum E { A = 255, B }":        "1:19: value 256 of B doesn't fit in u8",
+				"enum E { A = 1, B = 1 }":      "1:17: B has same value 1 as A",
+				"enum E { A = f() } fn f() {}": "1:14: value of A must be a constant",
+				"enum E { A } enum E { B }":    "1:19: E already declared at 1:6",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It records values of cases", func() {
+			file, _ := parser.ParseString(`
+enum State { Idle, Running, Done }
+fn f(s: State) {
+  switch s {
+  case State.Idle, State.Done { }
+  default { }
+  }
+}`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			sw := info.Switches[file.Decls[1].(*ast.FuncDecl).Body.Stmts[0].(*ast.SwitchStmt)]
+			So(sw.Enum.Name, ShouldEqual, "State")
+			So(sw.Values, ShouldResemble, [][]int64{{0, 2}, nil})
+			So(sw.Default, ShouldEqual, 1)
+		})
+
+		Convey("It reports switches over enums that aren't exhaustive", func() {
+			diags := check(`
+enum State { Idle, Running, Done, Error }
+fn f(s: State) {
+  if true {
+    switch s { case State.Running { } }
+  }
+}`)
+			So(diags.Error(), ShouldEqual,
+				"5:5: switch over State is not exhaustive, missing Idle, Done, Error")
+		})
+
+		Convey("It accepts switches covered by default", func() {
+			So(check(`
+enum State { Idle, Running }
+fn f(s: State) { switch s { case State.Idle { } default { } } }
+`), ShouldBeEmpty)
+		})
+
+		Convey("It doesn't require integer switches to be exhaustive", func() {
+			So(check("fn f(n: u8) { switch n { case 1, 2 { } case 3 { } } }"), ShouldBeEmpty)
+		})
+
+		Convey("It reports bad cases", func() {
+			for src, message := range map[string]string{
+				"fn f(n: u8) { switch n { case 1 { } case 1 { } } }":                      "1:42: duplicate case 1, previously at 1:31",
+				"fn f(n: u8, m: u8) { switch n { case m { } } }":                          "1:38: case must be a constant or enum member",
+				"fn f(n: u8) { switch n { default { } default { } } }":                    "1:38: multiple default cases in switch",
+				"enum E { A } fn f(n: E) { switch n { case E.B { } } }":                   "1:45: enum E has no member B",
+				"enum E { A } fn f(n: u8) { switch n { case 1, E.A { } } }":               "1:47: case E.A in switch over integers",
+				"enum E { A } fn f(n: E) { switch n { case E.A, 1 { } } }":                "1:48: case 1 in switch over E",
+				"enum E { A } enum F { B } fn f(n: E) { switch n { case E.A, F.B { } } }": "1:61: case F.B in switch over E",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
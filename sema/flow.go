@@ -0,0 +1,57 @@
+package sema
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/cfg"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// checkFlow builds control-flow graph of given function, see Info.CFGs,
+// warning about code no path reaches and reporting functions with a result
+// that can get to the end of their body without a return.
+func (c *checker) checkFlow(fn *ast.FuncDecl) {
+	g := cfg.New(fn.Body, c.info)
+	c.info.CFGs[fn] = g
+
+	for _, stmt := range g.Unreachable {
+		c.diags.Warn(stmt.Span(), "unreachable code")
+	}
+
+	if fn.Result != nil && g.FallsOff {
+		// report at the closing brace
+		end := fn.Body.Loc.End
+		start := token.Pos{Offset: end.Offset - 1, Line: end.Line, Column: end.Column - 1}
+		c.diags.Add(token.Span{Start: start, End: end}, "missing return at end of %s", fn.Name.Name)
+	}
+}
+
+// Exhaustive returns if switch stmt without a default case covers every
+// member of the enum it's over; checkSwitches reports ones that don't. Flow
+// checks and lowering use it to know if control can get past a switch
+// without taking a case.
+func (info *Info) Exhaustive(stmt *ast.SwitchStmt) bool {
+	sw := info.Switches[stmt]
+	if sw == nil || sw.Enum == nil {
+		return false
+	}
+
+	covered := map[int64]bool{}
+	for _, values := range sw.Values {
+		for _, v := range values {
+			covered[v] = true
+		}
+	}
+	for _, m := range sw.Enum.Members {
+		if !covered[m.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsTrue returns if condition x is a constant true, eg `while true` or
+// `while FOREVER` with FOREVER a constant. Flow checks and lowering use it
+// to know if a loop can end without a break.
+func (info *Info) IsTrue(x ast.Expr) bool {
+	return x != nil && info.Values[x] == 1 && isKind(info.Types[x], Bool)
+}
@@ -0,0 +1,62 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlow(t *testing.T) {
+	Convey("Flow", t, func() {
+		Convey("It accepts functions that return on every path", func() {
+			So(check(`
+enum State { Idle, Running }
+fn a(x: bool) -> u8 { if x { return 1; } else { return 2; } }
+fn b(s: State) -> u8 { switch s { case State.Idle { return 1; } case State.Running { return 2; } } }
+fn c() -> u8 { loop { } }
+fn d(n: u8) -> u8 { while true { if n > 3 { return n; } } }
+`), ShouldBeEmpty)
+		})
+
+		Convey("It reports functions that can get to the end without a return", func() {
+			for src, message := range map[string]string{
+				"fn f(c: bool) -> u8 { if c { return 1; } }":              "1:42: missing return at end of f",
+				"fn f(n: u8) -> u8 { switch n { case 1 { return 1; } } }": "1:55: missing return at end of f",
+				"fn f(c: bool) -> u8 { while c { return 1; } }":           "1:45: missing return at end of f",
+				"fn f() -> u8 { loop { break; } }":                        "1:32: missing return at end of f",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It goes on after switches over enums that don't cover every member", func() {
+			diags := check(`
+enum State { Idle, Running, Done }
+fn f(s: State) -> u8 {
+  switch s { case State.Idle { return 1; } case State.Running { return 2; } }
+  return 3;
+}`)
+			So(diags.Error(), ShouldEqual, "4:3: switch over State is not exhaustive, missing Done")
+		})
+
+		Convey("It warns about unreachable code", func() {
+			So(check(`
+fn f(c: bool) {
+  loop { break; g(); }
+  return;
+  if c { g(); }
+}
+fn g() { }`).Error(), ShouldEqual, "3:17: warning: unreachable code\n5:3: warning: unreachable code")
+		})
+
+		Convey("It records graphs of functions", func() {
+			file, _ := parser.ParseString("fn f() { } fn g() -> u8 { return 1; }")
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			So(info.CFGs[file.Decls[0].(*ast.FuncDecl)].FallsOff, ShouldBeTrue)
+			So(info.CFGs[file.Decls[1].(*ast.FuncDecl)].FallsOff, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,32 @@
+package sema
+
+import "github.com/sent-hil/bitlang/ast"
+
+// EntryPoints are the functions the runtime calls, like in Arduino sketches:
+// setup once after reset, then loop over and over.
+var EntryPoints = map[string]bool{
+	"setup": true,
+	"loop":  true,
+}
+
+func (c *checker) checkFunc(fn *ast.FuncDecl) {
+	seen := map[string]*ast.Param{}
+	for _, param := range fn.Params {
+		name := param.Name.Name
+		if prev, ok := seen[name]; ok {
+			c.diags.Add(param.Name.Loc, "duplicate parameter %s, previously declared at %s",
+				name, prev.Name.Loc)
+			continue
+		}
+		seen[name] = param
+	}
+
+	if EntryPoints[fn.Name.Name] {
+		if len(fn.Params) > 0 {
+			c.diags.Add(fn.Params[0].Loc, "entry point %s cannot take parameters", fn.Name.Name)
+		}
+		if fn.Result != nil {
+			c.diags.Add(fn.Result.Span(), "entry point %s cannot return a value", fn.Name.Name)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// check parses and checks given source.
+func check(src string) diag.List {
+	file, diags := parser.ParseString(src)
+	So(diags, ShouldBeEmpty)
+
+	_, diags = Check(file, nil)
+	return diags
+}
+
+func TestFuncs(t *testing.T) {
+	Convey("Funcs", t, func() {
+		Convey("It accepts functions with distinct parameters", func() {
+			So(check("fn add(a: u8, b: u8) -> u8 { return a + b; }"), ShouldBeEmpty)
+		})
+
+		Convey("It reports duplicate parameters", func() {
+			diags := check("fn add(a: u8, a: u16) -> u8 { return a; }")
+			So(diags.Error(), ShouldEqual, "1:15: duplicate parameter a, previously declared at 1:8")
+		})
+
+		Convey("It accepts setup and loop entry points", func() {
+			So(check("fn setup() {} fn loop() {}"), ShouldBeEmpty)
+		})
+
+		Convey("It reports entry points with parameters", func() {
+			diags := check("fn setup(a: u8) {}")
+			So(diags.Error(), ShouldEqual, "1:10: entry point setup cannot take parameters")
+		})
+
+		Convey("It reports entry points with results", func() {
+			diags := check("fn loop() -> u8 { return 1; }")
+			So(diags.Error(), ShouldEqual, "1:14: entry point loop cannot return a value")
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package sema
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/avr"
+)
+
+// Interrupt handlers are functions with an interrupt attribute naming the
+// vector they handle, eg `fn tick() interrupt(TIMER1_COMPA) { ... }`.
+
+// checkInterrupts collects interrupt handlers of file, checking each names a
+// vector of avr.Vectors that no other handles, takes no parameters and
+// returns nothing. Handlers return with RETI, so they can't be called.
+func (c *checker) checkInterrupts(file *ast.File) {
+	handlers := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+
+		// first is the first interrupt attribute, valid or not
+		var first *ast.Attr
+		for _, attr := range fn.Attrs {
+			switch attr.Name.Name {
+			case "interrupt":
+			case "recursive":
+				// See checkRecursion.
+				continue
+			default:
+				c.diags.Add(attr.Loc, "unknown function attribute %s", attr.Name.Name)
+				continue
+			}
+
+			if first == nil {
+				first = attr
+			}
+			vector, ok := c.vector(attr)
+			if !ok {
+				continue
+			}
+			if _, ok := c.info.Interrupts[fn]; ok {
+				c.diags.Add(attr.Loc, "%s already handles an interrupt", fn.Name.Name)
+				continue
+			}
+			if prev, ok := handlers[vector]; ok {
+				c.diags.Add(attr.Args[0].Span(), "%s already handled by %s at %s",
+					vector, prev.Name.Name, prev.Name.Loc)
+				continue
+			}
+			handlers[vector] = fn
+			c.info.Interrupts[fn] = vector
+		}
+
+		// signatures are checked even if the vector isn't valid
+		switch {
+		case first == nil:
+		case EntryPoints[fn.Name.Name]:
+			c.diags.Add(first.Loc, "entry point %s cannot be an interrupt handler", fn.Name.Name)
+		case len(fn.Params) > 0 || fn.Result != nil:
+			c.diags.Add(fn.Name.Loc, "interrupt handler %s must take no parameters and return nothing",
+				fn.Name.Name)
+		}
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if id, ok := call.Fun.(*ast.Ident); ok && c.info.Uses[id] != nil {
+				if handler, ok := c.info.Uses[id].Decl.(*ast.FuncDecl); ok && c.info.Interrupts[handler] != "" {
+					c.diags.Add(call.Loc, "cannot call interrupt handler %s", id.Name)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// vector returns name of the vector given interrupt attribute handles, if
+// it's valid.
+func (c *checker) vector(attr *ast.Attr) (string, bool) {
+	var name *ast.Ident
+	if len(attr.Args) == 1 {
+		name, _ = attr.Args[0].(*ast.Ident)
+	}
+	if name == nil {
+		c.diags.Add(attr.Loc, "interrupt takes the name of a vector, eg interrupt(TIMER1_COMPA)")
+		return "", false
+	}
+
+	if _, ok := avr.VectorNumber(name.Name); !ok {
+		c.diags.Add(name.Loc, "unknown interrupt vector %s", name.Name)
+		return "", false
+	}
+
+	return name.Name, true
+}
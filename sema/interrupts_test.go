@@ -0,0 +1,46 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInterrupts(t *testing.T) {
+	Convey("Interrupts", t, func() {
+		Convey("It collects interrupt handlers", func() {
+			file, _ := parser.ParseString(`
+var ticks: u16 = 0;
+fn tick() interrupt(TIMER1_COMPA) { ticks = ticks + 1; }
+fn received() interrupt(USART_RX) { }
+fn setup() { }
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			So(len(info.Interrupts), ShouldEqual, 2)
+			So(info.Interrupts[file.Decls[1].(*ast.FuncDecl)], ShouldEqual, "TIMER1_COMPA")
+			So(info.Interrupts[file.Decls[2].(*ast.FuncDecl)], ShouldEqual, "USART_RX")
+		})
+
+		Convey("It reports bad handlers", func() {
+			for src, message := range map[string]string{
+				"fn f() interrupt(TIMER9_OVF) { }":                      "1:18: unknown interrupt vector TIMER9_OVF",
+				"fn f() interrupt(RESET) { }":                           "1:18: unknown interrupt vector RESET",
+				"fn f() interrupt { }":                                  "1:8: interrupt takes the name of a vector, eg interrupt(TIMER1_COMPA)",
+				"fn f() interrupt(1) { }":                               "1:8: interrupt takes the name of a vector, eg interrupt(TIMER1_COMPA)",
+				"fn f() inline { }":                                     "1:8: unknown function attribute inline",
+				"fn f(a: u8) interrupt(INT0) { }":                       "1:4: interrupt handler f must take no parameters and return nothing",
+				"fn f() -> u8 interrupt(INT0) { return 1; }":            "1:4: interrupt handler f must take no parameters and return nothing",
+				"fn loop() interrupt(INT0) { }":                         "1:11: entry point loop cannot be an interrupt handler",
+				"fn f() interrupt(INT0) interrupt(INT1) { }":            "1:24: f already handles an interrupt",
+				"fn f() interrupt(INT0) { } fn g() interrupt(INT0) { }": "1:45: INT0 already handled by f at 1:4",
+				"fn f() interrupt(INT0) { } fn g() { f(); }":            "1:37: cannot call interrupt handler f",
+				"fn f(a: u8) interrupt(INT9) { }":                       "1:23: unknown interrupt vector INT9\n1:4: interrupt handler f must take no parameters and return nothing",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
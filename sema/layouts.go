@@ -0,0 +1,36 @@
+package sema
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/layout"
+)
+
+// checkLayouts computes memory layouts of structs, see Info.Layouts,
+// reporting ones that can't be laid out.
+func (c *checker) checkLayouts(file *ast.File) {
+	layouts, diags := layout.Compute(file, c.info)
+	c.info.Layouts = layouts
+	c.diags = append(c.diags, diags...)
+}
+
+// Len returns length of given array type, if checkTypes found it valid.
+func (info *Info) Len(typ *ast.ArrayType) (int64, bool) {
+	arr, ok := info.Types[typ].(*Array)
+	if !ok {
+		return 0, false
+	}
+	return arr.Len, true
+}
+
+// Size returns size in bytes of named type that isn't a struct, if it's
+// valid. Layouts of structs use it for fields of builtin, fixed-point and
+// enum types.
+func (info *Info) Size(name *ast.Ident) (int, bool) {
+	obj := info.Uses[name]
+	if obj == nil || obj.Kind != TypeObj {
+		return 0, false
+	}
+
+	size := sizeOf(obj.Type)
+	return size, size > 0
+}
@@ -0,0 +1,49 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLayouts(t *testing.T) {
+	Convey("Layouts", t, func() {
+		Convey("It lays out fields of any checked type", func() {
+			file, _ := parser.ParseString(`
+const N = 3;
+enum State { A, B }
+struct S { s: State, pos: q8.8, buf: [N * 2]u8, inner: [2]T }
+struct T align(2) { b: bool }
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			s := info.Layouts["S"]
+			So(s.Field("pos").Offset, ShouldEqual, 1)
+			So(s.Field("buf").Offset, ShouldEqual, 3)
+			So(s.Field("inner").Offset, ShouldEqual, 10)
+			So(s.Size, ShouldEqual, 14)
+		})
+
+		Convey("It reports structs that can't be laid out", func() {
+			for src, message := range map[string]string{
+				"struct S { a: u8, a: u16 }":     "1:19: duplicate field a in struct S",
+				"struct T { t: T }":              "1:8: struct T contains itself",
+				"struct U align(3) { a: u8 }":    "1:16: alignment must be a power of two",
+				"struct V { a: W } var v: V;":    "1:15: undefined: W",
+				"struct S { a: u8 } struct S {}": "1:27: S already declared at 1:8",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It leaves out structs with fields that can't be laid out", func() {
+			file, _ := parser.ParseString("struct T { t: T } struct U { a: u8, t: T } struct V { a: u8 }")
+			info, _ := Check(file, nil)
+			So(info.Layouts, ShouldContainKey, "V")
+			So(info.Layouts, ShouldNotContainKey, "T")
+			So(info.Layouts, ShouldNotContainKey, "U")
+		})
+	})
+}
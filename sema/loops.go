@@ -0,0 +1,124 @@
+package sema
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// loops checks break and continue are inside a loop, and that labels they
+// name are of an enclosing loop. It also counts atomic blocks that branches
+// and returns leave, see Info.AtomicExits.
+type loops struct {
+	*checker
+
+	// labels are labels of enclosing loops, innermost last; unlabeled loops
+	// are nil. Atomics are how many atomic blocks each loop is in.
+	labels  []*ast.Ident
+	atomics []int
+
+	// atomic is how many atomic blocks the statement being checked is in.
+	atomic int
+}
+
+func (c *checker) checkLoops(fn *ast.FuncDecl) {
+	l := &loops{checker: c}
+	l.stmts(fn.Body.Stmts)
+}
+
+func (l *loops) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		l.stmt(stmt, nil)
+	}
+}
+
+// stmt checks given statement; label is the label of it if it's a loop.
+func (l *loops) stmt(stmt ast.Stmt, label *ast.Ident) {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		l.stmts(stmt.Stmts)
+	case *ast.IfStmt:
+		l.stmt(stmt.Then, nil)
+		if stmt.Else != nil {
+			l.stmt(stmt.Else, nil)
+		}
+	case *ast.SwitchStmt:
+		for _, clause := range stmt.Cases {
+			l.stmt(clause.Body, nil)
+		}
+	case *ast.ForStmt:
+		l.body(stmt.Body, label)
+	case *ast.WhileStmt:
+		l.body(stmt.Body, label)
+	case *ast.LoopStmt:
+		l.body(stmt.Body, label)
+	case *ast.LabeledStmt:
+		if prev := l.label(stmt.Label.Name); prev != nil {
+			l.diags.Add(stmt.Label.Loc, "label %s already declared at %s",
+				stmt.Label.Name, prev.Loc)
+		}
+		l.stmt(stmt.Stmt, stmt.Label)
+	case *ast.AtomicStmt:
+		l.atomic++
+		l.stmt(stmt.Body, nil)
+		l.atomic--
+	case *ast.ReturnStmt:
+		if l.atomic > 0 {
+			l.info.AtomicExits[stmt] = l.atomic
+		}
+	case *ast.BranchStmt:
+		l.branch(stmt)
+	}
+}
+
+func (l *loops) body(body *ast.BlockStmt, label *ast.Ident) {
+	l.labels = append(l.labels, label)
+	l.atomics = append(l.atomics, l.atomic)
+	l.stmt(body, nil)
+	l.labels = l.labels[:len(l.labels)-1]
+	l.atomics = l.atomics[:len(l.atomics)-1]
+}
+
+func (l *loops) branch(stmt *ast.BranchStmt) {
+	name := "break"
+	if stmt.Tok == token.CONTINUE {
+		name = "continue"
+	}
+
+	if len(l.labels) == 0 {
+		l.diags.Add(stmt.Loc, "%s outside loop", name)
+		return
+	}
+
+	target := len(l.labels) - 1
+	if stmt.Label != nil {
+		if target = l.loop(stmt.Label.Name); target < 0 {
+			l.diags.Add(stmt.Label.Loc, "%s label %s is not of an enclosing loop",
+				name, stmt.Label.Name)
+			return
+		}
+	}
+
+	if n := l.atomic - l.atomics[target]; n > 0 {
+		l.info.AtomicExits[stmt] = n
+	}
+}
+
+// label returns label of enclosing loop with given name, or nil.
+func (l *loops) label(name string) *ast.Ident {
+	if i := l.loop(name); i >= 0 {
+		return l.labels[i]
+	}
+
+	return nil
+}
+
+// loop returns index of enclosing loop with given label, or -1.
+func (l *loops) loop(name string) int {
+	for i := len(l.labels) - 1; i >= 0; i-- {
+		if l.labels[i] != nil && l.labels[i].Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,85 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoops(t *testing.T) {
+	Convey("Loops", t, func() {
+		Convey("It accepts break and continue in loops", func() {
+			So(check(`
+fn loop() {
+  loop {
+    poll();
+    if done { break; }
+  }
+
+  outer: for var i = 0; i < 4; i = i + 1 {
+    while true {
+      switch i { case 1 { continue outer; } default { break; } }
+    }
+  }
+}
+
+fn poll() { }
+var done = false;`), ShouldBeEmpty)
+		})
+
+		Convey("It counts atomic blocks that returns and branches leave", func() {
+			file, _ := parser.ParseString(`
+fn f(a: bool) -> u8 {
+  outer: loop {
+    atomic {
+      loop {
+        atomic {
+          if a { break; }
+          if a { continue outer; }
+          if a { return 1; }
+        }
+      }
+      break;
+    }
+  }
+  return 0;
+}`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			var exits []int
+			ast.Inspect(file, func(n ast.Node) bool {
+				if stmt, ok := n.(ast.Stmt); ok {
+					switch stmt.(type) {
+					case *ast.BranchStmt, *ast.ReturnStmt:
+						exits = append(exits, info.AtomicExits[stmt])
+					}
+				}
+				return true
+			})
+			So(exits, ShouldResemble, []int{1, 2, 2, 1, 0})
+		})
+
+		Convey("It reports break and continue outside loops", func() {
+			So(check("fn f() { break; }").Error(), ShouldEqual, "1:10: break outside loop")
+			So(check("fn f(a: bool) { if a { continue; } }").Error(), ShouldEqual,
+				"1:24: continue outside loop")
+		})
+
+		Convey("It reports labels that aren't of an enclosing loop", func() {
+			diags := check(`
+fn f() {
+  outer: loop { break; }
+  loop { break outer; }
+}`)
+			So(diags.Error(), ShouldEqual, "4:16: break label outer is not of an enclosing loop")
+		})
+
+		Convey("It reports labels already used by an enclosing loop", func() {
+			diags := check("fn f() { a: loop { a: while true { } } }")
+			So(diags.Error(), ShouldEqual, "1:20: label a already declared at 1:10")
+		})
+	})
+}
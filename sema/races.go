@@ -0,0 +1,211 @@
+package sema
+
+import "github.com/sent-hil/bitlang/ast"
+
+// An interrupt can come between any two instructions of main code, ie code
+// that doesn't run in an interrupt handler. So a global that handlers also
+// use can change while main code reads or writes it. Multi-byte values can be
+// torn, since AVR moves one byte at a time, and values main code keeps in
+// registers go stale. Main code has to use such globals in atomic blocks,
+// except single-byte globals declared volatile, which are read and written
+// whole.
+
+// funcUses are globals a function uses and functions it calls, each noting if
+// it's inside an atomic block.
+type funcUses struct {
+	globals []globalUse
+	calls   []funcCall
+}
+
+type globalUse struct {
+	id     *ast.Ident
+	obj    *Object
+	atomic bool
+}
+
+type funcCall struct {
+	fn     *ast.FuncDecl
+	atomic bool
+}
+
+// usesVisitor collects funcUses of a function.
+type usesVisitor struct {
+	c      *checker
+	uses   *funcUses
+	atomic bool
+}
+
+func (v *usesVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.AtomicStmt:
+		return &usesVisitor{c: v.c, uses: v.uses, atomic: true}
+	case *ast.Ident:
+		obj := v.c.info.Uses[node]
+		if obj == nil {
+			break
+		}
+		if decl, ok := obj.Decl.(*ast.VarDecl); ok && v.c.globals[decl] {
+			v.uses.globals = append(v.uses.globals, globalUse{id: node, obj: obj, atomic: v.atomic})
+		}
+		if fn, ok := obj.Decl.(*ast.FuncDecl); ok && obj.Kind == FuncObj {
+			v.uses.calls = append(v.uses.calls, funcCall{fn: fn, atomic: v.atomic})
+		}
+	}
+
+	return v
+}
+
+// checkRaces checks attributes of variables, and warns about main code using
+// globals that interrupt handlers also use outside atomic blocks, and about
+// atomic blocks in handlers, where interrupts are already disabled.
+func (c *checker) checkRaces(file *ast.File) {
+	c.globals = map[*ast.VarDecl]bool{}
+	for _, decl := range file.Decls {
+		if v, ok := decl.(*ast.VarDecl); ok {
+			c.globals[v] = true
+			c.varAttrs(v, true)
+		}
+	}
+
+	uses := map[*ast.FuncDecl]*funcUses{}
+	called := map[*ast.FuncDecl]bool{}
+	var funcs []*ast.FuncDecl
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		funcs = append(funcs, fn)
+
+		uses[fn] = &funcUses{}
+		ast.Walk(&usesVisitor{c: c, uses: uses[fn]}, fn.Body)
+		for _, call := range uses[fn].calls {
+			called[call.fn] = true
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.VarDecl:
+				c.varAttrs(n, false)
+			case *ast.AtomicStmt:
+				if vector := c.info.Interrupts[fn]; vector != "" {
+					c.diags.Warn(n.Loc, "atomic block in interrupt handler %s is redundant, interrupts are disabled in handlers",
+						fn.Name.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	// globals used by code that runs in interrupt handlers, with the first
+	// handler using each
+	shared := map[*Object]*ast.FuncDecl{}
+	for _, fn := range funcs {
+		if c.info.Interrupts[fn] == "" {
+			continue
+		}
+		visited := map[*ast.FuncDecl]bool{}
+		var visit func(f *ast.FuncDecl)
+		visit = func(f *ast.FuncDecl) {
+			if visited[f] || uses[f] == nil {
+				return
+			}
+			visited[f] = true
+			for _, g := range uses[f].globals {
+				if shared[g.obj] == nil {
+					shared[g.obj] = fn
+				}
+			}
+			for _, call := range uses[f].calls {
+				visit(call.fn)
+			}
+		}
+		visit(fn)
+	}
+	if len(shared) == 0 {
+		return
+	}
+
+	// main code starts at functions that aren't handlers and that nothing
+	// calls, like the entry points; functions called in atomic blocks are
+	// protected whole
+	unprotected := map[*ast.FuncDecl]bool{}
+	visited := map[*ast.FuncDecl]bool{}
+	var visit func(fn *ast.FuncDecl, atomic bool)
+	visit = func(fn *ast.FuncDecl, atomic bool) {
+		if uses[fn] == nil || c.info.Interrupts[fn] != "" || unprotected[fn] || atomic && visited[fn] {
+			return
+		}
+		visited[fn] = true
+		unprotected[fn] = !atomic
+		for _, call := range uses[fn].calls {
+			visit(call.fn, atomic || call.atomic)
+		}
+	}
+	for _, fn := range funcs {
+		if !called[fn] {
+			visit(fn, false)
+		}
+	}
+
+	for _, fn := range funcs {
+		if !unprotected[fn] {
+			continue
+		}
+		for _, g := range uses[fn].globals {
+			if handler := shared[g.obj]; handler != nil && !g.atomic {
+				c.race(g, handler)
+			}
+		}
+	}
+}
+
+// race warns about use g in main code of a global that handler also uses,
+// unless it's a volatile byte.
+func (c *checker) race(g globalUse, handler *ast.FuncDecl) {
+	size := sizeOf(g.obj.Type)
+	switch {
+	case size == 1 && c.info.Volatile[g.obj]:
+		return
+	case size == 1:
+		c.diags.Warn(g.id.Loc, "%s is also used by interrupt handler %s, declare it volatile or use it in an atomic block",
+			g.id.Name, handler.Name.Name)
+	default:
+		c.diags.Warn(g.id.Loc, "%s is also used by interrupt handler %s, use it in an atomic block since an interrupt can come between its bytes",
+			g.id.Name, handler.Name.Name)
+	}
+}
+
+// varAttrs checks attributes of a variable declaration. Only globals can be
+// volatile, since only they can be shared with interrupt handlers.
+func (c *checker) varAttrs(v *ast.VarDecl, global bool) {
+	for _, attr := range v.Attrs {
+		switch {
+		case attr.Name.Name != "volatile":
+			c.diags.Add(attr.Loc, "unknown variable attribute %s", attr.Name.Name)
+		case len(attr.Args) > 0:
+			c.diags.Add(attr.Loc, "volatile takes no arguments")
+		case !global:
+			c.diags.Add(attr.Loc, "local variable %s cannot be volatile", v.Name.Name)
+		default:
+			if obj := c.info.Defs[v.Name]; obj != nil {
+				c.info.Volatile[obj] = true
+			}
+		}
+	}
+}
+
+// sizeOf returns size of a value of given type in bytes, or 0 if it isn't
+// known.
+func sizeOf(typ Type) int {
+	switch typ := typ.(type) {
+	case *Basic:
+		return typ.Size
+	case *Fixed:
+		return typ.Size()
+	case *Enum:
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,67 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRaces(t *testing.T) {
+	Convey("Races", t, func() {
+		Convey("It accepts shared globals used in atomic blocks or as volatile bytes", func() {
+			So(check(`
+var ticks: u16 = 0;
+var ready: bool volatile = false;
+fn tick() interrupt(TIMER1_COMPA) {
+  ticks = ticks + 1;
+  ready = true;
+}
+fn now() -> u16 { return ticks; }
+fn loop() {
+  var t: u16 = 0;
+  atomic { t = now(); }
+  while !ready { }
+  ready = false;
+}`), ShouldBeEmpty)
+		})
+
+		Convey("It warns about shared globals used outside atomic blocks", func() {
+			So(check(`
+var ticks: u16 = 0;
+var count: u8 = 0;
+fn tick() interrupt(TIMER1_COMPA) { bump(); }
+fn bump() { ticks = ticks + 1; count = count + 1; }
+fn elapsed() -> u16 { return ticks; }
+fn loop() {
+  var t = elapsed();
+  var c = count;
+}`).Error(), ShouldEqual, "6:30: warning: ticks is also used by interrupt handler tick, use it in an atomic block since an interrupt can come between its bytes\n"+
+				"9:11: warning: count is also used by interrupt handler tick, declare it volatile or use it in an atomic block")
+		})
+
+		Convey("It warns about atomic blocks in handlers", func() {
+			So(check("fn f() interrupt(INT0) { atomic { } }").Error(), ShouldEqual,
+				"1:26: warning: atomic block in interrupt handler f is redundant, interrupts are disabled in handlers")
+		})
+
+		Convey("It records volatile globals", func() {
+			file, _ := parser.ParseString("var a: u8 volatile = 0; var b: u8 = 0;")
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			So(len(info.Volatile), ShouldEqual, 1)
+			So(info.Volatile[info.Defs[file.Decls[0].(*ast.VarDecl).Name]], ShouldBeTrue)
+		})
+
+		Convey("It reports bad variable attributes", func() {
+			for src, message := range map[string]string{
+				"var a: u8 packed = 0;":              "1:11: unknown variable attribute packed",
+				"var a: u8 volatile(1) = 0;":         "1:11: volatile takes no arguments",
+				"fn f() { var a: u8 volatile = 0; }": "1:20: local variable a cannot be volatile",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package sema
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/callgraph"
+)
+
+// The stack has to fit in what's left of SRAM after globals, so how deep it
+// gets must be known, and recursion is nearly always a mistake. When it's
+// intended, one function of each cycle of calls must be declared with the
+// most calls of it there can be at once, eg
+// `fn walk(depth: u8) recursive(8) { ... }`.
+
+// checkRecursion builds the call graph of file, see Info.CallGraph, and
+// reports cycles of calls that aren't declared recursive.
+func (c *checker) checkRecursion(file *ast.File) {
+	var funcs []*ast.FuncDecl
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			funcs = append(funcs, fn)
+			c.recursiveAttrs(fn)
+		}
+	}
+
+	g := callgraph.New(funcs, c.callee, c.outside)
+	c.info.CallGraph = g
+
+	for _, comp := range g.Components {
+		declared := false
+		for _, f := range comp.Funcs {
+			if _, ok := c.info.Recursive[f.Decl]; ok {
+				declared = true
+				if !comp.Recursive {
+					c.diags.Warn(f.Decl.Name.Loc, "%s is declared recursive but doesn't call itself", f.Name())
+				}
+			}
+		}
+		if !comp.Recursive || declared {
+			continue
+		}
+
+		cycle := comp.Cycle()
+		c.diags.Add(cycle[0].Site.Loc, "recursive calls %s; if it's intended, declare %s recursive(N), N the most calls of it at once",
+			callgraph.CycleString(cycle), comp.Funcs[0].Name())
+	}
+}
+
+// recursiveAttrs checks recursive attributes of fn, adding the depth they
+// declare to Info.Recursive.
+func (c *checker) recursiveAttrs(fn *ast.FuncDecl) {
+	for _, attr := range fn.Attrs {
+		if attr.Name.Name != "recursive" {
+			continue
+		}
+
+		var n int64
+		ok := len(attr.Args) == 1
+		if ok {
+			n, ok = constInt(attr.Args[0])
+		}
+		switch {
+		case !ok || n < 1:
+			c.diags.Add(attr.Loc, "recursive takes the most calls there can be at once, eg recursive(8)")
+		case c.info.Recursive[fn] != 0:
+			c.diags.Add(attr.Loc, "%s already declared recursive", fn.Name.Name)
+		default:
+			c.info.Recursive[fn] = n
+		}
+	}
+}
+
+// callee returns function given call calls, or nil if it doesn't call one,
+// eg it's a conversion.
+func (c *checker) callee(call *ast.CallExpr) *ast.FuncDecl {
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	if obj := c.info.Uses[id]; obj != nil && obj.Kind == FuncObj {
+		fn, _ := obj.Decl.(*ast.FuncDecl)
+		return fn
+	}
+	return nil
+}
+
+// outside returns if given call calls a function of an imported module.
+func (c *checker) outside(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && c.info.Uses[id] != nil && c.info.Uses[id].Kind == ModuleObj
+}
@@ -0,0 +1,62 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecursion(t *testing.T) {
+	Convey("Recursion", t, func() {
+		Convey("It builds the call graph", func() {
+			file, diags := parser.ParseString(`
+import "drivers/lcd";
+fn loop() { draw(); put(1); lcd.print(2); draw(); }
+fn draw() { }
+fn put(v: u8) { }`)
+			So(diags, ShouldBeEmpty)
+
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			f := info.CallGraph.Func(file.Decls[1].(*ast.FuncDecl))
+			So(len(f.Calls), ShouldEqual, 3)
+			So(f.Calls[1].Callee.Name(), ShouldEqual, "put")
+			So(len(f.Outside), ShouldEqual, 1)
+		})
+
+		Convey("It reports cycles of calls with their path", func() {
+			So(check("fn f(n: u8) { if n > 0 { f(n - 1); } }").Error(), ShouldEqual,
+				"1:26: recursive calls f -> f; if it's intended, declare f recursive(N), N the most calls of it at once")
+
+			So(check(`
+fn loop() { even(4); }
+fn even(n: u8) -> bool { if n == 0 { return true; } return odd(n - 1); }
+fn odd(n: u8) -> bool { if n == 0 { return false; } return even(n - 1); }`).Error(), ShouldEqual,
+				"3:60: recursive calls even -> odd -> even; if it's intended, declare even recursive(N), N the most calls of it at once")
+		})
+
+		Convey("It accepts cycles with a function declared recursive", func() {
+			file, diags := parser.ParseString(`
+fn even(n: u8) -> bool { if n == 0 { return true; } return odd(n - 1); }
+fn odd(n: u8) -> bool recursive(16) { if n == 0 { return false; } return even(n - 1); }`)
+			So(diags, ShouldBeEmpty)
+
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			So(info.Recursive[file.Decls[1].(*ast.FuncDecl)], ShouldEqual, 16)
+		})
+
+		Convey("It checks recursive attributes", func() {
+			for src, message := range map[string]string{
+				"fn f() recursive { }":                      "1:8: recursive takes the most calls there can be at once, eg recursive(8)",
+				"fn f() recursive(0) { }":                   "1:8: recursive takes the most calls there can be at once, eg recursive(8)",
+				"fn f() recursive(2) recursive(3) { f(); }": "1:21: f already declared recursive",
+				"fn f() recursive(2) { }":                   "1:4: warning: f is declared recursive but doesn't call itself",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
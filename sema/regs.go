@@ -0,0 +1,113 @@
+package sema
+
+import "github.com/sent-hil/bitlang/ast"
+
+// MaxAddr is the highest data space address a register can be at.
+const MaxAddr = 0xffff
+
+// Register is a memory-mapped I/O register, a byte at a fixed data space
+// address, eg PORTB at 0x25. It's used as a u8, and its named bits as bools.
+type Register struct {
+	Name string
+	Addr int64
+	Bits []*RegBit
+}
+
+// RegBit is a named bit of a register.
+type RegBit struct {
+	Name string
+	Bit  int64
+}
+
+// Bit returns bit of register with given name, or nil if there's none.
+func (r *Register) Bit(name string) *RegBit {
+	for _, b := range r.Bits {
+		if b.Name == name {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// Access is a read or write of a register, or of one of its bits.
+type Access struct {
+	Reg *Register
+
+	// Bit is the bit accessed, or nil if it's the whole register.
+	Bit *RegBit
+}
+
+// checkRegs collects registers declared in file, checking their addresses
+// and bits are constants in range, and their bits have distinct names and
+// numbers.
+func (c *checker) checkRegs(file *ast.File) {
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.RegDecl)
+		if !ok {
+			continue
+		}
+
+		// resolve reports registers declared twice
+		if _, ok := c.info.Registers[decl.Name.Name]; ok {
+			continue
+		}
+
+		addr, ok := constInt(decl.Addr)
+		if !ok {
+			c.diags.Add(decl.Addr.Span(), "address of %s must be a constant", decl.Name.Name)
+			continue
+		}
+		if addr < 0 || addr > MaxAddr {
+			c.diags.Add(decl.Addr.Span(), "address %#x of %s out of range, must be 0 to %#x",
+				addr, decl.Name.Name, MaxAddr)
+			continue
+		}
+
+		reg := &Register{Name: decl.Name.Name, Addr: addr}
+		bits := map[int64]string{}
+		for _, b := range decl.Bits {
+			if reg.Bit(b.Name.Name) != nil {
+				c.diags.Add(b.Name.Loc, "duplicate bit %s in register %s", b.Name.Name, reg.Name)
+				continue
+			}
+
+			n, ok := constInt(b.Bit)
+			switch {
+			case !ok:
+				c.diags.Add(b.Bit.Span(), "bit of %s must be a constant", b.Name.Name)
+				continue
+			case n < 0 || n > 7:
+				c.diags.Add(b.Bit.Span(), "bit %d of %s out of range, must be 0 to 7", n, b.Name.Name)
+				continue
+			}
+			if prev, ok := bits[n]; ok {
+				c.diags.Add(b.Loc, "%s is same bit %d as %s", b.Name.Name, n, prev)
+				continue
+			}
+
+			bits[n] = b.Name.Name
+			reg.Bits = append(reg.Bits, &RegBit{Name: b.Name.Name, Bit: n})
+		}
+
+		c.info.Registers[reg.Name] = reg
+	}
+}
+
+// regBit checks a selector of a bit of register obj, which is used as a
+// bool.
+func (t *typer) regBit(sel *ast.SelectorExpr, obj *Object) Type {
+	reg := t.info.Registers[obj.Name]
+	if reg == nil || obj.Type == nil {
+		return Typ[Invalid]
+	}
+	t.info.Types[sel.X] = obj.Type
+
+	b := reg.Bit(sel.Sel.Name)
+	if b == nil {
+		t.diags.Add(sel.Sel.Loc, "register %s has no bit %s", reg.Name, sel.Sel.Name)
+		return Typ[Invalid]
+	}
+	t.info.Accesses[sel] = &Access{Reg: reg, Bit: b}
+	return Typ[Bool]
+}
@@ -0,0 +1,78 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegs(t *testing.T) {
+	Convey("Regs", t, func() {
+		Convey("It collects registers and their bits", func() {
+			file, _ := parser.ParseString(`
+reg PORTB @ 0x25 { PB0: bit 0, PB5: bit 5 }
+reg TIMSK0 @ 0x6e;
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			portb := info.Registers["PORTB"]
+			So(portb.Addr, ShouldEqual, 0x25)
+			So(portb.Bit("PB5").Bit, ShouldEqual, 5)
+			So(portb.Bit("PB1"), ShouldBeNil)
+			So(info.Registers["TIMSK0"].Bits, ShouldBeEmpty)
+		})
+
+		Convey("It records accesses of registers and bits", func() {
+			file, _ := parser.ParseString(`
+reg PORTB @ 0x25 { PB5: bit 5 }
+reg PINB @ 0x23 { PINB5: bit 5 }
+fn blink() {
+  PORTB.PB5 = !PINB.PINB5;
+  var x: u16 = PORTB;
+  PORTB = PORTB | 1;
+}`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			var accesses []string
+			ast.Inspect(file, func(n ast.Node) bool {
+				if x, ok := n.(ast.Expr); ok && info.Accesses[x] != nil {
+					a := info.Accesses[x]
+					name := a.Reg.Name
+					if a.Bit != nil {
+						name += "." + a.Bit.Name
+					}
+					accesses = append(accesses, name+" "+info.Types[x].String())
+					return false
+				}
+				return true
+			})
+			So(accesses, ShouldResemble, []string{
+				"PORTB.PB5 bool", "PINB.PINB5 bool", "PORTB u8", "PORTB u8", "PORTB u8",
+			})
+		})
+
+		Convey("It doesn't fold reads of registers", func() {
+			So(check("reg PINB @ 0x23; const X = PINB;").Error(), ShouldEqual,
+				"1:28: PINB is not constant")
+		})
+
+		Convey("It reports bad registers", func() {
+			for src, message := range map[string]string{
+				"var a = 1; reg R @ a;":                            "1:20: address of R must be a constant",
+				"reg R @ 0x10000;":                                 "1:9: address 0x10000 of R out of range, must be 0 to 0xffff",
+				"reg R @ 0x25 { A: bit 8 }":                        "1:23: bit 8 of A out of range, must be 0 to 7",
+				"reg R @ 0x25 { A: bit 1, A: bit 2 }":              "1:26: duplicate bit A in register R",
+				"reg R @ 0x25 { A: bit 1, B: bit 1 }":              "1:26: B is same bit 1 as A",
+				"reg R @ 0x25 { A: bit 1 } fn f() { R.B = true; }": "1:38: register R has no bit B",
+				"reg R @ 0x25 { A: bit 1 } fn f() { R.A = 1; }":    "1:42: cannot use 1 (untyped int constant) as bool value in assignment",
+				"reg R @ 0x25; fn f() { R = 256; }":                "1:28: constant 256 overflows u8",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+	})
+}
@@ -0,0 +1,290 @@
+package sema
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/sent-hil/bitlang/ast"
+)
+
+// resolver binds names to their declarations. Top level names are visible in
+// the whole file; names in functions are visible from their declaration to
+// the end of the block they're in.
+type resolver struct {
+	*checker
+	scope *Scope
+}
+
+func (c *checker) resolve(file *ast.File) {
+	r := &resolver{checker: c}
+	r.open(file)
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.ImportDecl:
+			// imported modules are checked by the module loader; they're
+			// declared so qualified names resolve
+			if decl.Name != nil {
+				continue
+			}
+			name := path.Base(decl.Path.Value)
+			r.declare(&Object{Kind: ModuleObj, Name: name, Decl: decl}, decl.Path)
+		case *ast.VarDecl:
+			r.declare(&Object{Kind: VarObj, Name: decl.Name.Name, Ident: decl.Name, Decl: decl}, nil)
+		case *ast.ConstDecl:
+			r.declare(&Object{Kind: ConstObj, Name: decl.Name.Name, Ident: decl.Name, Decl: decl}, nil)
+		case *ast.FuncDecl:
+			r.declare(&Object{Kind: FuncObj, Name: decl.Name.Name, Ident: decl.Name, Decl: decl}, nil)
+		case *ast.StructDecl:
+			r.declare(&Object{Kind: TypeObj, Name: decl.Name.Name, Ident: decl.Name, Decl: decl}, nil)
+		case *ast.EnumDecl:
+			r.declare(&Object{Kind: TypeObj, Name: decl.Name.Name, Ident: decl.Name, Decl: decl}, nil)
+		case *ast.RegDecl:
+			r.declare(&Object{Kind: RegObj, Name: decl.Name.Name, Ident: decl.Name, Decl: decl}, nil)
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.VarDecl:
+			r.expr(decl.Type)
+			r.expr(decl.Value)
+		case *ast.ConstDecl:
+			r.expr(decl.Type)
+			r.expr(decl.Value)
+		case *ast.FuncDecl:
+			r.funcDecl(decl)
+		case *ast.StructDecl:
+			for _, f := range decl.Fields {
+				r.expr(f.Type)
+			}
+		case *ast.EnumDecl:
+			for _, m := range decl.Members {
+				r.expr(m.Value)
+			}
+		case *ast.RegDecl:
+			r.expr(decl.Addr)
+			for _, b := range decl.Bits {
+				r.expr(b.Bit)
+			}
+		}
+	}
+}
+
+func (r *resolver) funcDecl(fn *ast.FuncDecl) {
+	for _, p := range fn.Params {
+		r.expr(p.Type)
+	}
+	r.expr(fn.Result)
+
+	r.open(fn)
+	for _, p := range fn.Params {
+		// checkFunc reports duplicate parameters
+		if r.scope.Lookup(p.Name.Name) == nil {
+			r.declare(&Object{Kind: ParamObj, Name: p.Name.Name, Ident: p.Name, Decl: p}, nil)
+		}
+	}
+	r.stmts(fn.Body.Stmts)
+	r.close()
+}
+
+// open opens a new scope for given node.
+func (r *resolver) open(node ast.Node) {
+	parent := r.scope
+	if parent == nil {
+		parent = Universe
+	}
+
+	r.scope = NewScope(parent)
+	r.info.Scopes[node] = r.scope
+}
+
+func (r *resolver) close() {
+	r.scope = r.scope.parent
+}
+
+// declare declares object in current scope, reporting names already declared
+// in it and names that shadow a declaration in an enclosing scope. Node is
+// where to report problems if object has no Ident.
+func (r *resolver) declare(obj *Object, node ast.Node) {
+	if obj.Ident != nil {
+		r.info.Defs[obj.Ident] = obj
+		node = obj.Ident
+	}
+
+	if prev := r.scope.Insert(obj); prev != nil {
+		r.diags.Add(node.Span(), "%s already declared%s", obj.Name, at(prev))
+		return
+	}
+
+	if s, prev := r.scope.parent.LookupParent(obj.Name); s != nil && s != Universe {
+		r.diags.Warn(node.Span(), "%s shadows %s declared%s", obj.Name, prev.Kind, at(prev))
+	}
+}
+
+// at returns where given object is declared, for messages.
+func at(obj *Object) string {
+	if obj.Ident == nil {
+		return ""
+	}
+	return fmt.Sprintf(" at %s", obj.Ident.Loc)
+}
+
+func (r *resolver) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		r.stmt(stmt)
+	}
+}
+
+func (r *resolver) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.VarDecl:
+		// value is resolved before the name is declared, so `var x = x`
+		// refers to an outer x
+		r.expr(stmt.Type)
+		r.expr(stmt.Value)
+		r.declare(&Object{Kind: VarObj, Name: stmt.Name.Name, Ident: stmt.Name, Decl: stmt}, nil)
+	case *ast.ConstDecl:
+		r.expr(stmt.Type)
+		r.expr(stmt.Value)
+		r.declare(&Object{Kind: ConstObj, Name: stmt.Name.Name, Ident: stmt.Name, Decl: stmt}, nil)
+	case *ast.AssignStmt:
+		r.expr(stmt.Target)
+		r.expr(stmt.Value)
+	case *ast.ExprStmt:
+		r.expr(stmt.X)
+	case *ast.BlockStmt:
+		r.open(stmt)
+		r.stmts(stmt.Stmts)
+		r.close()
+	case *ast.IfStmt:
+		r.expr(stmt.Cond)
+		r.stmt(stmt.Then)
+		if stmt.Else != nil {
+			r.stmt(stmt.Else)
+		}
+	case *ast.ForStmt:
+		r.open(stmt)
+		if stmt.Init != nil {
+			r.stmt(stmt.Init)
+		}
+		r.expr(stmt.Cond)
+		if stmt.Post != nil {
+			r.stmt(stmt.Post)
+		}
+		r.stmt(stmt.Body)
+		r.close()
+	case *ast.WhileStmt:
+		r.expr(stmt.Cond)
+		r.stmt(stmt.Body)
+	case *ast.LoopStmt:
+		r.stmt(stmt.Body)
+	case *ast.AtomicStmt:
+		r.stmt(stmt.Body)
+	case *ast.LabeledStmt:
+		r.stmt(stmt.Stmt)
+	case *ast.SwitchStmt:
+		r.expr(stmt.Tag)
+		for _, clause := range stmt.Cases {
+			for _, value := range clause.Values {
+				r.expr(value)
+			}
+			r.stmt(clause.Body)
+		}
+	case *ast.ReturnStmt:
+		r.expr(stmt.Value)
+	case *ast.BranchStmt, *ast.BadStmt:
+		// labels are checked by checkLoops
+	default:
+		panic(fmt.Sprintf("resolver: unexpected statement %T", stmt))
+	}
+}
+
+// expr resolves names used in given expression, which can be nil. Names
+// after a dot are fields or members, so they're left for type checking.
+func (r *resolver) expr(x ast.Expr) {
+	if x == nil {
+		return
+	}
+
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			r.use(n)
+		case *ast.SelectorExpr:
+			r.expr(n.X)
+			return false
+		}
+		return true
+	})
+}
+
+func (r *resolver) use(id *ast.Ident) {
+	if _, obj := r.scope.LookupParent(id.Name); obj != nil {
+		r.info.Uses[id] = obj
+		return
+	}
+
+	if suggestion := r.suggest(id.Name); suggestion != "" {
+		r.diags.Add(id.Loc, "undefined: %s, did you mean %s?", id.Name, suggestion)
+		return
+	}
+	r.diags.Add(id.Loc, "undefined: %s", id.Name)
+}
+
+// suggest returns the visible name closest to given misspelled one, or ""
+// if none is close enough, ie within an edit for every three letters. Ties go
+// to the innermost scope, then in alphabetical order.
+func (r *resolver) suggest(name string) string {
+	best, bestDist := "", len(name)/3+1
+	if bestDist < 2 {
+		bestDist = 2
+	}
+
+	for s := r.scope; s != nil; s = s.parent {
+		for _, candidate := range s.Names() {
+			d := editDistance(name, candidate)
+			if d < bestDist && d < len(name) && d < len(candidate) {
+				best, bestDist = candidate, d
+			}
+		}
+	}
+
+	return best
+}
+
+// editDistance returns how many edits turn a into b, where an edit is
+// inserting, deleting or changing a letter, or swapping two adjacent ones.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
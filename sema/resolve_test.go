@@ -0,0 +1,103 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolve(t *testing.T) {
+	Convey("Resolve", t, func() {
+		Convey("It links uses of names to their declarations", func() {
+			file, _ := parser.ParseString(`
+var led: u8 = 13;
+fn blink(pin: u8) { var on = true; write(pin, on); }
+fn write(pin: u8, on: bool) { }
+fn loop() { blink(led); }
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			uses := map[string]*Object{}
+			for id, obj := range info.Uses {
+				uses[id.Name+"@"+id.Loc.String()] = obj
+			}
+			So(uses["u8@2:10"], ShouldEqual, Universe.Lookup("u8"))
+			So(uses["pin@3:42"].Kind, ShouldEqual, ParamObj)
+			So(uses["on@3:47"].Decl, ShouldHaveSameTypeAs, &ast.VarDecl{})
+			So(uses["write@3:36"].Decl, ShouldEqual, file.Decls[2])
+			So(uses["led@5:19"].Ident.Loc.String(), ShouldEqual, "2:5")
+		})
+
+		Convey("It opens a scope per block", func() {
+			file, _ := parser.ParseString(`
+fn f() {
+  for var i = 0; i < 3; i = i + 1 { var x = i; }
+  if true { var x = 1; }
+  x = 2;
+}`)
+			info, diags := Check(file, nil)
+			So(diags.Error(), ShouldEqual, "5:3: undefined: x")
+
+			fn := file.Decls[0].(*ast.FuncDecl)
+			scope := info.Scopes[fn.Body.Stmts[0]]
+			So(scope.Names(), ShouldResemble, []string{"i"})
+			So(scope.Parent(), ShouldEqual, info.Scopes[fn])
+			So(scope.Parent().Parent(), ShouldEqual, info.Scopes[file])
+			So(info.Scopes[file].Parent(), ShouldEqual, Universe)
+		})
+
+		Convey("It resolves value of a declaration before the name", func() {
+			diags := check("fn f(x: u8) { if true { var x = x; } }")
+			So(diags.Error(), ShouldEqual,
+				"1:29: warning: x shadows parameter declared at 1:6")
+		})
+
+		Convey("It suggests similar names for undefined ones", func() {
+			diags := check(`
+fn blink() { }
+fn loop() { var count = 0; blnk(); cuont = 1; poll(); }
+`)
+			So(diags.Error(), ShouldEqual, "3:28: undefined: blnk, did you mean blink?\n"+
+				"3:36: undefined: cuont, did you mean count?\n"+
+				"3:47: undefined: poll")
+		})
+
+		Convey("It reports names declared twice in a scope", func() {
+			So(check("var a = 1; fn a() {}").Error(), ShouldEqual, "1:15: a already declared at 1:5")
+			So(check("fn f(a: u8) { var a = 1; }").Error(), ShouldEqual,
+				"1:19: a already declared at 1:6")
+		})
+
+		Convey("It warns about names that shadow outer ones", func() {
+			diags := check("var count = 0; fn f() { var count = 1; }")
+			So(diags.Error(), ShouldEqual,
+				"1:29: warning: count shadows variable declared at 1:5")
+			So(diags.Err(), ShouldBeNil)
+		})
+
+		Convey("It doesn't warn about shadowing builtins", func() {
+			So(check("fn f(len: u8) { }"), ShouldBeEmpty)
+		})
+
+		Convey("It resolves only the left of selectors", func() {
+			So(check(`
+import "drivers/lcd";
+enum State { Idle }
+fn f() { lcd.Print(State.Idle); }
+`), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestEditDistance(t *testing.T) {
+	Convey("editDistance", t, func() {
+		So(editDistance("", "abc"), ShouldEqual, 3)
+		So(editDistance("blink", "blink"), ShouldEqual, 0)
+		So(editDistance("blnk", "blink"), ShouldEqual, 1)
+		So(editDistance("cuont", "count"), ShouldEqual, 1)
+		So(editDistance("kitten", "sitting"), ShouldEqual, 3)
+	})
+}
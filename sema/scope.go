@@ -0,0 +1,117 @@
+package sema
+
+import (
+	"sort"
+
+	"github.com/sent-hil/bitlang/ast"
+)
+
+// ObjKind is what an object is.
+type ObjKind int
+
+const (
+	VarObj ObjKind = iota
+	ConstObj
+	ParamObj
+	FuncObj
+	TypeObj
+	ModuleObj
+	BuiltinObj
+	RegObj
+)
+
+var objKindNames = map[ObjKind]string{
+	VarObj:     "variable",
+	ConstObj:   "constant",
+	ParamObj:   "parameter",
+	FuncObj:    "function",
+	TypeObj:    "type",
+	ModuleObj:  "module",
+	BuiltinObj: "builtin",
+	RegObj:     "register",
+}
+
+func (k ObjKind) String() string { return objKindNames[k] }
+
+// Object is what a name is declared as.
+type Object struct {
+	Kind ObjKind
+	Name string
+
+	// Ident is the name in its declaration, and Decl the declaration; both
+	// are nil for builtins.
+	Ident *ast.Ident
+	Decl  ast.Node
+
+	// Type is type of the value, or the type a type name stands for. It's
+	// nil for builtin functions, and till the type checker gets to it.
+	Type Type
+}
+
+// Scope maps names to objects declared in a block of source. Names not found
+// in a scope are looked up in its parent.
+type Scope struct {
+	parent  *Scope
+	objects map[string]*Object
+}
+
+// NewScope returns an empty scope inside given parent, which is nil for the
+// outermost scope.
+func NewScope(parent *Scope) *Scope {
+	return &Scope{parent: parent, objects: map[string]*Object{}}
+}
+
+// Parent returns the enclosing scope, or nil for Universe.
+func (s *Scope) Parent() *Scope { return s.parent }
+
+// Lookup returns object with given name declared in this scope, or nil.
+func (s *Scope) Lookup(name string) *Object { return s.objects[name] }
+
+// LookupParent returns object with given name in this scope or the innermost
+// enclosing one that declares it, along with that scope.
+func (s *Scope) LookupParent(name string) (*Scope, *Object) {
+	for ; s != nil; s = s.parent {
+		if obj, ok := s.objects[name]; ok {
+			return s, obj
+		}
+	}
+
+	return nil, nil
+}
+
+// Insert declares given object in scope. If the name is already declared in
+// it, it returns that object instead and leaves scope as is.
+func (s *Scope) Insert(obj *Object) *Object {
+	if prev, ok := s.objects[obj.Name]; ok {
+		return prev
+	}
+
+	s.objects[obj.Name] = obj
+	return nil
+}
+
+// Names returns names declared in this scope, sorted.
+func (s *Scope) Names() []string {
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Universe is the scope of builtin types and functions, outside every file.
+var Universe = NewScope(nil)
+
+func init() {
+	for kind := Bool; kind <= I32; kind++ {
+		Universe.Insert(&Object{Kind: TypeObj, Name: Typ[kind].Name, Type: Typ[kind]})
+	}
+	Universe.Insert(&Object{Kind: TypeObj, Name: "f32", Type: Typ[F32]})
+	for _, f := range FixedTypes {
+		Universe.Insert(&Object{Kind: TypeObj, Name: f.Name, Type: f})
+	}
+	Universe.Insert(&Object{Kind: BuiltinObj, Name: "len"})
+	Universe.Insert(&Object{Kind: BuiltinObj, Name: "bit"})
+}
@@ -0,0 +1,188 @@
+package sema
+
+import (
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/callgraph"
+	"github.com/sent-hil/bitlang/cfg"
+	"github.com/sent-hil/bitlang/diag"
+	"github.com/sent-hil/bitlang/layout"
+)
+
+// Config configures the checks.
+type Config struct {
+	// BoundsCheck makes indexes into arrays that can't be checked at compile
+	// time be checked at runtime; see Info.BoundsChecks.
+	BoundsCheck bool
+
+	// PanicHandler is the function called when a runtime check fails. It must
+	// take no parameters and return nothing. If empty, DefaultPanicHandler
+	// provided by the runtime is used.
+	PanicHandler string
+
+	// Unused enables warnings about locals, parameters and imports that are
+	// never used, and values assigned to locals that are never read. Names
+	// starting with _ and modules imported as _ aren't reported.
+	Unused bool
+
+	// SoftFloat enables f32, which is emulated in software since AVR has no
+	// FPU. Fixed-point types are smaller and faster, so it's off by default.
+	SoftFloat bool
+}
+
+// DefaultPanicHandler is the runtime's handler for failed runtime checks; it
+// disables interrupts and halts.
+const DefaultPanicHandler = "__bitlang_panic"
+
+// Info is what checks found out about a file, for use by later passes.
+type Info struct {
+	// BoundsChecks are index expressions that have to be checked at runtime,
+	// with length of the array they index. It's only filled in if
+	// Config.BoundsCheck is set.
+	BoundsChecks map[*ast.IndexExpr]int64
+
+	// PanicHandler is the function to call when a runtime check fails.
+	PanicHandler string
+
+	// Lens are calls of builtin len, with the length they evaluate to.
+	Lens map[*ast.CallExpr]int64
+
+	// Enums are enums declared in the file, keyed by name.
+	Enums map[string]*Enum
+
+	// Registers are memory-mapped I/O registers declared in the file, keyed
+	// by name.
+	Registers map[string]*Register
+
+	// Accesses are reads and writes of registers, as their names or
+	// selectors of their bits. They're volatile: later passes must keep
+	// every one of them, in order.
+	Accesses map[ast.Expr]*Access
+
+	// Interrupts are interrupt handlers, with the vectors they handle.
+	Interrupts map[*ast.FuncDecl]string
+
+	// Volatile are global variables declared volatile. Like accesses of
+	// registers, later passes must keep every read and write of them, in
+	// order.
+	Volatile map[*Object]bool
+
+	// AtomicExits are returns, breaks and continues that leave atomic
+	// blocks, with how many they leave. Interrupts must be restored as they
+	// were before the outermost of them on the way out.
+	AtomicExits map[ast.Stmt]int
+
+	// CallGraph is the graph of calls between functions of the file.
+	CallGraph *callgraph.Graph
+
+	// Recursive are functions declared recursive(N), with N, the most calls
+	// of them there can be at once.
+	Recursive map[*ast.FuncDecl]int64
+
+	// Layouts are memory layouts of structs that could be laid out.
+	Layouts layout.Layouts
+
+	// CFGs are control-flow graphs of function bodies.
+	CFGs map[*ast.FuncDecl]*cfg.Graph
+
+	// Switches are switch statements, with values of their cases.
+	Switches map[*ast.SwitchStmt]*Switch
+
+	// Defs are names in declarations, with the objects they declare.
+	Defs map[*ast.Ident]*Object
+
+	// Uses are names used in expressions and types, with the objects they
+	// refer to. Names after a dot, eg fields, aren't in it.
+	Uses map[*ast.Ident]*Object
+
+	// Scopes are scopes opened by files, functions, blocks and for loops.
+	Scopes map[ast.Node]*Scope
+
+	// Types are types of expressions. Integer constants have the type
+	// they're used as, or DefaultInt.
+	Types map[ast.Expr]Type
+
+	// Values are values of integer and fixed-point constant expressions;
+	// fixed-point ones are as stored, see Fixed.Raw.
+	Values map[ast.Expr]int64
+
+	// Floats are values of untyped float and f32 constant expressions.
+	Floats map[ast.Expr]float64
+}
+
+// checker runs semantic checks over a file, collecting problems found.
+type checker struct {
+	config *Config
+	info   *Info
+	diags  diag.List
+
+	funcs map[string]*ast.FuncDecl
+
+	// globals are top level variable declarations.
+	globals map[*ast.VarDecl]bool
+}
+
+// Check runs semantic checks over given parsed file and returns what it
+// found out about it, along with problems found in it. Config can be nil.
+func Check(file *ast.File, config *Config) (*Info, diag.List) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	c := &checker{
+		config: config,
+		info: &Info{
+			BoundsChecks: map[*ast.IndexExpr]int64{},
+			Lens:         map[*ast.CallExpr]int64{},
+			Enums:        map[string]*Enum{},
+			Registers:    map[string]*Register{},
+			Accesses:     map[ast.Expr]*Access{},
+			Interrupts:   map[*ast.FuncDecl]string{},
+			Volatile:     map[*Object]bool{},
+			AtomicExits:  map[ast.Stmt]int{},
+			Recursive:    map[*ast.FuncDecl]int64{},
+			CFGs:         map[*ast.FuncDecl]*cfg.Graph{},
+			Switches:     map[*ast.SwitchStmt]*Switch{},
+			Defs:         map[*ast.Ident]*Object{},
+			Uses:         map[*ast.Ident]*Object{},
+			Scopes:       map[ast.Node]*Scope{},
+			Types:        map[ast.Expr]Type{},
+			Values:       map[ast.Expr]int64{},
+			Floats:       map[ast.Expr]float64{},
+		},
+		funcs: map[string]*ast.FuncDecl{},
+	}
+
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			c.funcs[fn.Name.Name] = fn
+		}
+	}
+
+	c.resolve(file)
+	c.checkPanicHandler(file)
+	c.checkEnums(file)
+	c.checkRegs(file)
+	c.checkInterrupts(file)
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			c.checkFunc(decl)
+			c.checkSwitches(decl)
+			c.checkLoops(decl)
+		}
+	}
+	c.checkTypes(file)
+	c.checkLayouts(file)
+	c.checkImports(file)
+	c.checkRecursion(file)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			// after checkTypes, so constant conditions are known
+			c.checkFlow(fn)
+			c.checkAssigns(fn)
+		}
+	}
+	c.checkRaces(file)
+
+	return c.info, c.diags
+}
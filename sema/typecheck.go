@@ -0,0 +1,957 @@
+package sema
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/avr"
+	"github.com/sent-hil/bitlang/token"
+)
+
+// typer infers types of expressions and checks values are used as values of
+// their type. Integers of one type are only used as another without a
+// conversion if every value fits, eg u8 as u16 but not u16 as u8.
+type typer struct {
+	*checker
+
+	// result is the result type of the function being checked, or nil.
+	result Type
+
+	// inits are global variables whose types are being inferred, to report
+	// ones whose value refers to themselves.
+	inits map[*Object]bool
+}
+
+func (c *checker) checkTypes(file *ast.File) {
+	t := &typer{checker: c, inits: map[*Object]bool{}}
+
+	// struct and enum types are created before any type is resolved, so
+	// declarations can refer to types declared after them
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.StructDecl:
+			if obj := c.info.Defs[decl.Name]; obj != nil {
+				obj.Type = &Struct{Name: decl.Name.Name}
+			}
+		case *ast.EnumDecl:
+			if obj := c.info.Defs[decl.Name]; obj != nil {
+				obj.Type = c.info.Enums[decl.Name.Name]
+			}
+		case *ast.RegDecl:
+			if obj := c.info.Defs[decl.Name]; obj != nil && c.info.Registers[decl.Name.Name] != nil {
+				obj.Type = Typ[U8]
+			}
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.StructDecl:
+			s, ok := c.info.Defs[decl.Name].Type.(*Struct)
+			if !ok {
+				continue
+			}
+			for _, f := range decl.Fields {
+				s.Fields = append(s.Fields, &StructField{Name: f.Name.Name, Type: t.typeOf(f.Type)})
+			}
+		case *ast.FuncDecl:
+			sig := &Func{}
+			for _, p := range decl.Params {
+				typ := t.typeOf(p.Type)
+				sig.Params = append(sig.Params, typ)
+				if obj := c.info.Defs[p.Name]; obj != nil {
+					obj.Type = typ
+				}
+			}
+			if decl.Result != nil {
+				sig.Result = t.typeOf(decl.Result)
+			}
+			c.info.Defs[decl.Name].Type = sig
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.VarDecl:
+			t.varDecl(decl)
+		case *ast.ConstDecl:
+			t.constDecl(decl)
+		case *ast.FuncDecl:
+			t.result = c.info.Defs[decl.Name].Type.(*Func).Result
+			t.stmts(decl.Body.Stmts)
+		}
+	}
+}
+
+// typeOf returns the type given type expression stands for.
+func (t *typer) typeOf(x ast.Expr) Type {
+	switch x := x.(type) {
+	case *ast.Ident:
+		obj := t.info.Uses[x]
+		if obj == nil {
+			return Typ[Invalid]
+		}
+		if obj.Kind != TypeObj || obj.Type == nil {
+			t.diags.Add(x.Loc, "%s is not a type", x.Name)
+			return Typ[Invalid]
+		}
+		t.checkSoftFloat(x, obj.Type)
+		return obj.Type
+	case *ast.ArrayType:
+		elem := t.typeOf(x.Elem)
+		n, ok := t.arrayLen(x)
+		if !ok {
+			return Typ[Invalid]
+		}
+		arr := &Array{Len: n, Elem: elem}
+		t.info.Types[x] = arr
+		return arr
+	case *ast.SelectorExpr:
+		// types of imported modules are checked by the module loader
+		return Typ[Invalid]
+	}
+
+	t.diags.Add(x.Span(), "%s is not a type", ast.ExprString(x))
+	return Typ[Invalid]
+}
+
+// checkSoftFloat reports uses of f32 when soft float isn't enabled.
+func (t *typer) checkSoftFloat(x ast.Expr, typ Type) {
+	if isKind(typ, F32) && !t.config.SoftFloat {
+		t.diags.Add(x.Span(), "f32 needs soft float, which isn't enabled; use a fixed-point type like q8.8")
+	}
+}
+
+func (t *typer) varDecl(decl *ast.VarDecl) {
+	obj := t.info.Defs[decl.Name]
+	if obj == nil || obj.Type != nil {
+		return
+	}
+
+	t.inits[obj] = true
+	defer delete(t.inits, obj)
+
+	var typ Type
+	switch {
+	case decl.Type != nil:
+		typ = t.typeOf(decl.Type)
+		if decl.Value != nil {
+			t.assign(decl.Value, typ, "variable declaration")
+		}
+	case decl.Value != nil:
+		typ = t.infer(decl.Value)
+	default:
+		t.diags.Add(decl.Name.Loc, "%s needs a type or a value", decl.Name.Name)
+		typ = Typ[Invalid]
+	}
+
+	obj.Type = typ
+}
+
+// infer returns type of a variable initialized with given value.
+func (t *typer) infer(x ast.Expr) Type {
+	lit, ok := x.(*ast.ArrayLit)
+	if !ok {
+		return t.defaultType(x, t.value(x))
+	}
+
+	if len(lit.Elems) == 0 {
+		t.diags.Add(lit.Loc, "cannot infer type of empty array literal")
+		return Typ[Invalid]
+	}
+
+	elem := t.infer(lit.Elems[0])
+	for _, e := range lit.Elems[1:] {
+		t.assign(e, elem, "array literal")
+	}
+
+	typ := &Array{Len: int64(len(lit.Elems)), Elem: elem}
+	t.info.Types[lit] = typ
+	return typ
+}
+
+// defaultType gives integer constant x of type typ DefaultInt, and float
+// constants f32 if soft float is enabled. There's no default fixed-point
+// type, since which one fits depends on the range and precision needed.
+func (t *typer) defaultType(x ast.Expr, typ Type) Type {
+	switch {
+	case isKind(typ, UntypedInt):
+		t.convertUntyped(x, DefaultInt)
+		return DefaultInt
+	case isKind(typ, UntypedFloat) && t.config.SoftFloat:
+		t.convertUntyped(x, Typ[F32])
+		return Typ[F32]
+	case isKind(typ, UntypedFloat):
+		t.diags.Add(x.Span(), "cannot infer type of %s, declare it with a fixed-point type like q8.8",
+			ast.ExprString(x))
+		return Typ[Invalid]
+	}
+
+	return typ
+}
+
+// assign checks x can be used as a value of type to; context says how it's
+// used, for messages.
+func (t *typer) assign(x ast.Expr, to Type, context string) {
+	if lit, ok := x.(*ast.ArrayLit); ok {
+		if arr, ok := to.(*Array); ok {
+			t.arrayLit(lit, arr)
+			return
+		}
+	}
+
+	from := t.value(x)
+	if isKind(from, Invalid) || isKind(to, Invalid) || Identical(from, to) {
+		return
+	}
+
+	if isUntyped(from) {
+		if IsNumeric(to) && !isUntyped(to) {
+			t.convertUntyped(x, to)
+			return
+		}
+		t.diags.Add(x.Span(), "cannot use %s (%s constant) as %s value in %s",
+			ast.ExprString(x), from, to, context)
+		return
+	}
+
+	if IsNumeric(from) && IsNumeric(to) {
+		if !widens(from, to) {
+			t.diags.Add(x.Span(), "cannot use %s (%s) as %s value in %s without a conversion",
+				ast.ExprString(x), from, to, context)
+		}
+		return
+	}
+
+	t.diags.Add(x.Span(), "cannot use %s (%s) as %s value in %s",
+		ast.ExprString(x), from, to, context)
+}
+
+// widens returns if numeric type from can be used as to without a
+// conversion: integers and fixed-point types that hold all its values.
+func widens(from, to Type) bool {
+	if Identical(from, to) {
+		return true
+	}
+
+	if ff, ok := from.(*Fixed); ok {
+		tf, ok := to.(*Fixed)
+		return ok && ff.Widens(tf)
+	}
+
+	fb, ok1 := from.(*Basic)
+	tb, ok2 := to.(*Basic)
+	return ok1 && ok2 && IsInteger(fb) && IsInteger(tb) && Widens(fb, tb)
+}
+
+// convertUntyped gives constant x numeric type to, reporting if its value
+// doesn't fit. Decimal constants are rounded to the nearest fixed-point
+// value, and only convert to integers if they're whole.
+func (t *typer) convertUntyped(x ast.Expr, to Type) bool {
+	v, whole := t.constant(x), isKind(t.info.Types[x], UntypedInt)
+
+	switch to := to.(type) {
+	case *Fixed:
+		if _, ok := to.Raw(v); !ok {
+			t.diags.Add(x.Span(), "constant %s overflows %s", t.constString(x), to)
+			return false
+		}
+	case *Basic:
+		switch {
+		case to.Kind == F32:
+			if math.Abs(v) > math.MaxFloat32 {
+				t.diags.Add(x.Span(), "constant %s overflows f32", t.constString(x))
+				return false
+			}
+		case !whole && v != math.Trunc(v):
+			t.diags.Add(x.Span(), "constant %s truncated to integer", t.constString(x))
+			return false
+		case !whole && !Representable(int64(v), to):
+			t.diags.Add(x.Span(), "constant %s overflows %s", t.constString(x), to)
+			return false
+		case whole && !Representable(t.info.Values[x], to):
+			t.diags.Add(x.Span(), "constant %s overflows %s", t.constString(x), to)
+			return false
+		}
+	}
+
+	t.setType(x, to)
+	return true
+}
+
+// constant returns value of untyped constant x.
+func (t *typer) constant(x ast.Expr) float64 {
+	if v, ok := t.info.Floats[x]; ok {
+		return v
+	}
+	return float64(t.info.Values[x])
+}
+
+// constString formats value of constant x for messages.
+func (t *typer) constString(x ast.Expr) string {
+	_, fixed := t.info.Types[x].(*Fixed)
+	if _, ok := t.info.Floats[x]; !ok && !fixed {
+		return strconv.FormatInt(t.info.Values[x], 10)
+	}
+	return strconv.FormatFloat(t.real(x), 'g', -1, 64)
+}
+
+// copyConstant records value of constant from as that of x.
+func (t *typer) copyConstant(x, from ast.Expr) {
+	if v, ok := t.info.Values[from]; ok {
+		t.info.Values[x] = v
+	}
+	if v, ok := t.info.Floats[from]; ok {
+		t.info.Floats[x] = v
+	}
+}
+
+// setType records type of untyped x and the constants it's made of, and
+// their values as stored in that type.
+func (t *typer) setType(x ast.Expr, typ Type) {
+	from := t.info.Types[x]
+	if !isUntyped(from) {
+		return
+	}
+
+	v := t.constant(x)
+	switch typ := typ.(type) {
+	case *Fixed:
+		t.info.Values[x], _ = typ.Raw(v)
+		delete(t.info.Floats, x)
+	case *Basic:
+		if typ.Kind == F32 {
+			t.info.Floats[x] = v
+			delete(t.info.Values, x)
+		} else if isKind(from, UntypedFloat) {
+			t.info.Values[x] = int64(v)
+			delete(t.info.Floats, x)
+		}
+	}
+
+	t.info.Types[x] = typ
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		t.setType(x.X, typ)
+	case *ast.UnaryExpr:
+		t.setType(x.X, typ)
+	case *ast.BinaryExpr:
+		t.setType(x.X, typ)
+		t.setType(x.Y, typ)
+	}
+}
+
+// value checks x is an expression with a value and returns its type.
+func (t *typer) value(x ast.Expr) Type {
+	typ := t.expr(x)
+	if typ == nil {
+		t.diags.Add(x.Span(), "%s (no value) used as value", ast.ExprString(x))
+		typ = Typ[Invalid]
+	}
+
+	t.info.Types[x] = typ
+	return typ
+}
+
+// expr returns type of given expression, or nil for calls of functions that
+// return nothing.
+func (t *typer) expr(x ast.Expr) Type {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return t.basicLit(x)
+	case *ast.Ident:
+		return t.ident(x)
+	case *ast.ParenExpr:
+		typ := t.value(x.X)
+		t.copyConstant(x, x.X)
+		return typ
+	case *ast.UnaryExpr:
+		return t.unary(x)
+	case *ast.BinaryExpr:
+		return t.binary(x)
+	case *ast.CallExpr:
+		typ := t.call(x)
+		if typ != nil {
+			t.info.Types[x] = typ
+		}
+		return typ
+	case *ast.SelectorExpr:
+		return t.selector(x)
+	case *ast.IndexExpr:
+		return t.index(x)
+	case *ast.ArrayLit:
+		return t.infer(x)
+	}
+
+	t.diags.Add(x.Span(), "%s is not a value", ast.ExprString(x))
+	return Typ[Invalid]
+}
+
+func (t *typer) basicLit(lit *ast.BasicLit) Type {
+	switch lit.Kind {
+	case token.INTEGER:
+		v, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil {
+			t.diags.Add(lit.Loc, "integer %s is too large", lit.Value)
+			return Typ[Invalid]
+		}
+		t.info.Values[lit] = v
+		return Typ[UntypedInt]
+	case token.FLOAT:
+		v, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			t.diags.Add(lit.Loc, "number %s is too large", lit.Value)
+			return Typ[Invalid]
+		}
+		t.info.Floats[lit] = v
+		return Typ[UntypedFloat]
+	case token.TRUE, token.FALSE:
+		t.info.Values[lit] = boolValue(lit.Kind == token.TRUE)
+		return Typ[Bool]
+	case token.STRING:
+		t.diags.Add(lit.Loc, "strings are not supported")
+	case token.NIL:
+		t.diags.Add(lit.Loc, "nil is not supported")
+	}
+
+	return Typ[Invalid]
+}
+
+func (t *typer) ident(id *ast.Ident) Type {
+	obj := t.info.Uses[id]
+	if obj == nil {
+		return Typ[Invalid]
+	}
+
+	switch obj.Kind {
+	case VarObj, ConstObj, ParamObj:
+		if obj.Type == nil && t.inits[obj] {
+			t.diags.Add(id.Loc, "initialization of %s refers to itself", id.Name)
+			return Typ[Invalid]
+		}
+
+		// globals can be declared after where they're used
+		switch decl := obj.Decl.(type) {
+		case *ast.VarDecl:
+			t.varDecl(decl)
+		case *ast.ConstDecl:
+			t.constDecl(decl)
+		}
+		if obj.Type == nil || isKind(obj.Type, Invalid) {
+			return Typ[Invalid]
+		}
+
+		if obj.Kind == ConstObj {
+			t.constIdent(id, obj)
+		}
+		return obj.Type
+	case RegObj:
+		// registers that failed checkRegs have no type
+		if reg := t.info.Registers[obj.Name]; reg != nil && obj.Type != nil {
+			t.info.Accesses[id] = &Access{Reg: reg}
+			return obj.Type
+		}
+	case FuncObj, BuiltinObj:
+		t.diags.Add(id.Loc, "%s %s used as value, missing call", obj.Kind, id.Name)
+	default:
+		t.diags.Add(id.Loc, "%s %s used as value", obj.Kind, id.Name)
+	}
+
+	return Typ[Invalid]
+}
+
+func (t *typer) unary(x *ast.UnaryExpr) Type {
+	typ := t.value(x.X)
+	if isKind(typ, Invalid) {
+		return typ
+	}
+
+	switch x.Op {
+	case token.BANG:
+		if !isKind(typ, Bool) {
+			t.diags.Add(x.Loc, "operator ! needs a bool operand, found %s (%s)", ast.ExprString(x.X), typ)
+			return Typ[Invalid]
+		}
+		t.foldUnary(x, typ)
+		return typ
+	case token.TILDE:
+		if !IsInteger(typ) {
+			t.diags.Add(x.Loc, "operator ~ not defined on %s (%s)", ast.ExprString(x.X), typ)
+			return Typ[Invalid]
+		}
+		t.foldUnary(x, typ)
+		return typ
+	case token.MINUS:
+		b, _ := typ.(*Basic)
+		switch {
+		case !IsNumeric(typ):
+			t.diags.Add(x.Loc, "operator - not defined on %s (%s)", ast.ExprString(x.X), typ)
+			return Typ[Invalid]
+		case b != nil && !b.Signed:
+			t.diags.Add(x.Loc, "cannot negate %s (%s), it's unsigned", ast.ExprString(x.X), typ)
+			return Typ[Invalid]
+		}
+		t.foldUnary(x, typ)
+		return typ
+	}
+
+	panic(fmt.Sprintf("typer: unexpected unary operator %s", ast.OpNames[x.Op]))
+}
+
+func (t *typer) binary(x *ast.BinaryExpr) Type {
+	if x.Op == token.AND || x.Op == token.OR {
+		for _, operand := range []ast.Expr{x.X, x.Y} {
+			if typ := t.value(operand); !isKind(typ, Bool) && !isKind(typ, Invalid) {
+				t.diags.Add(operand.Span(), "operator %s needs bool operands, found %s (%s)",
+					ast.OpNames[x.Op], ast.ExprString(operand), typ)
+			}
+		}
+		t.foldLogical(x)
+		return Typ[Bool]
+	}
+
+	xt, yt := t.value(x.X), t.value(x.Y)
+	if isKind(xt, Invalid) || isKind(yt, Invalid) {
+		return Typ[Invalid]
+	}
+
+	comparison := isComparison(x.Op)
+	if x.Op == token.EQUAL_EQUAL || x.Op == token.BANG_EQUAL {
+		_, enum := xt.(*Enum)
+		if (enum || isKind(xt, Bool)) && xt == yt {
+			t.fold(x, xt)
+			return Typ[Bool]
+		}
+	}
+
+	// bit operators and % are only defined on integers
+	valid := IsNumeric
+	if isIntegerOp(x.Op) {
+		valid = IsInteger
+	}
+	for _, operand := range []struct {
+		x   ast.Expr
+		typ Type
+	}{{x.X, xt}, {x.Y, yt}} {
+		if !valid(operand.typ) {
+			t.diags.Add(operand.x.Span(), "operator %s not defined on %s (%s)",
+				ast.OpNames[x.Op], ast.ExprString(operand.x), operand.typ)
+			return Typ[Invalid]
+		}
+	}
+
+	if x.Op == token.LESS_LESS || x.Op == token.GREATER_GREATER {
+		return t.shift(x, xt, yt)
+	}
+	if x.Op == token.AMPERSAND || x.Op == token.PIPE || x.Op == token.CARET {
+		t.maskUntyped(x.X, yt)
+		t.maskUntyped(x.Y, xt)
+	}
+
+	typ := t.unify(x, xt, yt)
+	if isKind(typ, Invalid) {
+		return typ
+	}
+
+	if (x.Op == token.SLASH || x.Op == token.PERCENT) && t.isZero(x.Y) {
+		t.diags.Add(x.Y.Span(), "division by zero")
+		return Typ[Invalid]
+	}
+
+	t.fold(x, typ)
+	if comparison {
+		return Typ[Bool]
+	}
+	if !t.checkFixedMulDiv(x, typ) {
+		return Typ[Invalid]
+	}
+	return typ
+}
+
+// checkFixedMulDiv reports products and quotients of fixed-point values
+// whose size code generation can't rescale, see avr.FixedMulDiv. Scaling by
+// an integer and constants are fine.
+func (t *typer) checkFixedMulDiv(x *ast.BinaryExpr, typ Type) bool {
+	f, ok := typ.(*Fixed)
+	if !ok || x.Op != token.STAR && x.Op != token.SLASH || t.isConst(x) || avr.FixedMulDiv(f.Size()) {
+		return true
+	}
+	if _, ok := t.info.Types[x.X].(*Fixed); !ok {
+		return true
+	}
+	if _, ok := t.info.Types[x.Y].(*Fixed); !ok {
+		return true
+	}
+
+	t.diags.Add(x.Loc, "%s of %s values is not supported, only of fixed-point types of up to 2 bytes",
+		map[token.TokenID]string{token.STAR: "multiplication", token.SLASH: "division"}[x.Op], f)
+	return false
+}
+
+func isIntegerOp(op token.TokenID) bool {
+	switch op {
+	case token.PERCENT, token.AMPERSAND, token.PIPE, token.CARET, token.LESS_LESS,
+		token.GREATER_GREATER:
+		return true
+	}
+
+	return false
+}
+
+// shift checks a shift, which is of the type of its left operand. The count
+// is a u8, and can't be a negative constant. An integer constant shifted by
+// a count that isn't constant is a DefaultInt.
+func (t *typer) shift(x *ast.BinaryExpr, xt, yt Type) Type {
+	if n, ok := t.info.Values[x.Y]; ok && n < 0 {
+		t.diags.Add(x.Y.Span(), "negative shift count %d", n)
+		return Typ[Invalid]
+	}
+	if isUntyped(yt) && !t.convertUntyped(x.Y, Typ[U8]) {
+		return Typ[Invalid]
+	}
+
+	if isUntyped(xt) && !t.isConst(x.Y) {
+		t.convertUntyped(x.X, DefaultInt)
+		xt = DefaultInt
+	}
+	t.fold(x, xt)
+	return xt
+}
+
+// maskUntyped lets a negative integer constant x, like ~bit(5), be used with
+// a bit operator on an unsigned type typ of the same width, by keeping its
+// two's complement bits.
+func (t *typer) maskUntyped(x ast.Expr, typ Type) {
+	b, ok := typ.(*Basic)
+	if !ok || !isKind(t.info.Types[x], UntypedInt) || b.Kind == UntypedInt || b.Signed {
+		return
+	}
+
+	_, max := Range(b)
+	if v := t.info.Values[x]; v < 0 && v >= -(max+1)/2 {
+		t.info.Values[x] = v & max
+	}
+}
+
+func isComparison(op token.TokenID) bool {
+	switch op {
+	case token.EQUAL_EQUAL, token.BANG_EQUAL, token.LESS, token.LESS_EQUAL,
+		token.GREATER, token.GREATER_EQUAL:
+		return true
+	}
+
+	return false
+}
+
+// unify returns the type both numeric operands of x are used as: the type
+// of the typed one if the other is a constant, or the wider one. A
+// fixed-point value can also be multiplied or divided by an integer, which
+// scales it without changing its type.
+func (t *typer) unify(x *ast.BinaryExpr, xt, yt Type) Type {
+	switch {
+	case isUntyped(xt) && isUntyped(yt):
+		if isKind(xt, UntypedFloat) {
+			return xt
+		}
+		return yt
+	case isUntyped(xt):
+		if !t.convertUntyped(x.X, yt) {
+			return Typ[Invalid]
+		}
+		return yt
+	case isUntyped(yt):
+		if !t.convertUntyped(x.Y, xt) {
+			return Typ[Invalid]
+		}
+		return xt
+	case widens(xt, yt):
+		return yt
+	case widens(yt, xt):
+		return xt
+	}
+
+	if _, ok := xt.(*Fixed); ok && IsInteger(yt) && (x.Op == token.STAR || x.Op == token.SLASH) {
+		return xt
+	}
+	if _, ok := yt.(*Fixed); ok && IsInteger(xt) && x.Op == token.STAR {
+		return yt
+	}
+
+	t.diags.Add(x.Loc, "mismatched types %s and %s in %s, convert one of them",
+		xt, yt, ast.ExprString(x))
+	return Typ[Invalid]
+}
+
+// isZero returns if x is a constant zero.
+func (t *typer) isZero(x ast.Expr) bool {
+	if v, ok := t.info.Values[x]; ok {
+		return v == 0
+	}
+	v, ok := t.info.Floats[x]
+	return ok && v == 0
+}
+
+func (t *typer) call(call *ast.CallExpr) Type {
+	var obj *Object
+	if id, ok := call.Fun.(*ast.Ident); ok {
+		obj = t.info.Uses[id]
+	}
+
+	switch {
+	case obj != nil && obj.Kind == TypeObj:
+		return t.conversion(call, obj.Type)
+	case obj != nil && obj.Kind == BuiltinObj && obj.Name == "bit":
+		return t.bit(call)
+	case obj != nil && obj.Kind == BuiltinObj:
+		return t.len(call)
+	case obj != nil && obj.Kind == FuncObj:
+		sig := obj.Type.(*Func)
+		if len(call.Args) != len(sig.Params) {
+			t.diags.Add(call.Loc, "%s takes %d arguments, found %d",
+				obj.Name, len(sig.Params), len(call.Args))
+		}
+		for i, arg := range call.Args {
+			if i < len(sig.Params) {
+				t.assign(arg, sig.Params[i], "argument to "+obj.Name)
+			} else {
+				t.value(arg)
+			}
+		}
+		return sig.Result
+	}
+
+	for _, arg := range call.Args {
+		t.value(arg)
+	}
+
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok && t.isModule(sel.X) {
+		// functions of imported modules are checked by the module loader
+		return Typ[Invalid]
+	}
+	if typ := t.value(call.Fun); !isKind(typ, Invalid) {
+		t.diags.Add(call.Fun.Span(), "cannot call %s (%s)", ast.ExprString(call.Fun), typ)
+	}
+	return Typ[Invalid]
+}
+
+// conversion checks call converting its argument to type to. Numeric types
+// convert to each other, and integers to and from enums; constants must fit
+// in the type, and are converted at compile time.
+func (t *typer) conversion(call *ast.CallExpr, to Type) Type {
+	t.checkSoftFloat(call.Fun, to)
+	if len(call.Args) != 1 {
+		t.diags.Add(call.Loc, "conversion to %s takes one argument, found %d", to, len(call.Args))
+		for _, arg := range call.Args {
+			t.value(arg)
+		}
+		return to
+	}
+
+	arg := call.Args[0]
+	from := t.value(arg)
+	if isKind(from, Invalid) || Identical(from, to) {
+		return to
+	}
+
+	target := to
+	_, fromEnum := from.(*Enum)
+	_, toEnum := to.(*Enum)
+	if toEnum {
+		target = Typ[U8]
+	}
+
+	ok := IsNumeric(from) && IsNumeric(to)
+	if fromEnum || toEnum {
+		ok = (fromEnum || IsInteger(from)) && (toEnum || IsInteger(to))
+	}
+	if !ok {
+		t.diags.Add(arg.Span(), "cannot convert %s (%s) to %s", ast.ExprString(arg), from, to)
+		return to
+	}
+
+	if isUntyped(from) && t.convertUntyped(arg, target) {
+		t.copyConstant(call, arg)
+	} else if !isUntyped(from) && t.isConst(arg) {
+		t.convertConst(call, arg, target)
+	}
+	return to
+}
+
+func (t *typer) isModule(x ast.Expr) bool {
+	id, ok := x.(*ast.Ident)
+	return ok && t.info.Uses[id] != nil && t.info.Uses[id].Kind == ModuleObj
+}
+
+func (t *typer) selector(sel *ast.SelectorExpr) Type {
+	if t.isModule(sel.X) {
+		// names of imported modules are checked by the module loader
+		return Typ[Invalid]
+	}
+
+	if id, ok := sel.X.(*ast.Ident); ok {
+		if obj := t.info.Uses[id]; obj != nil && obj.Kind == RegObj {
+			return t.regBit(sel, obj)
+		}
+		if obj := t.info.Uses[id]; obj != nil && obj.Kind == TypeObj {
+			enum, ok := obj.Type.(*Enum)
+			if !ok {
+				t.diags.Add(sel.Loc, "%s has no members", obj.Name)
+				return Typ[Invalid]
+			}
+			m := enum.Member(sel.Sel.Name)
+			if m == nil {
+				t.diags.Add(sel.Sel.Loc, "enum %s has no member %s", enum.Name, sel.Sel.Name)
+				return Typ[Invalid]
+			}
+			t.info.Types[sel.X] = enum
+			t.info.Values[sel] = m.Value
+			return enum
+		}
+	}
+
+	typ := t.value(sel.X)
+	if isKind(typ, Invalid) {
+		return typ
+	}
+
+	s, ok := typ.(*Struct)
+	if !ok {
+		t.diags.Add(sel.Loc, "%s (%s) has no fields", ast.ExprString(sel.X), typ)
+		return Typ[Invalid]
+	}
+	f := s.Field(sel.Sel.Name)
+	if f == nil {
+		t.diags.Add(sel.Sel.Loc, "%s (%s) has no field %s", ast.ExprString(sel.X), typ, sel.Sel.Name)
+		return Typ[Invalid]
+	}
+	return f.Type
+}
+
+func (t *typer) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		t.stmt(stmt)
+	}
+}
+
+func (t *typer) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.VarDecl:
+		t.varDecl(stmt)
+	case *ast.ConstDecl:
+		t.constDecl(stmt)
+	case *ast.AssignStmt:
+		if id, ok := stmt.Target.(*ast.Ident); ok && t.info.Uses[id] != nil && t.info.Uses[id].Kind == ConstObj {
+			t.diags.Add(id.Loc, "cannot assign to %s, it's a constant", id.Name)
+		}
+		t.assign(stmt.Value, t.value(stmt.Target), "assignment")
+	case *ast.ExprStmt:
+		if typ := t.expr(stmt.X); typ != nil {
+			t.info.Types[stmt.X] = typ
+			t.defaultType(stmt.X, typ)
+		}
+	case *ast.BlockStmt:
+		t.stmts(stmt.Stmts)
+	case *ast.IfStmt:
+		t.cond(stmt.Cond)
+		t.stmt(stmt.Then)
+		if stmt.Else != nil {
+			t.stmt(stmt.Else)
+		}
+	case *ast.ForStmt:
+		if stmt.Init != nil {
+			t.stmt(stmt.Init)
+		}
+		if stmt.Cond != nil {
+			t.cond(stmt.Cond)
+		}
+		if stmt.Post != nil {
+			t.stmt(stmt.Post)
+		}
+		t.stmt(stmt.Body)
+	case *ast.WhileStmt:
+		t.cond(stmt.Cond)
+		t.stmt(stmt.Body)
+	case *ast.LoopStmt:
+		t.stmt(stmt.Body)
+	case *ast.AtomicStmt:
+		t.stmt(stmt.Body)
+	case *ast.LabeledStmt:
+		t.stmt(stmt.Stmt)
+	case *ast.SwitchStmt:
+		t.switchStmt(stmt)
+	case *ast.ReturnStmt:
+		t.returnStmt(stmt)
+	case *ast.BranchStmt, *ast.BadStmt:
+	default:
+		panic(fmt.Sprintf("typer: unexpected statement %T", stmt))
+	}
+}
+
+func (t *typer) cond(x ast.Expr) {
+	if typ := t.value(x); !isKind(typ, Bool) && !isKind(typ, Invalid) {
+		t.diags.Add(x.Span(), "non-bool %s (%s) used as condition", ast.ExprString(x), typ)
+	}
+}
+
+// switchStmt checks tag of a switch is of the type of its cases; the cases
+// themselves are checked by checkSwitches.
+func (t *typer) switchStmt(stmt *ast.SwitchStmt) {
+	tag := t.defaultType(stmt.Tag, t.value(stmt.Tag))
+	sw := t.info.Switches[stmt]
+	_, enumTag := tag.(*Enum)
+
+	switch {
+	case isKind(tag, Invalid):
+	case sw.Enum != nil:
+		if tag != sw.Enum {
+			t.diags.Add(stmt.Tag.Span(), "switch on %s (%s) with cases of %s",
+				ast.ExprString(stmt.Tag), tag, sw.Enum)
+		}
+	case enumTag:
+		if hasCases(stmt) {
+			t.diags.Add(stmt.Tag.Span(), "switch on %s (%s) with integer cases",
+				ast.ExprString(stmt.Tag), tag)
+		}
+	case !IsInteger(tag):
+		t.diags.Add(stmt.Tag.Span(), "cannot switch on %s (%s)", ast.ExprString(stmt.Tag), tag)
+	}
+
+	for _, clause := range stmt.Cases {
+		for _, v := range clause.Values {
+			if _, ok := constInt(v); ok && sw.Enum == nil {
+				t.value(v)
+				if b, ok := tag.(*Basic); ok && IsInteger(b) {
+					t.convertUntyped(v, b)
+				}
+			} else if sel, ok := v.(*ast.SelectorExpr); ok && sw.Enum != nil {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Name == sw.Enum.Name && sw.Enum.Member(sel.Sel.Name) != nil {
+					t.info.Types[v] = sw.Enum
+				}
+			}
+		}
+		t.stmt(clause.Body)
+	}
+}
+
+func hasCases(stmt *ast.SwitchStmt) bool {
+	for _, clause := range stmt.Cases {
+		if len(clause.Values) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *typer) returnStmt(stmt *ast.ReturnStmt) {
+	switch {
+	case stmt.Value == nil && t.result != nil:
+		t.diags.Add(stmt.Loc, "missing return value")
+	case stmt.Value != nil && t.result == nil:
+		t.value(stmt.Value)
+		t.diags.Add(stmt.Value.Span(), "unexpected return value")
+	case stmt.Value != nil:
+		t.assign(stmt.Value, t.result, "return statement")
+	}
+}
@@ -0,0 +1,237 @@
+package sema
+
+import (
+	"testing"
+
+	"github.com/sent-hil/bitlang/ast"
+	"github.com/sent-hil/bitlang/parser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTypes(t *testing.T) {
+	Convey("Types", t, func() {
+		Convey("It records types of expressions", func() {
+			file, _ := parser.ParseString(`
+struct Point { x: u8, y: i16 }
+enum State { Idle, Running }
+var counter = 300;
+fn f(p: Point, buf: [4]u8) -> i16 {
+  var s = State.Idle;
+  var sum = p.x + buf[1];
+  return p.y - 1;
+}`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			types := map[string]string{}
+			for x, typ := range info.Types {
+				types[ast.ExprString(x)] = typ.String()
+			}
+			So(types["300"], ShouldEqual, "i16")
+			So(types["State.Idle"], ShouldEqual, "State")
+			So(types["p.x + buf[1]"], ShouldEqual, "u8")
+			So(types["buf"], ShouldEqual, "[4]u8")
+			So(types["p.y - 1"], ShouldEqual, "i16")
+			So(types["1"], ShouldEqual, "i16")
+
+			fn := file.Decls[3].(*ast.FuncDecl)
+			So(info.Defs[fn.Name].Type.String(), ShouldEqual, "fn(Point, [4]u8) -> i16")
+		})
+
+		Convey("It folds integer constants", func() {
+			file, _ := parser.ParseString("var x: u16 = (2 + 3) * 100 - -4;")
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+			So(info.Values[file.Decls[0].(*ast.VarDecl).Value], ShouldEqual, 504)
+		})
+
+		Convey("It widens integers that fit", func() {
+			So(check(`
+fn f(a: u8, b: i8, c: u16) -> i32 {
+  var x: u16 = a;
+  var y: i16 = a + i16(b);
+  c = c + a;
+  return c;
+}`), ShouldBeEmpty)
+		})
+
+		Convey("It reports narrowing without a conversion", func() {
+			for src, message := range map[string]string{
+				"fn f(a: u16) { var x: u8 = a; }":         "1:28: cannot use a (u16) as u8 value in variable declaration without a conversion",
+				"fn f(a: i8) { var x: u8 = a; }":          "1:27: cannot use a (i8) as u8 value in variable declaration without a conversion",
+				"fn f(a: u8) { var x: i8 = a; }":          "1:27: cannot use a (u8) as i8 value in variable declaration without a conversion",
+				"fn f(a: i16) -> u8 { return a; }":        "1:29: cannot use a (i16) as u8 value in return statement without a conversion",
+				"fn f(a: u8) { } fn g(b: u16) { f(b); }":  "1:34: cannot use b (u16) as u8 value in argument to f without a conversion",
+				"fn f(a: u8, b: i8) { var x = a + b; }":   "1:30: mismatched types u8 and i8 in a + b, convert one of them",
+				"fn f(a: u16) { var x: u8 = u8(a) + a; }": "1:28: cannot use u8(a) + a (u16) as u8 value in variable declaration without a conversion",
+				"fn f(a: u8) { var x: bool = a; }":        "1:29: cannot use a (u8) as bool value in variable declaration",
+				"fn f(a: [4]u8) { var b: [8]u8 = a; }":    "1:33: cannot use a ([4]u8) as [8]u8 value in variable declaration",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It reports constants that don't fit", func() {
+			for src, message := range map[string]string{
+				"var x: u8 = 300;":                        "1:13: constant 300 overflows u8",
+				"var x: u8 = -1;":                         "1:13: constant -1 overflows u8",
+				"var x: i8 = 100 + 28;":                   "1:13: constant 128 overflows i8",
+				"fn f(a: u8) -> bool { return a < 256; }": "1:34: constant 256 overflows u8",
+				"var x = 40000;":                          "1:9: constant 40000 overflows i16",
+				"var x = u8(256);":                        "1:12: constant 256 overflows u8",
+				"var x = 1 / (2 - 2);":                    "1:13: division by zero",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It converts between integers and enums", func() {
+			So(check(`
+enum State { Idle, Running }
+fn f(a: u16, s: State) {
+  var x: u8 = u8(a);
+  var y: i8 = i8(s);
+  var t = State(x);
+}`), ShouldBeEmpty)
+
+			for src, message := range map[string]string{
+				"fn f(a: bool) { var x = u8(a); }":   "1:28: cannot convert a (bool) to u8",
+				"fn f(a: u8) { var x = bool(a); }":   "1:28: cannot convert a (u8) to bool",
+				"fn f(a: u8) { var x = u16(a, a); }": "1:23: conversion to u16 takes one argument, found 2",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It checks operators", func() {
+			for src, message := range map[string]string{
+				"fn f(a: u8) { var x = -a; }":                "1:23: cannot negate a (u8), it's unsigned",
+				"fn f(a: u8) { var x = !a; }":                "1:23: operator ! needs a bool operand, found a (u8)",
+				"fn f(a: u8, b: bool) { var x = a and b; }":  "1:32: operator and needs bool operands, found a (u8)",
+				"fn f(a: bool) { var x = a + 1; }":           "1:25: operator + not defined on a (bool)",
+				"fn f(a: bool) { var x = a < true; }":        "1:25: operator < not defined on a (bool)",
+				"enum E { A } fn f(e: E) { var x = e + 1; }": "1:35: operator + not defined on e (E)",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+
+			So(check(`
+enum E { A, B }
+fn f(a: bool, e: E) -> bool { return a == true and e != E.B; }
+`), ShouldBeEmpty)
+		})
+
+		Convey("It checks conditions are bool", func() {
+			for src, message := range map[string]string{
+				"fn f(a: u8) { if a { } }":                   "1:18: non-bool a (u8) used as condition",
+				"fn f(a: u8) { while a - 1 { } }":            "1:21: non-bool a - 1 (u8) used as condition",
+				"fn f() { for var i = 0; i; i = i + 1 { } }": "1:25: non-bool i (i16) used as condition",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It checks calls and returns", func() {
+			for src, message := range map[string]string{
+				"fn f(a: u8) { } fn g() { f(); }":    "1:26: f takes 1 arguments, found 0",
+				"fn f() { } fn g() { var x = f(); }": "1:29: f() (no value) used as value",
+				"fn f() -> u8 { return; }":           "1:16: missing return value",
+				"fn f() { return 1; }":               "1:17: unexpected return value",
+				"fn f() { } fn g() { var x = f; }":   "1:29: function f used as value, missing call",
+				"fn f(a: u8) { a(); }":               "1:15: cannot call a (u8)",
+				"fn f() { var x = u8; }":             "1:18: type u8 used as value",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It checks fields, members and indexes", func() {
+			for src, message := range map[string]string{
+				"struct P { x: u8 } fn f(p: P) { p.y = 1; }": "1:35: p (P) has no field y",
+				"fn f(a: u8) { a.x = 1; }":                   "1:15: a (u8) has no fields",
+				"enum E { A } fn f() { var e = E.B; }":       "1:33: enum E has no member B",
+				"fn f(a: u8) { a[0] = 1; }":                  "1:15: cannot index a (u8)",
+				"fn f(buf: [4]u8) { buf[true] = 1; }":        "1:24: index must be an integer, found true (bool)",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It checks tags of switches", func() {
+			for src, message := range map[string]string{
+				"enum E { A } fn f(n: u8) { switch n { case E.A { } } }": "1:35: switch on n (u8) with cases of E",
+				"enum E { A } fn f(e: E) { switch e { case 0 { } } }":    "1:34: switch on e (E) with integer cases",
+				"fn f(b: bool) { switch b { case 1 { } } }":              "1:24: cannot switch on b (bool)",
+				"fn f(n: u8) { switch n { case 256 { } } }":              "1:31: constant 256 overflows u8",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It infers types of globals declared later", func() {
+			So(check("fn f() -> u8 { return led; } var led: u8 = 13;"), ShouldBeEmpty)
+			So(check("var a = b; var b = a;").Error(), ShouldEqual,
+				"1:20: initialization of a refers to itself")
+		})
+
+		Convey("It converts decimal constants to fixed-point at compile time", func() {
+			file, _ := parser.ParseString(`
+var a: q8.8 = 1.5;
+var b: q4.4 = 0.1 + 0.2;
+var c = q1.15(-0.5);
+var d: q8.8 = 3;
+`)
+			info, diags := Check(file, nil)
+			So(diags, ShouldBeEmpty)
+
+			var values []int64
+			for _, decl := range file.Decls {
+				values = append(values, info.Values[decl.(*ast.VarDecl).Value])
+			}
+			So(values, ShouldResemble, []int64{384, 5, -16384, 768})
+			So(info.Types[file.Decls[2].(*ast.VarDecl).Value].String(), ShouldEqual, "q1.15")
+		})
+
+		Convey("It checks fixed-point arithmetic", func() {
+			So(check(`
+fn f(a: q8.8, b: q8.8, n: u8) -> q16.16 {
+  var c: q8.8 = a * b / n - 0.25;
+  var d = i16(c) + 1;
+  return q8.8(d) * a;
+}
+fn g(a: q16.16, n: i32) -> q16.16 { return a * n / n + 1.5 * 2.0; }`), ShouldBeEmpty)
+
+			for src, message := range map[string]string{
+				"var x: q8.8 = 128.0;":                         "1:15: constant 128 overflows q8.8",
+				"var x: q1.15 = 1;":                            "1:16: constant 1 overflows q1.15",
+				"var x: u8 = 2.5;":                             "1:13: constant 2.5 truncated to integer",
+				"var x = 1.5;":                                 "1:9: cannot infer type of 1.5, declare it with a fixed-point type like q8.8",
+				"fn f(a: q8.8, n: u8) { var x = a + n; }":      "1:32: mismatched types q8.8 and u8 in a + n, convert one of them",
+				"fn f(a: q8.8, n: u8) { var x = n / a; }":      "1:32: mismatched types u8 and q8.8 in n / a, convert one of them",
+				"fn f(a: q16.16) -> q8.8 { return a; }":        "1:34: cannot use a (q16.16) as q8.8 value in return statement without a conversion",
+				"fn f(a: q8.8) { var x: q8.8 = a / 0.0; }":     "1:35: division by zero",
+				"enum E { A } fn f(a: q8.8) { var e = E(a); }": "1:40: cannot convert a (q8.8) to E",
+				"fn f(a: q16.16) { var x = a * a; }":           "1:27: multiplication of q16.16 values is not supported, only of fixed-point types of up to 2 bytes",
+				"fn f(a: q1.31) { var x = a / 0.5; }":          "1:26: division of q1.31 values is not supported, only of fixed-point types of up to 2 bytes",
+			} {
+				So(check(src).Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("It only allows f32 with soft float", func() {
+			So(check("var x: f32 = 1.5;").Error(), ShouldEqual,
+				"1:8: f32 needs soft float, which isn't enabled; use a fixed-point type like q8.8")
+
+			file, _ := parser.ParseString("var x = 1.5 * 2;")
+			info, diags := Check(file, &Config{SoftFloat: true})
+			So(diags, ShouldBeEmpty)
+			value := file.Decls[0].(*ast.VarDecl).Value
+			So(info.Types[value], ShouldEqual, Typ[F32])
+			So(info.Floats[value], ShouldEqual, 3)
+		})
+
+		Convey("It reports unsupported literals", func() {
+			So(check(`var s = "hi";`).Error(), ShouldEqual, "1:9: strings are not supported")
+		})
+	})
+}
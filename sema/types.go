@@ -0,0 +1,228 @@
+package sema
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Type is the type of a value.
+type Type interface {
+	String() string
+}
+
+// BasicKind is which builtin type a Basic is.
+type BasicKind int
+
+const (
+	// Invalid is the type of expressions with errors, so they're only
+	// reported once.
+	Invalid BasicKind = iota
+
+	Bool
+	U8
+	I8
+	U16
+	I16
+	U32
+	I32
+
+	// UntypedInt is the type of integer constants before they're used as a
+	// value of a type, eg 300 in `var a: u16 = 300`.
+	UntypedInt
+
+	// UntypedFloat is the type of decimal constants like 1.5 before they're
+	// used as a value of a fixed-point type, or of f32.
+	UntypedFloat
+
+	// F32 is a 32-bit float. ATmega328 has no FPU, so it's emulated in
+	// software at a cost of kilobytes of flash; it's only available with
+	// Config.SoftFloat.
+	F32
+)
+
+// Basic is a builtin type.
+type Basic struct {
+	Kind BasicKind
+	Name string
+
+	// Size is in bytes; it's 0 for untyped and invalid types.
+	Size   int
+	Signed bool
+}
+
+func (b *Basic) String() string { return b.Name }
+
+// Typ are builtin types by kind.
+var Typ = []*Basic{
+	Invalid:      {Invalid, "invalid type", 0, false},
+	Bool:         {Bool, "bool", 1, false},
+	U8:           {U8, "u8", 1, false},
+	I8:           {I8, "i8", 1, true},
+	U16:          {U16, "u16", 2, false},
+	I16:          {I16, "i16", 2, true},
+	U32:          {U32, "u32", 4, false},
+	I32:          {I32, "i32", 4, true},
+	UntypedInt:   {UntypedInt, "untyped int", 0, true},
+	UntypedFloat: {UntypedFloat, "untyped float", 0, true},
+	F32:          {F32, "f32", 4, true},
+}
+
+// DefaultInt is the type integer constants get when nothing else decides
+// it, eg `var i = 0`. Like int of avr-gcc it's 16 bits.
+var DefaultInt = Typ[I16]
+
+// Array is a fixed size array type.
+type Array struct {
+	Len  int64
+	Elem Type
+}
+
+func (a *Array) String() string { return fmt.Sprintf("[%d]%s", a.Len, a.Elem) }
+
+// Struct is a struct type.
+type Struct struct {
+	Name   string
+	Fields []*StructField
+}
+
+// StructField is a field of a struct type.
+type StructField struct {
+	Name string
+	Type Type
+}
+
+func (s *Struct) String() string { return s.Name }
+
+// Field returns field with given name, or nil if there's none.
+func (s *Struct) Field(name string) *StructField {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// Fixed is a signed Q-format fixed-point type, with Int integer bits
+// including the sign and Frac fraction bits. A value is stored as an integer
+// of Int+Frac bits counting in 1/2^Frac, eg 1.5 in q8.8 is 384.
+type Fixed struct {
+	Name      string
+	Int, Frac int
+}
+
+func (f *Fixed) String() string { return f.Name }
+
+// Size returns size of a value in bytes.
+func (f *Fixed) Size() int { return (f.Int + f.Frac) / 8 }
+
+// Raw returns v as stored in the type, rounded to the nearest value it can
+// hold, and if it fits.
+func (f *Fixed) Raw(v float64) (int64, bool) {
+	raw := math.Round(math.Ldexp(v, f.Frac))
+	bits := uint(f.Int + f.Frac)
+	min, max := -math.Ldexp(1, int(bits)-1), math.Ldexp(1, int(bits)-1)-1
+	return int64(raw), raw >= min && raw <= max
+}
+
+// Widens returns if every value of f is a value of to.
+func (f *Fixed) Widens(to *Fixed) bool {
+	return f.Int <= to.Int && f.Frac <= to.Frac
+}
+
+// FixedTypes are the builtin fixed-point types.
+var FixedTypes = []*Fixed{
+	{"q1.7", 1, 7},
+	{"q4.4", 4, 4},
+	{"q1.15", 1, 15},
+	{"q8.8", 8, 8},
+	{"q1.31", 1, 31},
+	{"q16.16", 16, 16},
+}
+
+// Func is the type of a function. Result is nil if it returns nothing.
+type Func struct {
+	Params []Type
+	Result Type
+}
+
+func (f *Func) String() string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = p.String()
+	}
+
+	s := "fn(" + strings.Join(params, ", ") + ")"
+	if f.Result != nil {
+		s += " -> " + f.Result.String()
+	}
+	return s
+}
+
+// IsInteger returns if given type is an integer type, including untyped
+// integer constants.
+func IsInteger(t Type) bool {
+	b, ok := t.(*Basic)
+	return ok && b.Kind >= U8 && b.Kind <= UntypedInt
+}
+
+// IsNumeric returns if arithmetic is defined on given type: integers,
+// fixed-point types and floats.
+func IsNumeric(t Type) bool {
+	if _, ok := t.(*Fixed); ok {
+		return true
+	}
+	return IsInteger(t) || isKind(t, UntypedFloat) || isKind(t, F32)
+}
+
+func isUntyped(t Type) bool {
+	return isKind(t, UntypedInt) || isKind(t, UntypedFloat)
+}
+
+func isKind(t Type, kind BasicKind) bool {
+	b, ok := t.(*Basic)
+	return ok && b.Kind == kind
+}
+
+// Range returns smallest and largest value of given integer type.
+func Range(b *Basic) (min, max int64) {
+	bits := uint(b.Size * 8)
+	if b.Signed {
+		return -1 << (bits - 1), 1<<(bits-1) - 1
+	}
+	return 0, 1<<bits - 1
+}
+
+// Representable returns if given constant fits in given integer type.
+func Representable(v int64, b *Basic) bool {
+	if b.Kind == UntypedInt {
+		return true
+	}
+
+	min, max := Range(b)
+	return v >= min && v <= max
+}
+
+// Widens returns if every value of integer type from is a value of integer
+// type to, so a from can be used as a to without a conversion.
+func Widens(from, to *Basic) bool {
+	if from.Signed == to.Signed {
+		return to.Size >= from.Size
+	}
+
+	return !from.Signed && to.Signed && to.Size > from.Size
+}
+
+// Identical returns if given types are the same type.
+func Identical(a, b Type) bool {
+	if a, ok := a.(*Array); ok {
+		b, ok := b.(*Array)
+		return ok && a.Len == b.Len && Identical(a.Elem, b.Elem)
+	}
+
+	return a == b
+}
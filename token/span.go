@@ -0,0 +1,43 @@
+package token
+
+import "fmt"
+
+// Pos is a location in source. Line and Column start at 1, so the zero Pos
+// is used to mean no position.
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid returns if position was set.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the range of source from Start till, but not including, End.
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// IsValid returns if span was set.
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
+// To returns span from start of s till end of other.
+func (s Span) To(other Span) Span {
+	return Span{Start: s.Start, End: other.End}
+}
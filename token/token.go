@@ -9,9 +9,13 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
+	COLON
 	DOT
 	MINUS
+	ARROW
 	PLUS
 	SEMICOLON
 	SLASH
@@ -24,16 +28,39 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	HASH
+	AMPERSAND
+	PIPE
+	CARET
+	TILDE
+	PERCENT
+	LESS_LESS
+	GREATER_GREATER
+	AT
 	IDENTIFIER
 	AND
+	ATOMIC
+	BREAK
+	CASE
+	CONST
+	CONTINUE
+	DEFAULT
 	IF
+	IMPORT
 	ELSE
+	ENUM
 	TRUE
 	FALSE
 	FOR
+	FN
+	LOOP
 	OR
+	REG
 	RETURN
+	STRUCT
+	SWITCH
 	VAR
+	WHILE
 	COMMENT
 	WHITESPACE
 	STRING
@@ -44,55 +71,96 @@ const (
 )
 
 var TokenIDString = map[TokenID]string{
-	LEFT_PAREN:    "LEFT_PAREN",
-	RIGHT_PAREN:   "RIGHT_PAREN",
-	LEFT_BRACE:    "LEFT_BRACE",
-	RIGHT_BRACE:   "RIGHT_BRACE",
-	COMMA:         "COMMA",
-	DOT:           "DOT",
-	MINUS:         "MINUS",
-	PLUS:          "PLUS",
-	SEMICOLON:     "SEMICOLON",
-	SLASH:         "SLASH",
-	STAR:          "STAR",
-	BANG:          "BANG",
-	BANG_EQUAL:    "BANG_EQUAL",
-	EQUAL:         "EQUAL",
-	EQUAL_EQUAL:   "EQUAL_EQUAL",
-	GREATER:       "GREATER",
-	GREATER_EQUAL: "GREATER_EQUAL",
-	LESS:          "LESS",
-	LESS_EQUAL:    "LESS_EQUAL",
-	IDENTIFIER:    "IDENTIFIER",
-	AND:           "AND",
-	IF:            "IF",
-	ELSE:          "ELSE",
-	TRUE:          "TRUE",
-	FALSE:         "FALSE",
-	FOR:           "FOR",
-	OR:            "OR",
-	RETURN:        "RETURN",
-	VAR:           "VAR",
-	COMMENT:       "COMMENT",
-	WHITESPACE:    "WHITESPACE",
-	STRING:        "STRING",
-	NIL:           "NIL",
-	FLOAT:         "FLOAT",
-	INTEGER:       "INTEGER",
-	EOF:           "EOF",
+	LEFT_PAREN:      "LEFT_PAREN",
+	RIGHT_PAREN:     "RIGHT_PAREN",
+	LEFT_BRACE:      "LEFT_BRACE",
+	RIGHT_BRACE:     "RIGHT_BRACE",
+	LEFT_BRACKET:    "LEFT_BRACKET",
+	RIGHT_BRACKET:   "RIGHT_BRACKET",
+	COMMA:           "COMMA",
+	COLON:           "COLON",
+	DOT:             "DOT",
+	MINUS:           "MINUS",
+	ARROW:           "ARROW",
+	PLUS:            "PLUS",
+	SEMICOLON:       "SEMICOLON",
+	SLASH:           "SLASH",
+	STAR:            "STAR",
+	BANG:            "BANG",
+	BANG_EQUAL:      "BANG_EQUAL",
+	EQUAL:           "EQUAL",
+	EQUAL_EQUAL:     "EQUAL_EQUAL",
+	GREATER:         "GREATER",
+	GREATER_EQUAL:   "GREATER_EQUAL",
+	LESS:            "LESS",
+	LESS_EQUAL:      "LESS_EQUAL",
+	HASH:            "HASH",
+	AMPERSAND:       "AMPERSAND",
+	PIPE:            "PIPE",
+	CARET:           "CARET",
+	TILDE:           "TILDE",
+	PERCENT:         "PERCENT",
+	LESS_LESS:       "LESS_LESS",
+	GREATER_GREATER: "GREATER_GREATER",
+	AT:              "AT",
+	IDENTIFIER:      "IDENTIFIER",
+	AND:             "AND",
+	ATOMIC:          "ATOMIC",
+	BREAK:           "BREAK",
+	CASE:            "CASE",
+	CONST:           "CONST",
+	CONTINUE:        "CONTINUE",
+	DEFAULT:         "DEFAULT",
+	IF:              "IF",
+	IMPORT:          "IMPORT",
+	ELSE:            "ELSE",
+	ENUM:            "ENUM",
+	TRUE:            "TRUE",
+	FALSE:           "FALSE",
+	FOR:             "FOR",
+	FN:              "FN",
+	LOOP:            "LOOP",
+	OR:              "OR",
+	REG:             "REG",
+	RETURN:          "RETURN",
+	STRUCT:          "STRUCT",
+	SWITCH:          "SWITCH",
+	VAR:             "VAR",
+	WHILE:           "WHILE",
+	COMMENT:         "COMMENT",
+	WHITESPACE:      "WHITESPACE",
+	STRING:          "STRING",
+	NIL:             "NIL",
+	FLOAT:           "FLOAT",
+	INTEGER:         "INTEGER",
+	EOF:             "EOF",
 }
 
 var KeywordsList = map[string]TokenID{
-	"and":    AND,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"for":    FOR,
-	"nil":    NIL,
-	"or":     OR,
-	"return": RETURN,
-	"var":    VAR,
+	"and":      AND,
+	"atomic":   ATOMIC,
+	"break":    BREAK,
+	"case":     CASE,
+	"const":    CONST,
+	"continue": CONTINUE,
+	"default":  DEFAULT,
+	"if":       IF,
+	"import":   IMPORT,
+	"else":     ELSE,
+	"enum":     ENUM,
+	"true":     TRUE,
+	"false":    FALSE,
+	"for":      FOR,
+	"fn":       FN,
+	"loop":     LOOP,
+	"nil":      NIL,
+	"or":       OR,
+	"reg":      REG,
+	"return":   RETURN,
+	"struct":   STRUCT,
+	"switch":   SWITCH,
+	"var":      VAR,
+	"while":    WHILE,
 }
 
 func init() {
@@ -108,6 +176,7 @@ func init() {
 type Token struct {
 	ID    TokenID
 	Value string
+	Span  Span
 }
 
 func NewToken(id TokenID, value string) *Token {